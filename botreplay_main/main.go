@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Command botreplay_main replays a bot-inbound log written by
+// Hub.StartBotRecording against a freshly started Hub, reproducing a
+// bot-driven match's inbound traffic (see server.ReplayBotLog). It exits
+// once the log is exhausted.
+package main
+
+import (
+	"flag"
+	"github.com/SoftbearStudios/mk48/server"
+	"log"
+	"time"
+)
+
+func main() {
+	var (
+		path    string
+		players int
+	)
+
+	flag.StringVar(&path, "in", "", "path to a log written by Hub.StartBotRecording")
+	flag.IntVar(&players, "players", 0, "HubOptions.MinClients to pass to the replay Hub")
+	flag.Parse()
+
+	if path == "" {
+		log.Fatal("missing -in")
+	}
+
+	hub := server.NewHub(server.HubOptions{
+		Cloud:      server.Offline{},
+		MinClients: players,
+	})
+	go hub.Run()
+
+	// Give the Hub's Run loop a moment to start ticking physics before the
+	// first record's tick-wait in ReplayBotLog begins polling it.
+	time.Sleep(100 * time.Millisecond)
+
+	if err := server.ReplayBotLog(path, hub); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -71,7 +71,7 @@ func (b *Bot) Send(out server.Outbound) {
 			}
 		}
 
-		img := rasterize(ship, update.Contacts, b.Hub.GetTerrain(), 1024, 128)
+		img := rasterizeToImage(ship, update.Contacts, b.Hub.GetTerrain(), 1024, 128)
 		var buf bytes.Buffer
 		err := png.Encode(&buf, img)
 		if err != nil {
@@ -113,64 +113,37 @@ func (b *Bot) sendToHub(inbound server.Inbound) {
 	b.Hub.ReceiveSigned(server.SignedInbound{Client: b, Inbound: inbound}, false)
 }
 
-// scale = meters per image dimension
-// Red channel = enemy/danger
-// Green channel = obstacle/land
-// Blue channel = friendly/collectible
-func rasterize(ship server.Contact, contacts []server.IDContact, t terrain.Terrain, scale float32, resolution int) image.Image {
+// rasterizeToImage renders the same observation server.Rasterize produces
+// (now shared with server/training's recorder) down to a human-viewable
+// RGBA image: red = enemy, green = obstacle/land, blue = friendly/
+// collectible. scale is meters per image dimension.
+func rasterizeToImage(ship server.Contact, contacts []server.IDContact, t terrain.Terrain, scale float32, resolution int) image.Image {
+	channels := []server.RasterizeChannel{server.ChannelEnemy, server.ChannelObstacle, server.ChannelFriendly, server.ChannelTerrain, server.ChannelCollectible}
+	frame := server.Rasterize(ship, contacts, t, channels, scale, resolution)
+	planeSize := resolution * resolution
+
 	img := image.NewRGBA(image.Rect(0, 0, resolution, resolution))
-	scale /= float32(resolution)
-
-	for x := 0; x < resolution; x++ {
-		for y := 0; y < resolution; y++ {
-			bg := color.RGBA{A: 255}
-			pos := ship.Position
-			pos.X += float32(x-resolution/2) * scale
-			pos.Y += float32(y-resolution/2) * scale
-			if terrain.LandAtPos(t, pos) {
-				bg.G = 255
-			}
-			img.SetRGBA(x, y, bg)
-		}
+	for i := 0; i < planeSize; i++ {
+		x, y := i%resolution, i/resolution
+		enemy := frame[0*planeSize+i]
+		obstacle := frame[1*planeSize+i]
+		friendly := frame[2*planeSize+i]
+		landBg := frame[3*planeSize+i]
+		collectible := frame[4*planeSize+i]
+
+		img.SetRGBA(x, y, color.RGBA{
+			R: enemy,
+			G: max(obstacle, landBg),
+			B: max(friendly, collectible),
+			A: 255,
+		})
 	}
+	return img
+}
 
-	for _, contact := range contacts {
-		data := contact.EntityType.Data()
-		normal := contact.Direction.Vec2f()
-		tangent := normal.Rot90()
-
-		var new color.RGBA
-		new.A = 255
-
-		if contact.Friendly {
-			new.B = 255
-		} else {
-			new.R = 255 / 4
-		}
-
-		switch data.Kind {
-		case world.EntityKindBoat:
-			new.R *= 2
-		case world.EntityKindWeapon:
-			new.R *= 4
-		case world.EntityKindCollectible:
-			new.R = 0
-			new.B = 255
-		case world.EntityKindObstacle:
-			new.G = 255
-		}
-
-		for l := -0.5 * data.Length; l <= 0.5*data.Length; l += scale * 0.5 {
-			for w := -0.5 * data.Width; w <= 0.5*data.Width; w += scale * 0.5 {
-				pos := contact.Position.Sub(ship.Position).AddScaled(normal, l).AddScaled(tangent, w)
-
-				pos = pos.Div(scale)
-
-				//old := rgba.RGBAAt(int(pos.X), int(pos.Y))
-
-				img.SetRGBA(int(pos.X)+resolution/2, int(pos.Y)+resolution/2, new)
-			}
-		}
+func max(a, b byte) byte {
+	if a > b {
+		return a
 	}
-	return img
+	return b
 }
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Command packetreplay_main spectates a capture written by
+// Hub.StartPacketCapture (see server.OpenPacketCapture/ReplayPacketCapture)
+// through the normal game client, by serving a websocket that streams its
+// recorded Updates/Leaderboards back at (scaled) recorded timestamps. It
+// never runs a Hub: the client only ever sees wire messages it already
+// knows how to render.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// messageType returns the wire messageType a captured record's Kind should
+// be framed as, or false for kinds the client doesn't render (captured
+// inbound commands are recorded for context, not for replay).
+func messageType(kind server.PacketCaptureKind) (string, bool) {
+	switch kind {
+	case server.PacketCaptureUpdate:
+		return "update", true
+	case server.PacketCaptureLeaderboard:
+		return "leaderboard", true
+	default:
+		return "", false
+	}
+}
+
+func main() {
+	var (
+		dir   string
+		addr  string
+		speed float64
+	)
+
+	flag.StringVar(&dir, "in", "", "capture directory written by Hub.StartPacketCapture")
+	flag.StringVar(&addr, "listen", ":8193", "address to serve the replay websocket on")
+	flag.Float64Var(&speed, "speed", 1, "playback speed multiplier (<=0 sends as fast as possible)")
+	flag.Parse()
+
+	if dir == "" {
+		log.Fatal("missing -in")
+	}
+
+	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("upgrade error:", err)
+			return
+		}
+		defer conn.Close()
+
+		reader, err := server.OpenPacketCapture(dir)
+		if err != nil {
+			log.Println("opening capture:", err)
+			return
+		}
+		defer reader.Close()
+
+		err = server.ReplayPacketCapture(reader, speed, func(record server.PacketCaptureRecord) error {
+			typ, ok := messageType(record.Kind)
+			if !ok {
+				return nil
+			}
+
+			frame, err := json.Marshal(struct {
+				Data json.RawMessage `json:"data"`
+				Type string          `json:"type"`
+			}{Data: record.Payload, Type: typ})
+			if err != nil {
+				return err
+			}
+
+			return conn.WriteMessage(websocket.TextMessage, frame)
+		})
+		if err != nil {
+			log.Println("replaying capture:", err)
+		}
+	})
+
+	fmt.Println("serving capture replay on", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Command replay_main summarizes a recording written by Hub.StartRecording,
+// as a quick way to confirm a bug report's log actually covers the tick
+// range in question. It does not re-run physics: Hub's physics internals are
+// unexported and tightly coupled to the live Run loop, so a true headless
+// resimulation would require exporting most of physics.go. Loading the log
+// into a real Hub via Hub.ReplayTick remains the way to actually reproduce a
+// tick.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server"
+	"log"
+	"os"
+)
+
+func main() {
+	var path string
+	flag.StringVar(&path, "in", "", "path to a recording written by Hub.StartRecording")
+	flag.Parse()
+
+	if path == "" {
+		log.Fatal("missing -in")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	summary, err := server.SummarizeRecording(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("ticks:        %d\n", summary.Ticks)
+	fmt.Printf("tick range:   %d..%d\n", summary.FirstTick, summary.LastTick)
+	fmt.Printf("max entities: %d\n", summary.MaxEntities)
+}
@@ -0,0 +1,384 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+	"time"
+)
+
+// Make sure to register in init function
+type (
+	// AdminAuth is embedded by every admin/observer console command. A
+	// command whose Auth doesn't match HubOptions.Auth (or HubOptions.Auth
+	// isn't configured at all) is rejected and audited as a failure (see
+	// Hub.auditAdmin), same as an un-authed Spawn.
+	AdminAuth struct {
+		Auth string `json:"auth"`
+	}
+
+	// AdminListClients requests a snapshot of every connected Client (see
+	// AdminClientList).
+	AdminListClients struct {
+		AdminAuth
+	}
+
+	// AdminKick disconnects every Client matching PlayerID (if not
+	// world.PlayerIDInvalid) or IP (if non-empty). At least one must be set.
+	AdminKick struct {
+		AdminAuth
+		PlayerID world.PlayerID `json:"playerID,omitempty"`
+		IP       string         `json:"ip,omitempty"`
+	}
+
+	// AdminSetBanned adds or removes IP from Hub.bannedIPs, which
+	// ServeSocket consults before upgrading a connection. Banning also
+	// kicks any Client currently connected from IP.
+	AdminSetBanned struct {
+		AdminAuth
+		IP     string `json:"ip"`
+		Banned bool   `json:"banned"`
+	}
+
+	// AdminTeleport moves PlayerID's ship to Position, bypassing normal
+	// movement and terrain/collision checks.
+	AdminTeleport struct {
+		AdminAuth
+		PlayerID world.PlayerID `json:"playerID"`
+		Position world.Vec2f    `json:"position"`
+	}
+
+	// AdminSpawnEntity spawns an unowned Entity of Type at Position, e.g. to
+	// manually seed a collectible or obstacle. Only non-boat types are
+	// useful here, since a boat needs an Owner (see spawnEntity).
+	AdminSpawnEntity struct {
+		AdminAuth
+		Type     world.EntityType `json:"type"`
+		Position world.Vec2f      `json:"position"`
+	}
+
+	// AdminSetFrozen pauses (or resumes) Hub.Run's Physics/Update calls,
+	// freezing the world in place while the Hub keeps accepting connections
+	// and processing other Inbounds (including another AdminSetFrozen).
+	AdminSetFrozen struct {
+		AdminAuth
+		Frozen bool `json:"frozen"`
+	}
+
+	// AdminSnapshotTerrain triggers an out-of-band SnapshotTerrain upload,
+	// instead of waiting for the next debugTicker.
+	AdminSnapshotTerrain struct {
+		AdminAuth
+	}
+
+	// AdminDumpFuncBenches requests the current funcBenches averages (see
+	// AdminFuncBenchReport) without resetting them; debugTicker's own
+	// Debug() call still owns that reset.
+	AdminDumpFuncBenches struct {
+		AdminAuth
+	}
+
+	// AdminSubscribeDebug toggles whether the sender receives an
+	// AdminDebugEvent every debugTicker period (see broadcastDebugEvent).
+	AdminSubscribeDebug struct {
+		AdminAuth
+		Subscribe bool `json:"subscribe"`
+	}
+
+	// AdminClientInfo is one AdminClientList entry.
+	AdminClientInfo struct {
+		world.IDPlayerData
+		EntityID world.EntityID `json:"entityID"`
+		Bot      bool           `json:"bot,omitempty"`
+		IP       string         `json:"ip,omitempty"`
+	}
+
+	// AdminClientList is the reply to AdminListClients.
+	AdminClientList struct {
+		Clients []AdminClientInfo `json:"clients"`
+	}
+
+	// AdminFuncBenchStat is one AdminFuncBenchReport entry; see funcBench.
+	AdminFuncBenchStat struct {
+		Name            string        `json:"name"`
+		AverageDuration time.Duration `json:"averageDuration"`
+		Runs            int           `json:"runs"`
+	}
+
+	// AdminFuncBenchReport is the reply to AdminDumpFuncBenches.
+	AdminFuncBenchReport struct {
+		Benches []AdminFuncBenchStat `json:"benches"`
+	}
+
+	// AdminDebugEvent is streamed to AdminSubscribeDebug subscribers once
+	// per debugTicker period; see broadcastDebugEvent.
+	AdminDebugEvent struct {
+		Clients     int     `json:"clients"`
+		Bots        int     `json:"bots"`
+		Teams       int     `json:"teams"`
+		WorldRadius float32 `json:"worldRadius"`
+	}
+)
+
+func init() {
+	registerInbound(
+		AdminListClients{},
+		AdminKick{},
+		AdminSetBanned{},
+		AdminTeleport{},
+		AdminSpawnEntity{},
+		AdminSetFrozen{},
+		AdminSnapshotTerrain{},
+		AdminDumpFuncBenches{},
+		AdminSubscribeDebug{},
+	)
+	registerOutbound(
+		&AdminClientList{},
+		AdminFuncBenchReport{},
+		AdminDebugEvent{},
+	)
+}
+
+// Pool Admin messages are low-frequency, so unlike Update there's no
+// benefit to a sync.Pool; Pool is a no-op satisfying Outbound.
+func (list *AdminClientList) Pool() {}
+
+// Priority and Coalesce: every admin reply is a one-off answer to a
+// specific command, not a repeating stream, so there's nothing to coalesce
+// and losing one would silently hide a result a moderator is waiting on.
+func (list *AdminClientList) Priority() Priority { return PriorityReliable }
+func (list *AdminClientList) Coalesce() string   { return "" }
+
+func (report AdminFuncBenchReport) Pool() {}
+
+func (report AdminFuncBenchReport) Priority() Priority { return PriorityReliable }
+func (report AdminFuncBenchReport) Coalesce() string   { return "" }
+
+func (event AdminDebugEvent) Pool() {}
+
+// Priority and Coalesce: AdminDebugEvent repeats every debugPeriod with a
+// fresh snapshot, so a subscriber that's fallen behind only needs the
+// latest one - same reasoning as Update.
+func (event AdminDebugEvent) Priority() Priority { return PriorityLossy }
+func (event AdminDebugEvent) Coalesce() string   { return "debug" }
+
+// authed reports whether auth matches the Hub's configured admin token.
+// Like Spawn.Auth, an empty HubOptions.Auth means the admin console is
+// disabled entirely, not wide open.
+func (auth AdminAuth) authed(h *Hub) bool {
+	return h.auth != "" && auth.Auth == h.auth
+}
+
+// auditAdmin rate-limits (per moderator IP) and forwards one admin command
+// outcome to h.cloud, so multi-server deployments can correlate moderator
+// actions across nodes. Failed (unauthed) attempts are audited too, so a
+// brute-force attempt against Auth shows up as a burst of ok=false events.
+func (h *Hub) auditAdmin(client Client, player *Player, command string, ok bool) {
+	var ip string
+	if addr := client.IP(); addr != nil {
+		ip = addr.String()
+	}
+
+	if !h.adminAuditLimiter.Allow(ip) {
+		return
+	}
+
+	if err := h.cloud.AuditAdminCommand(ip, player.PlayerID(), command, ok); err != nil {
+		println("admin audit:", err.Error())
+	}
+}
+
+// findClientByPlayerID linearly scans h.clients, mirroring
+// world.PlayerSet.GetByID - there is no Hub-wide PlayerID index since
+// PlayerID is derived from the Player's address (see world.PlayerID).
+func (h *Hub) findClientByPlayerID(playerID world.PlayerID) Client {
+	for c := h.clients.First; c != nil; c = c.Data().Next {
+		if c.Data().Player.PlayerID() == playerID {
+			return c
+		}
+	}
+	return nil
+}
+
+func (data AdminListClients) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) {
+		h.auditAdmin(client, player, "adminListClients", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminListClients", true)
+
+	list := &AdminClientList{Clients: make([]AdminClientInfo, 0, h.clients.Len)}
+	for c := h.clients.First; c != nil; c = c.Data().Next {
+		p := &c.Data().Player
+		var ip string
+		if addr := c.IP(); addr != nil {
+			ip = addr.String()
+		}
+		list.Clients = append(list.Clients, AdminClientInfo{
+			IDPlayerData: p.IDPlayerData(),
+			EntityID:     p.EntityID,
+			Bot:          c.Bot(),
+			IP:           ip,
+		})
+	}
+	client.Send(list)
+}
+
+func (data AdminKick) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) || (data.PlayerID == world.PlayerIDInvalid && data.IP == "") {
+		h.auditAdmin(client, player, "adminKick", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminKick", true)
+
+	for c := h.clients.First; c != nil; c = c.Data().Next {
+		matchesID := data.PlayerID != world.PlayerIDInvalid && c.Data().Player.PlayerID() == data.PlayerID
+		matchesIP := data.IP != "" && c.IP() != nil && c.IP().String() == data.IP
+		if matchesID || matchesIP {
+			c.Destroy()
+		}
+	}
+}
+
+func (data AdminSetBanned) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) || data.IP == "" {
+		h.auditAdmin(client, player, "adminSetBanned", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminSetBanned", true)
+
+	if data.Banned {
+		h.bannedIPs.Store(data.IP, struct{}{})
+		for c := h.clients.First; c != nil; c = c.Data().Next {
+			if c.IP() != nil && c.IP().String() == data.IP {
+				c.Destroy()
+			}
+		}
+	} else {
+		h.bannedIPs.Delete(data.IP)
+	}
+}
+
+func (data AdminTeleport) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) {
+		h.auditAdmin(client, player, "adminTeleport", false)
+		return
+	}
+
+	target := h.findClientByPlayerID(data.PlayerID)
+	if target == nil {
+		h.auditAdmin(client, player, "adminTeleport", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminTeleport", true)
+
+	h.world.EntityByID(target.Data().Player.EntityID, func(entity *world.Entity) (_ bool) {
+		if entity == nil {
+			return
+		}
+		entity.Position = data.Position
+		return
+	})
+}
+
+func (data AdminSpawnEntity) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) || data.Type == world.EntityTypeInvalid {
+		h.auditAdmin(client, player, "adminSpawnEntity", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminSpawnEntity", true)
+
+	entity := &world.Entity{
+		EntityType: data.Type,
+		Transform:  world.Transform{Position: data.Position},
+	}
+	h.spawnEntity(entity, 0)
+}
+
+func (data AdminSetFrozen) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) {
+		h.auditAdmin(client, player, "adminSetFrozen", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminSetFrozen", true)
+
+	h.frozen = data.Frozen
+}
+
+func (data AdminSnapshotTerrain) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) {
+		h.auditAdmin(client, player, "adminSnapshotTerrain", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminSnapshotTerrain", true)
+
+	h.SnapshotTerrain()
+}
+
+func (data AdminDumpFuncBenches) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) {
+		h.auditAdmin(client, player, "adminDumpFuncBenches", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminDumpFuncBenches", true)
+
+	report := AdminFuncBenchReport{Benches: make([]AdminFuncBenchStat, 0, len(h.funcBenches))}
+	for i := range h.funcBenches {
+		bench := &h.funcBenches[i]
+		var average time.Duration
+		if bench.runs > 0 {
+			average = bench.duration / time.Duration(bench.runs)
+		}
+		report.Benches = append(report.Benches, AdminFuncBenchStat{
+			Name:            bench.name,
+			AverageDuration: average,
+			Runs:            bench.runs,
+		})
+	}
+	client.Send(report)
+}
+
+func (data AdminSubscribeDebug) Process(h *Hub, client Client, player *Player) {
+	if !data.authed(h) {
+		h.auditAdmin(client, player, "adminSubscribeDebug", false)
+		return
+	}
+	h.auditAdmin(client, player, "adminSubscribeDebug", true)
+
+	if data.Subscribe {
+		h.debugSubscribers[client] = true
+	} else {
+		delete(h.debugSubscribers, client)
+	}
+}
+
+// broadcastDebugEvent sends an AdminDebugEvent to every client subscribed
+// via AdminSubscribeDebug. Called alongside Debug() from Hub.Run's
+// debugTicker case, so a console can chart the same numbers Debug() prints
+// to the server's stdout without scraping logs.
+func (h *Hub) broadcastDebugEvent() {
+	if len(h.debugSubscribers) == 0 {
+		return
+	}
+
+	var clients, bots int
+	for c := h.clients.First; c != nil; c = c.Data().Next {
+		if c.Bot() {
+			bots++
+		} else {
+			clients++
+		}
+	}
+
+	event := AdminDebugEvent{
+		Clients:     clients,
+		Bots:        bots,
+		Teams:       len(h.teams),
+		WorldRadius: h.worldRadius,
+	}
+
+	for subscriber := range h.debugSubscribers {
+		subscriber.Send(event)
+	}
+}
@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// binaryFieldSizes lists the exported-field kinds registerBinaryType knows
+// how to copy byte-for-byte onto the wire: fixed-size, non-pointer
+// primitives. This transparently covers this package's own fixed-point wire
+// types (world.Angle, world.Ticks, world.Velocity, world.EntityID, ...),
+// since reflect.Kind() resolves to their underlying primitive kind rather
+// than their declared name. A type with any other field (string, slice, map,
+// nested struct) is disqualified - see registerBinaryType - and stays on the
+// tag-0 JSON fallback.
+var binaryFieldSizes = map[reflect.Kind]uintptr{
+	reflect.Bool:    1,
+	reflect.Int8:    1,
+	reflect.Uint8:   1,
+	reflect.Int16:   2,
+	reflect.Uint16:  2,
+	reflect.Int32:   4,
+	reflect.Uint32:  4,
+	reflect.Float32: 4,
+	reflect.Int64:   8,
+	reflect.Uint64:  8,
+	reflect.Float64: 8,
+}
+
+// binaryField is one exported field of a binary-registered struct: its byte
+// offset and size within that struct's memory layout.
+type binaryField struct {
+	offset uintptr
+	size   uintptr
+}
+
+// binaryDescriptor is everything MarshalBinary/UnmarshalBinary need to copy
+// a registered type to and from the wire: its type (to allocate a fresh
+// value on decode), its fields in declaration order, and their total size.
+type binaryDescriptor struct {
+	typ    reflect.Type
+	fields []binaryField
+	size   uintptr
+}
+
+var (
+	// binaryTags maps a registered message's reflect.Type to its 1-byte wire
+	// tag. Tag 0 is reserved for messages that don't qualify for the binary
+	// codec (see registerBinaryType) and fall back to JSON framed inside a
+	// binary message (see Message.MarshalBinary).
+	binaryTags = make(map[reflect.Type]uint8)
+	// binaryDescriptors is the inverse of binaryTags, keyed by tag so
+	// UnmarshalBinary can look up how to decode a frame it receives.
+	binaryDescriptors       = make(map[uint8]binaryDescriptor)
+	nextBinaryTag     uint8 = 1
+)
+
+// registerBinaryType assigns typ the next free binary tag, provided every
+// one of its exported fields is a fixed-size primitive (see
+// binaryFieldSizes). It's called once per type from registerInbound and
+// registerOutbound, so the binary codec's tag space always tracks the JSON
+// codec's messageType space - it's a more compact encoding of the same
+// registered set, not a separate registration step callers need to remember.
+func registerBinaryType(typ reflect.Type) {
+	typ = indirectType(typ)
+
+	if nextBinaryTag == 0 {
+		panic("binary_message: out of uint8 tags")
+	}
+
+	var fields []binaryField
+	var size uintptr
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported; doesn't round-trip through JSON either
+		}
+
+		fieldSize, ok := binaryFieldSizes[field.Type.Kind()]
+		if !ok {
+			// Disqualified - e.g. Chat.Message (string) or Update.Contacts
+			// (map). Leave it unregistered so it falls back to tag 0.
+			return
+		}
+
+		fields = append(fields, binaryField{offset: field.Offset, size: fieldSize})
+		size += fieldSize
+	}
+
+	tag := nextBinaryTag
+	nextBinaryTag++
+	binaryTags[typ] = tag
+	binaryDescriptors[tag] = binaryDescriptor{typ: typ, fields: fields, size: size}
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+// MarshalBinary encodes message as [tag byte][fields, little-endian...] if
+// message.Data's type was registered by registerBinaryType, or as
+// [0][4-byte length][JSON bytes] otherwise, reusing the existing JSON codec
+// unchanged as a fallback for types (like Chat or Update) that carry a
+// string, slice, or map field a fixed-offset copy can't express.
+func (message Message) MarshalBinary() ([]byte, error) {
+	// Update never qualifies for the generic fixed-field scheme below (see
+	// registerBinaryType), so it gets its own hand-written compact
+	// encoding instead of falling all the way back to tag-0 JSON - see
+	// marshalUpdateBinary.
+	if update, ok := message.Data.(*Update); ok {
+		return marshalUpdateBinary(update)
+	}
+
+	typ := indirectType(reflect.TypeOf(message.Data))
+
+	if tag, ok := binaryTags[typ]; ok {
+		return marshalBinaryFields(tag, binaryDescriptors[tag], message.Data), nil
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 5, 5+len(body))
+	buf[0] = 0
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(body)))
+	return append(buf, body...), nil
+}
+
+// UnmarshalBinary decodes a frame written by MarshalBinary back into
+// message.Data.
+func (message *Message) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("binary_message: empty message")
+	}
+
+	tag := data[0]
+	if tag == 0 {
+		if len(data) < 5 {
+			return fmt.Errorf("binary_message: truncated fallback header")
+		}
+		n := binary.LittleEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(n) {
+			return fmt.Errorf("binary_message: truncated fallback body")
+		}
+		return json.Unmarshal(data[5:5+n], message)
+	}
+	if tag == updateBinaryTag {
+		// Data is *Update, not Update, matching registerOutbound(&Update{})
+		// in outbound.go - the same shape production code always sends.
+		update, err := unmarshalUpdateBinary(data)
+		if err != nil {
+			return err
+		}
+		message.Data = update
+		return nil
+	}
+
+	desc, ok := binaryDescriptors[tag]
+	if !ok {
+		return fmt.Errorf("binary_message: unregistered tag %d", tag)
+	}
+	if uint64(len(data)-1) < uint64(desc.size) {
+		return fmt.Errorf("binary_message: truncated message body")
+	}
+
+	ptr := reflect.New(desc.typ)
+	unmarshalBinaryFields(desc, unsafe.Pointer(ptr.Pointer()), data[1:])
+	// Matches decodeMessage's reflect.Indirect in jsoniter.go, so
+	// message.Data.(Inbound) type-asserts the same way regardless of codec.
+	message.Data = reflect.Indirect(ptr).Interface()
+	return nil
+}
+
+// marshalBinaryFields copies data's registered fields onto the wire in
+// declaration order. data's fields are read through an addressable copy
+// (reflect.Value.UnsafeAddr requires one), the same indirection
+// extension_unsafe.go uses to reinterpret a Player extension's backing
+// array rather than a generic recursive encoder.
+func marshalBinaryFields(tag uint8, desc binaryDescriptor, data interface{}) []byte {
+	val := reflect.ValueOf(data)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	addressable := reflect.New(desc.typ).Elem()
+	addressable.Set(val)
+	base := addressable.UnsafeAddr()
+
+	buf := make([]byte, 1+desc.size)
+	buf[0] = tag
+	pos := uintptr(1)
+	for _, field := range desc.fields {
+		fieldPtr := unsafe.Pointer(base + field.offset)
+		switch field.size {
+		case 1:
+			buf[pos] = *(*uint8)(fieldPtr)
+		case 2:
+			binary.LittleEndian.PutUint16(buf[pos:], *(*uint16)(fieldPtr))
+		case 4:
+			binary.LittleEndian.PutUint32(buf[pos:], *(*uint32)(fieldPtr))
+		case 8:
+			binary.LittleEndian.PutUint64(buf[pos:], *(*uint64)(fieldPtr))
+		}
+		pos += field.size
+	}
+	return buf
+}
+
+// unmarshalBinaryFields is marshalBinaryFields in reverse, writing wire bytes
+// directly into the freshly allocated struct at base.
+func unmarshalBinaryFields(desc binaryDescriptor, base unsafe.Pointer, data []byte) {
+	pos := uintptr(0)
+	for _, field := range desc.fields {
+		fieldPtr := unsafe.Pointer(uintptr(base) + field.offset)
+		switch field.size {
+		case 1:
+			*(*uint8)(fieldPtr) = data[pos]
+		case 2:
+			*(*uint16)(fieldPtr) = binary.LittleEndian.Uint16(data[pos:])
+		case 4:
+			*(*uint32)(fieldPtr) = binary.LittleEndian.Uint32(data[pos:])
+		case 8:
+			*(*uint64)(fieldPtr) = binary.LittleEndian.Uint64(data[pos:])
+		}
+		pos += field.size
+	}
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import "github.com/SoftbearStudios/mk48/server/world"
+
+// borderContactMargin is how close to a shard's edge an entity must be to
+// get published for the neighboring shard (see publishBorderContacts). Set
+// comfortably past the largest sensor range so a contact doesn't visibly
+// pop into existence right at the border.
+const borderContactMargin = 1600
+
+// BorderContact is a low-fidelity snapshot of one entity near a shard edge,
+// published for a neighboring shard's players to see (see updateClient)
+// without giving that shard direct access to this one's world. Unlike a
+// normal Contact, there's no sensor-uncertainty model applied - it's always
+// "visible" at reduced fidelity (no ArmamentConsumption/TurretAngles/
+// Guidance), since computing real uncertainty would need the viewer's full
+// Entity, which lives on the other shard.
+//
+// Known limitation: EntityID is only unique within the shard that minted
+// it, so if two shards independently allocate the same EntityID, a player
+// near both borders could briefly see the two as one flickering contact.
+// Acceptable for a best-effort visibility feature; out of scope to give
+// EntityID a shard-aware namespace.
+type BorderContact struct {
+	world.IDPlayerData
+	world.Transform
+	EntityID      world.EntityID
+	EntityType    world.EntityType
+	DamagePercent float32
+}
+
+// publishBorderContacts refreshes h.borderContacts with every entity within
+// borderContactMargin of either edge of h.shardBounds, for neighboring
+// shards to pick up via HubRouter.neighborBorderContacts. A no-op when h
+// isn't part of a HubRouter. Called at leaderboardTicker's cadence,
+// alongside the rest of Hub.Run's once-a-second housekeeping.
+func (h *Hub) publishBorderContacts() {
+	if h.router == nil {
+		return
+	}
+
+	var contacts []BorderContact
+	h.world.ForEntities(func(entity *world.Entity) (_, _ bool) {
+		x := entity.Position.X
+		if x-h.shardBounds.X > borderContactMargin && h.shardBounds.X+h.shardBounds.Width-x > borderContactMargin {
+			return // not near either edge
+		}
+
+		var idData world.IDPlayerData
+		if entity.Owner != nil {
+			idData = entity.Owner.IDPlayerData()
+		}
+
+		contacts = append(contacts, BorderContact{
+			IDPlayerData:  idData,
+			Transform:     entity.Transform,
+			EntityID:      entity.EntityID,
+			EntityType:    entity.EntityType,
+			DamagePercent: entity.DamagePercent(),
+		})
+		return
+	})
+
+	h.borderContacts.Store(contacts)
+}
+
+// neighborBorderContacts returns the BorderContacts most recently published
+// by every shard other than h (see publishBorderContacts). Cheap enough to
+// call per-client since it's an atomic.Value load per neighbor, not a lock.
+func (r *HubRouter) neighborBorderContacts(h *Hub) []BorderContact {
+	var all []BorderContact
+	for _, neighbor := range r.hubs {
+		if neighbor == h {
+			continue
+		}
+		if contacts, ok := neighbor.borderContacts.Load().([]BorderContact); ok {
+			all = append(all, contacts...)
+		}
+	}
+	return all
+}
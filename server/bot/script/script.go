@@ -0,0 +1,233 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package script implements a small DSL for defining bot personalities in a
+// text config file instead of Go code, so operators can add/tune roles like
+// "aggressive submarine" or "cautious carrier" without recompiling (see
+// BotClient.script in mk48/server). A file holds one or more named, weighted
+// scripts:
+//
+//	script aggressive_submarine weight 3
+//	if enemy_within 500 then aim_and_fire torpedo
+//	flee_if_health_below 0.2
+//	prefer_upgrade submarine
+//	end
+//
+//	script cautious_carrier weight 1
+//	patrol radius 2000 around 0,0
+//	flee_if_health_below 0.5
+//	prefer_upgrade carrier
+//	end
+//
+// Load rejects malformed syntax and any command it doesn't recognize,
+// reporting the offending file and line.
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Patrol is the effect of a "patrol radius <meters> around <x>,<y>" command.
+type Patrol struct {
+	Center world.Vec2f
+	Radius float32
+}
+
+// Script is one named, weighted bot personality compiled from a script
+// file by Load. The zero Script (Weight 0, everything else unset) behaves
+// like a bot with no script at all, falling back entirely to BotProfile.
+type Script struct {
+	Name   string
+	Weight float64
+
+	// FireWeapon/FireRadius come from "if enemy_within <meters> then
+	// aim_and_fire <weapon>". FireWeapon is EntitySubKindInvalid if unset.
+	FireWeapon world.EntitySubKind
+	FireRadius float32
+
+	// Patrol comes from "patrol radius <meters> around <x>,<y>"; nil if
+	// unset.
+	Patrol *Patrol
+
+	// FleeHealthBelow comes from "flee_if_health_below <fraction>"; 0 if
+	// unset, meaning it never overrides BotProfile.RetreatHealthThreshold.
+	FleeHealthBelow float32
+
+	// PreferredUpgrade comes from "prefer_upgrade <subkind>";
+	// EntitySubKindInvalid if unset.
+	PreferredUpgrade world.EntitySubKind
+}
+
+// Load parses a script file (see the package doc comment for its format)
+// into the Scripts it defines. Blank lines and lines starting with # are
+// ignored.
+func Load(path string) ([]Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var scripts []Script
+	var current *Script
+
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if err := parseLine(fields, &current, &scripts); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("%s: script %q missing end", path, current.Name)
+	}
+
+	return scripts, nil
+}
+
+// parseLine applies one already-tokenized, non-empty, non-comment line to
+// current, starting/ending/appending *scripts as directed by "script"/"end".
+func parseLine(fields []string, current **Script, scripts *[]Script) error {
+	switch fields[0] {
+	case "script":
+		if *current != nil {
+			return fmt.Errorf("nested script %q inside %q", fields[1], (*current).Name)
+		}
+		if len(fields) != 4 || fields[2] != "weight" {
+			return fmt.Errorf("expected \"script <name> weight <n>\", got %q", strings.Join(fields, " "))
+		}
+		weight, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return fmt.Errorf("invalid weight: %w", err)
+		}
+		*current = &Script{Name: fields[1], Weight: weight}
+		return nil
+	case "end":
+		if *current == nil {
+			return fmt.Errorf("end without a script")
+		}
+		*scripts = append(*scripts, **current)
+		*current = nil
+		return nil
+	}
+
+	if *current == nil {
+		return fmt.Errorf("%q outside a script", fields[0])
+	}
+
+	switch fields[0] {
+	case "if":
+		// if enemy_within <meters> then aim_and_fire <weapon>
+		if len(fields) != 6 || fields[1] != "enemy_within" || fields[3] != "then" || fields[4] != "aim_and_fire" {
+			return fmt.Errorf("expected \"if enemy_within <meters> then aim_and_fire <weapon>\", got %q", strings.Join(fields, " "))
+		}
+		radius, err := strconv.ParseFloat(fields[2], 32)
+		if err != nil {
+			return fmt.Errorf("invalid enemy_within radius: %w", err)
+		}
+		var weapon world.EntitySubKind
+		if err := weapon.UnmarshalText([]byte(fields[5])); err != nil {
+			return fmt.Errorf("invalid aim_and_fire weapon: %w", err)
+		}
+		(*current).FireRadius = float32(radius)
+		(*current).FireWeapon = weapon
+	case "patrol":
+		// patrol radius <meters> around <x>,<y>
+		if len(fields) != 5 || fields[1] != "radius" || fields[3] != "around" {
+			return fmt.Errorf("expected \"patrol radius <meters> around <x>,<y>\", got %q", strings.Join(fields, " "))
+		}
+		radius, err := strconv.ParseFloat(fields[2], 32)
+		if err != nil {
+			return fmt.Errorf("invalid patrol radius: %w", err)
+		}
+		center, err := parseVec2f(fields[4])
+		if err != nil {
+			return fmt.Errorf("invalid patrol center: %w", err)
+		}
+		(*current).Patrol = &Patrol{Center: center, Radius: float32(radius)}
+	case "flee_if_health_below":
+		if len(fields) != 2 {
+			return fmt.Errorf("expected \"flee_if_health_below <fraction>\", got %q", strings.Join(fields, " "))
+		}
+		fraction, err := strconv.ParseFloat(fields[1], 32)
+		if err != nil {
+			return fmt.Errorf("invalid flee_if_health_below fraction: %w", err)
+		}
+		(*current).FleeHealthBelow = float32(fraction)
+	case "prefer_upgrade":
+		if len(fields) != 2 {
+			return fmt.Errorf("expected \"prefer_upgrade <subkind>\", got %q", strings.Join(fields, " "))
+		}
+		var subKind world.EntitySubKind
+		if err := subKind.UnmarshalText([]byte(fields[1])); err != nil {
+			return fmt.Errorf("invalid prefer_upgrade subkind: %w", err)
+		}
+		(*current).PreferredUpgrade = subKind
+	default:
+		return fmt.Errorf("unrecognized command %q", fields[0])
+	}
+
+	return nil
+}
+
+// parseVec2f parses "x,y" (no spaces, as written in a patrol command).
+func parseVec2f(s string) (world.Vec2f, error) {
+	comma := strings.IndexByte(s, ',')
+	if comma < 0 {
+		return world.Vec2f{}, fmt.Errorf("expected \"x,y\", got %q", s)
+	}
+	x, y := s[:comma], s[comma+1:]
+	xFloat, err := strconv.ParseFloat(x, 32)
+	if err != nil {
+		return world.Vec2f{}, err
+	}
+	yFloat, err := strconv.ParseFloat(y, 32)
+	if err != nil {
+		return world.Vec2f{}, err
+	}
+	return world.Vec2f{X: float32(xFloat), Y: float32(yFloat)}, nil
+}
+
+// Pick weight-randomly selects one of scripts, or the zero Script (no
+// scripted behavior, same as an unconfigured bot) if scripts is empty.
+// Scripts with Weight <= 0 are treated as weight 1 rather than excluded, so
+// a script author can list a script without remembering to set a weight.
+func Pick(r *rand.Rand, scripts []Script) Script {
+	if len(scripts) == 0 {
+		return Script{}
+	}
+
+	total := 0.0
+	for i := range scripts {
+		total += effectiveWeight(&scripts[i])
+	}
+
+	target := r.Float64() * total
+	for i := range scripts {
+		target -= effectiveWeight(&scripts[i])
+		if target <= 0 {
+			return scripts[i]
+		}
+	}
+	return scripts[len(scripts)-1]
+}
+
+func effectiveWeight(s *Script) float64 {
+	if s.Weight <= 0 {
+		return 1
+	}
+	return s.Weight
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import "github.com/SoftbearStudios/mk48/server/world"
+
+// botBoatState is a step in BotBoatController's Idle->Seek->Engage->Flee
+// state machine.
+type botBoatState uint8
+
+const (
+	botBoatIdle botBoatState = iota
+	botBoatSeek
+	botBoatEngage
+	botBoatFlee
+)
+
+// fleeHealthFraction is the remaining-health fraction below which a boat
+// under BotBoatController gives up on Engage and runs.
+const fleeHealthFraction = 0.25
+
+// BotBoatController is a lightweight alternative to BotClient for NPC boats
+// that don't warrant a full websocket-shaped client with a bot personality
+// profile and squad coordination (see bot_client.go, weapon_ai.go, and
+// bot_profile.go for that fuller system, which already drives the module's
+// player-count-padding bots). It isn't a world.Controller - Entity.Update
+// only threads a terrain Collider through to world.Controller.Control (see
+// world/controller.go), not the Hub's entity index BotBoatController needs
+// to sense hostiles - so the Hub drives it directly, the same way
+// fireAutonomousTurret is driven from physics.go rather than from inside
+// Entity.Update.
+type BotBoatController struct {
+	state botBoatState
+}
+
+// Drive runs one tick of ship's state machine and returns the Guidance it
+// should steer toward. ship must be a boat with a live Owner.
+func (c *BotBoatController) Drive(h *Hub, ship *world.Entity) world.Guidance {
+	g := ship.Guidance
+	data := ship.Data()
+
+	pos, visual, radar, sonar := ship.Camera()
+	searchRadius := max(visual, max(radar, sonar))
+
+	var hostile *world.Entity
+	nearestDistSquared := searchRadius * searchRadius
+	h.world.ForEntitiesInRadius(pos, searchRadius, func(distanceSquared float32, _ world.EntityID, other *world.Entity) (stop bool) {
+		if other == ship || other.Data().Kind != world.EntityKindBoat || ship.Owner.Friendly(other.Owner) {
+			return false
+		}
+		if distanceSquared < nearestDistSquared {
+			nearestDistSquared = distanceSquared
+			hostile = other
+		}
+		return false
+	})
+
+	switch {
+	case ship.HealthPercent() < fleeHealthFraction:
+		c.state = botBoatFlee
+	case hostile != nil:
+		c.state = botBoatEngage
+	case c.state == botBoatEngage || c.state == botBoatFlee:
+		// Lost the contact that triggered Engage/Flee; go back to looking.
+		c.state = botBoatSeek
+	case c.state == botBoatIdle:
+		c.state = botBoatSeek
+	}
+
+	switch c.state {
+	case botBoatIdle:
+		g.VelocityTarget = 0
+	case botBoatSeek:
+		// Hold current heading at half speed until something is sighted.
+		g.VelocityTarget = data.Speed / 2
+	case botBoatEngage:
+		diff := hostile.Position.Sub(ship.Position)
+		g.DirectionTarget = diff.Angle()
+		g.VelocityTarget = data.Speed
+		ship.SetAimTarget(hostile.Position)
+		if index, aim := selectArmament(contactOf(ship), contactOf(hostile)); index != -1 {
+			h.fireArmament(ship, index, aim)
+		}
+	case botBoatFlee:
+		if hostile != nil {
+			diff := ship.Position.Sub(hostile.Position)
+			g.DirectionTarget = diff.Angle()
+		}
+		g.VelocityTarget = data.Speed
+	}
+
+	return g
+}
+
+// contactOf builds the minimal Contact selectArmament/selectSAM need to
+// evaluate entity as a ship or a target, since those helpers were written
+// against the Contact view sent to human clients (see outbound.go) rather
+// than a raw world.Entity.
+func contactOf(entity *world.Entity) *Contact {
+	return &Contact{
+		EntityType:          entity.EntityType,
+		Transform:           entity.Transform,
+		ArmamentConsumption: entity.ArmamentConsumption(),
+		TurretAngles:        entity.TurretAngles(),
+	}
+}
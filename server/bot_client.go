@@ -4,22 +4,52 @@
 package server
 
 import (
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/bot/script"
 	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/training"
 	"github.com/SoftbearStudios/mk48/server/world"
 	"github.com/chewxy/math32"
 	"io"
 	"math/rand"
+	"net"
+	"sync/atomic"
 	"time"
 )
 
 type (
 	BotClient struct {
 		ClientData
-		destination   world.Vec2f // where bot will head towards if no other objective
-		aggression    float32     // how likely bot is to attack when given a chance
-		levelAmbition uint8       // max level to upgrade to
-		destroying    bool        // already called destroy
-		request       int64       // last time requested team in millis
+		destination   world.Vec2f  // where bot will head towards if no other objective
+		aggression    float32      // how likely bot is to attack when given a chance
+		levelAmbition uint8        // max level to upgrade to
+		destroying    bool         // already called destroy
+		request       int64        // last time requested team in millis
+		profile       BotProfile    // see bot_profile.go; zero value is fully-randomized behavior
+		script        script.Script // see bot/script; zero value is no scripted behavior
+
+		// seq identifies this bot within a bot recording/replay (see
+		// bot_replay.go); assigned in Init for normal bots, or by
+		// ReplayBotLog for replaying ones.
+		seq uint32
+		// replaying is true for a BotClient created by ReplayBotLog: Send
+		// ignores Updates since ReplayBotLog injects its Inbounds directly.
+		replaying bool
+
+		// path/pathGoal cache the last terrain.Terrain.FindPath result, so a
+		// blocked bot doesn't re-run A* every tick (see followPath).
+		path     []world.Vec2f
+		pathGoal world.Vec2f
+
+		// recordTraining is true for one of the dedicated headless bots
+		// HubOptions.TrainingBots registers (see Hub.registerTrainingBots);
+		// false for an ordinary fill/ratio bot, which never touches
+		// Hub.trainingRecorder. trainPrevScore/trainPrevDamage are this
+		// bot's ship.Score/ship.Damage as of its last recorded tick, so
+		// Reward can be computed as a delta.
+		recordTraining  bool
+		trainPrevScore  int
+		trainPrevDamage float32
 	}
 
 	// Target is a contact that is closest or furthest
@@ -33,6 +63,17 @@ func (bot *BotClient) Bot() bool {
 	return true
 }
 
+// WantsSystemMessages is false: nothing renders a bot's Update, so there's
+// no point paying to filter/serialize System Chats for it (see
+// Hub.Broadcast).
+func (bot *BotClient) WantsSystemMessages() bool {
+	return false
+}
+
+func (bot *BotClient) IP() net.IP {
+	return nil
+}
+
 func (bot *BotClient) Close() {}
 
 func (bot *BotClient) Data() *ClientData {
@@ -59,14 +100,57 @@ func (bot *BotClient) Destroy() {
 }
 
 func (bot *BotClient) Init() {
-	r := getRand()
-	defer poolRand(r)
+	if bot.replaying {
+		// ReplayBotLog injects this bot's Spawn (and everything else) at
+		// the recorded tick; it shouldn't also spawn itself here.
+		return
+	}
+
+	bot.seq = atomic.AddUint32(&bot.Hub.nextBotSeq, 1)
+
+	r, release := bot.rand()
+	defer release()
+
+	bot.profile = randomProfile(r, bot.Hub.botProfiles)
+	bot.script = script.Pick(r, bot.Hub.botScripts)
+
+	if bot.profile.AggressionMax > bot.profile.AggressionMin {
+		bot.aggression = bot.profile.AggressionMin + r.Float32()*(bot.profile.AggressionMax-bot.profile.AggressionMin)
+	} else {
+		bot.aggression = square(r.Float32())
+	}
+
+	if bot.profile.LevelAmbitionMax > bot.profile.LevelAmbitionMin {
+		span := int(bot.profile.LevelAmbitionMax - bot.profile.LevelAmbitionMin)
+		bot.levelAmbition = bot.profile.LevelAmbitionMin + uint8(r.Intn(span+1))
+	} else {
+		bot.levelAmbition = uint8(r.Intn(int(world.BoatLevelMax)) + 1)
+	}
 
-	bot.aggression = square(r.Float32())
-	bot.levelAmbition = uint8(r.Intn(int(world.BoatLevelMax)) + 1)
 	bot.spawn(r)
 }
 
+// chooseUpgrade picks an upgrade path, preferring one matching
+// bot.script.PreferredUpgrade or (failing that) bot.profile.PreferredUpgrade
+// if any of upgradePaths matches it.
+func (bot *BotClient) chooseUpgrade(r *rand.Rand, upgradePaths []world.EntityType) world.EntityType {
+	for _, preferredSubKind := range [2]world.EntitySubKind{bot.script.PreferredUpgrade, bot.profile.PreferredUpgrade} {
+		if preferredSubKind == world.EntitySubKindInvalid {
+			continue
+		}
+		var preferred []world.EntityType
+		for _, t := range upgradePaths {
+			if t.Data().SubKind == preferredSubKind {
+				preferred = append(preferred, t)
+			}
+		}
+		if len(preferred) > 0 {
+			return randomType(r, preferred)
+		}
+	}
+	return randomType(r, upgradePaths)
+}
+
 func (bot *BotClient) Send(out outbound) {
 	defer out.Pool()
 
@@ -74,16 +158,28 @@ func (bot *BotClient) Send(out outbound) {
 		return
 	}
 
+	if bot.replaying {
+		// ReplayBotLog drives this bot directly; it doesn't react to
+		// Updates on its own (see bot_replay.go).
+		return
+	}
+
 	if encodeBotMessages {
-		// Discard output
-		if err := json.NewEncoder(io.Discard).Encode(Message{Data: out}); err != nil {
-			panic("bot test marshal: " + err.Error())
+		// Discard output. Exercised against binaryCodec as well as
+		// jsonCodec, so a bot-shaped Message (e.g. one with a full
+		// Contacts slice) is checked against both base wire formats;
+		// snappyCodec, which only compresses binaryCodec's output, is
+		// not run here.
+		for _, codec := range []Codec{jsonCodec{}, binaryCodec{}} {
+			if err := codec.Encode(io.Discard, Message{Data: out}); err != nil {
+				panic("bot test marshal (" + fmt.Sprintf("%T", codec) + "): " + err.Error())
+			}
 		}
 	}
 
 	// Use local rand to avoid locking
-	r := getRand()
-	defer poolRand(r)
+	r, release := bot.rand()
+	defer release()
 
 	switch update := out.(type) {
 	case *Update:
@@ -111,8 +207,13 @@ func (bot *BotClient) Send(out outbound) {
 			}
 		}
 
+		joinTeamProb := 1e-4
+		if bot.profile.TeamJoinProbability > 0 {
+			joinTeamProb = bot.profile.TeamJoinProbability
+		}
+
 		// Create or leave team
-		if prob(r, 1e-4) {
+		if prob(r, joinTeamProb) {
 			if ship.TeamID == world.TeamIDInvalid {
 				bot.receiveAsync(CreateTeam{
 					Name: randomTeamName(r),
@@ -142,7 +243,7 @@ func (bot *BotClient) Send(out outbound) {
 		requesting := now-bot.request > int64(time.Second*5/time.Millisecond) // in milliseconds
 
 		// Find enemies, collectibles, and hazards.
-		var closestEnemy, closestFriendly, closestCollectible, closestHazard Target
+		var closestEnemy, closestFriendly, closestCollectible, closestHazard, closestAirThreat Target
 		shipData := ship.EntityType.Data()
 
 		// Scan sensor contacts
@@ -173,12 +274,22 @@ func (bot *BotClient) Send(out outbound) {
 					closestFriendly.Closest(contact, friendDistance)
 				} else {
 					closestEnemy.Closest(contact, distanceSquared)
+
+					if contactData.SubKind == world.EntitySubKindAircraft {
+						// Airborne enemy boat, e.g. a plane launched by a carrier.
+						closestAirThreat.Closest(contact, distanceSquared)
+					}
 				}
 			}
 
+			if !contact.Friendly && contactData.Kind == world.EntityKindWeapon &&
+				(contactData.SubKind == world.EntitySubKindAircraft || contactData.SubKind == world.EntitySubKindMissile || contactData.SubKind == world.EntitySubKindRocket) {
+				closestAirThreat.Closest(contact, distanceSquared)
+			}
+
 			// Favor joining teams that have more score for protection.
 			if requesting && ship.TeamID == world.TeamIDInvalid && contact.TeamID != world.TeamIDInvalid &&
-				((ship.Score < contact.Score-5 && prob(r, 2e-3)) || prob(r, 1e-4)) {
+				((ship.Score < contact.Score-5 && prob(r, 2e-3)) || prob(r, joinTeamProb)) {
 
 				bot.request = now
 				requesting = false
@@ -189,6 +300,10 @@ func (bot *BotClient) Send(out outbound) {
 			}
 		}
 
+		// team is nil for a bot not currently on a team; SquadOrders fields
+		// are only meaningful when team.SquadOrders.HasLeader is true.
+		team := bot.Hub.teams[ship.TeamID]
+
 		// Prepare a manual steering command to send
 		manual := Manual{
 			EntityID: update.EntityID,
@@ -200,14 +315,70 @@ func (bot *BotClient) Send(out outbound) {
 			manual.AltitudeTarget = &altitudeTarget
 		}
 
+		isAircraft := shipData.SubKind == world.EntitySubKindAircraft
+		if isAircraft {
+			// Aircraft fly over land/hazards and can't ram, so they get their
+			// own steering instead of falling into the surface-boat switch
+			// below (which used to make them try to ram like a destroyer).
+			altitudeTarget := float32(1)
+			manual.AltitudeTarget = &altitudeTarget
+
+			if closestEnemy.Found() {
+				toTarget := closestEnemy.Position.Sub(ship.Position)
+				if toTarget.LengthSquared() > square(float32(aircraftBombingRadius)) {
+					// Close in on the target.
+					manual.DirectionTarget = toTarget.Angle()
+				} else {
+					// Orbit overhead instead of flying straight through it.
+					manual.DirectionTarget = toTarget.Angle() + world.Pi/2
+				}
+				manual.VelocityTarget = 25 * world.MeterPerSecond
+			} else {
+				if (bot.destination == world.Vec2f{}) || ship.Position.DistanceSquared(bot.destination) < 100*100 {
+					bot.destination = world.ToAngle(r.Float32() * math32.Pi * 2).Vec2f().Mul(update.WorldRadius * 0.9)
+				}
+				manual.DirectionTarget = bot.destination.Sub(ship.Position).Angle()
+				manual.VelocityTarget = 20 * world.MeterPerSecond
+			}
+		}
+
+		// A script's flee_if_health_below only ever raises the profile's
+		// threshold (never lowers it), so a cautious script layered on a
+		// default profile still flees, but a script can't make an otherwise
+		// fearless profile stand and fight past its own threshold.
+		retreatThreshold := bot.profile.RetreatHealthThreshold
+		if bot.script.FleeHealthBelow > retreatThreshold {
+			retreatThreshold = bot.script.FleeHealthBelow
+		}
+
 		// The purpose of this switch is to assign a value to
 		//  - manual.VelocityTarget
 		//  - manual.DirectionTarget
+		// It's skipped for aircraft, which steer themselves above.
 		switch {
+		case isAircraft:
 		case bot.isLandInMultiDirection(ship.Position, shipData.Length, ship.Direction):
-			// Avoid terrain by turning slowly.
-			manual.VelocityTarget = 5 * world.MeterPerSecond
-			manual.DirectionTarget = ship.Direction + world.Pi/2
+			// Try to navigate around the obstacle towards whichever goal the
+			// steering switch below would otherwise pick (same priority).
+			goal := bot.destination
+			switch {
+			case closestFriendly.Found():
+				goal = closestFriendly.Position
+			case closestEnemy.Found():
+				goal = closestEnemy.Position
+			case closestCollectible.Found():
+				goal = closestCollectible.Position
+			}
+
+			if direction, ok := bot.followPath(ship.Position, goal, shipData.Length); ok {
+				manual.DirectionTarget = direction
+				manual.VelocityTarget = 10 * world.MeterPerSecond
+			} else {
+				// No path found (e.g. goal unreachable): fall back to the
+				// old reactive behavior of just turning away from land.
+				manual.VelocityTarget = 5 * world.MeterPerSecond
+				manual.DirectionTarget = ship.Direction + world.Pi/2
+			}
 		case closestHazard.Found() && closestHazard.distanceSquared < square(closestHazard.EntityType.Data().Length+shipData.Length*2):
 			// Avoid collisions by turning away
 			awayDirection := closestHazard.Position.Sub(ship.Position).Angle().Inv()
@@ -220,6 +391,43 @@ func (bot *BotClient) Send(out outbound) {
 				manual.DirectionTarget = awayDirection
 				manual.VelocityTarget = 10 * world.MeterPerSecond
 			}
+		case retreatThreshold > 0 && shipData.Damage > 0 &&
+			1-ship.Damage/shipData.Damage < retreatThreshold:
+			// Health below the profile's (or script's) threshold: flee rather than fight.
+			fleeDirection := ship.Direction + world.Pi
+			if closestEnemy.Found() {
+				fleeDirection = closestEnemy.Position.Sub(ship.Position).Angle().Inv()
+			}
+			manual.DirectionTarget = fleeDirection
+			manual.VelocityTarget = 15 * world.MeterPerSecond
+		case bot.profile.FormationRole == FormationRoleScreen && team != nil && team.SquadOrders.HasLeader:
+			// Keep station around the leader rather than chasing targets.
+			slot := int(update.PlayerID % 8)
+			station := screenOffset(team.SquadOrders.LeaderPos, team.SquadOrders.LeaderDir, slot, 8, shipData.Length*6)
+			manual.DirectionTarget = station.Sub(ship.Position).Angle()
+			manual.VelocityTarget = 10 * world.MeterPerSecond
+		case bot.profile.FormationRole == FormationRoleScout:
+			// Range ahead of the team towards open water, rather than escorting.
+			if ship.Position == (world.Vec2f{}) {
+				manual.DirectionTarget = world.ToAngle(r.Float32() * math32.Pi * 2)
+			} else {
+				manual.DirectionTarget = ship.Position.Angle()
+			}
+			manual.VelocityTarget = 20 * world.MeterPerSecond
+		case bot.profile.FormationRole == FormationRoleArtillery && team != nil && team.SquadOrders.HasLeader:
+			// Hang back from the leader instead of closing to melee range.
+			holdDistance := bot.profile.WeaponHoldFireDistance
+			if holdDistance <= 0 {
+				holdDistance = shipData.Length * 10
+			}
+			toLeader := team.SquadOrders.LeaderPos.Sub(ship.Position)
+			if toLeader.LengthSquared() > holdDistance*holdDistance {
+				manual.DirectionTarget = toLeader.Angle()
+				manual.VelocityTarget = 10 * world.MeterPerSecond
+			} else {
+				manual.DirectionTarget = ship.Direction
+				manual.VelocityTarget = 0
+			}
 		case closestFriendly.Found():
 			// Wander towards closest friendly ship
 			manual.DirectionTarget = closestFriendly.Position.Sub(ship.Position).Angle()
@@ -237,6 +445,15 @@ func (bot *BotClient) Send(out outbound) {
 		case closestCollectible.Found():
 			manual.VelocityTarget = 20 * world.MeterPerSecond
 			manual.DirectionTarget = closestCollectible.Position.Sub(ship.Position).Angle()
+		case bot.script.Patrol != nil:
+			// Wander within the script's patrol area instead of fully randomly.
+			if (bot.destination == world.Vec2f{}) || ship.Position.DistanceSquared(bot.destination) < 100*100 {
+				patrol := bot.script.Patrol
+				bot.destination = patrol.Center.AddScaled(world.ToAngle(r.Float32()*math32.Pi*2).Vec2f(), r.Float32()*patrol.Radius)
+			}
+
+			manual.DirectionTarget = bot.destination.Sub(ship.Position).Angle()
+			manual.VelocityTarget = 10 * world.MeterPerSecond
 		default:
 			// Wander to a random destination
 			// Reset destination when it is reached
@@ -253,71 +470,127 @@ func (bot *BotClient) Send(out outbound) {
 		if shipData.Level < bot.levelAmbition {
 			if upgradePaths := ship.EntityType.UpgradePaths(ship.Score); len(upgradePaths) > 0 {
 				bot.receiveAsync(Upgrade{
-					Type: randomType(r, upgradePaths),
+					Type: bot.chooseUpgrade(r, upgradePaths),
 				})
 			}
 		}
 
-		// Attack with weapons (regardless of pathfinding)
-		if closestEnemy.Found() {
+		// fired records whether any of the Fire branches below triggered
+		// this tick, purely for recordTrainingFrame's Action.Fire - it has
+		// no effect on bot behavior.
+		fired := false
+
+		// Attack with weapons (regardless of pathfinding). Artillery bots
+		// don't independently engage; they only fire at a target the squad
+		// leader has called (see below), so they stay out of melee range.
+		if closestEnemy.Found() && bot.profile.FormationRole != FormationRoleArtillery {
 			// Aim
 			manual.TurretTarget = closestEnemy.Position
 
-			// Fire
-			if prob(r, float64(bot.aggression*0.1)) {
-				closestEnemyAngle := closestEnemy.Position.Sub(ship.Position).Angle()
-				bestArmamentIndex := -1
-				bestArmamentAngleDiff := float32(math32.MaxFloat32)
-
-				for index, armament := range shipData.Armaments {
-					armamentType := armament.Type
-					if armamentType == world.EntityKindInvalid {
-						armamentType = armament.Default.Data().Kind
-					}
-
-					armamentSubtype := armament.Subtype
-					if armamentSubtype == world.EntitySubKindInvalid {
-						armamentSubtype = armament.Default.Data().SubKind
-					}
+			if team != nil && bot.profile.FormationRole == FormationRoleLeader {
+				team.SquadOrders.Target = closestEnemy.Position
+				team.SquadOrders.HasTarget = true
+			}
 
-					if armamentType != world.EntityKindWeapon {
-						continue
-					}
-					if armamentSubtype == world.EntitySubKindSAM {
-						// TODO: Teach bots how to use SAMs
-						continue
-					}
+			// Aircraft only drop their payload once directly overhead, instead
+			// of firing the instant a target is merely in range.
+			readyToFire := !isAircraft || closestEnemy.distanceSquared < square(float32(aircraftBombingRadius)*0.25)
 
-					if ship.ArmamentConsumption[index] == 0 {
-						armamentTransform := world.ArmamentTransform(ship.EntityType, ship.Transform, ship.TurretAngles, index)
-						diff := closestEnemyAngle.Diff(armamentTransform.Direction).Abs()
-						if armament.Vertical || armament.Default.Data().SubKind == world.EntitySubKindAircraft {
-							diff = 0
-						}
-						if diff < bestArmamentAngleDiff {
-							bestArmamentIndex = index
-							bestArmamentAngleDiff = diff
-						}
-					}
+			// Fire
+			if readyToFire && prob(r, float64(bot.aggression*0.1)) {
+				if index, aim := selectArmament(&ship, closestEnemy.Contact); index != -1 {
+					bot.receiveAsync(Fire{
+						Index:          index,
+						PositionTarget: aim,
+					})
+					fired = true
 				}
+			}
+		}
 
-				if bestArmamentIndex != -1 && closestEnemy.distanceSquared < square(4*shipData.Length) && bestArmamentAngleDiff < math32.Pi/3 {
+		if bot.profile.FormationRole == FormationRoleArtillery && team != nil && team.SquadOrders.HasTarget {
+			manual.TurretTarget = team.SquadOrders.Target
+
+			if prob(r, float64(bot.aggression*0.1)) {
+				if index, ok := bot.fireAtPosition(&ship, team.SquadOrders.Target); ok {
 					bot.receiveAsync(Fire{
-						Index:          bestArmamentIndex,
-						PositionTarget: closestEnemy.Position,
+						Index:          index,
+						PositionTarget: team.SquadOrders.Target,
 					})
+					fired = true
 				}
 			}
 		}
 
+		// Scripted "if enemy_within <r> then aim_and_fire <weapon>" rule:
+		// fires deterministically (unlike the aggression-gated firing
+		// above) whenever its condition holds, so a script can describe a
+		// genuinely eager bot regardless of aggression.
+		if bot.script.FireWeapon != world.EntitySubKindInvalid && closestEnemy.Found() &&
+			closestEnemy.distanceSquared <= square(bot.script.FireRadius) {
+			if index := selectArmamentBySubKind(&ship, bot.script.FireWeapon); index != -1 {
+				bot.receiveAsync(Fire{
+					Index:          index,
+					PositionTarget: closestEnemy.Position,
+				})
+				fired = true
+			}
+		}
+
+		// SAM engagement: independent of the above, since SAMs are
+		// vertical-launch (no turret to aim) and defend against a different
+		// threat class (aircraft/missiles/rockets) than the melee loop above.
+		if closestAirThreat.Found() {
+			if index, aim := selectSAM(&ship, closestAirThreat.Contact); index != -1 {
+				bot.receiveAsync(Fire{
+					Index:          index,
+					PositionTarget: aim,
+				})
+				fired = true
+			}
+		}
+
+		if bot.recordTraining && bot.Hub.trainingRecorder != nil {
+			bot.recordTrainingFrame(ship, update.Contacts, manual, fired)
+		}
+
 		bot.receiveAsync(manual)
 	}
 }
 
+// recordTrainingFrame feeds one server.Rasterize observation, the action
+// just chosen for it, and the reward since the last recorded tick into
+// Hub.trainingRecorder. Errors are logged, not propagated - a dropped frame
+// shouldn't take down the bot driving it.
+func (bot *BotClient) recordTrainingFrame(ship Contact, contacts []IDContact, manual Manual, fired bool) {
+	channels := []RasterizeChannel{ChannelEnemy, ChannelFriendly, ChannelObstacle, ChannelCollectible, ChannelTerrain, ChannelVelocity}
+	frame := Rasterize(ship, contacts, bot.Hub.GetTerrain(), channels, 1024, 128)
+
+	reward := training.Reward{
+		DamageTaken: ship.Damage - bot.trainPrevDamage,
+		ScoreDelta:  ship.Score - bot.trainPrevScore,
+	}
+	bot.trainPrevDamage = ship.Damage
+	bot.trainPrevScore = ship.Score
+
+	action := training.Action{
+		VelocityTarget:  manual.VelocityTarget,
+		DirectionTarget: manual.DirectionTarget.Float(),
+		TurretTarget:    manual.TurretTarget.Sub(ship.Position).Angle().Float(),
+		Fire:            fired,
+	}
+
+	if err := bot.Hub.trainingRecorder.Record(frame, action, reward); err != nil {
+		fmt.Printf("recording training frame: %v\n", err)
+	}
+}
+
 // receiveAsync doesn't deadlock the hub.
-func (bot *BotClient) receiveAsync(in inbound) {
+func (bot *BotClient) receiveAsync(in Inbound) {
+	bot.Hub.recordBotInbound(bot.seq, in)
+
 	select {
-	case bot.Hub.inbound <- SignedInbound{Client: bot, inbound: in}:
+	case bot.Hub.inbound <- SignedInbound{Client: bot, Inbound: in}:
 	default:
 		// Drop bot messages to avoid downfall of server.
 	}
@@ -347,6 +620,60 @@ func (bot *BotClient) isLandInMultiDirection(pos world.Vec2f, length float32, an
 	return false
 }
 
+// pathReplanDistance is how far a goal must move before followPath throws
+// away its cached path and re-runs terrain.Terrain.FindPath.
+const pathReplanDistance = 200
+
+// pathWaypointRadius is how close a bot needs to get to a waypoint before
+// followPath advances to the next one.
+const pathWaypointRadius = 50
+
+// aircraftBombingRadius is the distance within which an aircraft bot stops
+// closing on a surface target and orbits it instead; it only drops its
+// payload ("directly overhead") within a quarter of this radius (see Send).
+const aircraftBombingRadius = 300
+
+// followPath steers bot towards goal using a cached terrain-aware path,
+// skipping ahead to any later waypoint already in line of sight. It returns
+// ok=false if no path to goal exists, so the caller can fall back to purely
+// reactive avoidance.
+func (bot *BotClient) followPath(pos, goal world.Vec2f, draft float32) (direction world.Angle, ok bool) {
+	if bot.path == nil || goal.DistanceSquared(bot.pathGoal) > square(float32(pathReplanDistance)) {
+		bot.pathGoal = goal
+		bot.path = bot.Hub.terrain.FindPath(pos, goal, draft)
+	}
+
+	for len(bot.path) > 0 && (pos.DistanceSquared(bot.path[0]) < square(float32(pathWaypointRadius)) ||
+		(len(bot.path) > 1 && bot.hasLineOfSight(pos, bot.path[1]))) {
+		bot.path = bot.path[1:]
+	}
+
+	if len(bot.path) == 0 {
+		return 0, false
+	}
+
+	return bot.path[0].Sub(pos).Angle(), true
+}
+
+// hasLineOfSight samples the terrain along the segment from -> to, treating
+// it the same way isLandInDirection does.
+func (bot *BotClient) hasLineOfSight(from, to world.Vec2f) bool {
+	diff := to.Sub(from)
+	dist := diff.Length()
+	if dist == 0 {
+		return true
+	}
+
+	steps := int(dist/(terrain.Scale*2)) + 1
+	for i := 1; i <= steps; i++ {
+		p := from.AddScaled(diff, float32(i)/float32(steps))
+		if bot.Hub.terrain.AtPos(p) > terrain.OceanLevel-6 {
+			return false
+		}
+	}
+	return true
+}
+
 func (bot *BotClient) isLandInDirection(pos world.Vec2f, length float32, angle world.Angle) bool {
 	inFront := pos.AddScaled(angle.Vec2f(), length*2)
 
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"io/ioutil"
+	"math/rand"
+)
+
+// FormationRole is a bot's assignment within its Team's SquadOrders (see
+// squad.go). The zero value, FormationRoleNone, means the bot ignores squad
+// state and behaves independently, same as before BotProfile existed.
+type FormationRole string
+
+const (
+	FormationRoleNone      FormationRole = ""
+	FormationRoleLeader    FormationRole = "leader"
+	FormationRoleScreen    FormationRole = "screen"
+	FormationRoleScout     FormationRole = "scout"
+	FormationRoleArtillery FormationRole = "artillery"
+)
+
+// BotProfile configures a family of bots' behavior. A Hub is given a pool of
+// profiles via HubOptions.BotProfiles (see LoadBotProfiles); each bot picks
+// one at random in BotClient.Init. The zero BotProfile (used when the pool
+// is empty) reproduces the old fully-randomized, independent behavior.
+type BotProfile struct {
+	Name                   string              `json:"name"`
+	AggressionMin          float32             `json:"aggressionMin"`
+	AggressionMax          float32             `json:"aggressionMax"`
+	LevelAmbitionMin       uint8               `json:"levelAmbitionMin"`
+	LevelAmbitionMax       uint8               `json:"levelAmbitionMax"`
+	PreferredUpgrade       world.EntitySubKind `json:"preferredUpgrade"`
+	TeamJoinProbability    float64             `json:"teamJoinProbability"`
+	RetreatHealthThreshold float32             `json:"retreatHealthThreshold"`
+	WeaponHoldFireDistance float32             `json:"weaponHoldFireDistance"`
+	FormationRole          FormationRole       `json:"formationRole"`
+}
+
+// LoadBotProfiles reads a JSON array of BotProfile from path, for use as
+// HubOptions.BotProfiles.
+func LoadBotProfiles(path string) ([]BotProfile, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []BotProfile
+	if err := json.Unmarshal(buf, &profiles); err != nil {
+		return nil, fmt.Errorf("parsing bot profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// randomProfile picks a uniformly random profile, or the zero value (fully
+// randomized behavior) if none were configured.
+func randomProfile(r *rand.Rand, profiles []BotProfile) BotProfile {
+	if len(profiles) == 0 {
+		return BotProfile{}
+	}
+	return profiles[r.Intn(len(profiles))]
+}
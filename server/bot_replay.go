@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/replay"
+	"io"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// botReplayRecorder is non-nil on a Hub between StartBotRecording and
+// StopBotRecording. Unlike StartRecording/RecordTick (see recorder.go and
+// replay.go), which snapshot physics state to reproduce a tick exactly, this
+// logs bot *decisions* - the intent is reproducing intermittent
+// bot-behavior bugs (bots wedging into terrain, all bots suddenly leaving
+// teams) rather than exact physics.
+type botReplayRecorder struct {
+	writer *replay.Writer
+}
+
+// StartBotRecording begins logging every Inbound a BotClient dispatches to
+// path, for later playback via ReplayBotLog. It also switches bots from the
+// shared math/rand pool (see getRand) to a per-tick, per-bot deterministic
+// source (see BotClient.rand), so the same recording replayed against a
+// fresh Hub makes the same random choices.
+func (h *Hub) StartBotRecording(path string) error {
+	w, err := replay.Create(path)
+	if err != nil {
+		return err
+	}
+
+	h.botRecorder = &botReplayRecorder{writer: w}
+	return nil
+}
+
+// StopBotRecording stops and closes any recording started by
+// StartBotRecording. Safe to call even if none is active.
+func (h *Hub) StopBotRecording() error {
+	if h.botRecorder == nil {
+		return nil
+	}
+
+	err := h.botRecorder.writer.Close()
+	h.botRecorder = nil
+	return err
+}
+
+// recordBotInbound appends in, dispatched by the bot with the given
+// sequence number on the current physics tick, to the active bot recording,
+// if any. Errors stop the recording, same convention as Hub.recordTick.
+func (h *Hub) recordBotInbound(botSeq uint32, in Inbound) {
+	if h.botRecorder == nil {
+		return
+	}
+
+	payload, err := json.Marshal(in)
+	if err == nil {
+		err = h.botRecorder.writer.Write(replay.Record{
+			Tick:    h.physicsTick,
+			BotSeq:  botSeq,
+			Type:    inboundTypeName(in),
+			Payload: payload,
+		})
+	}
+	if err != nil {
+		fmt.Println("bot recording error:", err)
+		h.StopBotRecording()
+	}
+}
+
+// inboundTypeName reproduces the messageType registerInbound derives for in,
+// so recorded Records can be decoded back via inboundMessageTypes.
+func inboundTypeName(in Inbound) string {
+	return uncapitalize(reflect.Indirect(reflect.ValueOf(in)).Type().Name())
+}
+
+// decodeInbound decodes payload as typ (one of the types registerInbound
+// was called with) into an Inbound.
+func decodeInbound(typ reflect.Type, payload json.RawMessage) (Inbound, error) {
+	ptr := reflect.New(typ)
+	if err := json.Unmarshal(payload, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface().(Inbound), nil
+}
+
+// ReplayBotLog replays a log written by StartBotRecording against h,
+// reproducing a bot-driven match's inbound traffic. It spawns one BotClient
+// per distinct BotSeq in the log, but each is marked replaying so its own
+// Send ignores Updates (see BotClient.Send); ReplayBotLog injects the
+// logged Inbounds directly once h.physicsTick reaches the tick they were
+// recorded on, rather than letting the bot decide what to do each update.
+//
+// This reproduces bot behavior bit-for-bit only so long as h's physics
+// never skips or falls behind relative to the original recording (see
+// Hub.skippedCounter) - under load, catch-up can shift which tick an
+// inbound lands on. It's intended for replaying short, known-bad tick
+// ranges (e.g. checked into testdata/) against a freshly started Hub, not
+// for reproducing an entire long match.
+func ReplayBotLog(path string, h *Hub) error {
+	reader, err := replay.Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	h.botReplaying = true
+	defer func() { h.botReplaying = false }()
+
+	bots := make(map[uint32]*BotClient)
+
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading replay log: %w", err)
+		}
+
+		typ, ok := inboundMessageTypes[messageType(record.Type)]
+		if !ok {
+			return fmt.Errorf("replay log: unknown inbound type %q", record.Type)
+		}
+
+		in, err := decodeInbound(typ, record.Payload)
+		if err != nil {
+			return fmt.Errorf("replay log: decoding %s: %w", record.Type, err)
+		}
+
+		for h.physicsTick < record.Tick {
+			time.Sleep(time.Millisecond)
+		}
+
+		bot, ok := bots[record.BotSeq]
+		if !ok {
+			bot = &BotClient{seq: record.BotSeq, replaying: true}
+			bots[record.BotSeq] = bot
+			h.register <- bot
+		}
+
+		for bot.Data().Hub == nil {
+			time.Sleep(time.Millisecond)
+		}
+
+		bot.receiveAsync(in)
+	}
+}
+
+// rand returns the *rand.Rand bot should use this tick, and a function to
+// release it afterwards. Normally this is the shared pool (see getRand),
+// but while bot recording/replay or a session recording/replay (see
+// session_record.go) is active, it's a deterministic source seeded from the
+// current tick and the bot's own sequence number, so the same recording
+// replayed later makes the same random choices.
+func (bot *BotClient) rand() (r *rand.Rand, release func()) {
+	if bot.Hub.botRecorder != nil || bot.Hub.botReplaying || bot.Hub.sessionRecorder != nil || bot.Hub.sessionReplaying {
+		return rand.New(rand.NewSource(int64(bot.Hub.physicsTick) ^ int64(bot.seq))), func() {}
+	}
+
+	r = getRand()
+	return r, func() { poolRand(r) }
+}
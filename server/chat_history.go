@@ -8,6 +8,27 @@ import (
 	"github.com/finnbear/moderation"
 )
 
+const (
+	// trigramSketchSize is how many buckets the rolling trigram count-min
+	// sketch hashes character trigrams into - small enough to stay cheap
+	// per-player, large enough that unrelated messages rarely collide.
+	trigramSketchSize = 64
+	// chatHistoryWindow is the number of recent messages the trigram
+	// sketch is meant to represent; it isn't stored as N separate vectors,
+	// just used to weight how much one message contributes relative to the
+	// existing (decayed) sketch.
+	chatHistoryWindow = 32
+)
+
+// ChatDecision is the result of ChatHistory.Update: whether to block the
+// message, why (for logging/moderation review), and the raw classifier
+// score behind that decision.
+type ChatDecision struct {
+	Block   bool
+	Reasons []string
+	Score   float32
+}
+
 type ChatHistory struct {
 	total         float32
 	inappropriate float32
@@ -16,11 +37,37 @@ type ChatHistory struct {
 	recentLengths      [7]uint8
 	recentLengthsIndex int8
 
+	// trigramSketch is a count-min sketch of character trigrams seen
+	// across recent messages, decayed the same way as total/inappropriate,
+	// used to detect near-duplicate flooding via cosine similarity.
+	trigramSketch [trigramSketchSize]float32
+
 	// Time last faded out in milliseconds
 	updated int64
 }
 
-func (hist *ChatHistory) Update(message string) (string, bool) {
+// Naive-Bayes feature weights (log-likelihood ratios of spam vs not-spam,
+// learned offline from moderation logs) and bias. score = bias +
+// sum(weight*feature); Update blocks when score > nbThreshold. Keeping
+// these as named constants instead of a config file matches how fadeRate's
+// tiers in Update are plain literals: this is a small enough model that a
+// loader would be more code than the model itself.
+const (
+	nbBias                float32 = -1.5
+	nbWeightInappropriate float32 = 3.2
+	nbWeightFrequency     float32 = 2.1
+	nbWeightRepetition    float32 = 1.8
+	nbWeightNearDuplicate float32 = 2.6
+	nbThreshold           float32 = 0
+)
+
+// Update scans message for moderation, folds it into hist's rolling spam
+// signals, and returns the (possibly censored) message along with the
+// decision of whether to block it. team is true for messages sent to the
+// player's own team, which are exempt from the frequency/repetition/
+// near-duplicate checks (spamming your own team is the team's problem, not
+// a reason to throttle global chat reputation).
+func (hist *ChatHistory) Update(message string, team bool) (string, ChatDecision) {
 	hist.total++
 	result := moderation.Scan(message)
 	inappropriate := result.Is(moderation.Inappropriate)
@@ -67,6 +114,7 @@ func (hist *ChatHistory) Update(message string) (string, bool) {
 	now := unixMillis()
 	seconds := (now - hist.updated) / 1000
 
+	fade := float32(1)
 	if hist.updated == 0 {
 		hist.updated = now
 	} else if seconds > 0 {
@@ -85,7 +133,7 @@ func (hist *ChatHistory) Update(message string) (string, bool) {
 			fadeRate = 0.99
 		}
 
-		fade := math32.Pow(fadeRate, float32(seconds))
+		fade = math32.Pow(fadeRate, float32(seconds))
 
 		// Fade in equal proportions to not distort inappropriateFraction
 		hist.total *= fade
@@ -94,6 +142,19 @@ func (hist *ChatHistory) Update(message string) (string, bool) {
 		hist.updated = now
 	}
 
+	// Decay the sketch by the same factor as total/inappropriate, so its
+	// counts represent the same "recent history" window rather than
+	// growing unboundedly.
+	for i := range hist.trigramSketch {
+		hist.trigramSketch[i] *= fade
+	}
+
+	messageTrigrams := trigramVector(message)
+	similarity := cosineSimilarity(messageTrigrams, hist.trigramSketch)
+	for i, v := range messageTrigrams {
+		hist.trigramSketch[i] += v / float32(chatHistoryWindow)
+	}
+
 	repetitionThresholdTotal := 3
 	/*
 		if _, ok := repetitionFalsePositives[message]; ok {
@@ -102,11 +163,77 @@ func (hist *ChatHistory) Update(message string) (string, bool) {
 		}
 	*/
 
-	frequencySpam := hist.total >= 10
+	frequencySpam := !team && hist.total >= 10
 	inappropriateSpam := hist.inappropriate > 2 && inappropriateFraction > 0.20
-	repetitionSpam := int(hist.total) > repetitionThresholdTotal && lengthStandardDeviation < 3 && lengthSpecificDeviation < 3
+	repetitionSpam := !team && int(hist.total) > repetitionThresholdTotal && lengthStandardDeviation < 3 && lengthSpecificDeviation < 3
+	nearDuplicateSpam := !team && int(hist.total) > 1 && similarity > 0.9
+
+	score := nbBias
+	reasons := make([]string, 0, 3)
+	if inappropriateSpam {
+		score += nbWeightInappropriate
+		reasons = append(reasons, "inappropriate")
+	}
+	if frequencySpam {
+		score += nbWeightFrequency
+		reasons = append(reasons, "frequency")
+	}
+	if repetitionSpam {
+		score += nbWeightRepetition
+		reasons = append(reasons, "repetition")
+	}
+	if nearDuplicateSpam {
+		score += nbWeightNearDuplicate
+		reasons = append(reasons, "near-duplicate")
+	}
+
+	block := (inappropriate && censorAmount > 4) || severelyInappropriate
+	if block {
+		reasons = append([]string{"censored"}, reasons...)
+	}
+	if !block && score > nbThreshold {
+		block = true
+	}
+
+	return message, ChatDecision{Block: block, Reasons: reasons, Score: score}
+}
+
+// trigramVector hashes every overlapping 3-byte window of message into
+// trigramSketchSize buckets, so messages can be compared by shape without
+// storing their full text.
+func trigramVector(message string) [trigramSketchSize]float32 {
+	var v [trigramSketchSize]float32
+	if len(message) < 3 {
+		return v
+	}
+	for i := 0; i+3 <= len(message); i++ {
+		v[trigramHash(message[i:i+3])]++
+	}
+	return v
+}
 
-	block := (inappropriate && censorAmount > 4) || severelyInappropriate || (frequencySpam || inappropriateSpam || repetitionSpam)
+// trigramHash is a small FNV-1a style hash of a 3-byte trigram into
+// [0, trigramSketchSize).
+func trigramHash(trigram string) uint32 {
+	var h uint32 = 2166136261
+	for i := 0; i < len(trigram); i++ {
+		h ^= uint32(trigram[i])
+		h *= 16777619
+	}
+	return h % trigramSketchSize
+}
 
-	return message, !block
+// cosineSimilarity returns the cosine similarity of a and b, or 0 if
+// either is a zero vector (no trigrams/history yet).
+func cosineSimilarity(a, b [trigramSketchSize]float32) float32 {
+	var dot, normA, normB float32
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math32.Sqrt(normA) * math32.Sqrt(normB))
 }
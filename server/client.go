@@ -3,6 +3,8 @@
 
 package server
 
+import "net"
+
 type (
 	// Client is an actor on the Hub.
 	Client interface {
@@ -23,6 +25,19 @@ type (
 		// Is this a bot or real player?
 		Bot() bool
 
+		// WantsSystemMessages reports whether updateClient should bother
+		// matching this client against Hub.Broadcast's buffered filtered
+		// Chats (see system_chat.go). False for clients with nothing
+		// rendering them (BotClient, ReplayClient), sparing them the
+		// per-broadcast filter-function call every tick.
+		WantsSystemMessages() bool
+
+		// IP is the client's remote address, or nil for a BotClient or a
+		// SocketClient that connected without TrustedProxies configured (see
+		// Hub.clientIP). Used by the admin console (see admin.go) to kick/ban
+		// by IP.
+		IP() net.IP
+
 		// Data allows the Client to be added to a double-linked list.
 		Data() *ClientData
 	}
@@ -33,6 +48,26 @@ type (
 		Hub      *Hub
 		Previous Client
 		Next     Client
+		// Stats is only meaningfully populated by SocketClient (see
+		// SocketClient.sendLossy/writeOne), but lives here rather than
+		// behind a type assertion so a future consumer (e.g. something
+		// rate-adapting per-client terrain/update detail under sustained
+		// backpressure) can read it off any Client uniformly.
+		Stats ClientStats
+	}
+
+	// ClientStats is SocketClient's backpressure telemetry for one
+	// connection; see Priority.
+	ClientStats struct {
+		Dropped     int64 // PriorityReliable sends that hit their deadline
+		Coalesced   int64 // PriorityLossy sends that replaced an already-queued one
+		WriteMicros int64 // most recent writePump frame's Encode+Write latency
+		// BytesBeforeCompress/BytesAfterCompress are only populated when the
+		// negotiated Codec is a snappyCodec (see snappy_codec.go); both stay
+		// zero for jsonCodec/binaryCodec connections. Compare them to judge
+		// whether Snappy's CPU cost is paying for itself on a given client.
+		BytesBeforeCompress int64
+		BytesAfterCompress  int64
 	}
 
 	// ClientList is a doubly-linked list of Clients.
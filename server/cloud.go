@@ -4,7 +4,10 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"net"
 	"time"
 )
 
@@ -18,7 +21,42 @@ type Cloud interface {
 	IncrementPlaysStatistic()
 	FlushStatistics() error
 	UpdateLeaderboard(playerScores map[string]int) error
-	UploadTerrainSnapshot(data []byte) error // takes an encoded PNG
+	// UploadTerrainKeyframe takes an encoded PNG of the full terrain, to be
+	// used as the base that subsequent UploadTerrainDelta calls build on.
+	UploadTerrainKeyframe(version uint64, data []byte) error
+	// UploadTerrainDelta takes the encoded data of a single changed terrain
+	// tile (see compressed.Terrain.EncodeTile) along with the keyframe
+	// version it is relative to, so viewers can apply it without a full
+	// re-upload.
+	UploadTerrainDelta(tileID uint32, data []byte, baseVersion uint64) error
+	// PruneTerrainSnapshots discards every stored keyframe/delta needed to
+	// reconstruct frames older than the most recent keep keyframes, so a
+	// rolling terrain history (see Hub.SnapshotTerrain) doesn't grow
+	// storage without bound. keep <= 0 is a no-op.
+	PruneTerrainSnapshots(keep int) error
+	// AuditAdminCommand records one admin/observer console command (see
+	// admin.go) so multi-server deployments can correlate moderator actions
+	// across nodes instead of only the one a moderator happened to be on.
+	// Called at most once per command, already rate-limited by the caller.
+	AuditAdminCommand(ip string, moderator world.PlayerID, command string, ok bool) error
+	// UploadWorldSnapshot persists data (see world.WriteSnapshot) as the
+	// latest world snapshot, overwriting any previous one, so
+	// DownloadWorldSnapshot can hand it back to a freshly started server
+	// (see Hub.SaveWorldSnapshot/LoadWorldSnapshot).
+	UploadWorldSnapshot(data []byte) error
+	// DownloadWorldSnapshot returns the bytes UploadWorldSnapshot last
+	// stored, or (nil, nil) if there isn't one yet (e.g. a server's first
+	// ever start).
+	DownloadWorldSnapshot() ([]byte, error)
+	// RecordPlayerLocation notes ip as playerID's current connection origin,
+	// for a Cloud that aggregates player origins geographically (see
+	// cloud.Cloud.RecordPlayerLocation, a GeoIP-backed implementation). A
+	// Cloud that doesn't track this may treat it as a no-op.
+	RecordPlayerLocation(playerID world.PlayerID, ip net.IP)
+	// ForgetPlayerLocation drops the entry RecordPlayerLocation recorded for
+	// playerID, e.g. once its Client disconnects, so an aggregated summary
+	// only ever reflects currently connected players.
+	ForgetPlayerLocation(playerID world.PlayerID)
 	UpdatePeriod() time.Duration
 }
 
@@ -44,10 +82,34 @@ func (offline Offline) UpdateLeaderboard(playerScores map[string]int) error {
 	return nil
 }
 
-func (offline Offline) UploadTerrainSnapshot(data []byte) error {
+func (offline Offline) UploadTerrainKeyframe(version uint64, data []byte) error {
 	return nil
 }
 
+func (offline Offline) UploadTerrainDelta(tileID uint32, data []byte, baseVersion uint64) error {
+	return nil
+}
+
+func (offline Offline) PruneTerrainSnapshots(keep int) error {
+	return nil
+}
+
+func (offline Offline) AuditAdminCommand(ip string, moderator world.PlayerID, command string, ok bool) error {
+	return nil
+}
+
+func (offline Offline) UploadWorldSnapshot(data []byte) error {
+	return nil
+}
+
+func (offline Offline) DownloadWorldSnapshot() ([]byte, error) {
+	return nil, nil
+}
+
+func (offline Offline) RecordPlayerLocation(playerID world.PlayerID, ip net.IP) {}
+
+func (offline Offline) ForgetPlayerLocation(playerID world.PlayerID) {}
+
 func (offline Offline) UpdatePeriod() time.Duration {
 	return time.Hour
 }
@@ -4,20 +4,27 @@
 package cloud
 
 import (
+	"bytes"
 	"encoding/json" // oof
 	"errors"
 	"mk48/server/cloud/db"
 	"mk48/server/cloud/dns"
 	"mk48/server/cloud/fs"
+	"mk48/server/world"
 	"net"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const UpdatePeriod = 30 * time.Second
 
+// worldSnapshotFilename is the fixed (not cache-busted) key the world
+// snapshot is stored under, mirroring leaderboard.json.
+const worldSnapshotFilename = "world_snapshot.bin"
+
 // A nil cloud is valid to use with any methods (acts as a no-op)
 // This just means server is in offline mode
 type Cloud struct {
@@ -27,6 +34,10 @@ type Cloud struct {
 	database   db.Database
 	dns        dns.DNS
 	fs         fs.Filesystem
+	geoIP      *geoIP
+
+	locationsMu     sync.Mutex
+	playerCountries map[world.PlayerID]string
 }
 
 func (cloud *Cloud) String() string {
@@ -47,29 +58,72 @@ func (cloud *Cloud) String() string {
 
 // Returns nil cloud on error
 func New() (*Cloud, error) {
-	cloud := &Cloud{}
+	cloud := &Cloud{playerCountries: make(map[world.PlayerID]string)}
 
 	userData, err := loadUserData()
 	if err != nil {
 		return nil, err
 	}
 
-	cloud.region = userData.Region
-
 	cloud.ip, err = getPublicIP()
 	if err != nil {
 		return nil, err
 	}
+
+	// A missing GeoIPPath just means no region auto-selection and
+	// RecordPlayerLocation becomes a no-op, not an error.
+	if userData.GeoIPPath != "" {
+		cloud.geoIP, err = openGeoIP(userData.GeoIPPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cloud.region = userData.Region
+	if cloud.region == "" {
+		cloud.region = cloud.geoIP.closestRegion(cloud.ip)
+	}
+
 	session, err := getAWSSession(cloud.region)
 	if err != nil {
 		return nil, err
 	}
 
-	cloud.database, err = db.NewDynamoDBDatabase(session, userData.Stage)
+	// Cloud.New always goes through the AWS userData path below, since it's
+	// inherently tied to session/cloud.ip/cloud.dns/cloud.fs, all of which
+	// need AWS regardless of db backend. A self-hoster who wants a
+	// Database without any of that - no EC2 instance, no userData at all -
+	// should call db.OpenFromEnv directly instead of Cloud.New.
+	backend := userData.Backend
+	if backend == "" {
+		backend = "dynamodb"
+	}
+	cloud.database, err = db.Open(backend, db.Config{
+		Stage:   userData.Stage,
+		Session: session,
+		DSN:     userData.DatabaseDSN,
+		Dir:     userData.DatabaseDir,
+	})
 	if err != nil {
 		return nil, err
 	}
-	cloud.dns, err = dns.NewRoute53DNS(session, userData.Domain, userData.Route53ZoneID)
+	dnsBackend := userData.DNSBackend
+	if dnsBackend == "" {
+		dnsBackend = "route53"
+	}
+	// ZoneID means different things per backend: a Route53 hosted zone ID
+	// for "route53", a Cloudflare zone ID for "cloudflare" (see dns.Config).
+	zoneID := userData.Route53ZoneID
+	if dnsBackend == "cloudflare" {
+		zoneID = userData.CloudflareZoneID
+	}
+	cloud.dns, err = dns.Open(dnsBackend, dns.Config{
+		Domain:   userData.Domain,
+		Session:  session,
+		ZoneID:   zoneID,
+		APIToken: userData.CloudflareAPIToken,
+		Path:     userData.StaticDNSPath,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +184,7 @@ func (cloud *Cloud) UpdateServer(players int) error {
 	if cloud == nil {
 		return nil
 	}
+	cloud.emitPlayerLocations()
 	return cloud.database.UpdateServer(db.Server{
 		Region:  cloud.region,
 		Slot:    cloud.serverSlot,
@@ -139,6 +194,78 @@ func (cloud *Cloud) UpdateServer(players int) error {
 	})
 }
 
+// UploadWorldSnapshot stores data (see world.WriteSnapshot) as the latest
+// world snapshot, overwriting any previous one.
+func (cloud *Cloud) UploadWorldSnapshot(data []byte) error {
+	if cloud == nil {
+		return nil
+	}
+	_, err := cloud.fs.UploadStaticFile(worldSnapshotFilename, 0, bytes.NewReader(data), false)
+	return err
+}
+
+// DownloadWorldSnapshot returns the bytes UploadWorldSnapshot last stored,
+// or (nil, nil) if there isn't one yet.
+func (cloud *Cloud) DownloadWorldSnapshot() ([]byte, error) {
+	if cloud == nil {
+		return nil, nil
+	}
+	data, err := cloud.fs.DownloadStaticFile(worldSnapshotFilename)
+	if err != nil {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// RecordPlayerLocation notes playerID's country, resolved from ip via
+// GeoIP, for the next emitPlayerLocations. A nil cloud.geoIP (no
+// GeoIPPath configured) makes this a no-op.
+func (cloud *Cloud) RecordPlayerLocation(playerID world.PlayerID, ip net.IP) {
+	if cloud == nil || cloud.geoIP == nil {
+		return
+	}
+	country := cloud.geoIP.country(ip)
+	if country == "" {
+		return
+	}
+
+	cloud.locationsMu.Lock()
+	cloud.playerCountries[playerID] = country
+	cloud.locationsMu.Unlock()
+}
+
+// ForgetPlayerLocation drops the country RecordPlayerLocation recorded for
+// playerID, so the next emitPlayerLocations no longer counts it.
+func (cloud *Cloud) ForgetPlayerLocation(playerID world.PlayerID) {
+	if cloud == nil {
+		return
+	}
+	cloud.locationsMu.Lock()
+	delete(cloud.playerCountries, playerID)
+	cloud.locationsMu.Unlock()
+}
+
+// emitPlayerLocations aggregates playerCountries into per-country counts
+// and uploads them as players_by_country.json, mirroring how
+// UpdateLeaderboard uploads leaderboard.json.
+func (cloud *Cloud) emitPlayerLocations() {
+	if cloud.geoIP == nil {
+		return
+	}
+
+	cloud.locationsMu.Lock()
+	counts := make(map[string]int, len(cloud.playerCountries))
+	for _, country := range cloud.playerCountries {
+		counts[country]++
+	}
+	cloud.locationsMu.Unlock()
+
+	countsJSON, err := json.Marshal(counts)
+	if err == nil {
+		_, _ = cloud.fs.UploadStaticFile("players_by_country.json", 10, bytes.NewReader(countsJSON), false)
+	}
+}
+
 func (cloud *Cloud) UpdateLeaderboard(playerScores map[string]int) (err error) {
 	if cloud == nil {
 		return nil
@@ -228,7 +355,8 @@ func (cloud *Cloud) UpdateLeaderboard(playerScores map[string]int) (err error) {
 
 	leaderboardJSON, err := json.Marshal(leaderboard)
 	if err == nil {
-		_ = cloud.fs.UploadStaticFile("leaderboard.json", 10, leaderboardJSON)
+		// Not cache-busted: clients always fetch "leaderboard.json" by name.
+		_, _ = cloud.fs.UploadStaticFile("leaderboard.json", 10, bytes.NewReader(leaderboardJSON), false)
 	}
 	return
 }
@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package db
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// maxCentroids bounds how many centroids a Distribution keeps - the cap
+// that triggers compact, and what Bytes sizes its buffer for (100 * 6 bytes
+// per centroid = ~600 bytes).
+const maxCentroids = 100
+
+// tdigestDelta controls how tightly centroids are packed near the tails
+// relative to the middle (see scaleBound) - smaller means more centroids
+// spent on resolving p99-style queries precisely.
+const tdigestDelta = 0.01
+
+// centroid is one (mean, weight) pair of a Distribution.
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// Distribution is a compact, mergeable summary of a stream of float64
+// samples (player scores, session lengths, ...) backed by a t-digest: a
+// small, sorted set of centroids, weighted to stay precise near the tails
+// (where p95/p99 queries care most) at the cost of precision in the middle.
+// Statistic stores one Distribution per metric per hour bucket, serialized
+// via Bytes/DistributionFromBytes since DynamoDB has no native type for it.
+type Distribution struct {
+	centroids []centroid // sorted by mean
+	count     float64    // sum of every centroid's weight
+}
+
+// Add folds one more sample into the digest.
+func (d *Distribution) Add(v float64) {
+	d.addWeighted(v, 1)
+}
+
+// Merge folds every sample summarized by other into d, as if every sample
+// that went into other had gone into d directly - the point of a t-digest
+// being mergeable: per-worker digests can each Add independently, then get
+// combined into one hourly Statistic with Merge.
+func (d *Distribution) Merge(other Distribution) {
+	for _, c := range other.centroids {
+		d.addWeighted(c.mean, c.weight)
+	}
+}
+
+// Quantile returns an estimate of the value at quantile q (0 <= q <= 1),
+// e.g. Quantile(0.5) for the median, Quantile(0.99) for p99. Returns 0 if
+// the digest has no samples.
+func (d *Distribution) Quantile(q float64) float64 {
+	if len(d.centroids) == 0 || d.count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return d.centroids[0].mean
+	}
+	if q >= 1 {
+		return d.centroids[len(d.centroids)-1].mean
+	}
+
+	target := q * d.count
+	var cumulative float64
+	for i, c := range d.centroids {
+		next := cumulative + c.weight
+		if target <= next || i == len(d.centroids)-1 {
+			// Linearly interpolate within this centroid's weight span.
+			if c.weight <= 0 {
+				return c.mean
+			}
+			frac := (target - cumulative) / c.weight
+			if i+1 < len(d.centroids) {
+				return c.mean + frac*(d.centroids[i+1].mean-c.mean)
+			}
+			return c.mean
+		}
+		cumulative = next
+	}
+	return d.centroids[len(d.centroids)-1].mean
+}
+
+// addWeighted folds one sample of the given weight into the digest,
+// merging into the nearest centroid if that stays under its quantile's
+// scale-function bound, otherwise inserting a new centroid.
+func (d *Distribution) addWeighted(v, weight float64) {
+	if idx, ok := d.nearestMergeable(v, weight); ok {
+		c := &d.centroids[idx]
+		c.mean += weight / (c.weight + weight) * (v - c.mean)
+		c.weight += weight
+	} else {
+		d.insert(centroid{mean: v, weight: weight})
+	}
+	d.count += weight
+
+	if len(d.centroids) > maxCentroids {
+		d.compact()
+	}
+}
+
+// nearestMergeable finds the centroid closest to v that can absorb
+// `weight` more without exceeding its quantile's scale-function bound.
+func (d *Distribution) nearestMergeable(v, weight float64) (index int, ok bool) {
+	if len(d.centroids) == 0 {
+		return 0, false
+	}
+
+	i := sort.Search(len(d.centroids), func(i int) bool { return d.centroids[i].mean >= v })
+
+	candidates := make([]int, 0, 2)
+	if i < len(d.centroids) {
+		candidates = append(candidates, i)
+	}
+	if i > 0 {
+		candidates = append(candidates, i-1)
+	}
+
+	best := -1
+	bestDist := math.MaxFloat64
+	for _, ci := range candidates {
+		dist := math.Abs(d.centroids[ci].mean - v)
+		if dist < bestDist && d.canAbsorb(ci, weight) {
+			best, bestDist = ci, dist
+		}
+	}
+	if best == -1 {
+		return 0, false
+	}
+
+	return best, true
+}
+
+// canAbsorb reports whether the centroid at index idx can take on `extra`
+// more weight without exceeding the scale-function weight budget for its
+// estimated quantile position.
+func (d *Distribution) canAbsorb(idx int, extra float64) bool {
+	var before float64
+	for i := 0; i < idx; i++ {
+		before += d.centroids[i].weight
+	}
+	mid := before + d.centroids[idx].weight/2
+	q := mid / d.count
+	return d.centroids[idx].weight+extra <= d.maxWeight(q)
+}
+
+// maxWeight approximates the t-digest scale function's per-centroid weight
+// budget at estimated quantile q: k(q) = δ/(2π)·asin(2q-1) controls how
+// quantile-space is subdivided, so the weight budget - its inverse in
+// weight-space - is cheaply approximated here as a cosine bump peaking at
+// the median and tightening toward both tails, rather than inverting k
+// exactly.
+func (d *Distribution) maxWeight(q float64) float64 {
+	shape := math.Cos(math.Pi * (2*q - 1) / 2)
+	if shape < 0.02 {
+		shape = 0.02
+	}
+	budget := d.count * tdigestDelta * shape
+	if budget < 1 {
+		budget = 1
+	}
+	return budget
+}
+
+// insert adds a brand new centroid, keeping centroids sorted by mean.
+func (d *Distribution) insert(c centroid) {
+	i := sort.Search(len(d.centroids), func(i int) bool { return d.centroids[i].mean >= c.mean })
+	d.centroids = append(d.centroids, centroid{})
+	copy(d.centroids[i+1:], d.centroids[i:])
+	d.centroids[i] = c
+}
+
+// compact sweeps centroids left to right, merging adjacent pairs that fit
+// under their combined scale-function bound, until the digest is back
+// under maxCentroids (or no more adjacent pair can be merged).
+func (d *Distribution) compact() {
+	for len(d.centroids) > maxCentroids {
+		merged := false
+		out := d.centroids[:0]
+		var before float64
+
+		i := 0
+		for i < len(d.centroids) {
+			c := d.centroids[i]
+			if i+1 < len(d.centroids) {
+				next := d.centroids[i+1]
+				mid := before + (c.weight+next.weight)/2
+				q := mid / d.count
+				if c.weight+next.weight <= d.maxWeight(q) {
+					combined := centroid{
+						mean:   (c.mean*c.weight + next.mean*next.weight) / (c.weight + next.weight),
+						weight: c.weight + next.weight,
+					}
+					out = append(out, combined)
+					before += combined.weight
+					i += 2
+					merged = true
+					continue
+				}
+			}
+			out = append(out, c)
+			before += c.weight
+			i++
+		}
+		d.centroids = out
+
+		if !merged {
+			break
+		}
+	}
+}
+
+// Bytes serializes the digest as alternating float32 mean + uint16 weight
+// fields (6 bytes per centroid, ~600 bytes for a full 100-centroid
+// digest) - compact enough to store directly as a DynamoDB binary
+// attribute. Weight is rounded to the nearest uint16, which is lossy only
+// for a single centroid absorbing more than 65535 samples (Quantile still
+// degrades gracefully, just slightly less precisely, in that case).
+func (d *Distribution) Bytes() []byte {
+	out := make([]byte, len(d.centroids)*6)
+	for i, c := range d.centroids {
+		binary.LittleEndian.PutUint32(out[i*6:], math.Float32bits(float32(c.mean)))
+		weight := c.weight
+		if weight > math.MaxUint16 {
+			weight = math.MaxUint16
+		}
+		binary.LittleEndian.PutUint16(out[i*6+4:], uint16(weight))
+	}
+	return out
+}
+
+// DistributionFromBytes decodes a Distribution previously serialized with
+// Bytes.
+func DistributionFromBytes(data []byte) Distribution {
+	var d Distribution
+	n := len(data) / 6
+	d.centroids = make([]centroid, 0, n)
+	for i := 0; i < n; i++ {
+		mean := float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*6:])))
+		weight := float64(binary.LittleEndian.Uint16(data[i*6+4:]))
+		d.centroids = append(d.centroids, centroid{mean: mean, weight: weight})
+		d.count += weight
+	}
+	return d
+}
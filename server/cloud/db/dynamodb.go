@@ -9,11 +9,18 @@ import (
 	"github.com/guregu/dynamo"
 )
 
+func init() {
+	Register("dynamodb", func(cfg Config) (Database, error) {
+		return NewDynamoDBDatabase(cfg.Session, cfg.Stage)
+	})
+}
+
 type DynamoDBDatabase struct {
-	svc          *dynamodb.DynamoDB
-	db           *dynamo.DB
-	scoresTable  dynamo.Table
-	serversTable dynamo.Table
+	svc             *dynamodb.DynamoDB
+	db              *dynamo.DB
+	scoresTable     dynamo.Table
+	serversTable    dynamo.Table
+	statisticsTable dynamo.Table
 }
 
 func NewDynamoDBDatabase(session *session.Session, stage string) (*DynamoDBDatabase, error) {
@@ -21,6 +28,7 @@ func NewDynamoDBDatabase(session *session.Session, stage string) (*DynamoDBDatab
 	ddb.db = dynamo.NewFromIface(ddb.svc)
 	ddb.scoresTable = ddb.db.Table("mk48-" + stage + "-scores")
 	ddb.serversTable = ddb.db.Table("mk48-" + stage + "-servers")
+	ddb.statisticsTable = ddb.db.Table("mk48-" + stage + "-statistics")
 	return ddb, nil
 }
 
@@ -105,3 +113,24 @@ func (ddb *DynamoDBDatabase) ReadServersByRegion(region string) (servers []Serve
 	// Unreachable
 	return
 }
+
+func (ddb *DynamoDBDatabase) UpdateStatistic(stat Statistic) error {
+	return ddb.statisticsTable.Put(stat).Run()
+}
+
+func (ddb *DynamoDBDatabase) ReadStatisticsByRegion(region string, from, to int64) (stats []Statistic, err error) {
+	query := ddb.statisticsTable.Get("region", region).Range("timestamp", dynamo.Between, from, to).Iter()
+
+	for {
+		var stat Statistic
+		ok := query.Next(&stat)
+		if !ok {
+			err = query.Err()
+			return
+		}
+		stats = append(stats, stat)
+	}
+
+	// Unreachable
+	return
+}
@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("embedded", func(cfg Config) (Database, error) {
+		return NewEmbeddedDatabase(cfg.Dir, cfg.Stage)
+	})
+}
+
+// sweepInterval is how often EmbeddedDatabase discards rows past their TTL,
+// standing in for the native expiry DynamoDB's "ttl" attribute gives the
+// production backend for free.
+const sweepInterval = time.Minute
+
+// embeddedState is the entirety of an EmbeddedDatabase's data, gob-encoded
+// to/from disk so a self-hosted deployment keeps its leaderboard and server
+// registry across restarts without running a real database.
+type embeddedState struct {
+	Scores     map[string]Score  // keyed by scoreKey(type, name)
+	Servers    map[string]Server // keyed by serverKey(region, slot)
+	Statistics []Statistic
+}
+
+// EmbeddedDatabase is a Database backed by an in-memory copy of
+// embeddedState, persisted to a single gob file under its directory - for
+// self-hosters who want a working leaderboard/server registry without
+// standing up DynamoDB or PostgreSQL. It has no real concurrency control
+// beyond its own mutex and isn't meant for a multi-process deployment (see
+// PostgresDatabase for that).
+type EmbeddedDatabase struct {
+	path string
+
+	mu    sync.Mutex
+	state embeddedState
+}
+
+// NewEmbeddedDatabase opens (or creates) the embedded store for stage under
+// dir, and starts its TTL sweeper.
+func NewEmbeddedDatabase(dir, stage string) (*EmbeddedDatabase, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	edb := &EmbeddedDatabase{
+		path: filepath.Join(dir, "mk48-"+stage+".gob"),
+		state: embeddedState{
+			Scores:  make(map[string]Score),
+			Servers: make(map[string]Server),
+		},
+	}
+
+	if body, err := ioutil.ReadFile(edb.path); err == nil {
+		if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&edb.state); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	go edb.sweepLoop()
+
+	return edb, nil
+}
+
+func scoreKey(scoreType, name string) string {
+	return scoreType + "\x00" + name
+}
+
+func serverKey(region string, slot int) string {
+	return region + "\x00" + strconv.Itoa(slot)
+}
+
+// sweepLoop discards scores/servers past their TTL every sweepInterval,
+// standing in for DynamoDB's native "ttl" attribute expiry (see Score.TTL,
+// Server.TTL).
+func (edb *EmbeddedDatabase) sweepLoop() {
+	for range time.Tick(sweepInterval) {
+		edb.sweep()
+	}
+}
+
+func (edb *EmbeddedDatabase) sweep() {
+	now := time.Now().Unix()
+
+	edb.mu.Lock()
+	dirty := false
+	for key, score := range edb.state.Scores {
+		if score.TTL != 0 && score.TTL < now {
+			delete(edb.state.Scores, key)
+			dirty = true
+		}
+	}
+	for key, server := range edb.state.Servers {
+		if server.TTL != 0 && server.TTL < now {
+			delete(edb.state.Servers, key)
+			dirty = true
+		}
+	}
+	edb.mu.Unlock()
+
+	if dirty {
+		_ = edb.persist()
+	}
+}
+
+// persist gob-encodes edb.state and writes it to edb.path. It takes
+// edb.mu itself, so callers (the mutators below, and sweep) must not
+// already be holding it - encoding the whole store on every write is
+// simple and correct at the scale this backend targets (a single
+// self-hosted instance), not something worth a write-ahead log for.
+func (edb *EmbeddedDatabase) persist() error {
+	edb.mu.Lock()
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(edb.state)
+	edb.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(edb.path, buf.Bytes(), 0644)
+}
+
+func (edb *EmbeddedDatabase) UpdateScore(score Score) error {
+	edb.mu.Lock()
+	key := scoreKey(score.Type, score.Name)
+	if existing, ok := edb.state.Scores[key]; !ok || score.Score > existing.Score {
+		edb.state.Scores[key] = score
+	}
+	edb.mu.Unlock()
+	return edb.persist()
+}
+
+func (edb *EmbeddedDatabase) ReadScores() ([]Score, error) {
+	edb.mu.Lock()
+	defer edb.mu.Unlock()
+	scores := make([]Score, 0, len(edb.state.Scores))
+	for _, score := range edb.state.Scores {
+		scores = append(scores, score)
+	}
+	return scores, nil
+}
+
+func (edb *EmbeddedDatabase) ReadScoresByType(scoreType string) ([]Score, error) {
+	all, err := edb.ReadScores()
+	if err != nil {
+		return nil, err
+	}
+	scores := all[:0]
+	for _, score := range all {
+		if score.Type == scoreType {
+			scores = append(scores, score)
+		}
+	}
+	return scores, nil
+}
+
+func (edb *EmbeddedDatabase) UpdateServer(server Server) error {
+	edb.mu.Lock()
+	edb.state.Servers[serverKey(server.Region, server.Slot)] = server
+	edb.mu.Unlock()
+	return edb.persist()
+}
+
+func (edb *EmbeddedDatabase) ReadServers() ([]Server, error) {
+	edb.mu.Lock()
+	defer edb.mu.Unlock()
+	servers := make([]Server, 0, len(edb.state.Servers))
+	for _, server := range edb.state.Servers {
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+func (edb *EmbeddedDatabase) ReadServersByRegion(region string) ([]Server, error) {
+	all, err := edb.ReadServers()
+	if err != nil {
+		return nil, err
+	}
+	servers := all[:0]
+	for _, server := range all {
+		if server.Region == region {
+			servers = append(servers, server)
+		}
+	}
+	return servers, nil
+}
+
+func (edb *EmbeddedDatabase) UpdateStatistic(stat Statistic) error {
+	edb.mu.Lock()
+	edb.state.Statistics = append(edb.state.Statistics, stat)
+	edb.mu.Unlock()
+	return edb.persist()
+}
+
+func (edb *EmbeddedDatabase) ReadStatisticsByRegion(region string, from, to int64) ([]Statistic, error) {
+	edb.mu.Lock()
+	defer edb.mu.Unlock()
+	var stats []Statistic
+	for _, stat := range edb.state.Statistics {
+		if stat.Region == region && stat.Timestamp >= from && stat.Timestamp < to {
+			stats = append(stats, stat)
+		}
+	}
+	return stats, nil
+}
+
+var _ Database = (*EmbeddedDatabase)(nil)
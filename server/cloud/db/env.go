@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package db
+
+import "os"
+
+// OpenFromEnv is an alternative to going through Cloud.New's AWS-only
+// userData.Backend path (see cloud.go): it selects and opens a Database
+// purely from environment variables, so a self-hoster can run any
+// registered backend - "postgres", "etcd", "embedded", or "dynamodb" -
+// without an EC2 instance or its user-data metadata service involved at
+// all. Stage still namespaces storage the same way Config.Stage always
+// has; it just comes from DB_STAGE instead of the AWS-specific userData.
+//
+//   DB_KIND    backend name (see Register); defaults to "embedded" since
+//              OpenFromEnv's whole point is working with nothing else set up
+//   DB_DSN     connection string (Config.DSN) - used by "postgres", "etcd"
+//   DB_DIR     storage directory (Config.Dir) - used by "embedded"
+//   DB_STAGE   deployment name (Config.Stage); defaults to "dev"
+func OpenFromEnv() (Database, error) {
+	kind := os.Getenv("DB_KIND")
+	if kind == "" {
+		kind = "embedded"
+	}
+
+	stage := os.Getenv("DB_STAGE")
+	if stage == "" {
+		stage = "dev"
+	}
+
+	dir := os.Getenv("DB_DIR")
+	if dir == "" {
+		dir = "."
+	}
+
+	return Open(kind, Config{
+		Stage: stage,
+		DSN:   os.Getenv("DB_DSN"),
+		Dir:   dir,
+	})
+}
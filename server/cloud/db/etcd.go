@@ -0,0 +1,245 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func init() {
+	Register("etcd", func(cfg Config) (Database, error) {
+		return NewEtcdDatabase(cfg.DSN)
+	})
+}
+
+// etcdRequestTimeout bounds every individual etcd call, so a partitioned
+// cluster fails New/UpdateX/ReadX calls promptly instead of hanging the
+// caller (Cloud.New, or Hub's periodic UpdatePeriod tick - see cloud.go).
+const etcdRequestTimeout = 5 * time.Second
+
+const (
+	etcdScorePrefix     = "mk48/scores/"
+	etcdServerPrefix    = "mk48/servers/"
+	etcdStatisticPrefix = "mk48/statistics/"
+)
+
+// EtcdDatabase is a Database backed by etcd v3, for self-hosters who'd
+// rather run one small etcd node than stand up DynamoDB or Postgres. It's
+// scoped to lean on what etcd is actually good at: the servers table is a
+// textbook fit (a small set of frequently-refreshed "who's alive" rows
+// queried by region prefix) for prefixed keys plus a lease, so
+// UpdateServer ties each row to a renewed lease instead of storing TTL as
+// inert data the way the other backends do. Scores and statistics don't
+// share that shape (they're read back by type/time range, not leased
+// liveness), so they're stored as plain JSON-encoded values under their
+// own prefixes and TTL is swept the same way EmbeddedDatabase does it -
+// still correct, just not etcd's strength.
+type EtcdDatabase struct {
+	client *clientv3.Client
+}
+
+// NewEtcdDatabase dials the etcd cluster at endpoints (a comma-separated
+// list, e.g. "localhost:2379" or "etcd-0:2379,etcd-1:2379") and starts the
+// score TTL sweeper.
+func NewEtcdDatabase(endpoints string) (*EtcdDatabase, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   splitDSN(endpoints),
+		DialTimeout: etcdRequestTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	edb := &EtcdDatabase{client: client}
+	go edb.sweepLoop()
+	return edb, nil
+}
+
+func splitDSN(dsn string) []string {
+	var endpoints []string
+	start := 0
+	for i := 0; i <= len(dsn); i++ {
+		if i == len(dsn) || dsn[i] == ',' {
+			if i > start {
+				endpoints = append(endpoints, dsn[start:i])
+			}
+			start = i + 1
+		}
+	}
+	return endpoints
+}
+
+func (edb *EtcdDatabase) sweepLoop() {
+	for range time.Tick(sweepInterval) {
+		now := time.Now().Unix()
+		edb.sweepExpired(etcdScorePrefix, func(ttl int64) bool { return ttl != 0 && ttl < now })
+	}
+}
+
+// sweepExpired deletes every value under prefix whose TTL (as reported by
+// expired) has passed. Servers aren't swept this way - a dead server's
+// lease simply lapses and etcd removes the key itself (see UpdateServer).
+func (edb *EtcdDatabase) sweepExpired(prefix string, expired func(ttl int64) bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := edb.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return
+	}
+	for _, kv := range resp.Kvs {
+		var score Score
+		if json.Unmarshal(kv.Value, &score) == nil && expired(score.TTL) {
+			_, _ = edb.client.Delete(ctx, string(kv.Key))
+		}
+	}
+}
+
+func (edb *EtcdDatabase) UpdateScore(score Score) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	key := etcdScorePrefix + score.Type + "/" + score.Name
+	existing, err := edb.client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(existing.Kvs) > 0 {
+		var prev Score
+		if json.Unmarshal(existing.Kvs[0].Value, &prev) == nil && prev.Score >= score.Score {
+			return nil
+		}
+	}
+
+	value, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+	_, err = edb.client.Put(ctx, key, string(value))
+	return err
+}
+
+func (edb *EtcdDatabase) ReadScores() ([]Score, error) {
+	return edb.readScores(etcdScorePrefix)
+}
+
+func (edb *EtcdDatabase) ReadScoresByType(scoreType string) ([]Score, error) {
+	return edb.readScores(etcdScorePrefix + scoreType + "/")
+}
+
+func (edb *EtcdDatabase) readScores(prefix string) ([]Score, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := edb.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]Score, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var score Score
+		if err := json.Unmarshal(kv.Value, &score); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, nil
+}
+
+// serverLeaseTTL is how long a Server row outlives its last UpdateServer
+// before etcd reclaims the lease and the row disappears on its own -
+// comfortably longer than cloud.UpdatePeriod so a briefly-slow server
+// doesn't get reported as gone.
+const serverLeaseTTL = 90 * time.Second
+
+func (edb *EtcdDatabase) UpdateServer(server Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	lease, err := edb.client.Grant(ctx, int64(serverLeaseTTL.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(server)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s%s/%d", etcdServerPrefix, server.Region, server.Slot)
+	_, err = edb.client.Put(ctx, key, string(value), clientv3.WithLease(lease.ID))
+	return err
+}
+
+func (edb *EtcdDatabase) ReadServers() ([]Server, error) {
+	return edb.readServers(etcdServerPrefix)
+}
+
+func (edb *EtcdDatabase) ReadServersByRegion(region string) ([]Server, error) {
+	return edb.readServers(etcdServerPrefix + region + "/")
+}
+
+func (edb *EtcdDatabase) readServers(prefix string) ([]Server, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := edb.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]Server, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var server Server
+		if err := json.Unmarshal(kv.Value, &server); err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+func (edb *EtcdDatabase) UpdateStatistic(stat Statistic) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	value, err := json.Marshal(stat)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s%s/%d", etcdStatisticPrefix, stat.Region, stat.Timestamp)
+	_, err = edb.client.Put(ctx, key, string(value))
+	return err
+}
+
+func (edb *EtcdDatabase) ReadStatisticsByRegion(region string, from, to int64) ([]Statistic, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := edb.client.Get(ctx, etcdStatisticPrefix+region+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]Statistic, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var stat Statistic
+		if err := json.Unmarshal(kv.Value, &stat); err != nil {
+			return nil, err
+		}
+		if stat.Timestamp >= from && stat.Timestamp < to {
+			stats = append(stats, stat)
+		}
+	}
+	return stats, nil
+}
+
+var _ Database = (*EtcdDatabase)(nil)
@@ -10,4 +10,6 @@ type Database interface {
 	UpdateServer(server Server) error
 	ReadServers() (servers []Server, err error)
 	ReadServersByRegion(region string) (servers []Server, err error)
+	UpdateStatistic(stat Statistic) error
+	ReadStatisticsByRegion(region string, from, to int64) (stats []Statistic, err error)
 }
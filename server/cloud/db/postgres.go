@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package db
+
+import (
+	"database/sql"
+	"net"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func init() {
+	Register("postgres", func(cfg Config) (Database, error) {
+		return NewPostgresDatabase(cfg.DSN)
+	})
+}
+
+// postgresSchema creates the tables PostgresDatabase needs if they don't
+// already exist, so an operator only has to point Config.DSN at an empty
+// database. ttl columns are Unix seconds, 0 meaning "never expires",
+// matching Score.TTL/Server.TTL's DynamoDB convention.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS mk48_scores (
+	type  TEXT NOT NULL,
+	name  TEXT NOT NULL,
+	score INTEGER NOT NULL,
+	ttl   BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (type, name)
+);
+CREATE TABLE IF NOT EXISTS mk48_servers (
+	region  TEXT NOT NULL,
+	slot    INTEGER NOT NULL,
+	ip      TEXT NOT NULL,
+	players INTEGER NOT NULL,
+	ttl     BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (region, slot)
+);
+CREATE TABLE IF NOT EXISTS mk48_statistics (
+	region               TEXT NOT NULL,
+	timestamp            BIGINT NOT NULL,
+	plays                INTEGER NOT NULL,
+	players              INTEGER NOT NULL,
+	new_players          INTEGER NOT NULL,
+	score_distribution   BYTEA,
+	session_distribution BYTEA,
+	PRIMARY KEY (region, timestamp)
+);
+`
+
+// PostgresDatabase is a Database backed by PostgreSQL, for self-hosters who
+// already run Postgres and would rather not stand up DynamoDB. Schema is
+// created lazily by NewPostgresDatabase (see postgresSchema).
+type PostgresDatabase struct {
+	db *sql.DB
+}
+
+// NewPostgresDatabase opens dsn (see github.com/lib/pq for its format),
+// ensures the schema exists, and starts the TTL sweeper.
+func NewPostgresDatabase(dsn string) (*PostgresDatabase, error) {
+	sqlDB, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlDB.Ping(); err != nil {
+		return nil, err
+	}
+	if _, err := sqlDB.Exec(postgresSchema); err != nil {
+		return nil, err
+	}
+
+	pdb := &PostgresDatabase{db: sqlDB}
+	go pdb.sweepLoop()
+	return pdb, nil
+}
+
+func (pdb *PostgresDatabase) sweepLoop() {
+	for range time.Tick(sweepInterval) {
+		now := time.Now().Unix()
+		_, _ = pdb.db.Exec("DELETE FROM mk48_scores WHERE ttl != 0 AND ttl < $1", now)
+		_, _ = pdb.db.Exec("DELETE FROM mk48_servers WHERE ttl != 0 AND ttl < $1", now)
+	}
+}
+
+func (pdb *PostgresDatabase) UpdateScore(score Score) error {
+	_, err := pdb.db.Exec(`
+		INSERT INTO mk48_scores (type, name, score, ttl) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (type, name) DO UPDATE SET score = $3, ttl = $4 WHERE mk48_scores.score < $3`,
+		score.Type, score.Name, score.Score, score.TTL)
+	return err
+}
+
+func (pdb *PostgresDatabase) ReadScores() ([]Score, error) {
+	rows, err := pdb.db.Query(`SELECT type, name, score, ttl FROM mk48_scores`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []Score
+	for rows.Next() {
+		var score Score
+		if err := rows.Scan(&score.Type, &score.Name, &score.Score, &score.TTL); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
+
+func (pdb *PostgresDatabase) ReadScoresByType(scoreType string) ([]Score, error) {
+	rows, err := pdb.db.Query(`SELECT type, name, score, ttl FROM mk48_scores WHERE type = $1`, scoreType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []Score
+	for rows.Next() {
+		var score Score
+		if err := rows.Scan(&score.Type, &score.Name, &score.Score, &score.TTL); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
+
+func (pdb *PostgresDatabase) UpdateServer(server Server) error {
+	_, err := pdb.db.Exec(`
+		INSERT INTO mk48_servers (region, slot, ip, players, ttl) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (region, slot) DO UPDATE SET ip = $3, players = $4, ttl = $5`,
+		server.Region, server.Slot, server.IP.String(), server.Players, server.TTL)
+	return err
+}
+
+func (pdb *PostgresDatabase) ReadServers() ([]Server, error) {
+	return pdb.readServers(`SELECT region, slot, ip, players, ttl FROM mk48_servers`)
+}
+
+func (pdb *PostgresDatabase) ReadServersByRegion(region string) ([]Server, error) {
+	return pdb.readServers(`SELECT region, slot, ip, players, ttl FROM mk48_servers WHERE region = $1`, region)
+}
+
+func (pdb *PostgresDatabase) readServers(query string, args ...interface{}) ([]Server, error) {
+	rows, err := pdb.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var servers []Server
+	for rows.Next() {
+		var server Server
+		var ip string
+		if err := rows.Scan(&server.Region, &server.Slot, &ip, &server.Players, &server.TTL); err != nil {
+			return nil, err
+		}
+		server.IP = net.ParseIP(ip)
+		servers = append(servers, server)
+	}
+	return servers, rows.Err()
+}
+
+func (pdb *PostgresDatabase) UpdateStatistic(stat Statistic) error {
+	_, err := pdb.db.Exec(`
+		INSERT INTO mk48_statistics (region, timestamp, plays, players, new_players, score_distribution, session_distribution)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (region, timestamp) DO UPDATE SET
+			plays = $3, players = $4, new_players = $5, score_distribution = $6, session_distribution = $7`,
+		stat.Region, stat.Timestamp, stat.Plays, stat.Players, stat.NewPlayers, stat.ScoreDistribution, stat.SessionDistribution)
+	return err
+}
+
+func (pdb *PostgresDatabase) ReadStatisticsByRegion(region string, from, to int64) ([]Statistic, error) {
+	rows, err := pdb.db.Query(`
+		SELECT region, timestamp, plays, players, new_players, score_distribution, session_distribution
+		FROM mk48_statistics WHERE region = $1 AND timestamp >= $2 AND timestamp < $3`, region, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []Statistic
+	for rows.Next() {
+		var stat Statistic
+		if err := rows.Scan(&stat.Region, &stat.Timestamp, &stat.Plays, &stat.Players, &stat.NewPlayers,
+			&stat.ScoreDistribution, &stat.SessionDistribution); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+var _ Database = (*PostgresDatabase)(nil)
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Config is everything any registered backend might need to open a
+// Database. A given backend only looks at the fields it cares about (e.g.
+// EmbeddedDatabase ignores Session and DSN entirely), so cloud.New can fill
+// in the whole struct once regardless of which Backend the operator chose.
+type Config struct {
+	// Stage names the deployment (e.g. "prod", "dev"), used by backends
+	// that namespace storage per-stage (DynamoDB table names, the
+	// embedded store's file name).
+	Stage string
+	// Session is an already-authenticated AWS session, required by the
+	// "dynamodb" backend.
+	Session *session.Session
+	// DSN is a backend-specific connection string, required by the
+	// "postgres" backend (see lib/pq for its format).
+	DSN string
+	// Dir is the directory the "embedded" backend persists its data
+	// under.
+	Dir string
+}
+
+// Factory opens a Database from cfg. Registered by a backend's package
+// init (see dynamodb.go, postgres.go, embedded.go) under the name
+// userData.Backend selects in cloud.New.
+type Factory func(cfg Config) (Database, error)
+
+// factories holds every backend registered via Register, keyed by the
+// name cloud.New matches against userData.Backend.
+var factories = make(map[string]Factory)
+
+// Register makes a backend available to Open under name. Meant to be
+// called from a backend's package init, not at runtime - two backends
+// racing to register the same name is a programming error, not something
+// to recover from.
+func Register(name string, factory Factory) {
+	if _, ok := factories[name]; ok {
+		panic("db: backend already registered: " + name)
+	}
+	factories[name] = factory
+}
+
+// Open returns a Database from the backend registered under name (see
+// Register), or an error if no such backend is registered.
+func Open(name string, cfg Config) (Database, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("db: unregistered backend %q", name)
+	}
+	return factory(cfg)
+}
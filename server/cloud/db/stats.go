@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// quantiles are the percentiles StatsHandler reports for each metric.
+var quantiles = []struct {
+	name string
+	q    float64
+}{
+	{"p50", 0.5},
+	{"p90", 0.9},
+	{"p99", 0.99},
+}
+
+// MergeStatistics merges every hourly Statistic's per-metric Distribution
+// across stats into one Distribution per metric, so a date range's worth of
+// hourly buckets can be queried as if they were one digest.
+func MergeStatistics(stats []Statistic) (score, session Distribution) {
+	for _, stat := range stats {
+		if len(stat.ScoreDistribution) > 0 {
+			score.Merge(DistributionFromBytes(stat.ScoreDistribution))
+		}
+		if len(stat.SessionDistribution) > 0 {
+			session.Merge(DistributionFromBytes(stat.SessionDistribution))
+		}
+	}
+	return
+}
+
+// StatsHandler returns an http.HandlerFunc that merges the hourly
+// Statistics for a region and Unix-millis [from, to) range and reports
+// p50/p90/p99 for each distribution-backed metric, reading "region",
+// "from", and "to" from the query string.
+//
+// Not yet wired into any mux - like the rest of this package, Database is
+// never actually instantiated from main.go in this codebase, so there's no
+// existing Hub/main.go seam to plug this into without inventing one out of
+// scope for this request.
+func StatsHandler(database Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		region := r.URL.Query().Get("region")
+
+		from, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		to, err := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+
+		stats, err := database.ReadStatisticsByRegion(region, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		score, session := MergeStatistics(stats)
+
+		result := make(map[string]map[string]float64, 2)
+		result["score"] = quantileMap(&score)
+		result["session"] = quantileMap(&session)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+// quantileMap reports every entry of quantiles for d, keyed by name.
+func quantileMap(d *Distribution) map[string]float64 {
+	out := make(map[string]float64, len(quantiles))
+	for _, entry := range quantiles {
+		out[entry.name] = d.Quantile(entry.q)
+	}
+	return out
+}
@@ -32,4 +32,10 @@ type Statistic struct {
 	Plays      int `dynamo:"plays"`      // i.e. each spawn
 	Players    int `dynamo:"players"`    // i.e. each connection
 	NewPlayers int `dynamo:"newPlayers"` // i.e. each "new" spawn
+
+	// Serialized Distributions (see Distribution.Bytes), one per metric,
+	// so queries like "p95 player score last week" don't require keeping
+	// every raw sample around.
+	ScoreDistribution   []byte `dynamo:"scoreDistribution,omitempty"`
+	SessionDistribution []byte `dynamo:"sessionDistribution,omitempty"`
 }
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+func init() {
+	Register("cloudflare", func(cfg Config) (DNS, error) {
+		return NewCloudflareDNS(cfg.APIToken, cfg.ZoneID, cfg.Domain), nil
+	})
+}
+
+// cloudflareAPI is Cloudflare's API v4 base URL.
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// CloudflareDNS is a DNS backed by the Cloudflare API, an alternative to
+// Route53DNS for operators who host their zone on Cloudflare instead of
+// AWS. Unlike Route53DNS, it has no AWS session dependency - just an API
+// token scoped to Zone.DNS edit on zoneID.
+type CloudflareDNS struct {
+	client   *http.Client
+	apiToken string
+	zoneID   string
+	domain   string
+}
+
+func NewCloudflareDNS(apiToken, zoneID, domain string) *CloudflareDNS {
+	return &CloudflareDNS{client: &http.Client{}, apiToken: apiToken, zoneID: zoneID, domain: domain}
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+type cloudflareResponse struct {
+	Success bool              `json:"success"`
+	Errors  []cloudflareError `json:"errors"`
+	Result  json.RawMessage   `json:"result"`
+}
+
+type cloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (c *CloudflareDNS) recordName(region string, slot int) string {
+	return fmt.Sprintf("ws-%s-%d.%s", region, slot, c.domain)
+}
+
+// do issues method against path (relative to cloudflareAPI), sending body
+// (if non-nil) as JSON and decoding the response's "result" field into out
+// (if non-nil).
+func (c *CloudflareDNS) do(method, path string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, cloudflareAPI+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var parsed cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return err
+	}
+	if !parsed.Success {
+		if len(parsed.Errors) > 0 {
+			return fmt.Errorf("cloudflare: %s (%d)", parsed.Errors[0].Message, parsed.Errors[0].Code)
+		}
+		return fmt.Errorf("cloudflare: request failed with no error detail")
+	}
+	if out != nil && len(parsed.Result) > 0 {
+		return json.Unmarshal(parsed.Result, out)
+	}
+	return nil
+}
+
+// findRecord returns the existing record for name, or nil if there isn't
+// one.
+func (c *CloudflareDNS) findRecord(name string) (*cloudflareRecord, error) {
+	var records []cloudflareRecord
+	path := fmt.Sprintf("/zones/%s/dns_records?name=%s", c.zoneID, name)
+	if err := c.do(http.MethodGet, path, nil, &records); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
+
+// UpdateRoute UPSERTs region/slot's A or AAAA record (chosen by
+// address.To4(), same as Route53DNS) with TTL=60, matching the ticket this
+// exists for. Cloudflare's API has no native upsert, so this looks up any
+// existing record by name first and PUTs over it, or POSTs a new one.
+func (c *CloudflareDNS) UpdateRoute(region string, slot int, address net.IP) error {
+	name := c.recordName(region, slot)
+	record := cloudflareRecord{Type: recordType(address), Name: name, Content: address.String(), TTL: 60}
+
+	existing, err := c.findRecord(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return c.do(http.MethodPost, fmt.Sprintf("/zones/%s/dns_records", c.zoneID), record, nil)
+	}
+	return c.do(http.MethodPut, fmt.Sprintf("/zones/%s/dns_records/%s", c.zoneID, existing.ID), record, nil)
+}
+
+func (c *CloudflareDNS) RemoveRoute(region string, slot int) error {
+	name := c.recordName(region, slot)
+	existing, err := c.findRecord(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil // Already gone.
+	}
+	return c.do(http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", c.zoneID, existing.ID), nil, nil)
+}
+
+func (c *CloudflareDNS) ListRoutes() ([]Route, error) {
+	var records []cloudflareRecord
+	path := fmt.Sprintf("/zones/%s/dns_records?per_page=100", c.zoneID)
+	if err := c.do(http.MethodGet, path, nil, &records); err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	for _, record := range records {
+		region, slot, ok := parseRecordName(record.Name, c.domain)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(record.Content)
+		if ip == nil {
+			continue
+		}
+		routes = append(routes, Route{Region: region, Slot: slot, IP: ip})
+	}
+	return routes, nil
+}
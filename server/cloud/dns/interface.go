@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package dns
+
+import "net"
+
+// Route is one entry returned by ListRoutes: the DNS record a given
+// region/slot currently resolves to.
+type Route struct {
+	Region string
+	Slot   int
+	IP     net.IP
+}
+
+// DNS points ws-<region>-<slot>.<domain> at a server's public IP, so
+// clients can connect without hard-coding IPs (see cloud.New). Address can
+// be either an IPv4 or IPv6 net.IP - implementations pick A vs AAAA based
+// on address.To4() being nil, the same way net.IP itself distinguishes
+// them.
+type DNS interface {
+	UpdateRoute(region string, slot int, address net.IP) error
+	RemoveRoute(region string, slot int) error
+	ListRoutes() ([]Route, error)
+}
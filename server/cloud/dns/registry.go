@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package dns
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Config is everything any registered backend might need to open a DNS. A
+// given backend only looks at the fields it cares about (e.g. StaticDNS
+// ignores Session/APIToken entirely), so cloud.New can fill in the whole
+// struct once regardless of which backend the operator chose - mirroring
+// db.Config.
+type Config struct {
+	// Domain is the zone records are created under, e.g. "mk48.io".
+	Domain string
+	// Session is an already-authenticated AWS session, required by the
+	// "route53" backend.
+	Session *session.Session
+	// ZoneID identifies the zone within the provider: a Route53 hosted
+	// zone ID for "route53", a Cloudflare zone ID for "cloudflare".
+	ZoneID string
+	// APIToken authenticates against the Cloudflare API, required by the
+	// "cloudflare" backend.
+	APIToken string
+	// Path is the file the "static" backend reads/writes its routes from,
+	// for self-hosted deployments without a cloud DNS provider.
+	Path string
+}
+
+// Factory opens a DNS from cfg. Registered by a backend's package init (see
+// route53.go, cloudflare.go, static.go) under the name userData.DNSBackend
+// selects in cloud.New.
+type Factory func(cfg Config) (DNS, error)
+
+// factories holds every backend registered via Register, keyed by the name
+// cloud.New matches against userData.DNSBackend.
+var factories = make(map[string]Factory)
+
+// Register makes a backend available to Open under name. Meant to be
+// called from a backend's package init, not at runtime - two backends
+// racing to register the same name is a programming error, not something
+// to recover from.
+func Register(name string, factory Factory) {
+	if _, ok := factories[name]; ok {
+		panic("dns: backend already registered: " + name)
+	}
+	factories[name] = factory
+}
+
+// Open returns a DNS from the backend registered under name (see Register),
+// or an error if no such backend is registered.
+func Open(name string, cfg Config) (DNS, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("dns: unregistered backend %q", name)
+	}
+	return factory(cfg)
+}
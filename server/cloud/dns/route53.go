@@ -8,12 +8,21 @@ package dns
 
 import (
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
-	"net"
 )
 
+func init() {
+	Register("route53", func(cfg Config) (DNS, error) {
+		return NewRoute53DNS(cfg.Session, cfg.Domain, cfg.ZoneID)
+	})
+}
+
 type Route53DNS struct {
 	svc    *route53.Route53
 	domain string
@@ -29,6 +38,21 @@ func NewRoute53DNS(session *session.Session, domain string, zoneID string) (*Rou
 	return route53DNS, nil
 }
 
+// recordName is the fully-qualified name a given region/slot's record lives
+// under, shared by UpdateRoute/RemoveRoute/ListRoutes.
+func (route53DNS *Route53DNS) recordName(region string, slot int) string {
+	return fmt.Sprintf("ws-%s-%d.%s", region, slot, route53DNS.domain)
+}
+
+// recordType is "A" for an IPv4 address or "AAAA" for IPv6, chosen the same
+// way net.IP itself distinguishes the two.
+func recordType(address net.IP) string {
+	if address.To4() != nil {
+		return "A"
+	}
+	return "AAAA"
+}
+
 func (route53DNS *Route53DNS) UpdateRoute(region string, slot int, address net.IP) error {
 	request := &route53.ChangeResourceRecordSetsInput{
 		ChangeBatch: &route53.ChangeBatch{
@@ -36,8 +60,8 @@ func (route53DNS *Route53DNS) UpdateRoute(region string, slot int, address net.I
 				{
 					Action: aws.String("UPSERT"),
 					ResourceRecordSet: &route53.ResourceRecordSet{
-						Name: aws.String(fmt.Sprintf("ws-%s-%d.%s", region, slot, route53DNS.domain)),
-						Type: aws.String("A"),
+						Name: aws.String(route53DNS.recordName(region, slot)),
+						Type: aws.String(recordType(address)),
 						ResourceRecords: []*route53.ResourceRecord{
 							{
 								Value: aws.String(address.String()),
@@ -53,3 +77,92 @@ func (route53DNS *Route53DNS) UpdateRoute(region string, slot int, address net.I
 	_, err := route53DNS.svc.ChangeResourceRecordSets(request)
 	return err
 }
+
+// RemoveRoute deletes region/slot's record, looking it up first via
+// ListResourceRecordSets since Route53's DELETE action requires the
+// record's exact current value (type, TTL, and ResourceRecords), not just
+// its name.
+func (route53DNS *Route53DNS) RemoveRoute(region string, slot int) error {
+	name := route53DNS.recordName(region, slot)
+
+	resp, err := route53DNS.svc.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(route53DNS.zoneID),
+		StartRecordName: aws.String(name),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.ResourceRecordSets) == 0 || aws.StringValue(resp.ResourceRecordSets[0].Name) != name+"." {
+		return nil // Already gone.
+	}
+
+	_, err = route53DNS.svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action:            aws.String("DELETE"),
+					ResourceRecordSet: resp.ResourceRecordSets[0],
+				},
+			},
+		},
+		HostedZoneId: aws.String(route53DNS.zoneID),
+	})
+	return err
+}
+
+// ListRoutes returns every ws-<region>-<slot>.<domain> record in the zone,
+// parsing region/slot back out of the name UpdateRoute encoded them into.
+func (route53DNS *Route53DNS) ListRoutes() ([]Route, error) {
+	var routes []Route
+
+	input := &route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(route53DNS.zoneID)}
+	for {
+		resp, err := route53DNS.svc.ListResourceRecordSets(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, set := range resp.ResourceRecordSets {
+			region, slot, ok := parseRecordName(aws.StringValue(set.Name), route53DNS.domain)
+			if !ok || len(set.ResourceRecords) == 0 {
+				continue
+			}
+			ip := net.ParseIP(aws.StringValue(set.ResourceRecords[0].Value))
+			if ip == nil {
+				continue
+			}
+			routes = append(routes, Route{Region: region, Slot: slot, IP: ip})
+		}
+
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		input.StartRecordName = resp.NextRecordName
+		input.StartRecordType = resp.NextRecordType
+	}
+
+	return routes, nil
+}
+
+// parseRecordName reverses recordName's "ws-<region>-<slot>.<domain>"
+// format; Route53 returns names with a trailing dot, so that's trimmed
+// first.
+func parseRecordName(name, domain string) (region string, slot int, ok bool) {
+	name = strings.TrimSuffix(name, ".")
+	suffix := "." + domain
+	if !strings.HasPrefix(name, "ws-") || !strings.HasSuffix(name, suffix) {
+		return "", 0, false
+	}
+	middle := strings.TrimSuffix(strings.TrimPrefix(name, "ws-"), suffix)
+
+	dash := strings.LastIndexByte(middle, '-')
+	if dash == -1 {
+		return "", 0, false
+	}
+	slot, err := strconv.Atoi(middle[dash+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return middle[:dash], slot, true
+}
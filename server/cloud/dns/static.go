@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+func init() {
+	Register("static", func(cfg Config) (DNS, error) {
+		return NewStaticDNS(cfg.Path)
+	})
+}
+
+// staticRoute is Route, but with IP as a string - net.IP doesn't round-trip
+// through encoding/json the way Route's other fields do.
+type staticRoute struct {
+	Region string `json:"region"`
+	Slot   int    `json:"slot"`
+	IP     string `json:"ip"`
+}
+
+// StaticDNS is a DNS for self-hosted deployments with no cloud DNS
+// provider: it just writes a JSON file of every region/slot's current IP
+// to Path, for something else (a reverse proxy's config generator, a cron
+// job templating a hosts file, etc.) to consume - there's no actual DNS
+// server behind it, hence "static". Safe for concurrent use; every method
+// reads, modifies, and rewrites the whole file under mu so a racing
+// UpdateRoute/RemoveRoute can't interleave with a ListRoutes and observe a
+// half-written file.
+type StaticDNS struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewStaticDNS(path string) (*StaticDNS, error) {
+	return &StaticDNS{path: path}, nil
+}
+
+func (s *StaticDNS) read() ([]staticRoute, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var routes []staticRoute
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+func (s *StaticDNS) write(routes []staticRoute) error {
+	data, err := json.MarshalIndent(routes, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+func (s *StaticDNS) UpdateRoute(region string, slot int, address net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	entry := staticRoute{Region: region, Slot: slot, IP: address.String()}
+	for i, route := range routes {
+		if route.Region == region && route.Slot == slot {
+			routes[i] = entry
+			return s.write(routes)
+		}
+	}
+	routes = append(routes, entry)
+	return s.write(routes)
+}
+
+func (s *StaticDNS) RemoveRoute(region string, slot int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	for i, route := range routes {
+		if route.Region == region && route.Slot == slot {
+			routes = append(routes[:i], routes[i+1:]...)
+			return s.write(routes)
+		}
+	}
+	return nil // Already gone.
+}
+
+func (s *StaticDNS) ListRoutes() ([]Route, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	staticRoutes, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]Route, 0, len(staticRoutes))
+	for _, route := range staticRoutes {
+		ip := net.ParseIP(route.IP)
+		if ip == nil {
+			return nil, fmt.Errorf("dns: static: invalid IP %q for %s slot %d", route.IP, route.Region, route.Slot)
+		}
+		routes = append(routes, Route{Region: route.Region, Slot: route.Slot, IP: ip})
+	}
+	return routes, nil
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package fs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// CachingFilesystem wraps another Filesystem, remembering the content hash
+// last uploaded under each filename so re-uploading identical content is a
+// no-op - the same dedup S3Filesystem gets from a HEAD+ETag check, but
+// usable in front of any Filesystem (notably LocalFilesystem, which has no
+// such check of its own).
+type CachingFilesystem struct {
+	inner Filesystem
+
+	mutex    sync.Mutex
+	uploaded map[string][md5.Size]byte // filename -> hash of its last-uploaded content
+}
+
+// NewCachingFilesystem wraps inner with an upload cache.
+func NewCachingFilesystem(inner Filesystem) *CachingFilesystem {
+	return &CachingFilesystem{inner: inner, uploaded: make(map[string][md5.Size]byte)}
+}
+
+func (c *CachingFilesystem) UploadStaticFile(filename string, secondsCache int, data io.Reader, cacheBust bool) (string, error) {
+	body, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+	hash := md5.Sum(body)
+
+	c.mutex.Lock()
+	last, ok := c.uploaded[filename]
+	c.mutex.Unlock()
+
+	if ok && last == hash {
+		actualFilename := filename
+		if cacheBust {
+			actualFilename = bustFilename(filename, hash)
+		}
+		return actualFilename, nil
+	}
+
+	actualFilename, err := c.inner.UploadStaticFile(filename, secondsCache, bytes.NewReader(body), cacheBust)
+	if err != nil {
+		return actualFilename, err
+	}
+
+	c.mutex.Lock()
+	c.uploaded[filename] = hash
+	c.mutex.Unlock()
+
+	return actualFilename, nil
+}
+
+func (c *CachingFilesystem) DownloadStaticFile(filename string) ([]byte, error) {
+	return c.inner.DownloadStaticFile(filename)
+}
+
+func (c *CachingFilesystem) DeleteStaticFile(filename string) error {
+	c.mutex.Lock()
+	delete(c.uploaded, filename)
+	c.mutex.Unlock()
+
+	return c.inner.DeleteStaticFile(filename)
+}
+
+func (c *CachingFilesystem) SignedURL(filename string) (string, error) {
+	return c.inner.SignedURL(filename)
+}
+
+var _ Filesystem = (*CachingFilesystem)(nil)
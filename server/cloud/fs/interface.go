@@ -3,6 +3,27 @@
 
 package fs
 
+import "io"
+
+// Filesystem uploads and serves static files, abstracting over where they
+// actually live (S3 in production, local disk for dev/testing, or a
+// CachingFilesystem wrapping either to avoid redundant uploads).
 type Filesystem interface {
-	UploadStaticFile(filename string, secondsCache int, data []byte) error
+	// UploadStaticFile uploads data under filename, instructing clients/CDNs
+	// to cache the response for secondsCache seconds. If cacheBust, the
+	// content's hash is spliced into the returned filename (e.g.
+	// "app.a1b2c3d4.js") so a new version never collides with a cached old
+	// one; callers must link to the returned filename, not the one passed
+	// in. Pass cacheBust false for files meant to be referenced by a fixed
+	// name (e.g. leaderboard.json).
+	UploadStaticFile(filename string, secondsCache int, data io.Reader, cacheBust bool) (actualFilename string, err error)
+	// DownloadStaticFile returns the bytes last uploaded under filename
+	// (its un-cache-busted name). Returns an error if it doesn't exist.
+	DownloadStaticFile(filename string) ([]byte, error)
+	// DeleteStaticFile removes a previously uploaded file. Not an error if
+	// it doesn't exist.
+	DeleteStaticFile(filename string) error
+	// SignedURL returns a time-limited URL for filename, for files not
+	// meant to be public (e.g. private replay downloads).
+	SignedURL(filename string) (string, error)
 }
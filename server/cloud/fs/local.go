@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package fs
+
+import (
+	"crypto/md5"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalFilesystem is a Filesystem backed by a directory on local disk, for
+// dev/testing without needing real AWS credentials.
+type LocalFilesystem struct {
+	root string
+}
+
+// NewLocalFilesystem returns a LocalFilesystem rooted at root, creating it
+// if it doesn't already exist.
+func NewLocalFilesystem(root string) (*LocalFilesystem, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalFilesystem{root: root}, nil
+}
+
+func (l *LocalFilesystem) UploadStaticFile(filename string, secondsCache int, data io.Reader, cacheBust bool) (string, error) {
+	body, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+
+	actualFilename := filename
+	if cacheBust {
+		actualFilename = bustFilename(filename, md5.Sum(body))
+	}
+
+	dest := filepath.Join(l.root, filepath.FromSlash(actualFilename))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	return actualFilename, ioutil.WriteFile(dest, body, 0644)
+}
+
+func (l *LocalFilesystem) DownloadStaticFile(filename string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(l.root, filepath.FromSlash(filename)))
+}
+
+func (l *LocalFilesystem) DeleteStaticFile(filename string) error {
+	err := os.Remove(filepath.Join(l.root, filepath.FromSlash(filename)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// SignedURL returns a file:// URL, since there's no CDN/auth to sign
+// against in local dev.
+func (l *LocalFilesystem) SignedURL(filename string) (string, error) {
+	return "file://" + filepath.Join(l.root, filepath.FromSlash(filename)), nil
+}
+
+var _ Filesystem = (*LocalFilesystem)(nil)
@@ -8,13 +8,29 @@ package fs
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path"
 	"strings"
+	"time"
 )
 
+// gzipThreshold is the minimum content size worth paying the CPU cost of
+// gzip for - small files aren't worth it, and some are already-compressed
+// formats that wouldn't shrink anyway.
+const gzipThreshold = 1024
+
+// signedURLExpiry is how long SignedURL's links remain valid.
+const signedURLExpiry = 15 * time.Minute
+
 type S3Filesystem struct {
 	svc          *s3.S3
 	staticBucket string
@@ -28,29 +44,154 @@ func NewS3Filesystem(session *session.Session, stage string) (*S3Filesystem, err
 	return s3Filesystem, nil
 }
 
-var s3ContentTypes = map[string]string{
-	".json": "application/json",
-}
+func (s3Filesystem *S3Filesystem) UploadStaticFile(filename string, secondsCache int, data io.Reader, cacheBust bool) (string, error) {
+	body, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+
+	contentHash := md5.Sum(body)
 
-func (s3Filesystem *S3Filesystem) UploadStaticFile(filename string, secondsCache int, data []byte) error {
-	readSeeker := bytes.NewReader(data)
+	actualFilename := filename
+	if cacheBust {
+		actualFilename = bustFilename(filename, contentHash)
+	}
+
+	contentType := staticContentType(filename)
 
-	// Patch S3's limited vocabulary of default content types
-	var contentType *string
-	for ext, mime := range s3ContentTypes {
-		if strings.HasSuffix(filename, ext) {
-			contentType = &mime
-			break
+	var contentEncoding *string
+	if isCompressibleMIME(contentType) && len(body) >= gzipThreshold {
+		if compressed, err := gzipBytes(body); err == nil && len(compressed) < len(body) {
+			body = compressed
+			contentEncoding = aws.String("gzip")
 		}
 	}
 
+	uploadHash := md5.Sum(body)
+	uploadETag := `"` + hex.EncodeToString(uploadHash[:]) + `"`
+
+	if etag, err := s3Filesystem.headETag(actualFilename); err == nil && etag == uploadETag {
+		// Identical bytes already live at this key - S3 would store the same
+		// thing again, so skip the (billed) PUT.
+		return actualFilename, nil
+	}
+
 	req, _ := s3Filesystem.svc.PutObjectRequest(&s3.PutObjectInput{
-		Bucket:       aws.String(s3Filesystem.staticBucket),
-		Key:          aws.String(filename),
-		Body:         readSeeker,
-		CacheControl: aws.String(fmt.Sprintf("no-transform, public, max-age=%d", secondsCache)),
-		ContentType:  contentType,
+		Bucket:          aws.String(s3Filesystem.staticBucket),
+		Key:             aws.String(actualFilename),
+		Body:            bytes.NewReader(body),
+		CacheControl:    aws.String(fmt.Sprintf("no-transform, public, max-age=%d", secondsCache)),
+		ContentType:     aws.String(contentType),
+		ContentEncoding: contentEncoding,
+	})
+	return actualFilename, req.Send()
+}
+
+func (s3Filesystem *S3Filesystem) DownloadStaticFile(filename string) ([]byte, error) {
+	out, err := s3Filesystem.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s3Filesystem.staticBucket),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	// UploadStaticFile may have gzipped the content (see gzipThreshold);
+	// unlike a browser, the AWS SDK doesn't transparently decode it.
+	if out.ContentEncoding != nil && *out.ContentEncoding == "gzip" {
+		reader, err := gzip.NewReader(out.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return ioutil.ReadAll(reader)
+	}
+
+	return ioutil.ReadAll(out.Body)
+}
+
+func (s3Filesystem *S3Filesystem) DeleteStaticFile(filename string) error {
+	_, err := s3Filesystem.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s3Filesystem.staticBucket),
+		Key:    aws.String(filename),
 	})
-	err := req.Send()
 	return err
 }
+
+func (s3Filesystem *S3Filesystem) SignedURL(filename string) (string, error) {
+	req, _ := s3Filesystem.svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s3Filesystem.staticBucket),
+		Key:    aws.String(filename),
+	})
+	return req.Presign(signedURLExpiry)
+}
+
+// headETag returns the ETag currently stored at filename, or an error if
+// there isn't one (including "not found").
+func (s3Filesystem *S3Filesystem) headETag(filename string) (string, error) {
+	out, err := s3Filesystem.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s3Filesystem.staticBucket),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.ETag == nil {
+		return "", fmt.Errorf("head %s: no ETag", filename)
+	}
+	return *out.ETag, nil
+}
+
+// bustFilename splices hash into filename just before its extension, e.g.
+// "app.js" + hash -> "app.a1b2c3d4.js".
+func bustFilename(filename string, hash [md5.Size]byte) string {
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	return fmt.Sprintf("%s.%s%s", base, hex.EncodeToString(hash[:])[:8], ext)
+}
+
+// staticContentType resolves filename's MIME type via the system's
+// registered extension table, falling back to a handful of types
+// mime.TypeByExtension often doesn't know about.
+func staticContentType(filename string) string {
+	if t := mime.TypeByExtension(path.Ext(filename)); t != "" {
+		return t
+	}
+	if t, ok := extraContentTypes[path.Ext(filename)]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// extraContentTypes covers extensions mime.TypeByExtension often doesn't
+// know about out of the box (it depends on the OS's mime.types file).
+var extraContentTypes = map[string]string{
+	".json": "application/json",
+	".wasm": "application/wasm",
+}
+
+// isCompressibleMIME reports whether contentType is text-ish enough that
+// gzip is worth attempting (binary/already-compressed formats like images
+// are skipped).
+func isCompressibleMIME(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "xml") ||
+		strings.Contains(contentType, "svg")
+}
+
+// gzipBytes compresses data, returning an error only if the writer itself
+// fails (bytes.Buffer never does).
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
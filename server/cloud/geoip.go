@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package cloud
+
+import (
+	"github.com/oschwald/geoip2-golang"
+	"net"
+)
+
+// defaultAWSRegion is New's region when userData.Region is empty and either
+// no GeoLite2 database is available or the server's public IP's country
+// isn't in awsRegionByCountry.
+const defaultAWSRegion = "us-east-1"
+
+// awsRegionByCountry approximates "closest AWS region" by GeoLite2 country,
+// for deployments that don't pin REGION in user data. It's a coarse,
+// continent-level table rather than great-circle math against each region's
+// coordinates - good enough to keep a multi-region fleet roughly balanced
+// without requiring every operator to hand-pick a region.
+var awsRegionByCountry = map[string]string{
+	"US": "us-east-1", "CA": "us-east-1", "MX": "us-east-1",
+	"GB": "eu-west-1", "IE": "eu-west-1", "FR": "eu-west-1", "DE": "eu-west-1", "NL": "eu-west-1", "ES": "eu-west-1", "IT": "eu-west-1",
+	"JP": "ap-northeast-1", "KR": "ap-northeast-1",
+	"CN": "ap-southeast-1", "SG": "ap-southeast-1", "IN": "ap-southeast-1", "TH": "ap-southeast-1",
+	"AU": "ap-southeast-2", "NZ": "ap-southeast-2",
+	"BR": "sa-east-1", "AR": "sa-east-1", "CL": "sa-east-1",
+}
+
+// geoIP wraps a MaxMind GeoLite2-Country database, used by New to pick
+// cloud.region from the server's own public IP when userData.Region is
+// empty, and by RecordPlayerLocation to bucket player IPs by country.
+type geoIP struct {
+	reader *geoip2.Reader
+}
+
+// openGeoIP opens a GeoLite2-Country .mmdb file (path comes from user data,
+// see UserData.GeoIPPath in server_main/cloud). With no path configured,
+// New never calls it: New falls back to defaultAWSRegion and
+// RecordPlayerLocation becomes a no-op. A configured path that can't be
+// opened returns an error, which New returns in turn.
+func openGeoIP(path string) (*geoIP, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &geoIP{reader: reader}, nil
+}
+
+// country returns ip's ISO 3166-1 alpha-2 country code, or "" if it
+// couldn't be resolved (including when g is nil).
+func (g *geoIP) country(ip net.IP) string {
+	if g == nil || ip == nil {
+		return ""
+	}
+	record, err := g.reader.Country(ip)
+	if err != nil {
+		return ""
+	}
+	return record.Country.IsoCode
+}
+
+// closestRegion maps ip's GeoLite2 country to the nearest entry in
+// awsRegionByCountry, falling back to defaultAWSRegion.
+func (g *geoIP) closestRegion(ip net.IP) string {
+	if region, ok := awsRegionByCountry[g.country(ip)]; ok {
+		return region
+	}
+	return defaultAWSRegion
+}
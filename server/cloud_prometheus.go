@@ -0,0 +1,312 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/SoftbearStudios/mk48/server/metrics"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus is a Cloud implementation that exposes server metrics in
+// Prometheus/OpenMetrics format instead of talking to AWS. Self-hosters can
+// scrape them via Hub.ServeMetrics without running a DynamoDB/S3/Route53 stack.
+type Prometheus struct {
+	players     prometheus.Gauge
+	connections prometheus.Counter
+	newPlayers  prometheus.Counter
+	plays       prometheus.Counter
+	playerScore        *prometheus.GaugeVec
+	adminCommands      *prometheus.CounterVec
+	entityTypeCount    *prometheus.GaugeVec
+	entityKindCount    *prometheus.GaugeVec
+	entitySubKindCount *prometheus.GaugeVec
+	funcDuration       *prometheus.GaugeVec
+	fps                prometheus.Gauge
+	bots               prometheus.Gauge
+	teams              prometheus.Gauge
+	wsDropped          prometheus.Gauge
+	wsCoalesced        prometheus.Gauge
+	worldOpDuration    *prometheus.HistogramVec
+	sectorEntities     prometheus.Histogram
+	tickDuration       prometheus.Histogram
+	serverUpdates      prometheus.Counter
+	leaderboardUpdates prometheus.Counter
+	registry           *prometheus.Registry
+}
+
+func NewPrometheus() *Prometheus {
+	players := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mk48_players",
+		Help: "Number of players currently connected.",
+	})
+	connections := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mk48_connections_total",
+		Help: "Total number of non-bot clients that have connected.",
+	})
+	newPlayers := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mk48_new_players_total",
+		Help: "Total number of players that have joined for the first time.",
+	})
+	plays := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mk48_plays_total",
+		Help: "Total number of times a player has spawned.",
+	})
+	playerScore := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mk48_player_score",
+		Help: "Score of each player currently on the leaderboard.",
+	}, []string{"name"})
+	adminCommands := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mk48_admin_commands_total",
+		Help: "Total number of admin/observer console commands, by command name and outcome.",
+	}, []string{"command", "ok"})
+	entityTypeCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mk48_entities",
+		Help: "Number of live entities, by EntityType (see Hub.Debug).",
+	}, []string{"entity_type"})
+	entityKindCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mk48_entities_by_kind",
+		Help: "Number of live entities, by EntityKind (see Hub.Debug). Coarser than mk48_entities.",
+	}, []string{"entity_kind"})
+	entitySubKindCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mk48_entities_by_sub_kind",
+		Help: "Number of live entities, by EntitySubKind (see Hub.Debug). Coarser than mk48_entities.",
+	}, []string{"entity_sub_kind"})
+	funcDuration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mk48_func_duration_seconds",
+		Help: "Average duration of a core Hub function over the last debugPeriod (see timeFunction).",
+	}, []string{"name"})
+	fps := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mk48_client_fps",
+		Help: "Average reported client FPS over the last debugPeriod.",
+	})
+	bots := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mk48_bots",
+		Help: "Number of bot clients currently connected.",
+	})
+	teams := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mk48_teams",
+		Help: "Number of teams currently in existence.",
+	})
+	wsDropped := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mk48_ws_dropped",
+		Help: "Sum of ClientStats.Dropped (PriorityReliable sends that hit their deadline) across currently-connected SocketClients.",
+	})
+	wsCoalesced := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mk48_ws_coalesced",
+		Help: "Sum of ClientStats.Coalesced (PriorityLossy sends that replaced an already-queued one) across currently-connected SocketClients.",
+	})
+	worldOpDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mk48_world_op_duration_seconds",
+		Help:    "Duration of world.World operations, by method (see metrics.Recorder).",
+		Buckets: prometheus.ExponentialBuckets(1e-6, 4, 10),
+	}, []string{"op"})
+	sectorEntities := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mk48_sector_entities",
+		Help:    "Distribution of entity count per occupied sector (see sector.World.SectorEntityCounts); only populated when HubOptions.World selects the sector backend.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+	})
+	tickDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mk48_tick_duration_seconds",
+		Help:    "Duration of one Hub.Physics+Hub.Update tick (see Hub.Run's updateTicker case), the thing BenchmarkTreeWorld/BenchmarkSingleWorld regress against.",
+		Buckets: prometheus.ExponentialBuckets(1e-4, 2, 12),
+	})
+	serverUpdates := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mk48_server_updates_total",
+		Help: "Total number of Hub.Cloud calls to UpdateServer.",
+	})
+	leaderboardUpdates := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mk48_leaderboard_updates_total",
+		Help: "Total number of Hub.Cloud calls to UpdateLeaderboard.",
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(players, connections, newPlayers, plays, playerScore, adminCommands, entityTypeCount, entityKindCount,
+		entitySubKindCount, funcDuration, fps, bots, teams, wsDropped, wsCoalesced, worldOpDuration, sectorEntities, tickDuration,
+		serverUpdates, leaderboardUpdates)
+
+	return &Prometheus{
+		players:            players,
+		connections:        connections,
+		newPlayers:         newPlayers,
+		plays:              plays,
+		playerScore:        playerScore,
+		adminCommands:      adminCommands,
+		entityTypeCount:    entityTypeCount,
+		entityKindCount:    entityKindCount,
+		entitySubKindCount: entitySubKindCount,
+		funcDuration:       funcDuration,
+		fps:                fps,
+		bots:               bots,
+		teams:              teams,
+		wsDropped:          wsDropped,
+		wsCoalesced:        wsCoalesced,
+		worldOpDuration:    worldOpDuration,
+		sectorEntities:     sectorEntities,
+		tickDuration:       tickDuration,
+		serverUpdates:      serverUpdates,
+		leaderboardUpdates: leaderboardUpdates,
+		registry:           registry,
+	}
+}
+
+func (p *Prometheus) String() string {
+	return "prometheus"
+}
+
+func (p *Prometheus) UpdateServer(players int) error {
+	p.players.Set(float64(players))
+	p.serverUpdates.Inc()
+	return nil
+}
+
+func (p *Prometheus) IncrementPlayerStatistic() {
+	p.connections.Inc()
+}
+
+func (p *Prometheus) IncrementNewPlayerStatistic() {
+	p.newPlayers.Inc()
+}
+
+func (p *Prometheus) IncrementPlaysStatistic() {
+	p.plays.Inc()
+}
+
+func (p *Prometheus) FlushStatistics() error {
+	return nil
+}
+
+func (p *Prometheus) UpdateLeaderboard(playerScores map[string]int) error {
+	p.playerScore.Reset()
+	for name, score := range playerScores {
+		p.playerScore.WithLabelValues(name).Set(float64(score))
+	}
+	p.leaderboardUpdates.Inc()
+	return nil
+}
+
+func (p *Prometheus) UploadTerrainKeyframe(version uint64, data []byte) error {
+	return nil
+}
+
+func (p *Prometheus) UploadTerrainDelta(tileID uint32, data []byte, baseVersion uint64) error {
+	return nil
+}
+
+func (p *Prometheus) PruneTerrainSnapshots(keep int) error {
+	return nil
+}
+
+// UploadWorldSnapshot and DownloadWorldSnapshot are no-ops: Prometheus only
+// exposes metrics, it doesn't have anywhere durable to put a world snapshot.
+func (p *Prometheus) UploadWorldSnapshot(data []byte) error {
+	return nil
+}
+
+func (p *Prometheus) DownloadWorldSnapshot() ([]byte, error) {
+	return nil, nil
+}
+
+// RecordPlayerLocation is a no-op: geographic player aggregation is a
+// cloud.Cloud (GeoIP) concern, not something Prometheus labels are suited to
+// (it would mean one series per player).
+func (p *Prometheus) RecordPlayerLocation(playerID world.PlayerID, ip net.IP) {}
+
+func (p *Prometheus) ForgetPlayerLocation(playerID world.PlayerID) {}
+
+// UpdateEntityTypeCounts sets mk48_entities from the per-EntityType counts
+// Hub.Debug already computes for /tmp/mk48-entities.log, so the same
+// breakdown is gettable without tailing a log file.
+func (p *Prometheus) UpdateEntityTypeCounts(counts map[string]int) {
+	p.entityTypeCount.Reset()
+	for name, count := range counts {
+		p.entityTypeCount.WithLabelValues(name).Set(float64(count))
+	}
+}
+
+// UpdateEntityKindCounts is UpdateEntityTypeCounts's coarser counterpart:
+// mk48_entities_by_kind/mk48_entities_by_sub_kind, keyed by EntityKind/
+// EntitySubKind instead of EntityType, so a dashboard can chart e.g. "all
+// weapons" without summing every weapon EntityType series by hand.
+func (p *Prometheus) UpdateEntityKindCounts(kindCounts, subKindCounts map[string]int) {
+	p.entityKindCount.Reset()
+	for name, count := range kindCounts {
+		p.entityKindCount.WithLabelValues(name).Set(float64(count))
+	}
+	p.entitySubKindCount.Reset()
+	for name, count := range subKindCounts {
+		p.entitySubKindCount.WithLabelValues(name).Set(float64(count))
+	}
+}
+
+// UpdateFuncBenchDuration sets mk48_func_duration_seconds for one
+// funcBench, as reset by Hub.Debug each debugPeriod.
+func (p *Prometheus) UpdateFuncBenchDuration(name string, avg time.Duration) {
+	p.funcDuration.WithLabelValues(name).Set(avg.Seconds())
+}
+
+// UpdateClients sets mk48_client_fps, mk48_bots, and mk48_teams, as computed
+// by Hub.Debug each debugPeriod.
+func (p *Prometheus) UpdateClients(fps float32, bots, teams int) {
+	p.fps.Set(float64(fps))
+	p.bots.Set(float64(bots))
+	p.teams.Set(float64(teams))
+}
+
+// UpdateWebSocketStats sets mk48_ws_dropped/mk48_ws_coalesced to the sum of
+// ClientStats.Dropped/Coalesced across currently-connected SocketClients, as
+// computed by Hub.Debug each debugPeriod. Like mk48_client_fps/mk48_bots,
+// this only reflects clients connected at scrape time - a client's stats
+// aren't folded in anywhere once it disconnects.
+func (p *Prometheus) UpdateWebSocketStats(dropped, coalesced int64) {
+	p.wsDropped.Set(float64(dropped))
+	p.wsCoalesced.Set(float64(coalesced))
+}
+
+// UpdateSectorEntityCounts feeds mk48_sector_entities from
+// sector.World.SectorEntityCounts, so hot-spotting (many entities packed
+// into one sector, the scenario sector.World's O(sector size) operations
+// handle worst) shows up before it manifests as a tick-duration regression.
+// A no-op when HubOptions.World selects the tree backend instead, which has
+// no analogous notion of a fixed-size sector.
+func (p *Prometheus) UpdateSectorEntityCounts(counts []int) {
+	for _, c := range counts {
+		p.sectorEntities.Observe(float64(c))
+	}
+}
+
+// ObserveTick records mk48_tick_duration_seconds for one Hub.Physics+
+// Hub.Update pair (see Hub.Run's updateTicker case). Unlike the other Update*
+// methods here, this is called once per simulation tick rather than once per
+// debugPeriod, directly from Hub.Run's single goroutine - Hub.Run has no
+// mutex to hold regardless (it's already single-threaded via its select
+// loop), so there's nothing to take "under the existing lock".
+func (p *Prometheus) ObserveTick(d time.Duration) {
+	p.tickDuration.Observe(d.Seconds())
+}
+
+// Observe implements metrics.Recorder, so *Prometheus can be passed directly
+// to a world.World's SetRecorder (see Hub's use of the type-assertion
+// pattern in NewHub) to populate mk48_world_op_duration_seconds.
+func (p *Prometheus) Observe(op metrics.Op, d time.Duration) {
+	p.worldOpDuration.WithLabelValues(op.String()).Observe(d.Seconds())
+}
+
+// AuditAdminCommand logs the command (Prometheus labels can't carry the
+// moderator/IP) and increments mk48_admin_commands_total, so an alert can
+// fire on an unexpected rate of admin activity even without log aggregation.
+func (p *Prometheus) AuditAdminCommand(ip string, moderator world.PlayerID, command string, ok bool) error {
+	log.Printf("admin command %q by player %d (%s) ok=%v\n", command, moderator, ip, ok)
+	p.adminCommands.WithLabelValues(command, fmt.Sprint(ok)).Inc()
+	return nil
+}
+
+func (p *Prometheus) UpdatePeriod() time.Duration {
+	return 15 * time.Second
+}
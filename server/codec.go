@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/gorilla/websocket"
+)
+
+// Codec turns a Message to and from wire bytes for one SocketClient
+// connection. SocketClient picks a Codec per-connection from the WebSocket
+// subprotocol negotiated at handshake (see codecForSubprotocol and
+// NewSocketClient); Hub and everything upstream of SocketClient.Send/
+// readPump never see which one is in use. A Codec doesn't frame its own
+// message boundaries - one Encode call's output is written to, and one
+// Decode call's input is read from, a single WebSocket frame, so the
+// gorilla/websocket layer already delineates messages.
+type Codec interface {
+	// FrameType is the gorilla/websocket frame type (TextMessage or
+	// BinaryMessage) this Codec's encoded output must be sent in.
+	FrameType() int
+	// MaxMessageSize is the conn.SetReadLimit readPump applies once this
+	// Codec is negotiated (see NewSocketClient). Each Codec gets its own
+	// limit rather than sharing the original fixed 512-byte cap, since a
+	// Codec's encoding density changes how many wire bytes the same
+	// Inbound actually costs.
+	MaxMessageSize() int64
+	Encode(w io.Writer, message Message) error
+	Decode(r io.Reader) (Message, error)
+	// SupportsLeaderboardDelta is whether this Codec's clients understand
+	// LeaderboardDelta (see Hub.Leaderboard); clients that don't always get
+	// the full legacy Leaderboard instead.
+	SupportsLeaderboardDelta() bool
+	// SupportsContactsDelta is whether this Codec's clients understand
+	// Update.ContactsAdded/ContactsUpdated/ContactsRemoved (see
+	// Hub.updateClient's diffContacts in contacts_delta.go); clients that
+	// don't always get a full Update.Contacts every tick instead.
+	SupportsContactsDelta() bool
+}
+
+// jsonCodec is the original, and still default, wire format: jsoniter over
+// a WebSocket text frame (see jsoniter.go).
+type jsonCodec struct{}
+
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) MaxMessageSize() int64 { return maxMessageSize }
+
+func (jsonCodec) Encode(w io.Writer, message Message) error {
+	return json.NewEncoder(w).Encode(message)
+}
+
+func (jsonCodec) Decode(r io.Reader) (Message, error) {
+	var message Message
+	err := json.NewDecoder(r).Decode(&message)
+	return message, err
+}
+
+// SupportsLeaderboardDelta is false: jsonCodec is also negotiated by older
+// clients built before LeaderboardDelta existed, so it always gets the
+// legacy full Leaderboard.
+func (jsonCodec) SupportsLeaderboardDelta() bool { return false }
+
+// SupportsContactsDelta is false for the same reason SupportsLeaderboardDelta
+// is: older clients negotiating plain jsonCodec predate ContactsAdded/
+// ContactsUpdated/ContactsRemoved and must keep getting a full Contacts.
+func (jsonCodec) SupportsContactsDelta() bool { return false }
+
+// binaryCodec is the compact codec from binary_message.go, sent over a
+// WebSocket binary frame.
+type binaryCodec struct{}
+
+func (binaryCodec) FrameType() int { return websocket.BinaryMessage }
+
+// MaxMessageSize is higher than jsonCodec's: binaryCodec's tag-0 fallback
+// wraps a whole JSON-encoded Message (see Message.MarshalBinary) inside a
+// 5-byte header, so it needs at least as much room as jsonCodec plus that
+// header - rounded up generously since it's still a cap, not a budget.
+func (binaryCodec) MaxMessageSize() int64 { return maxMessageSize * 4 }
+
+func (binaryCodec) Encode(w io.Writer, message Message) error {
+	body, err := message.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+func (binaryCodec) Decode(r io.Reader) (Message, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return Message{}, err
+	}
+	var message Message
+	err = message.UnmarshalBinary(body)
+	return message, err
+}
+
+// SupportsLeaderboardDelta is true: binarySubprotocol is a deliberate client
+// opt-in (see codecForSubprotocol), so a client negotiating it is assumed to
+// be built against the current wire format, including LeaderboardDelta.
+func (binaryCodec) SupportsLeaderboardDelta() bool { return true }
+
+// SupportsContactsDelta is true for the same reason SupportsLeaderboardDelta
+// is: binarySubprotocol is a deliberate opt-in by clients built against the
+// current wire format.
+func (binaryCodec) SupportsContactsDelta() bool { return true }
+
+// codecForSubprotocol picks the Codec a connection negotiated at handshake
+// (see upgrader.Subprotocols in socket_client.go), defaulting to jsonCodec
+// for clients that didn't request binarySubprotocol or snappySubprotocol -
+// so browser clients built against the original JSON format keep working
+// unchanged. stats is where a negotiated snappyCodec records its
+// before/after compression byte counts (see ClientStats); it's unused for
+// the other two Codecs.
+func codecForSubprotocol(subprotocol string, stats *ClientStats) Codec {
+	switch subprotocol {
+	case snappySubprotocol:
+		return &snappyCodec{inner: binaryCodec{}, stats: stats}
+	case binarySubprotocol:
+		return binaryCodec{}
+	default:
+		return jsonCodec{}
+	}
+}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestInboundCodecParity proves jsonCodec and binaryCodec decode an inbound
+// message to the same Go value - a client negotiating binarySubprotocol
+// must produce the exact Inbound Hub.ReceiveSigned would've gotten from a
+// JSON client, for both a binary-eligible type (SetActive: all fixed-size
+// fields, see registerBinaryType) and one that falls back to JSON-in-binary
+// (SendChat: a string field).
+func TestInboundCodecParity(t *testing.T) {
+	cases := []struct {
+		name string
+		typ  messageType
+		data Inbound
+	}{
+		{"binary-eligible", "setActive", SetActive{Active: true}},
+		{"json-fallback", "sendChat", SendChat{Message: "hi", Team: true, Auth: "secret"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// What a JSON client would send on the wire.
+			jsonBody, err := json.Marshal(messageJSON{Data: c.data, Type: c.typ})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			wantMessage, err := (jsonCodec{}).Decode(bytes.NewReader(jsonBody))
+			if err != nil {
+				t.Fatalf("json decode: %v", err)
+			}
+
+			// What a binarySubprotocol client would send for the same value.
+			var binBuf bytes.Buffer
+			if err := (binaryCodec{}).Encode(&binBuf, Message{Data: c.data}); err != nil {
+				t.Fatalf("binary encode: %v", err)
+			}
+			gotMessage, err := (binaryCodec{}).Decode(&binBuf)
+			if err != nil {
+				t.Fatalf("binary decode: %v", err)
+			}
+
+			if !reflect.DeepEqual(wantMessage.Data, gotMessage.Data) {
+				t.Errorf("codecs disagree: json=%#v binary=%#v", wantMessage.Data, gotMessage.Data)
+			}
+		})
+	}
+}
+
+// TestOutboundCodecRoundTrip proves binaryCodec round-trips an Outbound
+// value exactly, for both a binary-eligible type (RateLimited) and one
+// that falls back to JSON-in-binary (AdminFuncBenchReport: a slice field) -
+// the binary path must not silently drop anything a JSON client would've
+// received intact.
+func TestOutboundCodecRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		data Outbound
+	}{
+		{"binary-eligible", RateLimited{RetryAfterMillis: 250}},
+		{"json-fallback", AdminFuncBenchReport{Benches: []AdminFuncBenchStat{{Name: "x", Runs: 2}}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var binBuf bytes.Buffer
+			if err := (binaryCodec{}).Encode(&binBuf, Message{Data: c.data}); err != nil {
+				t.Fatalf("binary encode: %v", err)
+			}
+			gotMessage, err := (binaryCodec{}).Decode(&binBuf)
+			if err != nil {
+				t.Fatalf("binary decode: %v", err)
+			}
+
+			if !reflect.DeepEqual(c.data, gotMessage.Data) {
+				t.Errorf("binary round-trip changed value: want %#v got %#v", c.data, gotMessage.Data)
+			}
+		})
+	}
+}
+
+// TestSnappyCodecRoundTrip proves snappyCodec round-trips both below and
+// above snappyThreshold - the two take different flag-byte paths (see
+// snappyCodec.Encode) and both must decode back to the original value.
+func TestSnappyCodecRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		data Outbound
+	}{
+		{"below threshold", AdminDebugEvent{Clients: 3, Bots: 1, Teams: 2, WorldRadius: 500}},
+		{"above threshold", AdminFuncBenchReport{Benches: func() []AdminFuncBenchStat {
+			stats := make([]AdminFuncBenchStat, 20)
+			for i := range stats {
+				stats[i] = AdminFuncBenchStat{Name: "bench", Runs: i}
+			}
+			return stats
+		}()}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var stats ClientStats
+			codec := &snappyCodec{inner: binaryCodec{}, stats: &stats}
+
+			var buf bytes.Buffer
+			if err := codec.Encode(&buf, Message{Data: c.data}); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			gotMessage, err := codec.Decode(&buf)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			if !reflect.DeepEqual(c.data, gotMessage.Data) {
+				t.Errorf("snappy round-trip changed value: want %#v got %#v", c.data, gotMessage.Data)
+			}
+			if stats.BytesBeforeCompress == 0 {
+				t.Error("expected BytesBeforeCompress to be recorded")
+			}
+		})
+	}
+}
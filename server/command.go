@@ -0,0 +1,389 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"strconv"
+	"strings"
+)
+
+// CommandArgs is the ordered list of values an ArgumentParser chain parsed
+// on the way to a CommandNode's Handler, one per argument-consuming node
+// in the path from commandRoot.
+type CommandArgs []interface{}
+
+func (args CommandArgs) Int(i int) int                    { return args[i].(int) }
+func (args CommandArgs) Float32(i int) float32             { return args[i].(float32) }
+func (args CommandArgs) Player(i int) *Player              { return args[i].(*Player) }
+func (args CommandArgs) TeamID(i int) world.TeamID         { return args[i].(world.TeamID) }
+func (args CommandArgs) EntityType(i int) world.EntityType { return args[i].(world.EntityType) }
+func (args CommandArgs) String(i int) string               { return args[i].(string) }
+
+// ArgumentParser consumes as much of remaining as it needs - one
+// whitespace-delimited token for most kinds, a "quoted phrase" for
+// parseQuoted, or everything left for parseRestOfLine - returning the
+// parsed value and whatever of remaining it didn't consume.
+type ArgumentParser func(remaining string, h *Hub, invoker *Player) (value interface{}, rest string, ok bool)
+
+// CommandNode is one node of the registered slash-command tree (see
+// commandRoot, built in init()). A node matches input one of two ways,
+// never both: literally by Name (Arg == nil), or by consuming an argument
+// via Arg (Name == "", used only for Usage/Children/Handler). Handler is
+// nil for a node that only routes to Children (e.g. the "team" in
+// "/team invite").
+type CommandNode struct {
+	Name  string
+	Usage string // shown in /help, e.g. "invite <player>"
+	Arg   ArgumentParser
+
+	// Permission hides this node (and therefore its subtree) from /help and
+	// rejects any input that would otherwise match it. nil means visible
+	// and usable by everyone.
+	Permission func(h *Hub, player *Player, authed bool) bool
+
+	Handler  func(h *Hub, client Client, player *Player, authed bool, args CommandArgs) (reply string, teamOnly bool)
+	Children []*CommandNode
+}
+
+// splitToken trims leading whitespace off remaining and splits off the
+// first whitespace-delimited token.
+func splitToken(remaining string) (token, rest string) {
+	remaining = strings.TrimLeft(remaining, " \t")
+	if i := strings.IndexAny(remaining, " \t"); i >= 0 {
+		return remaining[:i], remaining[i:]
+	}
+	return remaining, ""
+}
+
+func parseInt(remaining string, _ *Hub, _ *Player) (interface{}, string, bool) {
+	token, rest := splitToken(remaining)
+	n, err := strconv.Atoi(token)
+	return n, rest, err == nil
+}
+
+func parseFloat(remaining string, _ *Hub, _ *Player) (interface{}, string, bool) {
+	token, rest := splitToken(remaining)
+	f, err := strconv.ParseFloat(token, 32)
+	return float32(f), rest, err == nil
+}
+
+// parsePlayerByName looks up a connected Client by Player name
+// (case-insensitive, since that's how players actually type each other's
+// names).
+func parsePlayerByName(remaining string, h *Hub, _ *Player) (interface{}, string, bool) {
+	token, rest := splitToken(remaining)
+	if token == "" {
+		return nil, rest, false
+	}
+	for c := h.clients.First; c != nil; c = c.Data().Next {
+		p := &c.Data().Player
+		if strings.EqualFold(p.Name, token) {
+			return p, rest, true
+		}
+	}
+	return nil, rest, false
+}
+
+func parseTeamID(remaining string, h *Hub, _ *Player) (interface{}, string, bool) {
+	token, rest := splitToken(remaining)
+	var teamID world.TeamID
+	if err := teamID.UnmarshalText([]byte(token)); err != nil {
+		return nil, rest, false
+	}
+	if h.teams[teamID] == nil {
+		return nil, rest, false
+	}
+	return teamID, rest, true
+}
+
+func parseEntityType(remaining string, _ *Hub, _ *Player) (interface{}, string, bool) {
+	token, rest := splitToken(remaining)
+	t := world.ParseEntityType(token)
+	if t == world.EntityTypeInvalid {
+		return nil, rest, false
+	}
+	return t, rest, true
+}
+
+// parseQuoted consumes a "quoted phrase" (spaces allowed inside), or falls
+// back to a single bare token if remaining doesn't start with a quote.
+func parseQuoted(remaining string, _ *Hub, _ *Player) (interface{}, string, bool) {
+	trimmed := strings.TrimLeft(remaining, " \t")
+	if !strings.HasPrefix(trimmed, `"`) {
+		token, rest := splitToken(remaining)
+		if token == "" {
+			return nil, rest, false
+		}
+		return token, rest, true
+	}
+
+	end := strings.IndexByte(trimmed[1:], '"')
+	if end < 0 {
+		return nil, "", false
+	}
+	return trimmed[1 : end+1], trimmed[end+2:], true
+}
+
+// parseRestOfLine consumes everything left of remaining as one value; ok is
+// false if nothing is left.
+func parseRestOfLine(remaining string, _ *Hub, _ *Player) (interface{}, string, bool) {
+	trimmed := strings.TrimSpace(remaining)
+	if trimmed == "" {
+		return nil, "", false
+	}
+	return trimmed, "", true
+}
+
+// usage renders a full command line, e.g. "/team invite <player>", from
+// path: the nodes walk matched on the way down from commandRoot (CommandNode
+// has no parent pointer, so the path is passed in rather than walked up).
+func usage(path []*CommandNode) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i, node := range path {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if node.Arg != nil {
+			b.WriteString(node.Usage)
+		} else {
+			b.WriteString(node.Name)
+		}
+	}
+	return b.String()
+}
+
+// runCommand walks commandRoot matching message (already stripped of its
+// leading '/') against the tree, and returns the Handler's reply once every
+// argument parses and a leaf with a Handler is reached. If message runs out
+// before reaching a Handler, or doesn't match any visible child, the reply
+// is a usage string instead - never a broadcast, always meant for invoker
+// alone (teamOnly tells deliverCommandReply to send it to invoker's team
+// chat instead of just invoker).
+func (h *Hub) runCommand(client Client, invoker *Player, authed bool, message string) (reply string, teamOnly bool) {
+	return h.walk(commandRoot, nil, nil, message, client, invoker, authed)
+}
+
+// walk is runCommand's recursive implementation; args
+// accumulates one entry per argument-consuming node along path.
+func (h *Hub) walk(node *CommandNode, path []*CommandNode, args CommandArgs, remaining string, client Client, invoker *Player, authed bool) (reply string, teamOnly bool) {
+	remaining = strings.TrimSpace(remaining)
+
+	if remaining == "" {
+		if node.Handler != nil {
+			return node.Handler(h, client, invoker, authed, args)
+		}
+		return "Usage: " + usage(append(path, visibleChildren(h, invoker, authed, node.Children)...)), false
+	}
+
+	for _, child := range node.Children {
+		if child.Permission != nil && !child.Permission(h, invoker, authed) {
+			continue
+		}
+
+		if child.Arg != nil {
+			value, rest, ok := child.Arg(remaining, h, invoker)
+			if !ok {
+				continue
+			}
+			return h.walk(child, append(path, child), append(args, value), rest, client, invoker, authed)
+		}
+
+		token, rest := splitToken(remaining)
+		if strings.EqualFold(token, child.Name) {
+			return h.walk(child, append(path, child), args, rest, client, invoker, authed)
+		}
+	}
+
+	return fmt.Sprintf("Unknown command: %s", usage(path)), false
+}
+
+// visibleChildren is only used to build a usage string out of the first of
+// node's children that would actually be reachable for invoker (or none) -
+// avoids hinting at e.g. admin-only children in the "Usage:" reply.
+func visibleChildren(h *Hub, invoker *Player, authed bool, children []*CommandNode) []*CommandNode {
+	for _, child := range children {
+		if child.Permission == nil || child.Permission(h, invoker, authed) {
+			return []*CommandNode{child}
+		}
+	}
+	return nil
+}
+
+// authedPermission is a CommandNode.Permission for admin-only commands
+// (e.g. /kick), keyed off the same Auth the player's SendChat carried, the
+// same way Spawn.Auth/AdminAuth.authed gate admin actions elsewhere.
+func authedPermission(_ *Hub, _ *Player, authed bool) bool {
+	return authed
+}
+
+// commandRoot is the registered slash-command tree; see init() below.
+var commandRoot *CommandNode
+
+func init() {
+	commandRoot = &CommandNode{
+		Children: []*CommandNode{
+			{
+				Name: "help",
+				Handler: func(h *Hub, _ Client, player *Player, authed bool, _ CommandArgs) (string, bool) {
+					return helpText(h, player, authed), false
+				},
+			},
+			{
+				Name: "team",
+				Children: []*CommandNode{
+					{
+						Name:  "invite",
+						Usage: "team invite <player>",
+						Children: []*CommandNode{{
+							Arg:   parsePlayerByName,
+							Usage: "<player>",
+							Handler: func(h *Hub, client Client, player *Player, _ bool, args CommandArgs) (string, bool) {
+								target := args.Player(0)
+								AddToTeam{TeamID: player.TeamID, PlayerID: target.PlayerID()}.Process(h, nil, player)
+								return fmt.Sprintf("Invited %s to the team.", target.Name), false
+							},
+						}},
+					},
+				},
+			},
+			{
+				Name:  "pay",
+				Usage: "pay <amount> <player>",
+				Children: []*CommandNode{{
+					Arg: parseInt,
+					Children: []*CommandNode{{
+						Arg:   parsePlayerByName,
+						Usage: "<amount> <player>",
+						Handler: func(h *Hub, client Client, player *Player, _ bool, args CommandArgs) (string, bool) {
+							amount := args.Int(0)
+							target := args.Player(1)
+							return payPlayer(player, target, amount), false
+						},
+					}},
+				}},
+			},
+			{
+				Name:  "report",
+				Usage: "report <player> <reason>",
+				Children: []*CommandNode{{
+					Arg: parsePlayerByName,
+					Children: []*CommandNode{{
+						Arg:   parseRestOfLine,
+						Usage: "<player> <reason>",
+						Handler: func(h *Hub, client Client, player *Player, _ bool, args CommandArgs) (string, bool) {
+							target := args.Player(0)
+							reason := args.String(1)
+							_ = AppendLog("/tmp/mk48-reports.log", []interface{}{
+								unixMillis(), player.Name, target.Name, reason,
+							})
+							return fmt.Sprintf("Reported %s. Thank you.", target.Name), false
+						},
+					}},
+				}},
+			},
+			{
+				Name:  "mute",
+				Usage: "mute <player>",
+				Children: []*CommandNode{{
+					Arg:   parsePlayerByName,
+					Usage: "<player>",
+					Handler: func(h *Hub, client Client, player *Player, _ bool, args CommandArgs) (string, bool) {
+						target := args.Player(0)
+						if player.Muted == nil {
+							player.Muted = make(map[string]bool)
+						}
+						player.Muted[target.Name] = true
+						return fmt.Sprintf("Muted %s.", target.Name), false
+					},
+				}},
+			},
+			{
+				Name:       "kick",
+				Usage:      "kick <player>",
+				Permission: authedPermission,
+				Children: []*CommandNode{{
+					Arg:   parsePlayerByName,
+					Usage: "<player>",
+					Handler: func(h *Hub, client Client, player *Player, _ bool, args CommandArgs) (string, bool) {
+						target := args.Player(0)
+						AdminKick{AdminAuth: AdminAuth{Auth: h.auth}, PlayerID: target.PlayerID()}.Process(h, client, player)
+						return fmt.Sprintf("Kicked %s.", target.Name), false
+					},
+				}},
+			},
+			{
+				Name:       "spawn",
+				Usage:      "spawn <type>",
+				Permission: authedPermission,
+				Children: []*CommandNode{{
+					Arg:   parseEntityType,
+					Usage: "<type>",
+					Handler: func(h *Hub, client Client, player *Player, _ bool, args CommandArgs) (string, bool) {
+						entityType := args.EntityType(0)
+						h.spawnEntity(&world.Entity{EntityType: entityType}, h.worldRadius)
+						return fmt.Sprintf("Spawned %s.", entityType), false
+					},
+				}},
+			},
+		},
+	}
+}
+
+// deliverCommandReply sends a command's reply to invoker alone (the usual
+// case), or to invoker's whole team when the handler returned teamOnly
+// (e.g. an announcement teammates should also see).
+func (h *Hub) deliverCommandReply(client Client, player *Player, reply string, teamOnly bool) {
+	if teamOnly {
+		if team := h.teams[player.TeamID]; team != nil {
+			h.announceTeam(team, reply)
+		}
+		return
+	}
+	if client != nil {
+		client.Send(Chat{Message: reply, System: true})
+	}
+}
+
+// helpText lists the usage of every top-level command invoker can actually
+// run.
+func helpText(h *Hub, player *Player, authed bool) string {
+	var b strings.Builder
+	b.WriteString("Commands:")
+	for _, child := range commandRoot.Children {
+		if child.Permission != nil && !child.Permission(h, player, authed) {
+			continue
+		}
+		b.WriteString(" /")
+		if child.Usage != "" {
+			b.WriteString(child.Usage)
+		} else {
+			b.WriteString(child.Name)
+		}
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// payPlayer transfers amount of score from payer to recipient, bounded so
+// payer can't go negative and amount must be positive - a direct
+// player-to-player gift, distinct from the existing Pay Inbound (which
+// drops a physical coin entity near your ship).
+func payPlayer(payer, recipient *Player, amount int) string {
+	if amount <= 0 {
+		return "Amount must be positive."
+	}
+	if payer == recipient {
+		return "You can't pay yourself."
+	}
+	if payer.Score < amount {
+		return "Insufficient score."
+	}
+
+	payer.Score -= amount
+	recipient.Score += amount
+	return fmt.Sprintf("Paid %d score to %s.", amount, recipient.Name)
+}
@@ -10,6 +10,7 @@ import (
 	"mk48/server/terrain"
 	"mk48/server/terrain/compressed"
 	"mk48/server/world"
+	"mk48/server/world/sector"
 	"runtime"
 	"sort"
 	"strconv"
@@ -17,6 +18,11 @@ import (
 	"time"
 )
 
+// terrainSnapshotsToKeep bounds how many past keyframe/delta frames
+// SnapshotTerrain asks the Cloud to retain, so a rolling terrain history
+// doesn't grow storage without bound (see Cloud.PruneTerrainSnapshots).
+const terrainSnapshotsToKeep = 720 // 1 hour at debugPeriod
+
 // Debug prints debugging info to console and tmp files.
 func (h *Hub) Debug() {
 	fmt.Printf("Debug [%v] %s\n", time.Now().Format(time.UnixDate), h.cloud)
@@ -29,16 +35,20 @@ func (h *Hub) Debug() {
 		realPlayers []*Player
 		fps         float32
 		fpsCount    int // Can be less than len(realPlayers) for players that haven't sent a trace yet
+		wsDropped   int64
+		wsCoalesced int64
 	)
 
 	for client := h.clients.First; client != nil; client = client.Data().Next {
-		if _, ok := client.(*SocketClient); ok {
+		if socketClient, ok := client.(*SocketClient); ok {
 			player := &client.Data().Player
 			realPlayers = append(realPlayers, player)
 			if player.FPS != 0 {
 				fps += player.FPS
 				fpsCount++
 			}
+			wsDropped += socketClient.Stats.Dropped
+			wsCoalesced += socketClient.Stats.Coalesced
 		} else {
 			botCount++
 		}
@@ -70,6 +80,11 @@ func (h *Hub) Debug() {
 		fmt.Printf(" - fps: %.1f\n", fps)
 	}
 
+	if p, ok := h.cloud.(*Prometheus); ok {
+		p.UpdateClients(fps, botCount, len(h.teams))
+		p.UpdateWebSocketStats(wsDropped, wsCoalesced)
+	}
+
 	fmt.Print(" - ")
 	h.terrain.Debug()
 
@@ -79,6 +94,8 @@ func (h *Hub) Debug() {
 	// Function benchmarks
 	var totalDuration time.Duration
 
+	p, hasPrometheus := h.cloud.(*Prometheus)
+
 	fmt.Print(" - ")
 	for i := range h.funcBenches {
 		bench := &h.funcBenches[i]
@@ -86,6 +103,10 @@ func (h *Hub) Debug() {
 		duration := bench.reset()
 		totalDuration += duration
 
+		if hasPrometheus {
+			p.UpdateFuncBenchDuration(bench.name, duration)
+		}
+
 		fmt.Print(bench.name, ": ", duration, ", ")
 	}
 	fmt.Println("total:", totalDuration)
@@ -97,6 +118,29 @@ func (h *Hub) Debug() {
 		return
 	})
 
+	if hasPrometheus {
+		namedCounts := make(map[string]int, len(entityTypeCounts))
+		kindCounts := make(map[string]int, 8)
+		subKindCounts := make(map[string]int, 16)
+		tmpBuf := make([]byte, 0, 16)
+		for i, c := range entityTypeCounts {
+			if c == 0 {
+				continue
+			}
+			entityType := world.EntityType(i)
+			namedCounts[string(entityType.AppendText(tmpBuf))] = c
+			data := entityType.Data()
+			kindCounts[data.Kind.String()] += c
+			subKindCounts[data.SubKind.String()] += c
+		}
+		p.UpdateEntityTypeCounts(namedCounts)
+		p.UpdateEntityKindCounts(kindCounts, subKindCounts)
+
+		if sw, ok := h.world.(*sector.World); ok {
+			p.UpdateSectorEntityCounts(sw.SectorEntityCounts())
+		}
+	}
+
 	_ = AppendLog("/tmp/mk48.log", []interface{}{
 		unixMillis(),
 		len(realPlayers),
@@ -145,13 +189,31 @@ func (h *Hub) SnapshotTerrain() {
 		return
 	}
 
+	ct, ok := h.terrain.(*compressed.Terrain)
+	if !ok {
+		return
+	}
+
+	// After the first keyframe, only ship the tiles that changed since the
+	// last call instead of re-uploading the whole terrain every period.
+	if h.sentTerrainKeyframe {
+		version := ct.Version()
+		for _, tileID := range ct.DirtyTiles() {
+			_ = h.cloud.UploadTerrainDelta(tileID, ct.EncodeTile(tileID), version)
+		}
+		_ = h.cloud.PruneTerrainSnapshots(terrainSnapshotsToKeep)
+		return
+	}
+
 	img := terrain.Render(h.terrain, compressed.Size/4)
 	var buf bytes.Buffer
 	err := png.Encode(&buf, img)
 	if err != nil {
 		return
 	}
-	_ = h.cloud.UploadTerrainSnapshot(buf.Bytes())
+	if err = h.cloud.UploadTerrainKeyframe(ct.Version(), buf.Bytes()); err == nil {
+		h.sentTerrainKeyframe = true
+	}
 
 	// TODO: Will fill disk space
 	/*
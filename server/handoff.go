@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+	"sync/atomic"
+)
+
+// handoffRequest carries a Client and its serialized state from one shard's
+// handoffTo to another shard's receiveHandoff (see Hub.handoff).
+type handoffRequest struct {
+	client    Client
+	player    Player
+	hasEntity bool
+	entity    world.Entity
+}
+
+// handoffBoundaryCrossings moves any Client whose ship has sailed outside
+// h.shardBounds to the shard that now owns its position (see
+// HubRouter.shardFor). A no-op when h isn't part of a HubRouter. Checked at
+// leaderboardTicker's cadence (once a second) - frequent enough that a
+// player never sees their ship "stop" at a border, not so frequent that it
+// meaningfully adds to that tick's cost.
+func (h *Hub) handoffBoundaryCrossings() {
+	if h.router == nil {
+		return
+	}
+
+	var crossed []Client
+	for c := h.clients.First; c != nil; c = c.Data().Next {
+		player := &c.Data().Player.Player
+		if player.EntityID == world.EntityIDInvalid {
+			continue
+		}
+
+		var outside bool
+		h.world.EntityByID(player.EntityID, func(entity *world.Entity) (_ bool) {
+			if entity == nil {
+				return
+			}
+			x := entity.Position.X
+			outside = x < h.shardBounds.X || x >= h.shardBounds.X+h.shardBounds.Width
+			return
+		})
+
+		if outside {
+			crossed = append(crossed, c)
+		}
+	}
+
+	for _, c := range crossed {
+		h.handoffTo(c)
+	}
+}
+
+// handoffTo serializes c's ship (if any) and Player state, removes it from
+// h, and delivers it to the shard that now owns its position, so a boat
+// sails seamlessly across a shard boundary instead of being disconnected or
+// despawned.
+//
+// Known limitation: h.teams is per-shard, so a cross-shard team's Members
+// only reflects players who joined while on that shard - a full cross-shard
+// team registry would need to be shared, which is out of scope here.
+func (h *Hub) handoffTo(c Client) {
+	data := c.Data()
+	player := &data.Player.Player
+
+	var entity world.Entity
+	hasEntity := player.EntityID != world.EntityIDInvalid
+	if hasEntity {
+		h.world.EntityByID(player.EntityID, func(e *world.Entity) (remove bool) {
+			if e == nil {
+				hasEntity = false
+				return
+			}
+			entity = *e
+			return true // owned by the destination shard's world now
+		})
+	}
+
+	dest := h.router.shardFor(entity.Position.X)
+	if dest == h {
+		// Raced back inside h.shardBounds between the scan in
+		// handoffBoundaryCrossings and here (e.g. killed at the border);
+		// nothing to do.
+		return
+	}
+
+	h.clearTeamRequests(player)
+	h.leaveTeam(player)
+
+	data.Hub = nil
+	h.clients.Remove(c)
+	atomic.AddInt32(&h.clientCount, -1)
+	delete(h.debugSubscribers, c)
+
+	dest.handoff <- handoffRequest{client: c, player: data.Player, hasEntity: hasEntity, entity: entity}
+}
+
+// receiveHandoff is handoffTo's counterpart on the destination shard's Run
+// goroutine: it re-attaches the Client (without re-calling Init - the
+// SocketClient/BotClient's read/write pumps are already running) and
+// respawns its ship with the same Transform it crossed the border with, so
+// the handoff is invisible to the player.
+func (h *Hub) receiveHandoff(req handoffRequest) {
+	data := req.client.Data()
+	data.Hub = h
+	data.Player = req.player
+	data.Player.Player.EntityID = world.EntityIDInvalid
+
+	h.clients.Add(req.client)
+	atomic.AddInt32(&h.clientCount, 1)
+
+	if req.hasEntity {
+		entity := req.entity
+		entity.Owner = &data.Player.Player
+		entityID := h.world.AddEntity(&entity)
+		data.Player.Player.EntityID = entityID
+	}
+}
@@ -2,8 +2,14 @@ package server
 
 import (
 	"fmt"
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/terrain/compressed"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func (h *Hub) ServeIndex(w http.ResponseWriter, r *http.Request) {
@@ -15,30 +21,166 @@ func (h *Hub) ServeIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Hub) ServeSocket(w http.ResponseWriter, r *http.Request) {
-	var ipStr string
+// ServeMetrics serves the Prometheus exposition format for scraping. It 404s
+// unless the Hub was configured with a *Prometheus Cloud (see NewPrometheus).
+func (h *Hub) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.cloud.(*Prometheus)
+	if !ok {
+		http.Error(w, "metrics unavailable", http.StatusNotFound)
+		return
+	}
+	promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// ServeMap renders a top-down PNG of the live world terrain (see
+// compressed.Terrain.RenderPNG), giving operators the same "what does the
+// world look like right now" visibility the Cloud keyframe upload provides,
+// without waiting on debugTicker or shipping anything off-box. It 404s
+// unless the Hub's terrain is a *compressed.Terrain, and requires
+// ?auth=<HubOptions.Auth> whenever Auth is configured. ?scale= controls the
+// nearest-neighbor upsampling factor (default 64, matching compressed.Size
+// at one source pixel per chunk).
+func (h *Hub) ServeMap(w http.ResponseWriter, r *http.Request) {
+	if h.auth != "" && r.URL.Query().Get("auth") != h.auth {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ct, ok := h.terrain.(*compressed.Terrain)
+	if !ok {
+		http.Error(w, "map unavailable", http.StatusNotFound)
+		return
+	}
+
+	scale := 64
+	if s := r.URL.Query().Get("scale"); s != "" {
+		if parsed, err := strconv.Atoi(s); err == nil && parsed > 0 {
+			scale = parsed
+		}
+	}
 
-	{
-		rawIpStr := r.Header.Get("X-Forwarded-For")
-		// The following would likely not work, as RemoteAddr likely has a port number
-		/*
-			if rawIpStr == "" {
-				rawIpStr = r.RemoteAddr
+	const worldSize = compressed.Size * terrain.Scale
+	buf, err := ct.RenderPNG(world.AABBFrom(-worldSize/2, -worldSize/2, worldSize, worldSize), scale)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(buf)
+}
+
+// clientIP returns the request's client IP, taking the left-most address in
+// X-Forwarded-For that isn't covered by h.trustedProxies. If TrustedProxies
+// wasn't configured, X-Forwarded-For is ignored entirely, since any client
+// could otherwise set it to disable rate limiting for itself.
+func (h *Hub) clientIP(r *http.Request) net.IP {
+	if len(h.trustedProxies) == 0 {
+		return nil
+	}
+
+	for _, hop := range strings.Split(r.Header.Get("X-Forwarded-For"), ",") {
+		ip := net.ParseIP(strings.TrimSpace(hop))
+		if ip == nil {
+			continue
+		}
+
+		trusted := false
+		for _, proxy := range h.trustedProxies {
+			if proxy.Contains(ip) {
+				trusted = true
+				break
 			}
-		*/
-		ip := net.ParseIP(rawIpStr)
-		if ip != nil {
-			ipStr = ip.String()
 		}
+		if !trusted {
+			return ip
+		}
+	}
+
+	return nil
+}
+
+// ServeAdmin is ServeSocket, but requires ?auth=<HubOptions.Auth> up front
+// (like ServeMap) so an admin console can be exposed on its own path/port
+// without trusting every connection to self-gate via AdminAuth on each
+// Inbound. Still registers a normal SocketClient - AdminAuth is re-checked
+// per command because a single HTTP-layer token check doesn't rate-limit
+// or audit individual commands (see admin.go).
+func (h *Hub) ServeAdmin(w http.ResponseWriter, r *http.Request) {
+	if h.auth == "" || r.URL.Query().Get("auth") != h.auth {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.ServeSocket(w, r)
+}
+
+// ServeEvents is a read-only counterpart to ServeSocket for consumers
+// (spectators, dashboards, a Leaderboard tick viewer) that only want to
+// observe Hub broadcasts rather than open a full bidirectional
+// SocketClient. It streams Outbound messages as Server-Sent Events (see
+// SSEClient) until the peer disconnects. ?topics=leaderboard,chat
+// restricts which of those a caller receives; omitted, it mirrors
+// everything a normal Client would get, including the per-entity Update
+// stream.
+func (h *Hub) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client := NewSSEClient(w, flusher, r.URL.Query().Get("topics"))
+	h.register <- client
+
+	// ServeHTTP must not return before the peer disconnects (or the Hub
+	// destroys the client some other way) - w is only valid for the
+	// lifetime of this call, unlike SocketClient's own goroutines.
+	select {
+	case <-r.Context().Done():
+		client.Destroy()
+	case <-client.done:
+	}
+}
+
+func (h *Hub) ServeSocket(w http.ResponseWriter, r *http.Request) {
+	if h.Draining() {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "server restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	ip := h.clientIP(r)
+	var ipStr string
+	if ip != nil {
+		ipStr = ip.String()
 	}
 
 	if ipStr != "" {
+		if _, banned := h.bannedIPs.Load(ipStr); banned {
+			http.Error(w, "banned", http.StatusForbidden)
+			return
+		}
+
+		if !h.connLimiter.Allow(ipStr) {
+			fmt.Printf("Blocked %s for too many connection attempts\n", ipStr)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many connections", http.StatusTooManyRequests)
+			return
+		}
+
 		h.ipMu.RLock()
 		count := h.ipConns[ipStr]
 		h.ipMu.RUnlock()
 		if count >= 10 {
-			fmt.Printf("Blocked %s for too many connections\n", ipStr)
-			http.Error(w, "Too many connections", 429)
+			fmt.Printf("Blocked %s for too many concurrent connections\n", ipStr)
+			http.Error(w, "Too many connections", http.StatusTooManyRequests)
 			return
 		}
 	}
@@ -57,5 +199,15 @@ func (h *Hub) ServeSocket(w http.ResponseWriter, r *http.Request) {
 		h.ipConns[ipStr]++
 	}
 
-	h.register <- NewSocketClient(conn, ipStr)
+	h.register <- NewSocketClient(conn, ip)
+}
+
+// allowMessage is called by SocketClient.readPump for each inbound message,
+// so a client spamming input frames on one socket is throttled the same way
+// as a client reconnecting rapidly (see RateLimiter).
+func (h *Hub) allowMessage(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+	return h.messageLimiter.Allow(ip.String())
 }
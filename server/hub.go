@@ -5,13 +5,19 @@ package server
 
 import (
 	"fmt"
-	"github.com/SoftbearStudios/mk48/server/cloud"
+	"github.com/SoftbearStudios/mk48/server/bot/script"
+	"github.com/SoftbearStudios/mk48/server/metrics"
 	"github.com/SoftbearStudios/mk48/server/terrain"
 	"github.com/SoftbearStudios/mk48/server/terrain/compressed"
 	"github.com/SoftbearStudios/mk48/server/terrain/noise"
+	"github.com/SoftbearStudios/mk48/server/training"
 	"github.com/SoftbearStudios/mk48/server/world"
 	"github.com/SoftbearStudios/mk48/server/world/sector"
+	"github.com/SoftbearStudios/mk48/server/world/tree"
+	"math/rand"
+	"net"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -21,21 +27,77 @@ const (
 	debugPeriod       = time.Second * 5
 	leaderboardPeriod = time.Second
 	spawnPeriod       = leaderboardPeriod
+	// leaderboardCount is how many players TopPlayers/Hub.topK track.
+	leaderboardCount = 10
+	// leaderboardFullPeriod is how often a delta-capable client gets a full
+	// Leaderboard resync instead of a LeaderboardDelta, bounding how far a
+	// client that missed a delta (e.g. a dropped PriorityReliable send
+	// during a brief disconnect) can drift from the real standings.
+	leaderboardFullPeriod = time.Second * 30
 	updatePeriod      = world.TickPeriod
 
 	// Must spawn atleast this many bots per real player,
 	// to give low-level ships some easier targets
 	minBotRatio = 0.5
 
-	// encodeBotMessages makes BotClient.Send marshal json and check for errors.
-	// Only useful for testing/benchmarking (drops performance significantly).
+	// encodeBotMessages makes BotClient.Send marshal its outbound Message
+	// through jsonCodec and binaryCodec and check for errors. Only useful for
+	// testing/benchmarking (drops performance significantly).
 	encodeBotMessages = false
+
+	// Applied when HubOptions leaves the corresponding rate limit unset.
+	defaultConnRateLimit    = 2 // new connections per second
+	defaultConnRateBurst    = 10
+	defaultMessageRateLimit = 20 // inbound messages per second
+	defaultMessageRateBurst = 40
+	// defaultInboundRateLimit/Burst govern inboundLimiter (see
+	// inboundWeight), a separate, weighted budget from messageLimiter's flat
+	// per-frame one - tuned so a steady stream of cost-1 Manuals at
+	// world.TickPeriod never starves, while a SendChat flood burns through
+	// its burst fast.
+	defaultInboundRateLimit = 20
+	defaultInboundRateBurst = 40
+	// maxInboundViolations is how many consecutive inboundLimiter rejections
+	// a SocketClient can rack up before readPump gives up and destroys the
+	// connection - a client that's still flooding after being told to slow
+	// down (see RateLimited) isn't worth the bandwidth spent telling it again.
+	maxInboundViolations = 5
+
+	// adminAuditRateLimit/Burst throttle AuditAdminCommand calls per
+	// moderator IP (see admin.go); generous enough that a human clicking
+	// around a console never notices, stingy enough to bound a runaway
+	// script's audit-log/metric volume.
+	adminAuditRateLimit = 5
+	adminAuditRateBurst = 20
+
+	// Applied when HubOptions.TerrainSnapshotInterval is left unset.
+	defaultTerrainSnapshotInterval = 5 * time.Minute
+
+	// Applied when HubOptions leaves the corresponding terrain cache field
+	// unset.
+	defaultTerrainPrefetchWorkers = 2
+	defaultTerrainChunkEvictTTL   = 30 * time.Minute
+	// terrainPrefetchRadius is how far around each entity prefetchTerrain
+	// queues chunks, in world units.
+	terrainPrefetchRadius = 1000
+
+	// Applied when HubOptions leaves the corresponding spawn-scoring field
+	// unset (see pickSpawnPosition in spawn_point.go).
+	defaultSpawnMinEnemyDistance  = 150  // hard floor; reject a candidate any closer to a hostile
+	defaultSpawnGoodEnemyDistance = 500  // distance beyond which a candidate earns defaultSpawnGoodDistanceBonus
+	defaultSpawnGoodDistanceBonus = 1000
+	defaultSpawnDistanceWeight    = 1 // score per world unit of distance to the nearest hostile
+	defaultSpawnTeammateDistance  = 300
+	defaultSpawnTeammateBonus     = 300
+	defaultSpawnHazardPenalty     = 2000 // subtracted when a candidate lands inside another boat's collision radius
+	defaultSpawnSensorPenalty     = 500  // subtracted per hostile whose radar/visual cone (see Entity.Camera) covers a candidate
+	defaultSpawnCandidates        = spawnPointCandidates
 )
 
 // Hub maintains the set of active clients and broadcasts messages to the clients.
 type Hub struct {
 	// World state
-	world       *sector.World
+	world       world.World
 	worldRadius float32 // interpolated
 	terrain     terrain.Terrain
 	clients     ClientList // implemented as double-linked list
@@ -45,16 +107,122 @@ type Hub struct {
 	// Flags
 	minPlayers       int
 	botMaxSpawnLevel uint8
+	fleetSize        int // see HubOptions.FleetSize; 1 means the default one-ship-per-player behavior
+	trainingRecorder *training.Recorder // see HubOptions.TrainingRecorder
 	auth             string
+	trustedProxies   []*net.IPNet // parsed from HubOptions.TrustedProxies
+	botProfiles      []BotProfile    // see bot_profile.go; empty means fully-randomized bots
+	botScripts       []script.Script // see bot/script; empty means no scripted bot behavior
+
+	// Spawn-point scoring weights (see pickSpawnPosition in spawn_point.go),
+	// overridable per HubOptions so admins can tune spawn safety per map.
+	spawnMinEnemyDistance  float32
+	spawnGoodEnemyDistance float32
+	spawnGoodDistanceBonus float32
+	spawnDistanceWeight    float32
+	spawnTeammateDistance  float32
+	spawnTeammateBonus     float32
+	spawnHazardPenalty     float32
+	spawnSensorPenalty     float32
+	spawnCandidates        int
 
 	// Cloud (and things that are served atomically by HTTP)
-	cloud      *cloud.Cloud
+	cloud      Cloud
 	statusJSON atomic.Value
 
+	// Rate limiting (see ratelimit.go), shared between ServeSocket (connection
+	// establishment) and SocketClient.readPump (in-session messages).
+	// inboundLimiter is readPump's second, weighted gate applied once a
+	// message is decoded (see inboundWeight), on top of messageLimiter's
+	// flat per-frame one.
+	connLimiter    *RateLimiter
+	messageLimiter *RateLimiter
+	inboundLimiter *RateLimiter
+	ipConns        map[string]int // concurrent connections per IP
+	ipMu           sync.RWMutex
+
+	// Admin/observer console (see admin.go). bannedIPs is checked by
+	// ServeSocket; frozen pauses Physics/Update while still accepting
+	// connections and processing other Inbounds; debugSubscribers receives a
+	// AdminDebugEvent each time Debug runs; adminAuditLimiter throttles how
+	// often a single moderator IP can trigger a cloud.AuditAdminCommand call.
+	bannedIPs         sync.Map // IP string -> struct{}
+	frozen            bool
+	debugSubscribers  map[Client]bool
+	adminAuditLimiter *RateLimiter
+
+	// Sharding (see hub_router.go, handoff.go, border_contacts.go). router
+	// and shardBounds are nil/zero unless this Hub was created by
+	// NewHubRouter; clientCount mirrors clients.Len but is updated
+	// atomically so HubRouter.leastLoaded can read it from another
+	// goroutine; borderContacts is this shard's published snapshot for
+	// neighbors (see publishBorderContacts), refreshed every
+	// leaderboardTicker period. handoff receives Clients transferred in
+	// from a neighboring shard (see Hub.handoffTo).
+	router         *HubRouter
+	shardBounds    world.AABB
+	clientCount    int32
+	borderContacts atomic.Value
+	handoff        chan handoffRequest
+
+	// draining is set by Shutdown (see shutdown.go) and read by ServeSocket,
+	// both from goroutines other than Run, hence atomic rather than a plain
+	// bool like frozen (which is only ever touched from Run's own goroutine
+	// via an Inbound).
+	draining int32
+	shutdown chan shutdownRequest
+
+	// recordFile is non-nil between StartRecording and StopRecording (see
+	// recorder.go).
+	recordFile *os.File
+
+	// tickLog holds the last maxTickLog ticks' WorldSnapshots, oldest first,
+	// so RunAt (see replay.go) can rewind the world for lag-compensated hit
+	// tests and anti-cheat replay without needing StartRecording.
+	tickLog []tickSnapshot
+
+	// packetCapture is non-nil between StartPacketCapture and
+	// StopPacketCapture (see packet_capture.go).
+	packetCapture *packetCapture
+
+	// botRecorder is non-nil between StartBotRecording and StopBotRecording
+	// (see bot_replay.go). nextBotSeq assigns each non-replaying BotClient
+	// its stable sequence number (BotClient.seq); botReplaying is true for
+	// the duration of a ReplayBotLog call.
+	botRecorder  *botReplayRecorder
+	nextBotSeq   uint32
+	botReplaying bool
+
+	// sessionRecorder is non-nil between StartSessionRecording and
+	// StopSessionRecording (see session_record.go); sessionReplaying is true
+	// for the duration of a ReplaySession call. seed is the value NewHub
+	// seeded h.world's EntityID source with (see HubOptions.Seed), recorded
+	// alongside the session log so ReplaySession can reproduce it.
+	sessionRecorder  *sessionRecorder
+	sessionReplaying bool
+	seed             int64
+
 	// chats are buffered until next update.
 	chats []Chat
+	// broadcasts are buffered System Chats from Hub.Broadcast, each paired
+	// with its own per-recipient filter (see filteredChat); drained
+	// alongside chats in updateClient, then cleared at the end of Update.
+	broadcasts []filteredChat
 	// funcBenches are benchmarks of core Hub functions.
 	funcBenches []funcBench
+	// weaponStats accumulates per (attacker ship, attacker armament, victim
+	// ship) fire/hit/damage/kill counts since the last AppendWeaponStats
+	// call (see weapon_stats.go); nil until the first shot is fired.
+	weaponStats map[weaponStatKey]*weaponStatCounts
+
+	// Leaderboard (see leaderboard.go). topK is maintained incrementally
+	// tick-to-tick instead of rebuilt from scratch; lastLeaderboard is its
+	// snapshot as of the last tick (best first), diffed against the new one
+	// to build a LeaderboardDelta; lastLeaderboardFull is when that
+	// snapshot was last sent in full, for leaderboardFullPeriod resync.
+	topK                *world.TopK
+	lastLeaderboard     []world.IDPlayerData
+	lastLeaderboardFull time.Time
 
 	// Inbound channels
 	inbound    chan SignedInbound
@@ -62,47 +230,357 @@ type Hub struct {
 	unregister chan Client
 
 	// Timer based events
-	cloudTicker       *time.Ticker
-	updateTicker      *time.Ticker
-	skippedCounter    int
-	updateCounter     int
-	leaderboardTicker *time.Ticker
-	debugTicker       *time.Ticker
-	botsTicker        *time.Ticker
+	cloudTicker         *time.Ticker
+	updateTicker        *time.Ticker
+	skippedCounter      int
+	updateCounter       int
+	physicsTick         uint32 // incremented once per Physics call; seeds deterministic per-entity Rngs
+	sentTerrainKeyframe bool   // whether SnapshotTerrain has uploaded its first keyframe yet
+	leaderboardTicker   *time.Ticker
+	debugTicker         *time.Ticker
+	botsTicker          *time.Ticker
 }
 
-func NewHub(minPlayers int, botMaxSpawnLevel int, auth string) *Hub {
-	c, err := cloud.New()
-	if err != nil {
-		fmt.Println("Cloud error:", err)
+// HubOptions configures NewHub. Zero-valued fields take sane defaults,
+// except Cloud, which must be set explicitly (use Offline{} for none).
+type HubOptions struct {
+	Cloud            Cloud
+	MinClients       int
+	MaxBotSpawnLevel uint8
+	Auth             string
+
+	// TrainingRecorder, if set, is shared by TrainingBots headless BotClients
+	// that each feed it one server.Rasterize frame plus their chosen action
+	// and ensuing reward per tick (see server/training and
+	// Hub.registerTrainingBots). Leaving it nil (the default) disables
+	// training recording entirely - no extra bots are registered and
+	// regular bots are untouched.
+	TrainingRecorder *training.Recorder
+	// TrainingBots is how many dedicated headless bots NewHub registers to
+	// feed TrainingRecorder. Ignored (and defaulted to 0) when
+	// TrainingRecorder is nil.
+	TrainingBots int
+
+	// FleetSize is how many ships a single Client may control at once: the
+	// primary one (Player.EntityID) plus FleetSize-1 additional hulls
+	// (Player.EntityIDs), spawned by repeated Spawn inbounds and steered
+	// individually via Manual's EntityID selector (see Spawn.Process and
+	// Manual.Process in inbound.go). Defaults to 1 (the original
+	// one-ship-per-player behavior) when left at zero.
+	FleetSize int
+
+	// ConnRateLimit/ConnRateBurst govern new connections per IP (see
+	// ServeSocket); MessageRateLimit/MessageRateBurst govern inbound
+	// messages per IP once connected (see SocketClient.readPump). All four
+	// default to defaultConnRateLimit/defaultConnRateBurst/
+	// defaultMessageRateLimit/defaultMessageRateBurst when left at zero.
+	ConnRateLimit    float64
+	ConnRateBurst    float64
+	MessageRateLimit float64
+	MessageRateBurst float64
+
+	// InboundRateLimit/InboundRateBurst govern inboundLimiter, the
+	// per-IP budget individual Inbound messages are weighed against once
+	// decoded (see inboundWeight); defaults to defaultInboundRateLimit/
+	// defaultInboundRateBurst when left at zero.
+	InboundRateLimit float64
+	InboundRateBurst float64
+
+	// TrustedProxies is the list of CIDRs (e.g. "10.0.0.0/8") allowed to set
+	// X-Forwarded-For. The left-most address not in this list is used as the
+	// client's IP; if empty, X-Forwarded-For is ignored entirely.
+	TrustedProxies []string
+
+	// BotProfiles is the pool BotClient.Init picks from (see LoadBotProfiles).
+	// Leaving it empty preserves the old fully-randomized bot behavior.
+	BotProfiles []BotProfile
+
+	// BotScripts is the weighted pool BotClient.Init picks a script.Script
+	// from (see script.Load), layered on top of BotProfiles. Leaving it
+	// empty means bots are driven entirely by BotProfiles/aggression as
+	// before script.Script existed.
+	BotScripts []script.Script
+
+	// Terrain selects and configures the terrain.Source NewHub builds the
+	// world's terrain from. Leaving Terrain.Source empty keeps the old
+	// hard-coded noise.NewDefault() behavior.
+	Terrain TerrainOptions
+
+	// TerrainSnapshotDir, if set, is loaded at startup (see
+	// compressed.Terrain.Load) and periodically re-snapshotted (see
+	// compressed.Terrain.StartAutoSnapshot) so player-sculpted terrain
+	// survives a restart. Leaving it empty disables both.
+	TerrainSnapshotDir string
+	// TerrainSnapshotInterval is how often TerrainSnapshotDir is refreshed.
+	// Defaults to defaultTerrainSnapshotInterval when left at zero.
+	TerrainSnapshotInterval time.Duration
+
+	// TerrainPrefetchWorkers is how many goroutines drain the background
+	// chunk-generation queue prefetchTerrain feeds (see
+	// compressed.Terrain.StartWorkers). Defaults to
+	// defaultTerrainPrefetchWorkers when left at zero.
+	TerrainPrefetchWorkers int
+	// TerrainChunkEvictTTL is how long an un-sculpted chunk may sit unused
+	// before compressed.Terrain frees it. Defaults to
+	// defaultTerrainChunkEvictTTL when left at zero; a negative value
+	// disables eviction entirely.
+	TerrainChunkEvictTTL time.Duration
+
+	// Seed, if nonzero, replaces the world's EntityID source (see
+	// world.World.SetRand) with one seeded from this value, so entity ID
+	// assignment is reproducible. Used by StartSessionRecording/
+	// ReplaySession (see session_record.go); leaving it zero keeps the
+	// default random, non-reproducible source.
+	Seed int64
+
+	// SpawnMinEnemyDistance/SpawnGoodEnemyDistance/SpawnGoodDistanceBonus/
+	// SpawnDistanceWeight/SpawnTeammateDistance/SpawnTeammateBonus/
+	// SpawnHazardPenalty/SpawnSensorPenalty tune pickSpawnPosition's
+	// candidate scoring (see spawn_point.go). All default to their
+	// defaultSpawn* constant when left at zero.
+	SpawnMinEnemyDistance  float32
+	SpawnGoodEnemyDistance float32
+	SpawnGoodDistanceBonus float32
+	SpawnDistanceWeight    float32
+	SpawnTeammateDistance  float32
+	SpawnTeammateBonus     float32
+	SpawnHazardPenalty     float32
+	SpawnSensorPenalty     float32
+
+	// SpawnCandidates is how many candidate positions pickSpawnPosition
+	// samples per radius attempt (see spawnPointCandidates in
+	// spawn_point.go). Defaults to defaultSpawnCandidates when left at zero;
+	// operators trade spawn quality for CPU by raising or lowering it.
+	SpawnCandidates int
+
+	// World selects the world.World implementation NewHub backs the Hub
+	// with: "sector" (default, the original grid-of-sectors World) or
+	// "tree" (the loose-quadtree World in world/tree), so the two can be
+	// A/B tested against each other. An unrecognized value falls back to
+	// "sector".
+	World string
+
+	// ShardBounds restricts this Hub's world to a rectangular slab and
+	// enables cross-shard handoff/border contacts (see hub_router.go). Left
+	// at its zero value, a Hub is unsharded: every entity belongs to it and
+	// handoffBoundaryCrossings/publishBorderContacts are no-ops. Set by
+	// NewHubRouter; not meant to be configured directly by callers of
+	// NewHub.
+	ShardBounds world.AABB
+}
+
+// TerrainOptions configures HubOptions.Terrain.
+type TerrainOptions struct {
+	// Source is a name registered with terrain.RegisterSource, e.g.
+	// "perlin", "ridged-multifractal", "worley-islands" or
+	// "hydraulic-erosion" (see their respective packages). The process must
+	// have imported the package that registers Source, typically via a
+	// blank import in main, e.g. server_main. Empty defaults to "perlin".
+	Source string
+	// Params is passed to Source's factory as-is, e.g. noise.Params
+	// marshalled to JSON; nil lets the factory fall back to its own
+	// defaults.
+	Params []byte
+}
+
+func NewHub(options HubOptions) *Hub {
+	fmt.Println(options.Cloud)
+
+	botMaxSpawnLevel := options.MaxBotSpawnLevel
+	if botMaxSpawnLevel > world.BoatLevelMax {
+		botMaxSpawnLevel = world.BoatLevelMax
 	}
-	fmt.Println(c)
 
-	if botMaxSpawnLevel > int(world.BoatLevelMax) {
-		botMaxSpawnLevel = int(world.BoatLevelMax)
+	if options.ConnRateLimit <= 0 {
+		options.ConnRateLimit = defaultConnRateLimit
+	}
+	if options.ConnRateBurst <= 0 {
+		options.ConnRateBurst = defaultConnRateBurst
+	}
+	if options.MessageRateLimit <= 0 {
+		options.MessageRateLimit = defaultMessageRateLimit
+	}
+	if options.MessageRateBurst <= 0 {
+		options.MessageRateBurst = defaultMessageRateBurst
+	}
+	if options.InboundRateLimit <= 0 {
+		options.InboundRateLimit = defaultInboundRateLimit
+	}
+	if options.InboundRateBurst <= 0 {
+		options.InboundRateBurst = defaultInboundRateBurst
+	}
+	if options.TerrainSnapshotInterval <= 0 {
+		options.TerrainSnapshotInterval = defaultTerrainSnapshotInterval
+	}
+	if options.TerrainPrefetchWorkers <= 0 {
+		options.TerrainPrefetchWorkers = defaultTerrainPrefetchWorkers
+	}
+	if options.TerrainChunkEvictTTL == 0 {
+		options.TerrainChunkEvictTTL = defaultTerrainChunkEvictTTL
 	}
 
+	if options.SpawnMinEnemyDistance <= 0 {
+		options.SpawnMinEnemyDistance = defaultSpawnMinEnemyDistance
+	}
+	if options.SpawnGoodEnemyDistance <= 0 {
+		options.SpawnGoodEnemyDistance = defaultSpawnGoodEnemyDistance
+	}
+	if options.SpawnGoodDistanceBonus <= 0 {
+		options.SpawnGoodDistanceBonus = defaultSpawnGoodDistanceBonus
+	}
+	if options.SpawnDistanceWeight <= 0 {
+		options.SpawnDistanceWeight = defaultSpawnDistanceWeight
+	}
+	if options.SpawnTeammateDistance <= 0 {
+		options.SpawnTeammateDistance = defaultSpawnTeammateDistance
+	}
+	if options.SpawnTeammateBonus <= 0 {
+		options.SpawnTeammateBonus = defaultSpawnTeammateBonus
+	}
+	if options.SpawnHazardPenalty <= 0 {
+		options.SpawnHazardPenalty = defaultSpawnHazardPenalty
+	}
+	if options.SpawnSensorPenalty <= 0 {
+		options.SpawnSensorPenalty = defaultSpawnSensorPenalty
+	}
+	if options.SpawnCandidates <= 0 {
+		options.SpawnCandidates = defaultSpawnCandidates
+	}
+	if options.FleetSize <= 0 {
+		options.FleetSize = 1
+	}
+
+	var trustedProxies []*net.IPNet
+	for _, cidr := range options.TrustedProxies {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			trustedProxies = append(trustedProxies, ipNet)
+		} else {
+			fmt.Println("invalid trusted proxy CIDR:", cidr, err)
+		}
+	}
+
+	minPlayers := options.MinClients
 	radius := max(world.MinRadius, world.RadiusOf(minPlayers))
-	return &Hub{
-		cloud:             c,
-		world:             sector.New(radius),
-		terrain:           compressed.New(noise.NewDefault()),
+	compressedTerrain := compressed.New(newTerrainSource(options.Terrain))
+
+	if options.TerrainSnapshotDir != "" {
+		if err := compressedTerrain.Load(options.TerrainSnapshotDir); err != nil {
+			fmt.Println("loading terrain snapshot:", err)
+		}
+		compressedTerrain.StartAutoSnapshot(options.TerrainSnapshotDir, options.TerrainSnapshotInterval)
+	}
+	// Runs for the lifetime of the process, same as StartAutoSnapshot above.
+	compressedTerrain.StartWorkers(options.TerrainPrefetchWorkers, options.TerrainChunkEvictTTL)
+
+	var w world.World
+	switch options.World {
+	case "tree":
+		w = tree.New(int(radius))
+	default:
+		w = sector.New(radius)
+	}
+	if options.Seed != 0 {
+		w.SetRand(rand.New(rand.NewSource(options.Seed)))
+	}
+	// single.World and sector.World both optionally report operation timings
+	// via metrics.Recorder (see server/metrics); tree.World doesn't implement
+	// SetRecorder yet, hence the interface assertion instead of a world.World
+	// method, matching the *Prometheus type-assertion pattern used elsewhere
+	// in this file.
+	if recorder, ok := options.Cloud.(*Prometheus); ok {
+		if settable, ok := w.(interface{ SetRecorder(metrics.Recorder) }); ok {
+			settable.SetRecorder(recorder)
+		}
+	}
+
+	h := &Hub{
+		cloud:             options.Cloud,
+		world:             w,
+		terrain:           compressedTerrain,
 		worldRadius:       radius,
 		teams:             make(map[world.TeamID]*Team),
 		minPlayers:        minPlayers,
-		botMaxSpawnLevel:  uint8(botMaxSpawnLevel),
-		auth:              auth,
+		botMaxSpawnLevel:  botMaxSpawnLevel,
+		fleetSize:         options.FleetSize,
+		trainingRecorder:  options.TrainingRecorder,
+		auth:              options.Auth,
+		trustedProxies:    trustedProxies,
+		botProfiles:       options.BotProfiles,
+		botScripts:        options.BotScripts,
+		connLimiter:       NewRateLimiter(options.ConnRateLimit, options.ConnRateBurst),
+		messageLimiter:    NewRateLimiter(options.MessageRateLimit, options.MessageRateBurst),
+		inboundLimiter:    NewRateLimiter(options.InboundRateLimit, options.InboundRateBurst),
+		adminAuditLimiter: NewRateLimiter(adminAuditRateLimit, adminAuditRateBurst),
+		debugSubscribers:  make(map[Client]bool),
+		shardBounds:       options.ShardBounds,
+		handoff:           make(chan handoffRequest, 8),
+		shutdown:          make(chan shutdownRequest),
+		ipConns:           make(map[string]int),
 		inbound:           make(chan SignedInbound, 16+minPlayers*2),
 		register:          make(chan Client, 8+minPlayers/256),
 		unregister:        make(chan Client, 16+minPlayers/128),
-		cloudTicker:       time.NewTicker(cloud.UpdatePeriod),
+		cloudTicker:       time.NewTicker(options.Cloud.UpdatePeriod()),
 		updateTicker:      time.NewTicker(updatePeriod),
 		leaderboardTicker: time.NewTicker(leaderboardPeriod),
 		debugTicker:       time.NewTicker(debugPeriod),
 		botsTicker:        time.NewTicker(botPeriod),
+		seed:              options.Seed,
+		topK:              world.NewTopK(leaderboardCount),
+
+		spawnMinEnemyDistance:  options.SpawnMinEnemyDistance,
+		spawnGoodEnemyDistance: options.SpawnGoodEnemyDistance,
+		spawnGoodDistanceBonus: options.SpawnGoodDistanceBonus,
+		spawnDistanceWeight:    options.SpawnDistanceWeight,
+		spawnTeammateDistance:  options.SpawnTeammateDistance,
+		spawnTeammateBonus:     options.SpawnTeammateBonus,
+		spawnHazardPenalty:     options.SpawnHazardPenalty,
+		spawnSensorPenalty:     options.SpawnSensorPenalty,
+		spawnCandidates:        options.SpawnCandidates,
+	}
+
+	// Registered synchronously here, not via h.register: Run hasn't started
+	// its goroutine yet at this point, and h.register is bounded, so a
+	// caller asking for more TrainingBots than that capacity would deadlock
+	// if sent through the channel like a normal client connection.
+	h.registerTrainingBots(options.TrainingRecorder, options.TrainingBots)
+
+	return h
+}
+
+// registerTrainingBots registers count dedicated headless BotClients that
+// each feed recorder one server.Rasterize frame plus their action and
+// reward per tick (see BotClient.recordTrainingFrame). A nil recorder or
+// non-positive count registers nothing, leaving ordinary bot spawning
+// (Hub.botsTicker) completely untouched.
+func (h *Hub) registerTrainingBots(recorder *training.Recorder, count int) {
+	if recorder == nil || count <= 0 {
+		return
+	}
+	for i := 0; i < count; i++ {
+		bot := &BotClient{recordTraining: true}
+		h.recordSessionRegister(bot)
+		h.clients.Add(bot)
+		bot.Data().Hub = h
+		bot.Init()
+		atomic.AddInt32(&h.clientCount, 1)
 	}
 }
 
+// newTerrainSource builds the terrain.Source NewHub generates the world
+// from options.Terrain, falling back to noise.NewDefault() when Source is
+// empty or unregistered (e.g. its package was never blank-imported).
+func newTerrainSource(options TerrainOptions) terrain.Source {
+	if options.Source == "" {
+		return noise.NewDefault()
+	}
+	source, err := terrain.NewSource(options.Source, options.Params)
+	if err != nil {
+		fmt.Println("terrain source:", err)
+		return noise.NewDefault()
+	}
+	return source
+}
+
 func (h *Hub) Run() {
 	defer func() {
 		if r := recover(); r != nil {
@@ -117,17 +595,31 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
+			h.recordSessionRegister(client)
+
 			h.clients.Add(client)
 			client.Data().Hub = h
 			client.Init()
+			atomic.AddInt32(&h.clientCount, 1)
 
 			if !client.Bot() {
 				h.cloud.IncrementPlayerStatistic()
+				h.cloud.RecordPlayerLocation(client.Data().Player.Player.PlayerID(), client.IP())
 			}
+		case req := <-h.handoff:
+			h.receiveHandoff(req)
+		case req := <-h.shutdown:
+			h.beginShutdown(req)
 		case client := <-h.unregister:
+			h.recordSessionUnregister(client)
+
 			client.Close()
 			player := &client.Data().Player.Player
 
+			if !client.Bot() {
+				h.cloud.ForgetPlayerLocation(player.PlayerID())
+			}
+
 			// Player no longer is joining teams
 			// May want to do this during despawn because clearing team requests in O(n).
 			h.clearTeamRequests(player)
@@ -137,10 +629,17 @@ func (h *Hub) Run() {
 
 			client.Data().Hub = nil
 			h.clients.Remove(client)
+			atomic.AddInt32(&h.clientCount, -1)
+			delete(h.debugSubscribers, client)
 
 			// Remove in Despawn during leaderboard update.
 			h.despawn.Add(client)
 		case in := <-h.inbound:
+			// Metric for the same AdminDumpFuncBenches/Prometheus reporting
+			// Leaderboard/Physics/Update use; covers this whole batch, not
+			// per-message, to match their whole-tick granularity.
+			start := time.Now()
+
 			// Read all messages currently in the channel
 			n := len(h.inbound)
 
@@ -148,6 +647,8 @@ func (h *Hub) Run() {
 				// If not same hub the message is old
 				data := in.Client.Data()
 				if h == data.Hub {
+					h.recordSessionInbound(in.Client, in.Inbound)
+					h.captureInbound(data.Player.PlayerID(), in.Inbound)
 					in.Inbound(h, in.Client, &data.Player)
 				}
 
@@ -157,6 +658,7 @@ func (h *Hub) Run() {
 
 				in = <-h.inbound
 			}
+			h.timeFunction("inbound", start)
 		case updateTime := <-h.updateTicker.C:
 			now := time.Now()
 			if missed := now.Sub(updateTime) - updatePeriod/10; missed > 0 {
@@ -174,19 +676,36 @@ func (h *Hub) Run() {
 			ticks := world.Ticks(h.skippedCounter) + 1
 			h.skippedCounter = 0
 
+			if h.frozen {
+				// AdminSetFrozen paused the world; keep accepting
+				// connections/Inbounds but don't advance it.
+				break
+			}
+
+			tickStart := time.Now()
 			h.Physics(ticks)
 			h.Update()
+			if p, ok := h.cloud.(*Prometheus); ok {
+				p.ObserveTick(time.Since(tickStart))
+			}
 		case <-h.leaderboardTicker.C:
 			h.terrain.Repair()
+			h.prefetchTerrain()
 			h.Despawn()
 			h.Spawn()
 			h.Leaderboard()
+			h.updateSquads()
 
 			h.worldRadius = world.Lerp(h.worldRadius, world.RadiusOf(h.clients.Len), 0.25)
 			h.world.Resize(h.worldRadius)
+
+			h.handoffBoundaryCrossings()
+			h.publishBorderContacts()
 		case <-h.debugTicker.C:
 			h.Debug()
 			h.SnapshotTerrain()
+			_ = h.AppendWeaponStats("/tmp/mk48-weaponstats.log")
+			h.broadcastDebugEvent()
 		case <-h.botsTicker.C:
 			// There are two reasons to add bots:
 			// - When minPlayers is not met by bots + clients
@@ -217,6 +736,17 @@ func (h *Hub) Run() {
 	}
 }
 
+// InjectSigned delivers in to Run's inbound case as if its Client had sent
+// it over a real connection. It's meant for a headless harness replaying a
+// pre-recorded trace of SignedInbound (see ReplayClient), so unlike
+// BotClient.receiveAsync - which drops under congestion, fine for a bot that
+// will just act again next tick - InjectSigned blocks until delivered, since
+// a replay missing even one message would desync from what was recorded.
+// in.Client must already be registered (see h.register) before calling this.
+func (h *Hub) InjectSigned(in SignedInbound) {
+	h.inbound <- in
+}
+
 func (h *Hub) clearTeamRequests(player *world.Player) {
 	for _, team := range h.teams {
 		team.JoinRequests.Remove(player)
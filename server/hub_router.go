@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+	"net/http"
+	"sync/atomic"
+)
+
+// HubRouter fronts N Hubs, each pinned to its own goroutine and owning a
+// vertical slab of the world (a contiguous range of X), so the per-tick
+// Physics/Update work in updateTicker scales with cores instead of
+// bottlenecking a single Hub once clients.Len grows. Shards are fixed-width
+// at startup; there is no dynamic rebalancing.
+type HubRouter struct {
+	hubs []*Hub
+}
+
+// NewHubRouter creates shardCount Hubs from the same options, each given an
+// equal-width vertical slab of the world (see HubOptions.ShardBounds),
+// wires each Hub's router field so handoff.go and border_contacts.go can
+// reach neighbors, and starts them running on their own goroutines.
+// shardCount less than 1 is treated as 1 (a single, unsharded Hub).
+func NewHubRouter(shardCount int, options HubOptions) *HubRouter {
+	if shardCount < 1 {
+		shardCount = 1
+	}
+
+	radius := max(world.MinRadius, world.RadiusOf(options.MinClients))
+	sliceWidth := radius * 2 / float32(shardCount)
+
+	router := &HubRouter{hubs: make([]*Hub, shardCount)}
+	for i := 0; i < shardCount; i++ {
+		shardOptions := options
+		shardOptions.ShardBounds = world.AABBFrom(-radius+sliceWidth*float32(i), -radius, sliceWidth, radius*2)
+
+		hub := NewHub(shardOptions)
+		hub.router = router
+		router.hubs[i] = hub
+
+		go hub.Run()
+	}
+	return router
+}
+
+// shardFor returns the Hub whose ShardBounds currently owns x, clamping to
+// the outermost shard if x has drifted past the original radius (worldRadius
+// itself is lerped over time in Hub.Run, but ShardBounds are fixed at
+// startup).
+func (r *HubRouter) shardFor(x float32) *Hub {
+	for _, hub := range r.hubs {
+		if x < hub.shardBounds.X+hub.shardBounds.Width {
+			return hub
+		}
+	}
+	return r.hubs[len(r.hubs)-1]
+}
+
+// leastLoaded picks the Hub with the fewest clients, used to place a brand
+// new connection, which doesn't have a world position to shard by yet (it
+// gets handed off to the correct shard once it spawns and crosses a
+// boundary; see handoff.go). clientCount is updated atomically so this can
+// be read from the HTTP goroutine without taking each Hub's loop lock - the
+// rest of Hub is only safe to touch from its own Run goroutine.
+func (r *HubRouter) leastLoaded() *Hub {
+	best := r.hubs[0]
+	bestCount := atomic.LoadInt32(&best.clientCount)
+	for _, hub := range r.hubs[1:] {
+		if count := atomic.LoadInt32(&hub.clientCount); count < bestCount {
+			best, bestCount = hub, count
+		}
+	}
+	return best
+}
+
+// ServeSocket upgrades to the least-loaded shard; see leastLoaded.
+func (r *HubRouter) ServeSocket(w http.ResponseWriter, req *http.Request) {
+	r.leastLoaded().ServeSocket(w, req)
+}
+
+// ServeAdmin upgrades to the least-loaded shard's admin console.
+func (r *HubRouter) ServeAdmin(w http.ResponseWriter, req *http.Request) {
+	r.leastLoaded().ServeAdmin(w, req)
+}
+
+// ServeIndex reports the status of the least-loaded shard. Good enough for
+// a liveness check; a true aggregate player count would need to sum
+// statusJSON across every shard.
+func (r *HubRouter) ServeIndex(w http.ResponseWriter, req *http.Request) {
+	r.leastLoaded().ServeIndex(w, req)
+}
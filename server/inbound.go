@@ -4,6 +4,7 @@
 package server
 
 import (
+	"fmt"
 	"github.com/SoftbearStudios/mk48/server/world"
 	"github.com/finnbear/moderation"
 	"math/rand"
@@ -27,6 +28,12 @@ type (
 		Target world.Vec2f `json:"target"`
 	}
 
+	// SetActive toggles your ship's dual-mode sensors (see world.SensorMode)
+	// between actively emitting and passively listening.
+	SetActive struct {
+		Active bool `json:"active"`
+	}
+
 	// CreateTeam creates a new team
 	CreateTeam struct {
 		Name string `json:"name"`
@@ -66,10 +73,14 @@ type (
 		PlayerID world.PlayerID `json:"playerID"`
 	}
 
-	// SendChat sends a chat message to global chat.
+	// SendChat sends a chat message to global chat. A Message beginning with
+	// '/' is instead routed to the slash-command tree (see command.go) and
+	// never broadcast; Auth unlocks admin-only commands the same way
+	// Spawn.Auth unlocks admin-only spawns.
 	SendChat struct {
 		Message string `json:"message"`
 		Team    bool   `json:"team"`
+		Auth    string `json:"auth"`
 	}
 
 	// Spawn spawns your ship.
@@ -92,6 +103,26 @@ type (
 	}
 )
 
+// inboundWeight is how many inboundLimiter tokens processing in costs (see
+// HubOptions.InboundRateLimit/SocketClient.readPump). SendChat is weighted heaviest
+// since a chat flood is both disruptive to other players and cheap for an
+// attacker to generate; team-membership changes and Spawn are weighted
+// lightly above the default since they touch shared state (a Team, or a
+// fresh entity) rather than just the sender's own ship. Everything else -
+// Manual, AimTurrets, SetActive, Fire, Upgrade, Trace, Pay - costs the
+// default 1, since a normal client already sends several of these every
+// world.TickPeriod as a matter of course.
+func inboundWeight(in Inbound) float64 {
+	switch in.(type) {
+	case SendChat:
+		return 5
+	case CreateTeam, AddToTeam, RemoveFromTeam, Spawn:
+		return 2
+	default:
+		return 1
+	}
+}
+
 func init() {
 	registerInbound(
 		AddToTeam{},
@@ -102,6 +133,7 @@ func init() {
 		Pay{},
 		RemoveFromTeam{},
 		SendChat{},
+		SetActive{},
 		Spawn{},
 		Trace{},
 		Upgrade{},
@@ -163,6 +195,7 @@ func (data AddToTeam) Process(h *Hub, _ Client, player *Player) {
 		team.Members.Add(joiningPlayer)
 
 		joiningPlayer.TeamID = player.TeamID
+		h.announceTeam(team, fmt.Sprintf("%s joined the team.", joiningPlayer.Name))
 	} else if player.PlayerID() == playerID {
 		if len(team.Members)+len(team.JoinRequests) >= world.TeamMembersMax {
 			return // Team with requests is full
@@ -174,6 +207,9 @@ func (data AddToTeam) Process(h *Hub, _ Client, player *Player) {
 		}
 
 		team.JoinRequests.Add(&player.Player)
+		if owner := h.playerOf(team.Owner()); owner != nil {
+			h.SendSystem(owner, fmt.Sprintf("%s requested to join the team.", player.Name))
+		}
 	} // else possibly needed for voting system in future
 }
 
@@ -205,6 +241,8 @@ func (data CreateTeam) Process(h *Hub, _ Client, player *Player) {
 	team := &Team{}
 	team.Create(&player.Player)
 	h.teams[teamID] = team
+
+	h.SendSystem(player, fmt.Sprintf("Created team %s.", name))
 }
 
 func (data RemoveFromTeam) Process(h *Hub, _ Client, player *Player) {
@@ -224,7 +262,11 @@ func (data RemoveFromTeam) Process(h *Hub, _ Client, player *Player) {
 	// You can remove yourself or other if you are owner
 	if removePlayer != nil {
 		if &player.Player == team.Owner() || &player.Player == removePlayer {
+			teamID, removedName := player.TeamID, removePlayer.Name
 			h.leaveTeam(removePlayer)
+			if team := h.teams[teamID]; team != nil {
+				h.announceTeam(team, fmt.Sprintf("%s left the team.", removedName))
+			}
 		}
 	} else if &player.Player == team.Owner() {
 		// Deny join request
@@ -237,8 +279,14 @@ func (data RemoveFromTeam) Process(h *Hub, _ Client, player *Player) {
 
 func (data Spawn) Process(h *Hub, client Client, player *Player) {
 	h.world.EntityByID(player.EntityID, func(oldShip *world.Entity) (_ bool) {
-		if oldShip != nil {
-			return // can only have one ship
+		// addingToFleet is a second (or third, ...) Spawn from a player who
+		// already has a primary ship. Only a fleet-capable Hub
+		// (HubOptions.FleetSize > 1, see hub.go) allows this instead of
+		// rejecting it outright as "can only have one ship" - see
+		// world.Player.EntityIDs.
+		addingToFleet := oldShip != nil
+		if addingToFleet && (h.fleetSize <= 1 || len(player.EntityIDs) >= h.fleetSize-1) {
+			return
 		}
 
 		authed := h.auth != "" && data.Auth == h.auth
@@ -253,36 +301,40 @@ func (data Spawn) Process(h *Hub, client Client, player *Player) {
 			return
 		}
 
-		name, ok := sanitize(data.Name, true, world.PlayerNameLengthMin, world.PlayerNameLengthMax)
-		// Invalid name
-		if !ok {
-			return
-		}
+		// Name/score/team-code handling only applies to a player's first
+		// ship - a fleet addition keeps the identity already established.
+		if !addingToFleet {
+			name, ok := sanitize(data.Name, true, world.PlayerNameLengthMin, world.PlayerNameLengthMax)
+			// Invalid name
+			if !ok {
+				return
+			}
 
-		if authed {
-			player.Score += 1000
-		} else {
-			// Moderate name
-			lower := strings.ToLower(name)
-			for _, reservedName := range reservedNames {
-				if lower == reservedName {
-					println("blocked reserved name", name)
-					return // reserved
+			if authed {
+				player.Score += 1000
+			} else {
+				// Moderate name
+				lower := strings.ToLower(name)
+				for _, reservedName := range reservedNames {
+					if lower == reservedName {
+						println("blocked reserved name", name)
+						return // reserved
+					}
 				}
 			}
-		}
-		player.Name = name
-
-		// Team codes
-		if code := data.Code; code != world.TeamCodeInvalid && player.TeamID == world.TeamIDInvalid {
-			for teamID, team := range h.teams {
-				if team.Code == code {
-					if !team.Full() {
-						h.clearTeamRequests(&player.Player)
-						team.Members.Add(&player.Player)
-						player.TeamID = teamID
+			player.Name = name
+
+			// Team codes
+			if code := data.Code; code != world.TeamCodeInvalid && player.TeamID == world.TeamIDInvalid {
+				for teamID, team := range h.teams {
+					if team.Code == code {
+						if !team.Full() {
+							h.clearTeamRequests(&player.Player)
+							team.Members.Add(&player.Player)
+							player.TeamID = teamID
+						}
+						break
 					}
-					break
 				}
 			}
 		}
@@ -292,9 +344,19 @@ func (data Spawn) Process(h *Hub, client Client, player *Player) {
 		}
 
 		entity.Initialize(data.Type)
+		spawnCenter := world.Vec2f{}
 		spawnRadius := h.worldRadius * 0.75
 
-		if team := h.teams[player.TeamID]; team != nil && player.CanRespawnWithTeam() {
+		var teammate *world.Vec2f
+		canRespawnWithTeam := player.CanRespawnWithTeam()
+
+		if addingToFleet {
+			// Rally an additional hull next to the primary ship rather than
+			// re-running the team-rally/world-center logic below, which is
+			// about placing a player's very first ship of the session.
+			spawnCenter = oldShip.Position
+			spawnRadius = 200
+		} else if team := h.teams[player.TeamID]; team != nil && canRespawnWithTeam {
 			// Spawn near the first other team member with a ship
 			for _, member := range team.Members {
 				if member == &player.Player {
@@ -307,7 +369,9 @@ func (data Spawn) Process(h *Hub, client Client, player *Player) {
 					if memberShip == nil {
 						return
 					}
-					entity.Position = memberShip.Position
+					pos := memberShip.Position
+					spawnCenter = pos
+					teammate = &pos
 					spawnRadius = 200
 					spawned = true
 					return
@@ -319,11 +383,23 @@ func (data Spawn) Process(h *Hub, client Client, player *Player) {
 			}
 		}
 
-		if h.spawnEntity(entity, spawnRadius) == world.EntityIDInvalid {
+		if !h.pickSpawnPosition(entity, spawnCenter, spawnRadius, teammate, canRespawnWithTeam) {
+			// No safe spawn point found within the allowed radius
+			return
+		}
+
+		if h.spawnEntity(entity, 0) == world.EntityIDInvalid {
 			// Spawn failed
 			return
 		}
 
+		if addingToFleet {
+			return
+		}
+
+		if player.DeathReason.Type != "" {
+			h.SendSystem(player, deathMessage(player.DeathReason))
+		}
 		player.ClearDeath()
 
 		if !bot {
@@ -364,7 +440,18 @@ func (data AimTurrets) Process(h *Hub, _ Client, player *Player) {
 	})
 }
 
-func (data Fire) Process(h *Hub, _ Client, player *Player) {
+func (data SetActive) Process(h *Hub, _ Client, player *Player) {
+	h.world.EntityByID(player.EntityID, func(entity *world.Entity) (_ bool) {
+		if entity == nil || entity.Owner != &player.Player {
+			return
+		}
+
+		entity.SetActive(data.Active)
+		return
+	})
+}
+
+func (data Fire) Process(h *Hub, client Client, player *Player) {
 	h.world.EntityByID(player.EntityID, func(entity *world.Entity) (_ bool) {
 		if entity == nil || entity.Owner != &player.Player {
 			return
@@ -439,6 +526,7 @@ func (data Fire) Process(h *Hub, _ Client, player *Player) {
 
 		if !failed {
 			entity.ConsumeArmament(data.Index)
+			h.recordWeaponFired(entity.EntityType, armamentData.Type, client.Bot())
 		}
 
 		return
@@ -498,6 +586,15 @@ func (data Pay) Process(h *Hub, _ Client, player *Player) {
 			},
 		}
 
+		// Look for a spot near the requested position that doesn't overlap
+		// the paying ship (or another coin already there) before falling
+		// back to spawnEntity's own jitter, so dropped coins don't spawn
+		// stacked on top of each other at a busy depositor/HQ.
+		coinRadius := world.EntityTypeCoin.Data().Radius
+		if spot, ok := world.ForFreeSpotNear(h.world, data.Position, entityData.Radius, coinRadius, h.worldRadius); ok {
+			paymentEntity.Position = spot
+		}
+
 		if h.spawnEntity(paymentEntity, 1) != world.EntityIDInvalid {
 			// Payment successful, subtract funds
 			player.Score -= withdraw
@@ -512,10 +609,17 @@ func (data SendChat) Process(h *Hub, client Client, player *Player) {
 		return
 	}
 
+	if strings.HasPrefix(data.Message, "/") {
+		authed := h.auth != "" && data.Auth == h.auth
+		reply, teamOnly := h.runCommand(client, player, authed, data.Message[1:])
+		h.deliverCommandReply(client, player, reply, teamOnly)
+		return
+	}
+
 	name := player.Name
 
 	// Allow spamming ones own team, since you can get kicked
-	msg, ok := player.ChatHistory.Update(data.Message, data.Team)
+	msg, decision := player.ChatHistory.Update(data.Message, data.Team)
 
 	t := "user"
 	if client.Bot() {
@@ -524,18 +628,19 @@ func (data SendChat) Process(h *Hub, client Client, player *Player) {
 
 	_ = AppendLog("/tmp/mk48-chat.log", []interface{}{
 		time.Now().UnixNano() / 1e6,
-		!ok,
+		decision.Block,
+		decision.Reasons,
 		name,
 		t,
 		data.Message,
 		msg,
 	})
 
-	if !ok {
+	if decision.Block {
 		return
 	}
 
-	msg, ok = sanitize(msg, false, 1, 128)
+	msg, ok := sanitize(msg, false, 1, 128)
 	if !ok {
 		return
 	}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/SoftbearStudios/mk48/server/world"
 	"testing"
 )
@@ -10,28 +10,106 @@ import (
 	"time"
 )
 
-// Leaderboard sends Leaderboard message to each Client.
+// Leaderboard updates h.topK with every connected player's current
+// PlayerData and broadcasts the result to each Client: a LeaderboardDelta to
+// clients whose Codec supports it (see diffLeaderboard), or the full legacy
+// Leaderboard to everyone else, and to delta-capable clients too every
+// leaderboardFullPeriod, so a client that missed a delta can't drift forever.
+// Unlike the old full PlayerSet rebuild (see TopPlayers), each player only
+// costs h.topK an O(log leaderboardCount) Update, regardless of how many
+// players are connected overall.
 // Its run in parallel because it doesn't write to World
 func (h *Hub) Leaderboard() {
 	defer h.timeFunction("leaderboard", time.Now())
 
-	playerSet := make(world.PlayerSet, 0, h.clients.Len)
+	seen := make(map[world.PlayerID]bool, h.topK.Len())
 	for client := h.clients.First; client != nil; client = client.Data().Next {
 		player := &client.Data().Player
 		if player.EntityID == world.EntityIDInvalid {
 			continue
 		}
-		playerSet = append(playerSet, &player.Player)
+		id := player.PlayerID()
+		seen[id] = true
+		h.topK.Update(id, player.PlayerData)
 	}
+	// Players who disconnected or stopped having a valid EntityID since last
+	// tick, but were still tracked in topK, have to be evicted explicitly -
+	// they won't receive an Update call above to reveal their absence.
+	for _, prev := range h.lastLeaderboard {
+		if !seen[prev.PlayerID] {
+			h.topK.Remove(prev.PlayerID)
+		}
+	}
+
+	top := h.topK.Snapshot(make([]world.IDPlayerData, 0, leaderboardCount))
+
+	playerData := make([]world.PlayerData, len(top))
+	for i, p := range top {
+		playerData[i] = p.PlayerData
+	}
+	full := Leaderboard{Leaderboard: playerData}
+	h.captureOutboundLeaderboard(full)
 
-	top := TopPlayers(playerSet, 10)
-	leaderboard := outbound(Leaderboard{Leaderboard: top})
+	delta := diffLeaderboard(h.lastLeaderboard, top)
+	h.lastLeaderboard = top
 
+	resync := time.Since(h.lastLeaderboardFull) >= leaderboardFullPeriod
+	if resync {
+		h.lastLeaderboardFull = time.Now()
+	}
+
+	fullOut := outbound(full)
+	var deltaOut outbound
 	for client := h.clients.First; client != nil; client = client.Data().Next {
-		client.Send(leaderboard)
+		if !resync {
+			if sc, ok := client.(*SocketClient); ok && sc.codec.SupportsLeaderboardDelta() {
+				if deltaOut == nil {
+					deltaOut = outbound(delta)
+				}
+				client.Send(deltaOut)
+				continue
+			}
+		}
+		client.Send(fullOut)
 	}
 }
 
+// diffLeaderboard builds the LeaderboardDelta between prev and curr (both
+// best-first, as returned by TopK.Snapshot), comparing PlayerData - not just
+// PlayerID - so a rank or score change on a player who never left the top k
+// still shows up as Changed.
+func diffLeaderboard(prev, curr []world.IDPlayerData) LeaderboardDelta {
+	prevRank := make(map[world.PlayerID]int, len(prev))
+	prevData := make(map[world.PlayerID]world.PlayerData, len(prev))
+	for i, p := range prev {
+		prevRank[p.PlayerID] = i
+		prevData[p.PlayerID] = p.PlayerData
+	}
+
+	var delta LeaderboardDelta
+	currIDs := make(map[world.PlayerID]bool, len(curr))
+	for rank, p := range curr {
+		currIDs[p.PlayerID] = true
+		entry := LeaderboardEntry{IDPlayerData: p, Rank: uint8(rank)}
+
+		data, was := prevData[p.PlayerID]
+		switch {
+		case !was:
+			delta.Entered = append(delta.Entered, entry)
+		case data != p.PlayerData || prevRank[p.PlayerID] != rank:
+			delta.Changed = append(delta.Changed, entry)
+		}
+	}
+
+	for _, p := range prev {
+		if !currIDs[p.PlayerID] {
+			delta.Left = append(delta.Left, p.PlayerID)
+		}
+	}
+
+	return delta
+}
+
 // TopPlayers Top count players with highest score of a world.PlayerSet.
 func TopPlayers(players world.PlayerSet, count int) []world.PlayerData {
 	if count <= 20 {
@@ -35,19 +35,26 @@ func main() {
 		auth    string
 		port    int
 		players int
+		world   string
 	)
 
 	flag.StringVar(&auth, "auth", "", "admin auth code")
 	flag.IntVar(&port, "port", 8192, "http service port")
 	flag.IntVar(&players, "players", 40, "minimum number of players")
+	flag.StringVar(&world, "world", "sector", "world implementation: sector or tree")
 	flag.Parse()
 
 	if players < 0 {
 		log.Fatal("invalid argument players: ", players)
 	}
 
-	hub := newHub(players, auth)
-	go hub.run()
+	hub := NewHub(HubOptions{
+		Cloud:      Offline{},
+		MinClients: players,
+		Auth:       auth,
+		World:      world,
+	})
+	go hub.Run()
 
 	if port < 0 {
 		log.Println("https://mk48.io simulation started")
@@ -23,6 +23,15 @@ type (
 	Outbound interface {
 		// Pool returns the contents of Outbound to their sync.Pool
 		Pool()
+		// Priority is how SocketClient.Send should treat this message under
+		// backpressure; see Priority.
+		Priority() Priority
+		// Coalesce is a non-empty key identifying what this message is an
+		// update of, for PriorityLossy messages that may replace an
+		// already-queued message sharing the same key (see
+		// SocketClient.sendLossy). PriorityReliable messages should return
+		// "", since they're never coalesced.
+		Coalesce() string
 	}
 
 	Message struct {
@@ -51,6 +60,7 @@ func registerInbound(inbounds ...Inbound) {
 		val := reflect.ValueOf(in)
 		m := messageType(uncapitalize(reflect.Indirect(val).Type().Name()))
 		inboundMessageTypes[m] = val.Type()
+		registerBinaryType(val.Type())
 	}
 }
 
@@ -59,6 +69,7 @@ func registerOutbound(outbounds ...Outbound) {
 		val := reflect.ValueOf(out)
 		m := messageType(uncapitalize(reflect.Indirect(val).Type().Name()))
 		outboundMessageTypes[val.Type()] = m
+		registerBinaryType(val.Type())
 	}
 }
 
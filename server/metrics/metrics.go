@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package metrics defines a small, dependency-free Recorder interface that
+// world.World implementations (see world/single and world/sector) call into
+// on their hot query/mutation paths, so a Cloud implementation (see
+// server.Prometheus) can time them without World needing to import
+// prometheus itself.
+package metrics
+
+import "time"
+
+// Op identifies which World method an Observe call is timing.
+type Op uint8
+
+const (
+	OpAddEntity Op = iota
+	OpEntityByID
+	OpForEntities
+	OpForEntitiesInRadius
+	OpForEntitiesAndOthers
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpAddEntity:
+		return "AddEntity"
+	case OpEntityByID:
+		return "EntityByID"
+	case OpForEntities:
+		return "ForEntities"
+	case OpForEntitiesInRadius:
+		return "ForEntitiesInRadius"
+	case OpForEntitiesAndOthers:
+		return "ForEntitiesAndOthers"
+	default:
+		return "unknown"
+	}
+}
+
+// Recorder observes how long one call to a World operation took. World
+// implementations hold a Recorder (possibly nil) and call Observe via the
+// package-level Observe helper below rather than checking for nil at every
+// call site.
+type Recorder interface {
+	Observe(op Op, d time.Duration)
+}
+
+// Observe is a nil-safe wrapper around r.Observe, meant to be deferred at the
+// top of a World method, e.g.:
+//
+//	defer metrics.Observe(w.recorder, metrics.OpAddEntity, time.Now())
+func Observe(r Recorder, op Op, start time.Time) {
+	if r != nil {
+		r.Observe(op, time.Since(start))
+	}
+}
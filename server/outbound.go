@@ -10,10 +10,24 @@ import (
 )
 
 type (
-	// Chat is a chat message.
+	// Chat is a chat message. System (e.g. team join/leave, death cause,
+	// command replies - see Hub.Broadcast/Hub.SendSystem) distinguishes
+	// server-generated messages from player-authored ones, for clients
+	// that want to render them differently or let players hide them via
+	// Player.HideSystemChat. Overlay further hints that a System message
+	// is important enough to show outside the normal chat log (e.g. as a
+	// banner). Severity/TTLMillis are only meaningful alongside Overlay:
+	// Severity lets the client pick a banner color (0 is plain info,
+	// higher is more urgent), and TTLMillis hints how long to keep it on
+	// screen before dismissing it; both are zero (client default) for a
+	// plain non-overlay Chat.
 	Chat struct {
 		world.PlayerData
-		Message string `json:"message"`
+		Message   string `json:"message"`
+		System    bool   `json:"system,omitempty"`
+		Overlay   bool   `json:"overlay,omitempty"`
+		Severity  uint8  `json:"severity,omitempty"`
+		TTLMillis uint16 `json:"ttlMillis,omitempty"`
 	}
 
 	// Contact is a view of a world.Entity from an observer.
@@ -43,6 +57,35 @@ type (
 		Leaderboard []world.PlayerData `json:"leaderboard"`
 	}
 
+	// LeaderboardEntry is one ranked player within a LeaderboardDelta.
+	LeaderboardEntry struct {
+		world.IDPlayerData
+		Rank uint8 `json:"rank"`
+	}
+
+	// LeaderboardDelta is Leaderboard's incremental counterpart (see
+	// Hub.Leaderboard/diffLeaderboard): Entered/Changed carry a player's
+	// full current rank and data, Left carries only the PlayerID of someone
+	// who fell out of the top leaderboardCount since the last tick. Sent
+	// instead of Leaderboard to clients whose negotiated Codec reports
+	// SupportsLeaderboardDelta, except for the periodic
+	// leaderboardFullPeriod resync, which always gets the full Leaderboard
+	// so a client that missed a delta can't drift forever.
+	LeaderboardDelta struct {
+		Entered []LeaderboardEntry `json:"entered,omitempty"`
+		Changed []LeaderboardEntry `json:"changed,omitempty"`
+		Left    []world.PlayerID   `json:"left,omitempty"`
+	}
+
+	// RateLimited is sent to a SocketClient whose Inbound was rejected by
+	// Hub.inboundLimiter (see inboundWeight in inbound.go), so it can back
+	// off instead of just seeing its messages silently disappear.
+	// RetryAfterMillis is an estimate (see RateLimiter.RetryAfter), not a
+	// guarantee the next attempt will succeed.
+	RateLimited struct {
+		RetryAfterMillis int64 `json:"retryAfterMillis"`
+	}
+
 	// Update is a view of Contacts, TeamMembers, and Terrain.
 	// It is dependant special marshaller on Update.Contacts to marshal as a map.
 	Update struct {
@@ -55,6 +98,21 @@ type (
 		DeathMessage string               `json:"deathMessage,omitempty"`
 		Terrain      *terrain2.Data       `json:"terrain,omitempty"`
 
+		// ContactsAdded/ContactsUpdated/ContactsRemoved/ContactsFull are
+		// Contacts' delta-compressed alternative for a Codec that reports
+		// SupportsContactsDelta (see diffContacts in contacts_delta.go):
+		// Contacts itself is left empty on those ticks and these three
+		// carry only what changed since the last tick this client was sent,
+		// the same full+delta split LeaderboardDelta already uses for
+		// Leaderboard. ContactsFull marks a periodic (or first-connection)
+		// resync tick, where Contacts is populated in full as usual and
+		// these three stay empty instead - bounding how long a client can
+		// drift if it ever misses an Update.
+		ContactsAdded   []IDContact      `json:"contactsAdded,omitempty"`
+		ContactsUpdated []IDContact      `json:"contactsUpdated,omitempty"`
+		ContactsRemoved []world.EntityID `json:"contactsRemoved,omitempty"`
+		ContactsFull    bool             `json:"contactsFull,omitempty"`
+
 		// Put smaller fields here for packing
 		PlayerID    world.PlayerID `json:"playerID,omitempty"`
 		EntityID    world.EntityID `json:"entityID,omitempty"`
@@ -64,18 +122,31 @@ type (
 
 func init() {
 	registerOutbound(
+		Chat{},
 		Leaderboard{},
+		LeaderboardDelta{},
+		RateLimited{},
 		&Update{},
 	)
 }
 
 const poolContactsCap = 32
 
+// deltaContactsCap sizes ContactsAdded/ContactsUpdated/ContactsRemoved's
+// starting capacity much smaller than poolContactsCap: they only ever hold
+// what changed in one tick, which diffContacts' own justification (most
+// contacts are unchanged between adjacent ticks) implies is usually a small
+// fraction of poolContactsCap.
+const deltaContactsCap = 8
+
 var updatePool = sync.Pool{
 	New: func() interface{} {
 		return &Update{
-			Contacts:    make([]IDContact, 0, poolContactsCap),
-			TeamMembers: make([]world.IDPlayerData, 0, world.TeamMembersMax),
+			Contacts:        make([]IDContact, 0, poolContactsCap),
+			ContactsAdded:   make([]IDContact, 0, deltaContactsCap),
+			ContactsUpdated: make([]IDContact, 0, deltaContactsCap),
+			ContactsRemoved: make([]world.EntityID, 0, deltaContactsCap),
+			TeamMembers:     make([]world.IDPlayerData, 0, world.TeamMembersMax),
 		}
 	},
 }
@@ -93,15 +164,54 @@ func (update *Update) Pool() {
 
 	// Delete all fields except Contacts, TeamMembers, and TeamRequests
 	*update = Update{
-		Contacts:     clearIDContacts(update.Contacts),
-		TeamMembers:  clearIDPlayerData(update.TeamMembers),
-		TeamRequests: clearIDPlayerData(update.TeamRequests),
+		Contacts:        clearIDContacts(update.Contacts),
+		ContactsAdded:   clearIDContacts(update.ContactsAdded),
+		ContactsUpdated: clearIDContacts(update.ContactsUpdated),
+		ContactsRemoved: clearEntityIDs(update.ContactsRemoved),
+		TeamMembers:     clearIDPlayerData(update.TeamMembers),
+		TeamRequests:    clearIDPlayerData(update.TeamRequests),
 	}
 	updatePool.Put(update)
 }
 
+// Priority and Coalesce: an Update is superseded by the next tick's Update
+// for the same client, so a congested SocketClient should replace a queued
+// one rather than fall further behind by keeping both.
+func (update *Update) Priority() Priority { return PriorityLossy }
+func (update *Update) Coalesce() string   { return "update" }
+
 func (leaderboard Leaderboard) Pool() {}
 
+// Priority and Coalesce: Leaderboard is sent at most once per
+// leaderboardTicker period, so there's never a same-key repeat to coalesce;
+// losing it would leave a client's standings stale until the next tick.
+func (leaderboard Leaderboard) Priority() Priority { return PriorityReliable }
+func (leaderboard Leaderboard) Coalesce() string   { return "" }
+
+func (delta LeaderboardDelta) Pool() {}
+
+// Priority and Coalesce: a missed LeaderboardDelta leaves a client's
+// standings wrong until the next leaderboardFullPeriod resync, the same
+// staleness risk as missing a full Leaderboard, so it gets the same
+// treatment - never dropped, never coalesced.
+func (delta LeaderboardDelta) Priority() Priority { return PriorityReliable }
+func (delta LeaderboardDelta) Coalesce() string   { return "" }
+
+func (chat Chat) Pool() {}
+
+// Priority and Coalesce: a chat message (or the system messages Hub.Broadcast
+// sends through the same type) must never be silently dropped.
+func (chat Chat) Priority() Priority { return PriorityReliable }
+func (chat Chat) Coalesce() string   { return "" }
+
+func (rateLimited RateLimited) Pool() {}
+
+// Priority and Coalesce: a client needs to actually see this to know to back
+// off, so it's never dropped; each rejection is its own notice, so there's
+// nothing to coalesce two of together.
+func (rateLimited RateLimited) Priority() Priority { return PriorityReliable }
+func (rateLimited RateLimited) Coalesce() string   { return "" }
+
 func clearIDContacts(contacts []IDContact) []IDContact {
 	for i := range contacts {
 		contacts[i] = IDContact{}
@@ -115,3 +225,10 @@ func clearIDPlayerData(data []world.IDPlayerData) []world.IDPlayerData {
 	}
 	return data[:0]
 }
+
+func clearEntityIDs(ids []world.EntityID) []world.EntityID {
+	for i := range ids {
+		ids[i] = world.EntityIDInvalid
+	}
+	return ids[:0]
+}
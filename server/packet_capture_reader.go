@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PacketCaptureRecord is one record read back from a capture written by
+// Hub.StartPacketCapture.
+type PacketCaptureRecord struct {
+	Unix     int64 // unix milliseconds the record was captured at
+	PlayerID world.PlayerID
+	Kind     PacketCaptureKind
+	Payload  json.RawMessage
+}
+
+// packetCaptureSegment identifies one <minute>.<seq>.cap.gz file written by
+// packetCapture.rotate; seq only goes above 0 when a minute outgrew
+// maxSegmentBytes and had to split.
+type packetCaptureSegment struct {
+	minute int64
+	seq    int
+}
+
+// PacketCaptureReader reads back the gzipped segment files written by
+// Hub.StartPacketCapture (see packetCapture.rotate), in capture order,
+// regardless of how many segments they were split across.
+type PacketCaptureReader struct {
+	dir      string
+	segments []packetCaptureSegment // remaining segments, in ascending order
+	file     *os.File
+	gz       *gzip.Reader
+	reader   *bufio.Reader
+	header   PacketCaptureHeader
+}
+
+// OpenPacketCapture opens every *.cap.gz segment in dir for reading, in
+// capture order.
+func OpenPacketCapture(dir string) (*PacketCaptureReader, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []packetCaptureSegment
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".cap.gz")
+		if name == entry.Name() {
+			continue // doesn't have the suffix
+		}
+
+		parts := strings.SplitN(name, ".", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		minute, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		seq, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		segments = append(segments, packetCaptureSegment{minute, seq})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].minute != segments[j].minute {
+			return segments[i].minute < segments[j].minute
+		}
+		return segments[i].seq < segments[j].seq
+	})
+
+	r := &PacketCaptureReader{dir: dir, segments: segments}
+	if err := r.openNextSegment(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Header returns the PacketCaptureHeader of the segment currently being
+// read.
+func (r *PacketCaptureReader) Header() PacketCaptureHeader {
+	return r.header
+}
+
+// Close closes the segment currently being read, if any.
+func (r *PacketCaptureReader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// openNextSegment closes the current segment file, if any, opens the next
+// one in r.segments, and reads its header line (see packetCapture.rotate).
+func (r *PacketCaptureReader) openNextSegment() error {
+	if r.gz != nil {
+		r.gz.Close()
+		r.gz = nil
+	}
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	if len(r.segments) == 0 {
+		return io.EOF
+	}
+
+	s := r.segments[0]
+	r.segments = r.segments[1:]
+
+	file, err := os.Open(filepath.Join(r.dir, fmt.Sprintf("%d.%d.cap.gz", s.minute, s.seq)))
+	if err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	reader := bufio.NewReader(gz)
+	// The header was written by a plain json.Encoder, which always
+	// terminates its output with '\n' - read exactly that line so reader's
+	// position lands precisely at the start of the first binary record
+	// (a json.Decoder would over-read into it via its own buffering).
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		gz.Close()
+		file.Close()
+		return fmt.Errorf("reading segment %d.%d header: %w", s.minute, s.seq, err)
+	}
+
+	var header PacketCaptureHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		gz.Close()
+		file.Close()
+		return fmt.Errorf("decoding segment %d.%d header: %w", s.minute, s.seq, err)
+	}
+
+	r.file = file
+	r.gz = gz
+	r.reader = reader
+	r.header = header
+	return nil
+}
+
+// Next returns the next record across all of the capture's segments, in
+// capture order, returning io.EOF once every segment is exhausted.
+func (r *PacketCaptureReader) Next() (record PacketCaptureRecord, err error) {
+	for {
+		var header [21]byte
+		if _, err = io.ReadFull(r.reader, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				if err = r.openNextSegment(); err != nil {
+					return
+				}
+				continue
+			}
+			return
+		}
+
+		record.Unix = int64(binary.LittleEndian.Uint64(header[0:8]))
+		record.PlayerID = world.PlayerID(binary.LittleEndian.Uint64(header[8:16]))
+		record.Kind = PacketCaptureKind(header[16])
+		length := binary.LittleEndian.Uint32(header[17:21])
+
+		payload := make([]byte, length)
+		if _, err = io.ReadFull(r.reader, payload); err != nil {
+			return
+		}
+		record.Payload = payload
+		return
+	}
+}
+
+// ReplayPacketCapture reads every remaining record from r in order, calling
+// send for each, sleeping between records to match the gaps they were
+// originally captured with, divided by speed (speed <= 0 means send every
+// record as fast as possible, ignoring original timing). It's meant for
+// spectating a captured match through the normal client: wrap send to
+// forward each record's Payload over a live websocket connection (see
+// packetreplay_main).
+func ReplayPacketCapture(r *PacketCaptureReader, speed float64, send func(PacketCaptureRecord) error) error {
+	var last int64
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if last != 0 && speed > 0 {
+			if gap := record.Unix - last; gap > 0 {
+				time.Sleep(time.Duration(float64(gap)/speed) * time.Millisecond)
+			}
+		}
+		last = record.Unix
+
+		if err := send(record); err != nil {
+			return err
+		}
+	}
+}
@@ -15,6 +15,9 @@ import (
 func (h *Hub) Physics(ticks world.Ticks) {
 	defer h.timeFunction("physics", time.Now())
 
+	h.physicsTick++
+	h.recordTick(ticks)
+	h.logTick(h.physicsTick)
 	timeDeltaSeconds := min(ticks.Float(), 1.0)
 
 	{
@@ -54,11 +57,19 @@ func (h *Hub) Physics(ticks world.Ticks) {
 		// Update movement and record various outputs
 		h.world.SetParallel(true)
 		h.world.ForEntities(func(e *world.Entity) (_, remove bool) {
-			remove = e.Update(ticks, h.worldRadius, terrain)
 			data := e.Data()
+			wasSinking := data.Kind == world.EntityKindBoat && e.Sinking != 0
+			if wasSinking {
+				h.cookOff(e, timeDeltaSeconds)
+			}
+
+			remove = e.Update(ticks, h.worldRadius, terrain)
 			if remove {
 				if data.Kind == world.EntityKindBoat {
-					boatOutput <- *e // Copy entity
+					if !wasSinking {
+						// Died without a staged sequence (e.g. limited lifespan).
+						boatOutput <- *e // Copy entity
+					}
 				} else if data.Kind == world.EntityKindWeapon && (data.SubKind == world.EntitySubKindTorpedo || data.SubKind == world.EntitySubKindMissile || data.SubKind == world.EntitySubKindShell) {
 					// This torpedo died of "natural" causes, affect the
 					// terrain (see #49)
@@ -120,6 +131,10 @@ func (h *Hub) Physics(ticks world.Ticks) {
 		switch entity.Data().Kind {
 		case world.EntityKindAircraft, world.EntityKindWeapon:
 			radius = max(radius, entity.Data().Sensors.MaxRange())
+		case world.EntityKindBoat:
+			if entity.Data().HasAutonomousTurret {
+				radius = max(radius, entity.Data().Sensors.MaxRange())
+			}
 		}
 
 		return
@@ -166,6 +181,12 @@ func (h *Hub) Physics(ticks world.Ticks) {
 			collectible = other
 		}
 
+		// Wrecks are already dying; don't re-run combat resolution on them.
+		// Their cook-off weapons are separate entities that collide normally.
+		if (boat != nil && boat.Sinking != 0) || (otherBoat != nil && otherBoat.Sinking != 0) {
+			return
+		}
+
 		// e must be either entity or other
 		removeEntity := func(e *world.Entity, reason world.DeathReason) {
 			data := e.Data()
@@ -173,6 +194,7 @@ func (h *Hub) Physics(ticks world.Ticks) {
 			if data.Kind == world.EntityKindBoat {
 				e.Owner.DeathReason = reason
 				h.boatDied(e)
+				return // e begins sinking in place instead of being removed now
 			}
 
 			if e == entity {
@@ -182,7 +204,8 @@ func (h *Hub) Physics(ticks world.Ticks) {
 			}
 		}
 
-		if !entity.Collides(other, timeDeltaSeconds) || !altitudeOverlap {
+		collided, toi := entity.CollidesAt(other, timeDeltaSeconds)
+		if !collided || !altitudeOverlap {
 			if collectible != nil && altitudeOverlap {
 				// Collectibles gravitate towards players (except if they player paid them)
 				if boat != nil && (boat.Owner != collectible.Owner || collectible.Ticks > 5*world.TicksPerSecond) {
@@ -214,7 +237,15 @@ func (h *Hub) Physics(ticks world.Ticks) {
 				if entityData.Kind == world.EntityKindWeapon {
 					// Home towards target/decoy
 					if altitudeOverlap && entityData.Sensors.Any() {
-						entity.UpdateSensor(other)
+						rng := world.NewRng(h.physicsTick, entity.EntityID)
+						entity.UpdateSensor(other, timeDeltaSeconds, &rng)
+					}
+				}
+
+				// Autonomous turret point defense
+				if boat == entity && entityData.HasAutonomousTurret {
+					for _, i := range entity.UpdateTurretSensor(other, timeDeltaSeconds) {
+						h.fireAutonomousTurret(entity, i)
 					}
 				}
 
@@ -288,6 +319,13 @@ func (h *Hub) Physics(ticks world.Ticks) {
 			decoy = other
 		}
 
+		// Roll each entity's position back from its end-of-tick position to
+		// where it actually was at the time of impact, so damage location and
+		// ram angle reflect the true point of contact rather than overshoot.
+		timeSinceImpact := timeDeltaSeconds - toi
+		entityImpactPos := entity.Position.Sub(entity.Direction.Vec2f().Mul(timeSinceImpact * entity.Velocity.Float()))
+		otherImpactPos := other.Position.Sub(other.Direction.Vec2f().Mul(timeSinceImpact * other.Velocity.Float()))
+
 		switch {
 		case boat != nil && collectible != nil:
 			// Players can collect the collectibles they paid...
@@ -313,10 +351,16 @@ func (h *Hub) Physics(ticks world.Ticks) {
 
 			removeEntity(collectible, world.DeathReason{})
 		case boat != nil && weapon != nil && !friendly:
-			dist2 := entity.Position.DistanceSquared(other.Position)
+			weaponImpactPos := otherImpactPos
+			if weapon == entity {
+				weaponImpactPos = entityImpactPos
+			}
+			dist2 := entityImpactPos.DistanceSquared(otherImpactPos)
 			r2 := square(boat.Data().Radius)
 
-			if boat.Damage(world.DamageToTicks(weapon.Data().Damage * collisionMultiplier(dist2, r2) * boat.SpawnProtection())) {
+			damage := weapon.Data().Damage * collisionMultiplier(dist2, r2) * boat.SpawnProtection()
+			killed := boat.DamageAt(world.DamageToTicks(damage), weaponImpactPos)
+			if killed {
 				weapon.Owner.Score += 10 + boat.Owner.Score/4
 				removeEntity(boat, world.DeathReason{
 					Type:   world.DeathTypeSinking,
@@ -325,6 +369,8 @@ func (h *Hub) Physics(ticks world.Ticks) {
 				})
 			}
 
+			h.recordWeaponHitStats(weapon, boat, damage, killed)
+
 			removeEntity(weapon, world.DeathReason{})
 		case boat != nil && otherBoat != nil:
 			/*
@@ -349,7 +395,12 @@ func (h *Hub) Physics(ticks world.Ticks) {
 				d := b.Data()
 				oD := oB.Data()
 
-				posDiff := b.Position.Sub(oB.Position).Norm()
+				bImpactPos, oBImpactPos := entityImpactPos, otherImpactPos
+				if b != entity {
+					bImpactPos, oBImpactPos = otherImpactPos, entityImpactPos
+				}
+
+				posDiff := bImpactPos.Sub(oBImpactPos).Norm()
 
 				// Approximate mass
 				m := d.Width * d.Length
@@ -361,8 +412,8 @@ func (h *Hub) Physics(ticks world.Ticks) {
 					damage := baseDamage
 
 					// Colliding with center of boat is more deadly
-					frontPos := oB.Position.AddScaled(oB.Direction.Vec2f(), oD.Length*0.5)
-					dist2 := frontPos.DistanceSquared(b.Position)
+					frontPos := oBImpactPos.AddScaled(oB.Direction.Vec2f(), oD.Length*0.5)
+					dist2 := frontPos.DistanceSquared(bImpactPos)
 					damage *= collisionMultiplier(dist2, square(d.Radius))
 					damage *= b.SpawnProtection()
 
@@ -381,7 +432,7 @@ func (h *Hub) Physics(ticks world.Ticks) {
 						damage *= ramDamage
 					}
 
-					if b.Damage(world.DamageToTicks(damage)) {
+					if b.DamageAt(world.DamageToTicks(damage), oBImpactPos) {
 						deathType := world.DeathTypeCollision
 						if isOtherRam {
 							deathType = world.DeathTypeRamming
@@ -426,7 +477,9 @@ func (h *Hub) Physics(ticks world.Ticks) {
 	})
 }
 
-// boatDied removes score and spawns crates
+// boatDied removes score and begins e's staged sinking sequence. Its loot
+// (crates, magazine cook-offs) is spawned over that sequence by cookOff
+// instead of all at once.
 func (h *Hub) boatDied(e *world.Entity) {
 	// Lose 1/2 score if you die
 	// Cap at 50 so can't get max level right away
@@ -435,37 +488,58 @@ func (h *Hub) boatDied(e *world.Entity) {
 		e.Owner.Score = 80
 	}
 
+	e.Sink()
+}
+
+// cookOff randomly fires one secondary event (a magazine cook-off or a
+// piece of debris) from a sinking boat. The chance per second is weighted
+// towards the end of the sequence by an x^2 + 0.1 curve, so most of a
+// wreck's loot and explosions land right before it finally sinks.
+func (h *Hub) cookOff(e *world.Entity, seconds float32) {
+	progress := e.SinkProgress()
+	chance := (square(progress) + 0.1) * seconds
+	if rand.Float32() >= chance {
+		return
+	}
+
 	data := e.Data()
 
-	// Loot is based on the length of the boat
-	loot := data.Length * 0.25 * (rand.Float32()*0.1 + 0.9)
+	if armaments := data.Armaments; len(armaments) != 0 && rand.Float32() < 0.4 {
+		i := rand.Intn(len(armaments))
+		armamentData := &armaments[i]
 
-	for i := 0; i < int(loot); i++ {
-		lootType := world.EntityTypeScrap
-		switch data.SubKind {
-		case world.EntitySubKindPirate:
-			if rand.Float32() < 0.5 {
-				lootType = world.EntityTypeCoin
-			}
-		case world.EntitySubKindTanker:
-			if rand.Float32() < 0.5 {
-				lootType = world.EntityTypeBarrel
-			}
-		}
+		// Magazine cook-off: one of the boat's own weapons, now unowned.
+		h.spawnEntity(&world.Entity{
+			EntityType: armamentData.Type,
+			Transform:  e.ArmamentTransform(i),
+		}, 0)
+		return
+	}
 
-		crate := &world.Entity{
-			EntityType: lootType,
-			Transform:  e.Transform,
+	lootType := world.EntityTypeScrap
+	switch data.SubKind {
+	case world.EntitySubKindPirate:
+		if rand.Float32() < 0.5 {
+			lootType = world.EntityTypeCoin
 		}
+	case world.EntitySubKindTanker:
+		if rand.Float32() < 0.5 {
+			lootType = world.EntityTypeBarrel
+		}
+	}
 
-		// Make loot roughly conform to rectangle of ship
-		normal := e.Direction.Vec2f()
-		tangent := normal.Rot90()
-		crate.Position = crate.Position.AddScaled(normal, (rand.Float32()-0.5)*data.Length)
-		crate.Position = crate.Position.AddScaled(tangent, (rand.Float32()-0.5)*data.Width)
-
-		h.spawnEntity(crate, data.Radius*0.15)
+	debris := &world.Entity{
+		EntityType: lootType,
+		Transform:  e.Transform,
 	}
+
+	// Make loot roughly conform to rectangle of ship
+	normal := e.Direction.Vec2f()
+	tangent := normal.Rot90()
+	debris.Position = debris.Position.AddScaled(normal, (rand.Float32()-0.5)*data.Length)
+	debris.Position = debris.Position.AddScaled(tangent, (rand.Float32()-0.5)*data.Width)
+
+	h.spawnEntity(debris, data.Radius*0.15)
 }
 
 func collisionMultiplier(d2, r2 float32) float32 {
@@ -5,6 +5,7 @@ package main
 
 import (
 	"github.com/SoftbearStudios/mk48/server/world"
+	"mk48/server/terrain/compressed"
 )
 
 // Player is an extension of world.Player with extra data
@@ -15,4 +16,17 @@ type Player struct {
 
 	// Optimizations
 	TerrainArea world.AABB
+	// TerrainHashes remembers the tile hashes last sent to this player (see
+	// compressed.Terrain.AtDelta), so repeat Updates over the same area can
+	// skip tiles that haven't changed. nil until the first terrain send.
+	TerrainHashes *compressed.ClientTileHashes
+
+	// Muted is the set of chat sender Names this Player has muted via
+	// /mute. Keyed by Name rather than PlayerID since Chat carries no
+	// PlayerID. nil until the first /mute.
+	Muted map[string]bool
+	// HideSystemChat, if set, tells Hub.SendSystem and updateClient to
+	// withhold System Chats (team events, death cause, command replies)
+	// from this Player.
+	HideSystemChat bool
 }
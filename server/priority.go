@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+// Priority classifies an Outbound for SocketClient.Send's backpressure
+// policy. PriorityReliable messages (chat, the leaderboard, an admin reply)
+// are never silently dropped - Send blocks briefly rather than lose one.
+// PriorityLossy messages (the per-tick Update) are fine to miss, and a
+// repeat of the same Coalesce key replaces one already queued rather than
+// piling up stale state behind it.
+type Priority byte
+
+const (
+	PriorityReliable Priority = iota
+	PriorityLossy
+)
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// RasterizeChannel is one plane of a Rasterize observation.
+type RasterizeChannel int
+
+const (
+	ChannelEnemy RasterizeChannel = iota
+	ChannelFriendly
+	ChannelObstacle
+	ChannelCollectible
+	ChannelTerrain
+	ChannelVelocity
+
+	// rasterizeMaxSpeed clamps ChannelVelocity's input, in m/s, before it's
+	// mapped onto a single byte plane. Comfortably above anything but a
+	// torpedo's top speed, so ordinary boat traffic still has resolution.
+	rasterizeMaxSpeed = 30
+)
+
+// Rasterize renders ship's surroundings into one 8-bit plane per entry of
+// channels, concatenated resolution*resolution bytes at a time in the order
+// channels is given - the training.Recorder's raw-channel frame format (see
+// server/training). This is the same coordinate system and contact
+// footprint the rasterizer bot example (examples/bot.go) used to build a
+// single hardcoded RGBA image (red=enemy, green=obstacle/terrain,
+// blue=friendly/collectible); Rasterize generalizes that into an arbitrary,
+// per-caller channel set instead. scale is meters per image dimension.
+func Rasterize(ship Contact, contacts []IDContact, t terrain.Terrain, channels []RasterizeChannel, scale float32, resolution int) []byte {
+	planeSize := resolution * resolution
+	frame := make([]byte, len(channels)*planeSize)
+	scale /= float32(resolution)
+
+	if terrainIdx := indexOfChannel(channels, ChannelTerrain); terrainIdx >= 0 {
+		plane := frame[terrainIdx*planeSize : (terrainIdx+1)*planeSize]
+		for x := 0; x < resolution; x++ {
+			for y := 0; y < resolution; y++ {
+				pos := ship.Position
+				pos.X += float32(x-resolution/2) * scale
+				pos.Y += float32(y-resolution/2) * scale
+				if terrain.LandAtPos(t, pos) {
+					plane[y*resolution+x] = 255
+				}
+			}
+		}
+	}
+
+	velocityIdx := indexOfChannel(channels, ChannelVelocity)
+
+	for _, contact := range contacts {
+		data := contact.EntityType.Data()
+		normal := contact.Direction.Vec2f()
+		tangent := normal.Rot90()
+
+		var ch RasterizeChannel
+		switch {
+		case data.Kind == world.EntityKindCollectible:
+			ch = ChannelCollectible
+		case data.Kind == world.EntityKindObstacle:
+			ch = ChannelObstacle
+		case contact.Friendly:
+			ch = ChannelFriendly
+		default:
+			ch = ChannelEnemy
+		}
+
+		idx := indexOfChannel(channels, ch)
+		if idx < 0 && velocityIdx < 0 {
+			continue // caller's layout wants neither this contact's channel nor velocity
+		}
+
+		speedByte := rasterizeVelocityByte(contact.Velocity)
+
+		for l := -0.5 * data.Length; l <= 0.5*data.Length; l += scale * 0.5 {
+			for w := -0.5 * data.Width; w <= 0.5*data.Width; w += scale * 0.5 {
+				pos := contact.Position.Sub(ship.Position).AddScaled(normal, l).AddScaled(tangent, w)
+				pos = pos.Div(scale)
+
+				px := int(pos.X) + resolution/2
+				py := int(pos.Y) + resolution/2
+				if px < 0 || px >= resolution || py < 0 || py >= resolution {
+					continue
+				}
+				offset := py*resolution + px
+
+				if idx >= 0 {
+					frame[idx*planeSize+offset] = 255
+				}
+				if velocityIdx >= 0 {
+					frame[velocityIdx*planeSize+offset] = speedByte
+				}
+			}
+		}
+	}
+
+	return frame
+}
+
+func indexOfChannel(channels []RasterizeChannel, ch RasterizeChannel) int {
+	for i, c := range channels {
+		if c == ch {
+			return i
+		}
+	}
+	return -1
+}
+
+// rasterizeVelocityByte maps a contact's speed onto a single unsigned byte,
+// centered at 127 (stationary) and saturating at 0/255 beyond
+// +/-rasterizeMaxSpeed.
+func rasterizeVelocityByte(vel world.Velocity) byte {
+	v := vel.Float() / rasterizeMaxSpeed
+	if v > 1 {
+		v = 1
+	} else if v < -1 {
+		v = -1
+	}
+	return byte((v + 1) * 127.5)
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// rateLimiterShards is the number of independently-locked shards a
+// RateLimiter's buckets are spread across, to reduce lock contention between
+// unrelated IPs (see ServeSocket and SocketClient.readPump, its two callers).
+const rateLimiterShards = 16
+
+// rateLimiterEvictAge is how long a bucket can go unused before it's
+// considered stale and evicted the next time its shard is swept.
+const rateLimiterEvictAge = 10 * time.Minute
+
+// tokenBucket is a single IP's token bucket: tokens regenerate at rate per
+// second up to burst, and every allowed event consumes one.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiterShard struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// RateLimiter is a sharded, per-key token-bucket limiter. It's shared between
+// ServeSocket (connection establishment) and SocketClient.readPump (in-session
+// messages), so a client that reconnects rapidly and a client that floods a
+// single socket with input frames are throttled by the same mechanism.
+type RateLimiter struct {
+	shards [rateLimiterShards]rateLimiterShard
+	rate   float64 // tokens regenerated per second
+	burst  float64 // bucket capacity
+}
+
+// NewRateLimiter creates a RateLimiter that allows burst events immediately
+// and then rate events per second thereafter.
+func NewRateLimiter(rate, burst float64) *RateLimiter {
+	limiter := &RateLimiter{rate: rate, burst: burst}
+	for i := range limiter.shards {
+		limiter.shards[i].buckets = make(map[string]*tokenBucket)
+	}
+	return limiter
+}
+
+func shardFor(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % rateLimiterShards)
+}
+
+// Allow reports whether an event for key (typically an IP address) is
+// allowed, consuming a token if so.
+func (l *RateLimiter) Allow(key string) bool {
+	return l.AllowN(key, 1)
+}
+
+// AllowN is like Allow, but the event consumes cost tokens instead of 1 -
+// for a limiter shared by event kinds of different weight (e.g. a chat
+// message costing more than a steering update; see inboundWeight).
+func (l *RateLimiter) AllowN(key string, cost float64) bool {
+	if l == nil {
+		return true
+	}
+
+	shard := &l.shards[shardFor(key)]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	now := time.Now()
+
+	// Lazily evict buckets that have been full (i.e. idle) for a while,
+	// instead of running a separate sweep goroutine.
+	if len(shard.buckets) > rateLimiterShards {
+		for k, b := range shard.buckets {
+			if now.Sub(b.last) > rateLimiterEvictAge {
+				delete(shard.buckets, k)
+			}
+		}
+	}
+
+	bucket := shard.buckets[key]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		shard.buckets[key] = bucket
+	} else {
+		elapsed := now.Sub(bucket.last).Seconds()
+		if bucket.tokens += elapsed * l.rate; bucket.tokens > l.burst {
+			bucket.tokens = l.burst
+		}
+		bucket.last = now
+	}
+
+	if bucket.tokens < cost {
+		return false
+	}
+	bucket.tokens -= cost
+	return true
+}
+
+// RetryAfter estimates how long a caller should wait before a cost-sized
+// event would be allowed again, assuming an empty bucket - i.e. the worst
+// case. It doesn't inspect any particular key's bucket, so it's only an
+// estimate, not a guarantee; good enough for a RateLimited hint to a client
+// deciding how long to back off.
+func (l *RateLimiter) RetryAfter(cost float64) time.Duration {
+	if l == nil || l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(cost / l.rate * float64(time.Second))
+}
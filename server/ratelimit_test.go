@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import "testing"
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := NewRateLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("1.2.3.4") {
+			t.Fatalf("expected burst event %d to be allowed", i)
+		}
+	}
+
+	if limiter.Allow("1.2.3.4") {
+		t.Fatal("expected burst to be exhausted")
+	}
+
+	// A different key has its own bucket.
+	if !limiter.Allow("5.6.7.8") {
+		t.Fatal("expected a different key to have its own bucket")
+	}
+}
+
+func TestRateLimiter_Nil(t *testing.T) {
+	var limiter *RateLimiter
+	if !limiter.Allow("1.2.3.4") {
+		t.Fatal("expected a nil RateLimiter to allow everything")
+	}
+}
+
+func TestRateLimiter_AllowN(t *testing.T) {
+	limiter := NewRateLimiter(1, 10)
+
+	if !limiter.AllowN("1.2.3.4", 5) {
+		t.Fatal("expected a 5-cost event to fit in a 10-token burst")
+	}
+	if !limiter.AllowN("1.2.3.4", 5) {
+		t.Fatal("expected a second 5-cost event to exhaust the remaining burst exactly")
+	}
+	if limiter.AllowN("1.2.3.4", 1) {
+		t.Fatal("expected the burst to be exhausted")
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"os"
+)
+
+// StartRecording opens path and begins appending a tickRecording (see
+// RecordTick) to it at the start of every subsequent Physics call, until
+// StopRecording is called. It is meant for reproducing a specific bug report
+// ("here's the log where my Fairmile D collided incorrectly"), not for
+// continuous production use - the file grows without bound.
+func (h *Hub) StartRecording(path string) error {
+	if h.recordFile != nil {
+		return fmt.Errorf("already recording to a file")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	h.recordFile = f
+	return nil
+}
+
+// StopRecording closes the file opened by StartRecording, if any.
+func (h *Hub) StopRecording() error {
+	if h.recordFile == nil {
+		return nil
+	}
+
+	f := h.recordFile
+	h.recordFile = nil
+	return f.Close()
+}
+
+// recordTick is called at the start of every Physics call. It is a no-op
+// unless StartRecording has been called.
+func (h *Hub) recordTick(delta world.Ticks) {
+	if h.recordFile == nil {
+		return
+	}
+
+	if err := h.RecordTick(h.recordFile, delta); err != nil {
+		fmt.Println("recordTick error:", err)
+		_ = h.StopRecording()
+	}
+}
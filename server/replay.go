@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"io"
+)
+
+// entitySnapshot is the serializable subset of world.Entity's state needed to
+// re-derive a tick deterministically. It excludes Owner: world.Player.PlayerID
+// is a process-local pointer address (see Player.PlayerID), so there is no
+// stable identity to serialize a Player by across a recording and a replay.
+type entitySnapshot struct {
+	EntityID   world.EntityID   `json:"entityID"`
+	EntityType world.EntityType `json:"entityType"`
+	Transform  world.Transform  `json:"transform"`
+	Guidance   world.Guidance   `json:"guidance"`
+	Ticks      world.Ticks      `json:"ticks"`
+	Sinking    world.Ticks      `json:"sinking"`
+}
+
+// tickRecording is the serialized pre-tick state of one Hub.Physics call.
+type tickRecording struct {
+	Tick     uint32           `json:"tick"`
+	Delta    world.Ticks      `json:"delta"`
+	Entities []entitySnapshot `json:"entities"`
+}
+
+// RecordTick serializes the current entity set and the delta about to be
+// passed to Physics, so a later ReplayTick can re-run the exact same tick.
+// Combined with world.NewRng being seeded from (tick, entityID) rather than
+// math/rand's global source, replaying a recording reproduces the exact
+// post-tick physics state - useful for crash reproduction and regression
+// tests of the collision code. Owner linkage isn't recorded (see
+// entitySnapshot), so this doesn't cover score/ownership changes.
+func (h *Hub) RecordTick(w io.Writer, delta world.Ticks) error {
+	var entities []entitySnapshot
+	h.world.ForEntities(func(e *world.Entity) (stop, remove bool) {
+		entities = append(entities, entitySnapshot{
+			EntityID:   e.EntityID,
+			EntityType: e.EntityType,
+			Transform:  e.Transform,
+			Guidance:   e.Guidance,
+			Ticks:      e.Ticks,
+			Sinking:    e.Sinking,
+		})
+		return
+	})
+
+	return json.NewEncoder(w).Encode(tickRecording{
+		Tick:     h.physicsTick,
+		Delta:    delta,
+		Entities: entities,
+	})
+}
+
+// ReplayTick decodes a tickRecording written by RecordTick, rewinds
+// physicsTick to match, and overwrites each recorded entity's physics state
+// in place (entities missing from the world, e.g. ones that have since
+// despawned, are skipped). It returns the delta the caller should pass to
+// Physics to re-run the tick.
+func (h *Hub) ReplayTick(r io.Reader) (delta world.Ticks, err error) {
+	var recording tickRecording
+	if err = json.NewDecoder(r).Decode(&recording); err != nil {
+		return
+	}
+
+	h.physicsTick = recording.Tick - 1 // Physics increments before use
+	for _, snapshot := range recording.Entities {
+		h.world.EntityByID(snapshot.EntityID, func(e *world.Entity) (remove bool) {
+			e.EntityType = snapshot.EntityType
+			e.Transform = snapshot.Transform
+			e.Guidance = snapshot.Guidance
+			e.Ticks = snapshot.Ticks
+			e.Sinking = snapshot.Sinking
+			return false
+		})
+	}
+
+	return recording.Delta, nil
+}
+
+// maxTickLog is how many of the most recent ticks RunAt can rewind to,
+// e.g. to compensate for a client's round-trip lag when checking a hit.
+const maxTickLog = 2 * world.TicksPerSecond
+
+// tickSnapshot is one entry of Hub.tickLog: the world as of the start of the
+// given physics tick, before that tick's Physics call mutated it.
+type tickSnapshot struct {
+	tick     uint32
+	snapshot *world.WorldSnapshot
+}
+
+// logTick appends the world's current state to h.tickLog under tick, and
+// evicts entries older than maxTickLog ticks. Called once per Physics call,
+// before any entity is mutated, so RunAt can rewind to any of the last
+// maxTickLog ticks. Unlike recordTick (see recorder.go), this always runs -
+// it's how RunAt finds its own history, not an opt-in diagnostic.
+func (h *Hub) logTick(tick uint32) {
+	h.tickLog = append(h.tickLog, tickSnapshot{tick: tick, snapshot: world.Snapshot(h.world)})
+
+	cutoff := 0
+	for cutoff < len(h.tickLog) && tick-h.tickLog[cutoff].tick > uint32(maxTickLog) {
+		cutoff++
+	}
+	h.tickLog = h.tickLog[cutoff:]
+}
+
+// RunAt rewinds the world to its state as of tick (the most recent logTick
+// covering it; ticks older than maxTickLog or not yet reached are ignored),
+// calls fn, then restores the world to its present state. It's meant for
+// lag-compensated hit detection (re-check a shot against the shooter's view
+// of the world as of the tick their input referenced) and anti-cheat
+// auditing (re-run a historical tick's logic to see if the reported outcome
+// matches), without disturbing gameplay as observed by everyone else.
+//
+// This only rewinds/restores entity state (see world.WorldSnapshot); it does
+// not re-run Physics tick-by-tick forward afterward, since fn only needs to
+// read/compare against the historical state, and restoring the present
+// snapshot directly is cheaper and avoids re-triggering side effects (like
+// firing or spawning) a forward replay would.
+func (h *Hub) RunAt(tick uint64, fn func()) {
+	var target *world.WorldSnapshot
+	for i := range h.tickLog {
+		if uint64(h.tickLog[i].tick) == tick {
+			target = h.tickLog[i].snapshot
+			break
+		}
+	}
+	if target == nil {
+		fn()
+		return
+	}
+
+	present := world.Snapshot(h.world)
+	world.Restore(h.world, target)
+	fn()
+	world.Restore(h.world, present)
+}
+
+// RecordingSummary is metadata about a recording written by RecordTick/
+// StartRecording, without needing a live Hub to decode it into.
+type RecordingSummary struct {
+	Ticks       int // number of tickRecordings read
+	FirstTick   uint32
+	LastTick    uint32
+	MaxEntities int
+}
+
+// SummarizeRecording reads every tickRecording in r and reports basic
+// metadata about it. It exists for tooling (see replay_main) that wants to
+// inspect a recording without standing up a full Hub, since reconstructing
+// game state from scratch requires one (ReplayTick mutates an existing
+// world.Entity set rather than creating one).
+func SummarizeRecording(r io.Reader) (summary RecordingSummary, err error) {
+	decoder := json.NewDecoder(r)
+	for {
+		var recording tickRecording
+		if err = decoder.Decode(&recording); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		if summary.Ticks == 0 {
+			summary.FirstTick = recording.Tick
+		}
+		summary.Ticks++
+		summary.LastTick = recording.Tick
+		if len(recording.Entities) > summary.MaxEntities {
+			summary.MaxEntities = len(recording.Entities)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package replay is the gzip/JSON-lines log format shared by
+// server.StartBotRecording/ReplayBotLog and server.StartSessionRecording/
+// ReplaySession. It only knows about the
+// generic envelope (tick, bot, wire message type, raw payload); decoding a
+// Record's Payload into an actual server.Inbound requires the type registry
+// in package server, which is why that half lives there (see
+// server/bot_replay.go) rather than in this package.
+package replay
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+)
+
+// Record is one bot-dispatched Inbound, tagged with the tick it was issued
+// on and which bot (by BotClient.seq) issued it. A session recording (see
+// server/session_record.go) reuses BotSeq for its own per-recording client
+// ID and also writes register/unregister/checkpoint events, whose Type is a
+// sentinel rather than an Inbound type name.
+type Record struct {
+	Tick    uint32          `json:"tick"`
+	BotSeq  uint32          `json:"botSeq"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Writer appends Records to a gzip-compressed JSON-lines file.
+type Writer struct {
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// Create opens path for writing, truncating any existing file.
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(file)
+	return &Writer{file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// Write appends record to the log.
+func (w *Writer) Write(record Record) error {
+	return w.enc.Encode(record)
+}
+
+// Close flushes and closes the underlying file.
+func (w *Writer) Close() error {
+	if err := w.gz.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Reader reads back Records written by a Writer, in the order they were
+// written.
+type Reader struct {
+	file *os.File
+	gz   *gzip.Reader
+	dec  *json.Decoder
+}
+
+// Open opens a log written by Create for reading.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Reader{file: file, gz: gz, dec: json.NewDecoder(gz)}, nil
+}
+
+// Next reads the next Record in the log, returning io.EOF once exhausted.
+func (r *Reader) Next() (record Record, err error) {
+	err = r.dec.Decode(&record)
+	return
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error {
+	if err := r.gz.Close(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
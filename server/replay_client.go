@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+// ReplayClient is a minimal Client for a headless harness replaying a
+// pre-recorded trace of SignedInbound through Hub.Run's select loop (see
+// Hub.InjectSigned). Unlike BotClient it carries none of the fields a bot
+// needs to decide what to do on its own (profile, aggression, pathing) -
+// the harness is the only thing that ever originates an Inbound for it.
+type ReplayClient struct {
+	ClientData
+}
+
+func (*ReplayClient) Bot() bool {
+	return true
+}
+
+func (*ReplayClient) WantsSystemMessages() bool {
+	return false
+}
+
+func (*ReplayClient) Close() {}
+
+func (client *ReplayClient) Data() *ClientData {
+	return &client.ClientData
+}
+
+func (client *ReplayClient) Destroy() {
+	client.Hub.Unregister(client)
+}
+
+func (*ReplayClient) Init() {}
+
+// Send discards the server's reply. The harness only cares about the
+// world-state side effects of the Inbounds it injects, not what the server
+// would have sent back over a real connection.
+func (*ReplayClient) Send(out outbound) {
+	out.Pool()
+}
@@ -0,0 +1,259 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/replay"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"io"
+	"sort"
+	"time"
+)
+
+// Sentinel Record.Type values for the non-Inbound events a session
+// recording needs (see sessionRecorder). They can't collide with a real
+// inboundTypeName, which is always an uncapitalized Go identifier with no
+// '@'.
+const (
+	sessionEventRegister   = "@register"
+	sessionEventUnregister = "@unregister"
+	sessionEventCheckpoint = "@checkpoint"
+
+	// checkpointInterval is how often ReplaySession gets something to
+	// assert against - often enough to localize a physics-determinism
+	// regression to a few seconds of ticks, not so often the log balloons.
+	checkpointInterval = 5 * world.TicksPerSecond
+)
+
+// sessionRecorder is non-nil on a Hub between StartSessionRecording and
+// StopSessionRecording. Unlike botReplayRecorder (bot_replay.go), which only
+// logs what bots decided to do, this logs every client's inbound traffic
+// plus register/unregister, so ReplaySession can reconstruct an entire
+// match - human and bot clients alike - against a fresh Hub, rather than
+// just a bot-only one.
+type sessionRecorder struct {
+	writer    *replay.Writer
+	nextID    uint32
+	clientIDs map[Client]uint32
+}
+
+// StartSessionRecording begins logging register/unregister/inbound events
+// to path, for later playback via ReplaySession. h should be freshly
+// created with HubOptions.Seed set to a nonzero value, so entity ID
+// assignment (see world.World.SetRand) and bot RNG (see BotClient.rand) are
+// reproducible when replayed.
+func (h *Hub) StartSessionRecording(path string) error {
+	if h.sessionRecorder != nil {
+		return fmt.Errorf("already recording a session")
+	}
+
+	w, err := replay.Create(path)
+	if err != nil {
+		return err
+	}
+
+	h.sessionRecorder = &sessionRecorder{writer: w, clientIDs: make(map[Client]uint32)}
+
+	// The first @checkpoint is the starting world's hash, like every later
+	// one, since ReplaySession checks each against worldHash.
+	return h.writeSessionCheckpoint()
+}
+
+// StopSessionRecording stops and closes any recording started by
+// StartSessionRecording. Safe to call even if none is active.
+func (h *Hub) StopSessionRecording() error {
+	if h.sessionRecorder == nil {
+		return nil
+	}
+
+	err := h.sessionRecorder.writer.Close()
+	h.sessionRecorder = nil
+	return err
+}
+
+// recordSessionRegister assigns client a stable ID (scoped to this
+// recording, not to be confused with BotClient.seq) and logs its arrival.
+func (h *Hub) recordSessionRegister(client Client) {
+	if h.sessionRecorder == nil {
+		return
+	}
+
+	id := h.sessionRecorder.nextID
+	h.sessionRecorder.nextID++
+	h.sessionRecorder.clientIDs[client] = id
+
+	h.writeSessionEvent(id, sessionEventRegister, nil)
+}
+
+// recordSessionUnregister logs client's departure and forgets its ID.
+func (h *Hub) recordSessionUnregister(client Client) {
+	if h.sessionRecorder == nil {
+		return
+	}
+
+	id, ok := h.sessionRecorder.clientIDs[client]
+	if !ok {
+		return // registered before recording started
+	}
+	delete(h.sessionRecorder.clientIDs, client)
+
+	h.writeSessionEvent(id, sessionEventUnregister, nil)
+}
+
+// recordSessionInbound logs in, dispatched by client on the current physics
+// tick. When that tick is a multiple of checkpointInterval, also writes a
+// @checkpoint hashing the current world state (once per Inbound logged on
+// such a tick; a tick with no Inbound gets none), so ReplaySession has
+// something to assert against along the way instead of only at the end of
+// the log.
+func (h *Hub) recordSessionInbound(client Client, in Inbound) {
+	if h.sessionRecorder == nil {
+		return
+	}
+
+	id, ok := h.sessionRecorder.clientIDs[client]
+	if !ok {
+		return // registered before recording started
+	}
+
+	payload, err := json.Marshal(in)
+	if err == nil {
+		err = h.sessionRecorder.writer.Write(replay.Record{Tick: h.physicsTick, BotSeq: id, Type: inboundTypeName(in), Payload: payload})
+	}
+	if err == nil && h.physicsTick%checkpointInterval == 0 {
+		err = h.writeSessionCheckpoint()
+	}
+	if err != nil {
+		fmt.Println("session recording error:", err)
+		_ = h.StopSessionRecording()
+	}
+}
+
+func (h *Hub) writeSessionEvent(clientID uint32, kind string, payload json.RawMessage) {
+	if err := h.sessionRecorder.writer.Write(replay.Record{Tick: h.physicsTick, BotSeq: clientID, Type: kind, Payload: payload}); err != nil {
+		fmt.Println("session recording error:", err)
+		_ = h.StopSessionRecording()
+	}
+}
+
+func (h *Hub) writeSessionCheckpoint() error {
+	payload, err := json.Marshal(h.worldHash())
+	if err != nil {
+		return err
+	}
+	return h.sessionRecorder.writer.Write(replay.Record{Tick: h.physicsTick, Type: sessionEventCheckpoint, Payload: payload})
+}
+
+// worldHash summarizes every entity's deterministic state into a single
+// value, order-independent (entities are sorted by EntityID first), so
+// ReplaySession can compare one against a recorded @checkpoint without
+// caring what order ForEntities happened to visit entities in.
+func (h *Hub) worldHash() uint64 {
+	var entities []entitySnapshot
+	h.world.ForEntities(func(e *world.Entity) (stop, remove bool) {
+		entities = append(entities, entitySnapshot{
+			EntityID:   e.EntityID,
+			EntityType: e.EntityType,
+			Transform:  e.Transform,
+			Guidance:   e.Guidance,
+			Ticks:      e.Ticks,
+			Sinking:    e.Sinking,
+		})
+		return
+	})
+	sort.Slice(entities, func(i, j int) bool { return entities[i].EntityID < entities[j].EntityID })
+
+	buf, err := json.Marshal(entities)
+	if err != nil {
+		panic(err) // entitySnapshot always marshals
+	}
+
+	// FNV-1a.
+	var hash uint64 = 14695981039346656037
+	for _, b := range buf {
+		hash ^= uint64(b)
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// ReplaySession replays a log written by StartSessionRecording against h,
+// which should be freshly created with the same HubOptions.Seed the
+// recording was started with. It spawns one ReplayClient per distinct
+// recorded client ID at the tick it registered, injects its Inbounds as
+// they were received (see Hub.InjectSigned), and compares every recorded
+// @checkpoint against h's own worldHash, returning an error on the first
+// mismatch.
+//
+// Like ReplayBotLog, this only reproduces the recording bit-for-bit so long
+// as h's physics never falls behind and has to skip ticks relative to the
+// original run (see Hub.skippedCounter).
+func ReplaySession(path string, h *Hub) error {
+	reader, err := replay.Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	h.sessionReplaying = true
+	defer func() { h.sessionReplaying = false }()
+
+	clients := make(map[uint32]*ReplayClient)
+
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading session log: %w", err)
+		}
+
+		for h.physicsTick < record.Tick {
+			time.Sleep(time.Millisecond)
+		}
+
+		switch record.Type {
+		case sessionEventCheckpoint:
+			var want uint64
+			if err := json.Unmarshal(record.Payload, &want); err != nil {
+				return fmt.Errorf("session log: decoding checkpoint: %w", err)
+			}
+			if got := h.worldHash(); got != want {
+				return fmt.Errorf("session log: world hash mismatch at tick %d: got %d, want %d", record.Tick, got, want)
+			}
+		case sessionEventRegister:
+			client := &ReplayClient{}
+			clients[record.BotSeq] = client
+			h.register <- client
+
+			for client.Data().Hub == nil {
+				time.Sleep(time.Millisecond)
+			}
+		case sessionEventUnregister:
+			if client, ok := clients[record.BotSeq]; ok {
+				client.Destroy()
+				delete(clients, record.BotSeq)
+			}
+		default:
+			typ, ok := inboundMessageTypes[messageType(record.Type)]
+			if !ok {
+				return fmt.Errorf("session log: unknown inbound type %q", record.Type)
+			}
+
+			in, err := decodeInbound(typ, record.Payload)
+			if err != nil {
+				return fmt.Errorf("session log: decoding %s: %w", record.Type, err)
+			}
+
+			client, ok := clients[record.BotSeq]
+			if !ok {
+				return fmt.Errorf("session log: inbound from unregistered client %d", record.BotSeq)
+			}
+			h.InjectSigned(SignedInbound{Client: client, Inbound: in})
+		}
+	}
+}
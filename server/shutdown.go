@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// shutdownRequest carries a Shutdown call's arguments into Run's select
+// loop (see Hub.shutdown), so beginShutdown only ever touches h.world/
+// h.clients/h.cloud from Run's own goroutine, the same way handoffRequest
+// does for cross-shard handoff.
+type shutdownRequest struct {
+	message string
+	done    chan struct{}
+}
+
+// Shutdown asks Run to stop the world in place: mark the Hub as draining
+// (see Draining, checked by ServeSocket), immediately notify every
+// connected Client with a System/Overlay Chat (see Broadcast) instead of
+// waiting for the next Update tick, and save a world snapshot (see
+// SaveWorldSnapshot) - all from Run's own goroutine, so it's safe to do
+// even while Physics/Update might otherwise be mutating h.world. Safe to
+// call from any goroutine (see server_main's signal handler). The returned
+// channel is closed once all of that has happened; the caller should still
+// apply its own grace period afterward for clients to act on the notice
+// before actually exiting, since Shutdown doesn't wait for them to
+// reconnect elsewhere or disconnect on their own.
+func (h *Hub) Shutdown(message string) <-chan struct{} {
+	atomic.StoreInt32(&h.draining, 1)
+	req := shutdownRequest{message: message, done: make(chan struct{})}
+	h.shutdown <- req
+	return req.done
+}
+
+// Draining is whether Shutdown has been called, checked by ServeSocket to
+// reject new /ws upgrades during a graceful restart instead of accepting
+// connections that are about to be dropped anyway.
+func (h *Hub) Draining() bool {
+	return atomic.LoadInt32(&h.draining) != 0
+}
+
+// beginShutdown is Shutdown's Run-goroutine half (see shutdownRequest).
+func (h *Hub) beginShutdown(req shutdownRequest) {
+	for client := h.clients.First; client != nil; client = client.Data().Next {
+		client.Send(Chat{Message: req.message, System: true, Overlay: true})
+	}
+
+	if err := h.SaveWorldSnapshot(); err != nil {
+		log.Printf("saving world snapshot on shutdown: %v\n", err)
+	}
+
+	close(req.done)
+}
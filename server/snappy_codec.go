@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+)
+
+// snappyThreshold is the minimum encoded payload size worth compressing.
+// Below it, Snappy's own overhead (plus our one flag byte) dominates any
+// savings, so small frames - most Chat/RateLimited/AdminDebugEvent sends -
+// go out raw instead. Update frames, the payload this exists for, are
+// comfortably larger on any scene with more than a couple of contacts.
+const snappyThreshold = 256
+
+// snappySubprotocol negotiates binaryCodec wrapped in per-message Snappy
+// compression (see snappyCodec). It's a further opt-in beyond
+// binarySubprotocol, not a replacement for it - most frames are small
+// enough that compression would net lose (see snappyThreshold), so a
+// client should only request this when it actually expects large,
+// repetitive payloads (e.g. dense Update.Contacts).
+const snappySubprotocol = "mk48-binary-snappy"
+
+// snappyCodec wraps another Codec - always binaryCodec in practice, see
+// codecForSubprotocol - with optional Snappy compression of its encoded
+// output. One flag byte precedes inner's bytes: 0 means "verbatim", 1
+// means "snappy.Encode of inner's bytes". No length prefix is needed
+// beyond that, unlike binary_message.go's tag-0 JSON fallback - a Codec's
+// Encode/Decode already correspond 1:1 with a single WebSocket frame (see
+// the Codec doc comment), so Decode's io.Reader is already bounded to
+// exactly one message.
+//
+// A snappyCodec is constructed once per connection (see
+// codecForSubprotocol) and reuses buf/scratch across every Encode/Decode
+// call on it, so a client under sustained load doesn't reallocate
+// compression scratch space every tick.
+type snappyCodec struct {
+	inner   Codec
+	stats   *ClientStats
+	buf     bytes.Buffer
+	scratch []byte
+}
+
+func (c *snappyCodec) FrameType() int { return c.inner.FrameType() }
+
+func (c *snappyCodec) MaxMessageSize() int64 { return c.inner.MaxMessageSize() }
+
+func (c *snappyCodec) SupportsLeaderboardDelta() bool { return c.inner.SupportsLeaderboardDelta() }
+
+func (c *snappyCodec) SupportsContactsDelta() bool { return c.inner.SupportsContactsDelta() }
+
+func (c *snappyCodec) Encode(w io.Writer, message Message) error {
+	c.buf.Reset()
+	if err := c.inner.Encode(&c.buf, message); err != nil {
+		return err
+	}
+	raw := c.buf.Bytes()
+
+	if len(raw) < snappyThreshold {
+		atomic.AddInt64(&c.stats.BytesBeforeCompress, int64(len(raw)))
+		atomic.AddInt64(&c.stats.BytesAfterCompress, int64(len(raw)+1))
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+		_, err := w.Write(raw)
+		return err
+	}
+
+	c.scratch = snappy.Encode(c.scratch, raw)
+	atomic.AddInt64(&c.stats.BytesBeforeCompress, int64(len(raw)))
+	atomic.AddInt64(&c.stats.BytesAfterCompress, int64(len(c.scratch)+1))
+
+	if _, err := w.Write([]byte{1}); err != nil {
+		return err
+	}
+	_, err := w.Write(c.scratch)
+	return err
+}
+
+func (c *snappyCodec) Decode(r io.Reader) (Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(data) == 0 {
+		return Message{}, fmt.Errorf("snappy_codec: empty frame")
+	}
+
+	payload := data[1:]
+	if data[0] == 1 {
+		payload, err = snappy.Decode(nil, payload)
+		if err != nil {
+			return Message{}, err
+		}
+	}
+
+	return c.inner.Decode(bytes.NewReader(payload))
+}
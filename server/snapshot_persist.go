@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// SaveWorldSnapshot encodes h.world (see world.WriteSnapshot) and hands it
+// to the Cloud for durable storage, so a restart can pick up where the
+// server left off instead of starting from an empty world. Meant to be
+// called once, around a graceful shutdown.
+func (h *Hub) SaveWorldSnapshot() error {
+	if h.cloud == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := world.WriteSnapshot(h.world, &buf); err != nil {
+		return fmt.Errorf("encoding world snapshot: %w", err)
+	}
+	return h.cloud.UploadWorldSnapshot(buf.Bytes())
+}
+
+// LoadWorldSnapshot fetches the snapshot SaveWorldSnapshot last stored (if
+// any) and applies it to h.world (see world.ReadSnapshot). Meant to be
+// called once, right after NewHub, before serving any connections - boats
+// won't have their extension state (armaments, turrets, altitude) restored
+// until their owning Player has reconnected and respawned, since that state
+// lives on the Player rather than the Entity (see binary_snapshot.go).
+func (h *Hub) LoadWorldSnapshot() error {
+	if h.cloud == nil {
+		return nil
+	}
+	data, err := h.cloud.DownloadWorldSnapshot()
+	if err != nil {
+		return fmt.Errorf("downloading world snapshot: %w", err)
+	}
+	if data == nil {
+		return nil
+	}
+	if err := world.ReadSnapshot(h.world, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("decoding world snapshot: %w", err)
+	}
+	return nil
+}
@@ -5,12 +5,15 @@ package server
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/SoftbearStudios/mk48/server/world"
 	"github.com/gorilla/websocket"
 )
 
@@ -24,19 +27,28 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 8) / 10
 
-	// If more than this many messages are queued for sending, the
-	// socket is congested and messages may be dropped
-	socketCongestionThreshold = 5
-
 	// Allows ~1 second of messages to backup before close
 	// (although the sending may be throttled to slow down
 	// hitting this limit)
 	socketBufferSize = 16
 
+	// socketSendDeadline is how long SocketClient.Send blocks trying to
+	// queue a PriorityReliable message before giving up on the connection
+	// entirely (see sendReliable). Short enough that one slow client's
+	// writePump can't back up Hub.Run's broadcast loop for long.
+	socketSendDeadline = 250 * time.Millisecond
+
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
 
 	debugSocket = true
+
+	// binarySubprotocol is offered during the WebSocket handshake (see
+	// upgrader below) so clients built against Message.MarshalBinary/
+	// UnmarshalBinary (see binary_message.go) can opt into the more compact
+	// codec. A client that doesn't request it negotiates no subprotocol and
+	// NewSocketClient falls back to the original JSON path unchanged.
+	binarySubprotocol = "mk48-binary"
 )
 
 var upgrader = websocket.Upgrader{
@@ -46,31 +58,67 @@ var upgrader = websocket.Upgrader{
 	HandshakeTimeout: time.Second,
 	ReadBufferSize:   maxMessageSize,
 	WriteBufferSize:  2048,
+	Subprotocols:     []string{binarySubprotocol, snappySubprotocol},
 }
 
 // SocketClient is a middleman between the websocket connection and the hub.
 type SocketClient struct {
 	ClientData
-	conn    *websocket.Conn
-	send    chan Outbound
-	once    sync.Once
-	ip      net.IP
-	counter int // counts up every send
+	conn  *websocket.Conn
+	send  chan Outbound // PriorityReliable messages only; see sendLossy
+	once  sync.Once
+	ip    net.IP
+	codec Codec // negotiated at handshake; see codecForSubprotocol
+
+	lossyMu sync.Mutex
+	lossy   map[string]Outbound // Coalesce key -> latest not-yet-written PriorityLossy message
+	wake    chan struct{}       // buffered 1; pokes writePump to drain lossy
+
+	// violations counts consecutive Hub.inboundLimiter rejections; only
+	// ever touched from readPump's own goroutine, so it needs no locking.
+	// See maxInboundViolations.
+	violations int
+
+	// contactsCache is the last full Contacts this client was sent, keyed
+	// by EntityID, used by Hub.updateClient/diffContacts (contacts_delta.go)
+	// to compute ContactsAdded/Updated/Removed. Only populated for a Codec
+	// that reports SupportsContactsDelta; nil otherwise. Every
+	// contactsFullPeriod resync clears it and refills it with that tick's
+	// full Contacts, so the next tick diffs against a fresh delta base.
+	// Only ever touched from Hub.updateClient, which runs at
+	// most once per client per tick (see Hub.Update), so it needs no
+	// locking despite updateClient running in parallel across clients.
+	contactsCache map[world.EntityID]Contact
 }
 
 // Create a SocketClient from a connection
 func NewSocketClient(conn *websocket.Conn, ip net.IP) *SocketClient {
-	return &SocketClient{
-		conn: conn,
-		ip:   ip,
-		send: make(chan Outbound, socketBufferSize),
+	client := &SocketClient{
+		conn:  conn,
+		ip:    ip,
+		send:  make(chan Outbound, socketBufferSize),
+		lossy: make(map[string]Outbound),
+		wake:  make(chan struct{}, 1),
 	}
+	// Passed separately from conn.Subprotocol() rather than folded into the
+	// struct literal above: a negotiated snappyCodec needs &client.Stats to
+	// record into, which doesn't exist until client itself does.
+	client.codec = codecForSubprotocol(conn.Subprotocol(), &client.Stats)
+	return client
 }
 
 func (client *SocketClient) Bot() bool {
 	return false
 }
 
+func (client *SocketClient) WantsSystemMessages() bool {
+	return true
+}
+
+func (client *SocketClient) IP() net.IP {
+	return client.ip
+}
+
 func (client *SocketClient) Close() {
 	close(client.send)
 }
@@ -103,35 +151,63 @@ func (client *SocketClient) Init() {
 }
 
 func (client *SocketClient) Send(message Outbound) {
-	// How many messages there are in excess of a reasonable amount
-	congestion := len(client.send) - socketCongestionThreshold
-
-	// The closer the buffer is to being full, the more messages
-	// we drop on the floor (to give the socket a chance to
-	// catch up)
-	client.counter++
-	if congestion > 1 && client.counter%congestion != 0 {
-		// Drop the message on the floor
-		// The only long-term data loss will be from event-based things
-		// like chat messages
-		fmt.Println("SocketClient dropping message due to congestion")
+	if message.Priority() == PriorityLossy && message.Coalesce() != "" {
+		client.sendLossy(message)
 		return
 	}
+	client.sendReliable(message)
+}
+
+// sendLossy coalesces message into client.lossy under its Coalesce key,
+// replacing (and Pool-ing) whatever was already waiting there, then pokes
+// writePump to drain it. Unlike the old fixed-threshold drop, this never
+// grows unbounded behind a slow client - there's at most one pending
+// message per key, no matter how far writePump falls behind.
+func (client *SocketClient) sendLossy(message Outbound) {
+	key := message.Coalesce()
+
+	client.lossyMu.Lock()
+	if previous, ok := client.lossy[key]; ok {
+		previous.Pool()
+		atomic.AddInt64(&client.Stats.Coalesced, 1)
+	}
+	client.lossy[key] = message
+	client.lossyMu.Unlock()
 
 	select {
-	case client.send <- message:
+	case client.wake <- struct{}{}:
 	default:
-		// Not responsive
+		// writePump hasn't drained the last wake yet; it'll see this
+		// message too once it does.
+	}
+}
+
+// sendReliable queues a PriorityReliable message, blocking up to
+// socketSendDeadline rather than dropping it. Only on true deadline exceeded
+// does it give up - and then it's the connection that gets destroyed, not
+// just this one message, since a client that can't keep up with reliable
+// traffic isn't salvageable by dropping more of it.
+func (client *SocketClient) sendReliable(message Outbound) {
+	select {
+	case client.send <- message:
+	case <-time.After(socketSendDeadline):
 		if debugSocket {
 			fmt.Println("SocketClient is not responsive")
 		}
+		atomic.AddInt64(&client.Stats.Dropped, 1)
+		message.Pool()
 		client.Destroy()
 	}
 }
 
 func (client *SocketClient) readPump() {
 	defer client.Destroy()
-	client.conn.SetReadLimit(maxMessageSize)
+	// Per-Codec, not the upgrader's fixed ReadBufferSize: the subprotocol
+	// (and therefore client.codec) is already negotiated by the time
+	// NewSocketClient runs, but WriteBufferSize/ReadBufferSize above are
+	// set on the shared upgrader before any connection (and its
+	// subprotocol) exists, so they can't vary per-Codec the same way.
+	client.conn.SetReadLimit(client.codec.MaxMessageSize())
 	_ = client.conn.SetReadDeadline(time.Now().Add(pongWait))
 	client.conn.SetPongHandler(func(string) error {
 		_ = client.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -150,8 +226,14 @@ func (client *SocketClient) readPump() {
 			break
 		}
 
-		var message Message
-		err = json.NewDecoder(r).Decode(&message)
+		if !client.Hub.allowMessage(client.ip) {
+			// Drop the message on the floor rather than closing the socket;
+			// a client that briefly bursts shouldn't be disconnected outright.
+			_, _ = io.Copy(io.Discard, r)
+			continue
+		}
+
+		message, err := client.codec.Decode(r)
 		if err != nil {
 			log.Println("unmarshal error:", err.Error())
 			break
@@ -159,9 +241,22 @@ func (client *SocketClient) readPump() {
 
 		if invalidMessage, ok := message.Data.(InvalidInbound); ok {
 			log.Println("invalid message type received:", invalidMessage.messageType)
-		} else {
-			client.Hub.ReceiveSigned(SignedInbound{Client: client, Inbound: message.Data.(Inbound)}, true)
+			continue
+		}
+
+		in := message.Data.(Inbound)
+		weight := inboundWeight(in)
+		if client.ip != nil && !client.Hub.inboundLimiter.AllowN(client.ip.String(), weight) {
+			client.violations++
+			client.Send(RateLimited{RetryAfterMillis: client.Hub.inboundLimiter.RetryAfter(weight).Milliseconds()})
+			if client.violations > maxInboundViolations {
+				break
+			}
+			continue
 		}
+		client.violations = 0
+
+		client.Hub.ReceiveSigned(SignedInbound{Client: client, Inbound: in}, true)
 	}
 }
 
@@ -181,28 +276,15 @@ func (client *SocketClient) writePump() {
 	for {
 		select {
 		case out, ok := <-client.send:
-			_ = client.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel.
+				_ = client.conn.SetWriteDeadline(time.Now().Add(writeWait))
 				_ = client.conn.WriteMessage(websocket.CloseMessage, nil)
 				panic("hub closed channel")
 			}
-
-			w, err := client.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				panic(err)
-			}
-
-			// Wrap with Message to marshal type
-			if err = json.NewEncoder(w).Encode(Message{Data: out}); err != nil {
-				panic(err)
-			}
-
-			out.Pool()
-
-			if err = w.Close(); err != nil {
-				panic(err)
-			}
+			client.writeOne(out)
+		case <-client.wake:
+			client.flushLossy()
 		case <-pingTicker.C:
 			_ = client.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -211,3 +293,43 @@ func (client *SocketClient) writePump() {
 		}
 	}
 }
+
+// flushLossy writes out (and clears) every message currently coalesced in
+// client.lossy. It snapshots the map and swaps in a fresh one before
+// writing, rather than writing while holding lossyMu, so Send can keep
+// coalescing the next message for a key while this round's writes (which
+// can block on the network) are still in flight.
+func (client *SocketClient) flushLossy() {
+	client.lossyMu.Lock()
+	pending := client.lossy
+	client.lossy = make(map[string]Outbound, len(pending))
+	client.lossyMu.Unlock()
+
+	for _, out := range pending {
+		client.writeOne(out)
+	}
+}
+
+// writeOne encodes and writes a single Outbound, returning it to its
+// sync.Pool afterward, and records the Encode+Write latency into
+// Stats.WriteMicros.
+func (client *SocketClient) writeOne(out Outbound) {
+	_ = client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+	w, err := client.conn.NextWriter(client.codec.FrameType())
+	if err != nil {
+		panic(err)
+	}
+
+	start := time.Now()
+	if err = client.codec.Encode(w, Message{Data: out}); err != nil {
+		panic(err)
+	}
+	out.Pool()
+
+	if err = w.Close(); err != nil {
+		panic(err)
+	}
+
+	atomic.StoreInt64(&client.Stats.WriteMicros, time.Since(start).Microseconds())
+}
@@ -4,6 +4,7 @@
 package server
 
 import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
 	"github.com/SoftbearStudios/mk48/server/world"
 	"github.com/chewxy/math32"
 	"math/rand"
@@ -69,7 +70,7 @@ func (h *Hub) Spawn() {
 					barrelCount := 0
 
 					// Count current barrels
-					h.world.ForEntitiesInRadius(pos, barrelRadius, func(_ float32, entity *world.Entity) (_ bool) {
+					h.world.ForEntitiesInRadius(pos, barrelRadius, func(_ float32, _ world.EntityID, entity *world.Entity) (_ bool) {
 						barrelCount++
 						return
 					})
@@ -121,8 +122,9 @@ func (h *Hub) Spawn() {
 	}
 }
 
-// spawnEntity spawns an entity and sets its owners EntityID if applicable.
-// Returns if non zero EntityID if spawned.
+// spawnEntity spawns an entity and sets its owner's EntityID (or appends to
+// EntityIDs, if the owner already has a primary ship - see HubOptions.FleetSize)
+// if applicable. Returns if non zero EntityID if spawned.
 // TODO fix this mess
 func (h *Hub) spawnEntity(entity *world.Entity, initialRadius float32) world.EntityID {
 	if initialRadius > 0 {
@@ -133,7 +135,7 @@ func (h *Hub) spawnEntity(entity *world.Entity, initialRadius float32) world.Ent
 		governor := 0
 
 		// Always randomize on first iteration
-		for entity.Position == center || !h.canSpawn(entity, threshold) {
+		for entity.Position == center || !h.canSpawn(entity, threshold) || !h.biomeAccepts(entity.Data().Kind, entity.Position) {
 			// Pick a new position
 			position := world.RandomAngle().Vec2f().Mul(math32.Sqrt(rand.Float32()) * radius)
 			entity.Position = center.Add(position)
@@ -165,17 +167,50 @@ func (h *Hub) spawnEntity(entity *world.Entity, initialRadius float32) world.Ent
 	h.world.AddEntity(entity)
 	entityID := entity.EntityID
 	if entity.Owner != nil && entity.Data().Kind == world.EntityKindBoat {
-		if entity.Owner.EntityID != world.EntityIDInvalid {
-			panic("owner already has EntityID")
-		}
-		if entity.Owner.Respawning() {
-			entity.Owner.ClearRespawn()
+		if entity.Owner.EntityID == world.EntityIDInvalid {
+			if entity.Owner.Respawning() {
+				entity.Owner.ClearRespawn()
+			}
+			entity.Owner.EntityID = entityID
+		} else {
+			// Owner already has a primary ship; this is a fleet addition
+			// (see HubOptions.FleetSize), so track it as a secondary hull
+			// instead of panicking. Spawn.Process (inbound.go) is the only
+			// caller that reaches this branch - it already checked fleet
+			// capacity before calling spawnEntity.
+			entity.Owner.EntityIDs = append(entity.Owner.EntityIDs, entityID)
 		}
-		entity.Owner.EntityID = entityID
 	}
 	return entityID
 }
 
+// biomeAccepts applies a soft preference for where collectibles spawn -
+// likelier in shallows (denser "reefs"), less likely in deep ocean - by
+// rejecting (and letting spawnEntity's loop re-roll) a fraction of
+// candidate positions in the wrong biome. Everything other than a
+// collectible is unaffected, and this is always true if h.terrain can't
+// report a Biome (e.g. a flat test terrain with no TypedSource behind it).
+// Dedicated obstacle types like icebergs would need entries in
+// entities.json before they could be biased the same way; there aren't
+// any in this build yet (see world.EntityType).
+func (h *Hub) biomeAccepts(kind world.EntityKind, pos world.Vec2f) bool {
+	if kind != world.EntityKindCollectible {
+		return true
+	}
+	biomed, ok := h.terrain.(interface{ BiomeAt(world.Vec2f) terrain.Biome })
+	if !ok {
+		return true
+	}
+	switch biomed.BiomeAt(pos) {
+	case terrain.BiomeShallows:
+		return true
+	case terrain.BiomeDeepOcean:
+		return rand.Float32() < 0.35
+	default:
+		return rand.Float32() < 0.7
+	}
+}
+
 // nearAny Returns if any entities are within a threshold for spawning (or if colliding with terrain)
 func (h *Hub) canSpawn(entity *world.Entity, threshold float32) bool {
 	switch entity.Data().Kind {
@@ -206,7 +241,7 @@ func (h *Hub) canSpawn(entity *world.Entity, threshold float32) bool {
 	radius := entity.Data().Radius
 	maxT := (radius + world.EntityRadiusMax) * threshold
 
-	return !h.world.ForEntitiesInRadius(entity.Position, maxT, func(r float32, otherEntity *world.Entity) (stop bool) {
+	return !h.world.ForEntitiesInRadius(entity.Position, maxT, func(r float32, _ world.EntityID, otherEntity *world.Entity) (stop bool) {
 		t := (radius + otherEntity.Data().Radius) * threshold
 		return r < t*t
 	})
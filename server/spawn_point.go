@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+	"github.com/chewxy/math32"
+	"math/rand"
+)
+
+const (
+	// spawnPointCandidates is the fallback for h.spawnCandidates (how many
+	// candidate positions pickSpawnPosition scores per radius attempt) used
+	// only to seed defaultSpawnCandidates in hub.go.
+	spawnPointCandidates = 16
+	// spawnPointExpansions bounds how many times pickSpawnPosition retries
+	// with an expanded radius if every candidate fails a hard floor
+	// (closestEnemy < spawnMinEnemyDistance, or terrain/collision unsafe).
+	spawnPointExpansions = 4
+	// spawnPointExpansionFactor grows the radius by this factor on each
+	// retry of pickSpawnPosition.
+	spawnPointExpansionFactor = 1.5
+	// spawnPointSafetyThreshold is the canSpawn threshold a candidate must
+	// pass, matching the final conservative check spawnEntity itself
+	// performs right before adding the entity.
+	spawnPointSafetyThreshold = 1
+)
+
+// pickSpawnPosition samples h.spawnCandidates positions within radius of
+// center, scores each by distance from the nearest hostile boat (rewarding
+// distance, up to a point) weighed against a bonus for landing near
+// teammate (if eligible), a penalty for landing inside another boat's
+// collision radius, and a penalty for falling inside a hostile's radar or
+// visual sensor cone (see scoreSpawnCandidate), and moves entity to the
+// highest-scoring candidate. Candidates closer to a hostile than
+// h.spawnMinEnemyDistance, or that fail the terrain/entity collision check
+// (canSpawn), are rejected outright; if every candidate in an attempt is
+// rejected, radius is expanded and resampled up to spawnPointExpansions
+// times. Returns false, leaving entity untouched, only if every attempt was
+// exhausted without finding an acceptable candidate - the caller should
+// treat that as a failed spawn.
+//
+// Scoring already only weighs hostiles (entity.Owner.Friendly excludes
+// teammates in scoreSpawnCandidate), so there's no separate "team filter"
+// mode to apply. A candidate is accepted once it clears the hard floors
+// above even if its weighted score is negative (e.g. a hazard-penalized
+// candidate surrounded by worse alternatives); falling all the way back to
+// spawnEntity's own random-walk placement only happens if every attempt is
+// exhausted, not merely if the best score is negative, since the boats this
+// is used for have no other fallback position to offer.
+func (h *Hub) pickSpawnPosition(entity *world.Entity, center world.Vec2f, radius float32, teammate *world.Vec2f, canRespawnWithTeam bool) bool {
+	var best world.Vec2f
+	bestScore := float32(math32.Inf(-1))
+	found := false
+
+	for attempt := 0; attempt <= spawnPointExpansions; attempt++ {
+		for i := 0; i < h.spawnCandidates; i++ {
+			candidate := center.Add(world.RandomAngle().Vec2f().Mul(math32.Sqrt(rand.Float32()) * radius))
+			if candidate.LengthSquared() > h.worldRadius*h.worldRadius {
+				continue
+			}
+
+			score, passed := h.scoreSpawnCandidate(entity, candidate, teammate, canRespawnWithTeam)
+			if !passed {
+				continue
+			}
+
+			if !found || score > bestScore {
+				best, bestScore, found = candidate, score, true
+			}
+		}
+
+		if found {
+			entity.Position = best
+			entity.Direction = world.RandomAngle()
+			entity.DirectionTarget = entity.Direction
+			return true
+		}
+
+		radius *= spawnPointExpansionFactor
+	}
+
+	return false
+}
+
+// scoreSpawnCandidate scores a single candidate position for entity,
+// returning passed = false if the candidate is closer to a hostile boat
+// than h.spawnMinEnemyDistance, or fails the terrain/entity collision check
+// - both hard floors pickSpawnPosition rejects candidates on regardless of
+// score. Temporarily moves entity to candidate to run that check, restoring
+// its original position before returning. The sensor-cone penalty reuses
+// Entity.Camera and Sensor.InArc, the same primitives updateClient uses to
+// decide what a player can see, so a candidate a hostile's radar or
+// lookouts would immediately spot is scored down the same way a physically
+// close hostile is.
+func (h *Hub) scoreSpawnCandidate(entity *world.Entity, candidate world.Vec2f, teammate *world.Vec2f, canRespawnWithTeam bool) (score float32, passed bool) {
+	original := entity.Position
+	entity.Position = candidate
+	safe := h.canSpawn(entity, spawnPointSafetyThreshold)
+	entity.Position = original
+	if !safe {
+		return 0, false
+	}
+
+	closestEnemy := float32(math32.Inf(1))
+	hazard := false
+	sensorHits := 0
+
+	searchRadius := h.spawnGoodEnemyDistance * 2
+	h.world.ForEntitiesInRadius(candidate, searchRadius, func(r float32, _ world.EntityID, other *world.Entity) (stop bool) {
+		if other.Data().Kind != world.EntityKindBoat || entity.Owner.Friendly(other.Owner) {
+			return false
+		}
+
+		dist := math32.Sqrt(r)
+		if dist < closestEnemy {
+			closestEnemy = dist
+		}
+
+		// Collision radius check doubles as the "inside another player's
+		// AABB" hazard penalty - this codebase treats boat collision space
+		// as circular everywhere else (see canSpawn in spawn.go), so a
+		// circular hazard check matches the rest of the collision model
+		// rather than introducing a one-off box test.
+		if dist < other.Data().Radius {
+			hazard = true
+		}
+
+		// Penalize landing inside this hostile's radar or visual cone,
+		// using the same Camera/Sensor.InArc math updateClient uses to
+		// decide what a player can see. Bounded by searchRadius like the
+		// hazard check above, so a hostile with radar range beyond
+		// searchRadius won't be caught here - an acceptable approximation
+		// given searchRadius already scales with spawnGoodEnemyDistance.
+		_, visualRange, radarRange, _ := other.Camera()
+		bearing := candidate.Sub(other.Position).Angle() - other.Direction
+		sensors := other.Data().Sensors
+		if (radarRange > 0 && dist < radarRange && sensors.Radar.InArc(bearing)) ||
+			(visualRange > 0 && dist < visualRange && sensors.Visual.InArc(bearing)) {
+			sensorHits++
+		}
+
+		return false
+	})
+
+	if closestEnemy < h.spawnMinEnemyDistance {
+		return 0, false
+	}
+
+	if closestEnemy > h.spawnGoodEnemyDistance {
+		score += h.spawnGoodDistanceBonus
+	}
+	score += h.spawnDistanceWeight * closestEnemy
+
+	if hazard {
+		score -= h.spawnHazardPenalty
+	}
+	score -= float32(sensorHits) * h.spawnSensorPenalty
+
+	if canRespawnWithTeam && teammate != nil {
+		if dist := candidate.Distance(*teammate); dist < h.spawnTeammateDistance {
+			score += h.spawnTeammateBonus
+		}
+	}
+
+	return score, true
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/SoftbearStudios/mk48/server/terrain"
 	"github.com/gorilla/websocket"
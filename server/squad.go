@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// SquadOrders is the shared tactical state a Team's bots read each tick, so
+// screen/scout/artillery bots can coordinate around a leader instead of each
+// independently chasing whatever's closest. It's recomputed by
+// Hub.updateSquads once per leaderboard period.
+type SquadOrders struct {
+	HasLeader bool
+	LeaderID  world.PlayerID
+	LeaderPos world.Vec2f
+	LeaderDir world.Angle
+
+	// HasTarget/Target is set when the leader has a closest enemy in sight,
+	// so artillery bots only fire at a target the leader can see.
+	HasTarget bool
+	Target    world.Vec2f
+}
+
+// updateSquads recomputes SquadOrders for every team, whether or not any of
+// its bots has a FormationRole, picking the first member with
+// FormationRoleLeader as leader (falling back to the team's owner, i.e.
+// Members[0], if none claimed it).
+func (h *Hub) updateSquads() {
+	for _, team := range h.teams {
+		var leader *world.Player
+		for _, member := range team.Members {
+			if bot, ok := h.botOf(member); ok && bot.profile.FormationRole == FormationRoleLeader {
+				leader = member
+				break
+			}
+		}
+		if leader == nil && len(team.Members) > 0 {
+			leader = team.Members[0]
+		}
+
+		// Only the leader-position fields are refreshed here; Target/
+		// HasTarget are instead set by the leader bot's own Send (see
+		// bot_client.go) when it calls a target, and left alone otherwise so
+		// they survive until the leader calls a new one.
+		team.SquadOrders.HasLeader = false
+		if leader != nil {
+			h.world.EntityByID(leader.EntityID, func(e *world.Entity) (remove bool) {
+				team.SquadOrders.HasLeader = true
+				team.SquadOrders.LeaderID = leader.PlayerID()
+				team.SquadOrders.LeaderPos = e.Position
+				team.SquadOrders.LeaderDir = e.Direction
+				return false
+			})
+		}
+	}
+}
+
+// botOf returns the BotClient backing player, if player belongs to a bot
+// (rather than a human SocketClient).
+func (h *Hub) botOf(player *world.Player) (*BotClient, bool) {
+	for client := h.clients.First; client != nil; client = client.Data().Next {
+		if &client.Data().Player.Player == player {
+			bot, ok := client.(*BotClient)
+			return bot, ok
+		}
+	}
+	return nil, false
+}
+
+// screenOffset returns where a screening bot at slot index (0-based, among
+// a team's screen bots) should keep station relative to the leader: spread
+// evenly around the leader at a fixed radius.
+func screenOffset(leaderPos world.Vec2f, leaderDir world.Angle, index, count int, radius float32) world.Vec2f {
+	if count <= 0 {
+		count = 1
+	}
+	angle := leaderDir + world.ToAngle(2*3.14159265/float32(count)*float32(index))
+	return leaderPos.AddScaled(angle.Vec2f(), radius)
+}
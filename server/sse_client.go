@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sseBufferSize matches socketBufferSize - the same amount of backpressure
+// before a slow consumer gets messages dropped rather than blocking the Hub.
+const sseBufferSize = socketBufferSize
+
+// SSEClient is a read-only Client that streams Outbound messages to an HTTP
+// responder as Server-Sent Events (see Hub.ServeEvents) instead of a
+// full-duplex SocketClient. It never originates an Inbound of its own, so
+// Bot reports true the same way BotClient/ReplayClient do, keeping it out
+// of cloud player-count/location bookkeeping (see Hub.Run's register case).
+type SSEClient struct {
+	ClientData
+	w       http.ResponseWriter
+	flusher http.Flusher
+	send    chan Outbound
+	done    chan struct{} // closed once writePump exits, so ServeEvents can return
+	once    sync.Once
+	topics  map[string]bool // nil means every topic; see topicOf
+}
+
+// NewSSEClient parses the raw ?topics= query value (comma-separated) into
+// the filter Send checks. An empty string subscribes to every topic, the
+// same full mirror a SocketClient would get.
+func NewSSEClient(w http.ResponseWriter, flusher http.Flusher, topics string) *SSEClient {
+	var set map[string]bool
+	if topics != "" {
+		set = make(map[string]bool)
+		for _, topic := range strings.Split(topics, ",") {
+			set[strings.TrimSpace(topic)] = true
+		}
+	}
+
+	return &SSEClient{
+		w:       w,
+		flusher: flusher,
+		send:    make(chan Outbound, sseBufferSize),
+		done:    make(chan struct{}),
+		topics:  set,
+	}
+}
+
+func (client *SSEClient) Bot() bool {
+	return true
+}
+
+// WantsSystemMessages is true despite Bot() being true: an SSE connection
+// exists to observe everything (see NewSSEClient's topics filter), unlike
+// BotClient/ReplayClient which have nothing rendering their Update at all.
+func (client *SSEClient) WantsSystemMessages() bool {
+	return true
+}
+
+func (client *SSEClient) IP() net.IP {
+	return nil
+}
+
+func (client *SSEClient) Close() {
+	close(client.send)
+}
+
+func (client *SSEClient) Data() *ClientData {
+	return &client.ClientData
+}
+
+func (client *SSEClient) Destroy() {
+	client.once.Do(func() {
+		hub := client.Hub
+		select {
+		case hub.unregister <- client:
+		default:
+			go func() {
+				hub.unregister <- client
+			}()
+		}
+	})
+}
+
+func (client *SSEClient) Init() {
+	go client.writePump()
+}
+
+// topicOf names the SSE "event:" field a given Outbound is sent under, and
+// is what ?topics= filters against - "leaderboard" for Hub.Leaderboard's
+// broadcast, "chat" for a Chat, "update" for the per-entity Update a normal
+// SocketClient receives every updatePeriod.
+func topicOf(out outbound) string {
+	switch out.(type) {
+	case Leaderboard:
+		return "leaderboard"
+	case Chat:
+		return "chat"
+	default:
+		return "update"
+	}
+}
+
+func (client *SSEClient) Send(out outbound) {
+	if client.topics != nil && !client.topics[topicOf(out)] {
+		out.Pool()
+		return
+	}
+
+	select {
+	case client.send <- out:
+	default:
+		// Not responsive; drop and disconnect at once. SocketClient.Send
+		// instead coalesces lossy messages and waits up to
+		// socketSendDeadline for reliable ones.
+		out.Pool()
+		client.Destroy()
+	}
+}
+
+// writePump writes each queued Outbound as one SSE frame (event: <topic>,
+// data: <json>, blank line - see
+// https://html.spec.whatwg.org/multipage/server-sent-events.html) and
+// flushes immediately, so curl/EventSource consumers see it without
+// waiting on net/http's response buffering. Exits, and closes done so
+// Hub.ServeEvents can return, once Close closes client.send.
+func (client *SSEClient) writePump() {
+	defer close(client.done)
+
+	for out := range client.send {
+		topic := topicOf(out)
+		body, err := json.Marshal(out)
+		out.Pool()
+		if err != nil {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(client.w, "event: %s\ndata: %s\n\n", topic, body); err != nil {
+			client.Destroy()
+			continue
+		}
+		client.flusher.Flush()
+	}
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// filteredChat pairs a buffered Broadcast with the predicate updateClient
+// tests each recipient against; see Hub.broadcasts.
+type filteredChat struct {
+	chat   Chat
+	filter func(player *Player) bool
+}
+
+// Broadcast buffers msg (tagged System, see Chat.System) to be drained into
+// every matching client's next Update, bypassing the per-player spam
+// throttle ChatHistory.Update applies to user chat (see SendChat.Process).
+// filter, if non-nil, is tested against each recipient's *Player - team-
+// scoped (player.TeamID == x), radius-scoped (closure over a position and
+// world.Vec2f.Distance, reading the player's ship position out of h.world),
+// or anything else a caller can express as a predicate; a nil filter
+// reaches every client the same way the old unconditional broadcast did.
+// Clients whose Client.WantsSystemMessages is false (bots, replay) never
+// pay the cost of being matched against filter at all - see updateClient.
+func (h *Hub) Broadcast(msg Chat, filter func(player *Player) bool) {
+	msg.System = true
+	h.broadcasts = append(h.broadcasts, filteredChat{chat: msg, filter: filter})
+}
+
+// SendSystem privately delivers a System Chat to player alone, honoring
+// their HideSystemChat toggle. Used for things only one player cares about,
+// such as a death cause or a team join request; see Broadcast and
+// announceTeam for wider-audience announcements.
+func (h *Hub) SendSystem(player *Player, msg string) {
+	if player == nil || player.HideSystemChat {
+		return
+	}
+	if client := h.findClientByPlayerID(player.PlayerID()); client != nil {
+		client.Send(Chat{Message: msg, System: true})
+	}
+}
+
+// announceTeam appends a System Chat visible only to team's members.
+func (h *Hub) announceTeam(team *Team, msg string) {
+	team.Chats = append(team.Chats, Chat{Message: msg, System: true})
+}
+
+// playerOf finds the full *Player behind a *world.Player such as
+// Team.Owner(), by PlayerID (which is derived from the world.Player's own
+// address - see world.Player.PlayerID).
+func (h *Hub) playerOf(wp *world.Player) *Player {
+	if wp == nil {
+		return nil
+	}
+	if client := h.findClientByPlayerID(wp.PlayerID()); client != nil {
+		return &client.Data().Player
+	}
+	return nil
+}
+
+// deathMessage renders reason as the sentence SendSystem delivers to a
+// player when Spawn.Process clears their death.
+func deathMessage(reason world.DeathReason) string {
+	switch reason.Type {
+	case world.DeathTypeBorder:
+		return "You went out of bounds and sank."
+	case world.DeathTypeTerrain:
+		return "You ran aground."
+	case world.DeathTypeCollision:
+		if reason.Player != "" {
+			return fmt.Sprintf("You collided with %s.", reason.Player)
+		}
+		return fmt.Sprintf("You collided with a %s.", reason.Entity)
+	case world.DeathTypeRamming:
+		return fmt.Sprintf("You were rammed by %s.", reason.Player)
+	case world.DeathTypeSinking:
+		return fmt.Sprintf("You were sunk by %s.", reason.Player)
+	default:
+		return ""
+	}
+}
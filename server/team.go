@@ -11,4 +11,7 @@ import (
 type Team struct {
 	world.Team
 	Chats []Chat
+	// SquadOrders is shared tactical state for bots with a FormationRole on
+	// this team (see squad.go), recomputed each leaderboard period.
+	SquadOrders SquadOrders
 }
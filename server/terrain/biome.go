@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package terrain
+
+// Biome is a coarse classification of a terrain cell, layered on top of its
+// raw height by a Source that also implements TypedSource (see
+// noise.Generator.GenerateTyped). BiomeUnknown is the zero value, returned
+// for any Source that only produces heightmaps.
+type Biome byte
+
+const (
+	BiomeUnknown Biome = iota
+	BiomeDeepOcean
+	BiomeShallows
+	BiomeBeach
+	BiomePlains
+	BiomeRocky
+	BiomeArctic
+)
+
+func (b Biome) String() string {
+	switch b {
+	case BiomeDeepOcean:
+		return "deepOcean"
+	case BiomeShallows:
+		return "shallows"
+	case BiomeBeach:
+		return "beach"
+	case BiomePlains:
+		return "plains"
+	case BiomeRocky:
+		return "rocky"
+	case BiomeArctic:
+		return "arctic"
+	default:
+		return "unknown"
+	}
+}
+
+// TypedSource is implemented by a Source that can also classify each cell
+// it generates into a Biome, e.g. noise.Generator. It's a separate
+// interface rather than part of Source because most Sources (flatSource,
+// ridged, worley) have no biome data to offer - callers type-assert for it
+// (see compressed.Terrain.BiomeAt) the same way hub.go type-asserts for
+// world.World's optional SetRecorder.
+type TypedSource interface {
+	// GenerateTyped is Generate, plus one Biome per returned byte in the
+	// same row-major order.
+	GenerateTyped(x, y, width, height int) ([]byte, []Biome)
+}
@@ -19,8 +19,27 @@ const regenMillis = 30 * 60 * 1000
 
 // chunk stores a region of heightmap data as nibbles.
 type chunk struct {
-	data  [chunkSize][chunkSize / 2]byte
-	regen int64 // timestamp of next regen (managed by compressed.Repair)
+	data [chunkSize][chunkSize / 2]byte
+	// regen is the timestamp of the chunk's next regen (managed by
+	// compressed.Repair).
+	regen int64
+	// revision increments on every mutation (Sculpt or Repair), and is
+	// persisted by snapshot.go so a reloaded chunk can be compared against
+	// one freshly generated from the same coordinates.
+	revision uint64
+	// sculptedAt is the timestamp of the last Sculpt that touched this
+	// chunk (0 if none yet), persisted alongside revision.
+	sculptedAt int64
+	// codec is the index into the codecs registry (see codec.go) chosen by
+	// generateChunk as smallest for this chunk's current content - used by
+	// EncodeTile/DecodeTile so a chunk full of flat ocean doesn't pay the
+	// same bytes as one with a detailed coastline.
+	codec byte
+	// lastAccess is the timestamp (millis) of the last getChunk/getChunkSlow
+	// that returned this chunk, read and written atomically since it's
+	// touched from every gameplay goroutine calling At/AtPos/Collides. Used
+	// by evictStale (see worker.go) to find chunks worth freeing.
+	lastAccess int64
 }
 
 // If c passed in, it is partially regenerated (atomically)
@@ -52,9 +71,24 @@ func generateChunk(generator terrain.Source, cx, cy uint, c *chunk) *chunk {
 		}
 	}
 
+	c.codec, _ = chooseCodec(c.raw())
+
 	return c
 }
 
+// raw expands c's packed nibble data into one byte per pixel, row-major,
+// each value left in its top 4 bits - the format Codec implementations and
+// compressed.Buffer operate on (see codec.go).
+func (c *chunk) raw() []byte {
+	out := make([]byte, chunkSize*chunkSize)
+	for y := uint(0); y < chunkSize; y++ {
+		for x := uint(0); x < chunkSize; x++ {
+			out[y*chunkSize+x] = c.at(x, y)
+		}
+	}
+	return out
+}
+
 // at gets a global position in the chunk.
 // It assumes c is the correct chunk.
 func (c *chunk) at(x, y uint) byte {
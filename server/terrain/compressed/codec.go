@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+// Codec turns one chunk's raw heightfield - chunkSize*chunkSize bytes,
+// row-major, one sample per byte with the value left in its top 4 bits (the
+// format chunk.raw and compressed.Buffer already use) - into a smaller
+// encoded form, and back. Implementations only need to round-trip buffers
+// of exactly that shape; they're not used for arbitrary-sized data.
+type Codec interface {
+	Encode(raw []byte) []byte
+	Decode(data []byte) []byte
+}
+
+// codecs is the registry tried by chooseCodec, in index order - a chunk's
+// codec byte (see chunk.codec) is an index into this slice, so existing
+// entries must keep their index if more are ever added (snapshot files on
+// disk reference codecs by this index).
+var codecs = []Codec{
+	rleCodec{},
+	deltaCodec{},
+	paethCodec{width: chunkSize},
+}
+
+// chooseCodec tries every registered Codec against raw and returns the
+// index and encoded bytes of whichever compressed smallest. Called once per
+// chunk, at generation time (see generateChunk), rather than per-encode.
+func chooseCodec(raw []byte) (id byte, encoded []byte) {
+	encoded = codecs[0].Encode(raw)
+	for i := 1; i < len(codecs); i++ {
+		if e := codecs[i].Encode(raw); len(e) < len(encoded) {
+			id, encoded = byte(i), e
+		}
+	}
+	return
+}
+
+// rleCodec is compressed.Buffer's original 4-bit-value/4-bit-run-length
+// scheme, wrapped to satisfy Codec. Best for chunks with large flat runs
+// (open ocean, grass plains).
+type rleCodec struct{}
+
+func (rleCodec) Encode(raw []byte) []byte {
+	var buf Buffer
+	buf.Grow(len(raw))
+	_, _ = buf.Write(raw)
+	return buf.Buffer()
+}
+
+func (rleCodec) Decode(data []byte) []byte {
+	var buf Buffer
+	buf.Reset(append([]byte(nil), data...))
+	out := make([]byte, chunkSize*chunkSize)
+	n, _ := buf.Read(out)
+	return out[:n]
+}
+
+// paethPredictor picks whichever of west, north, or northwest is closest to
+// west+north-northwest, the same rule PNG's filter type 4 uses.
+func paethPredictor(west, north, northwest int) int {
+	p := west + north - northwest
+	pWest := absInt(p - west)
+	pNorth := absInt(p - north)
+	pNorthwest := absInt(p - northwest)
+
+	if pWest <= pNorth && pWest <= pNorthwest {
+		return west
+	} else if pNorth <= pNorthwest {
+		return north
+	}
+	return northwest
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// paethCodec predicts each sample from its west/north/northwest neighbors
+// (see paethPredictor), leaving a residual stream that's near-zero across
+// smooth gradients (e.g. an ocean-to-sand transition), then RLE-encodes
+// that residual. width is the row length to predict across - chunkSize for
+// the codecs registry's entry.
+type paethCodec struct {
+	width int
+}
+
+func (p paethCodec) Encode(raw []byte) []byte {
+	width := p.width
+	residual := make([]byte, len(raw))
+
+	for i, v := range raw {
+		x, y := i%width, i/width
+		residual[i] = byte(paethResidual(raw, x, y, width, int(v>>4))) << 4
+	}
+
+	return rleCodec{}.Encode(residual)
+}
+
+func (p paethCodec) Decode(data []byte) []byte {
+	residual := rleCodec{}.Decode(data)
+	width := p.width
+	raw := make([]byte, len(residual))
+
+	for i := range residual {
+		x, y := i%width, i/width
+		r := int(residual[i] >> 4)
+		var west, north, northwest int
+		if x > 0 {
+			west = int(raw[i-1] >> 4)
+		}
+		if y > 0 {
+			north = int(raw[i-width] >> 4)
+		}
+		if x > 0 && y > 0 {
+			northwest = int(raw[i-width-1] >> 4)
+		}
+		v := (r + paethPredictor(west, north, northwest)) & 0xF
+		raw[i] = byte(v) << 4
+	}
+
+	return raw
+}
+
+// paethResidual computes sample i (at x, y, with value v) 's residual against
+// its already-encoded west/north/northwest neighbors in raw, wrapping mod 16
+// the same way Decode's addition does, so the two are exact inverses.
+func paethResidual(raw []byte, x, y, width, v int) int {
+	var west, north, northwest int
+	if x > 0 {
+		west = int(raw[y*width+x-1] >> 4)
+	}
+	if y > 0 {
+		north = int(raw[(y-1)*width+x] >> 4)
+	}
+	if x > 0 && y > 0 {
+		northwest = int(raw[(y-1)*width+x-1] >> 4)
+	}
+	return (v - paethPredictor(west, north, northwest)) & 0xF
+}
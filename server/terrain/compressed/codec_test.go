@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"bytes"
+	"github.com/SoftbearStudios/mk48/server/terrain/noise"
+	"math/rand"
+	"testing"
+)
+
+// TestCodecs_RoundTrip fuzzes every registered Codec with random
+// chunk-sized heightfields (including all-flat and all-random extremes) and
+// checks Decode(Encode(raw)) always reproduces raw exactly.
+func TestCodecs_RoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i, codec := range codecs {
+		for trial := 0; trial < 200; trial++ {
+			raw := make([]byte, chunkSize*chunkSize)
+			switch trial % 4 {
+			case 0:
+				// All one value - the easy case every codec should crush.
+				v := roundByte(byte(r.Intn(256)))
+				for j := range raw {
+					raw[j] = v
+				}
+			case 1:
+				// Fully random - the adversarial case for delta/Paeth.
+				for j := range raw {
+					raw[j] = roundByte(byte(r.Intn(256)))
+				}
+			case 2:
+				// Smooth gradient - what delta/Paeth are meant for.
+				base := r.Intn(16)
+				for j := range raw {
+					base += r.Intn(3) - 1
+					if base < 0 {
+						base = 0
+					} else if base > 15 {
+						base = 15
+					}
+					raw[j] = byte(base << 4)
+				}
+			case 3:
+				// Real generator output.
+				raw = chunkFromGenerator(r)
+			}
+
+			encoded := codec.Encode(raw)
+			decoded := codec.Decode(encoded)
+
+			if !bytes.Equal(raw, decoded) {
+				t.Fatalf("codecs[%d] trial %d: round trip mismatch\nraw:     %v\ndecoded: %v", i, trial, raw, decoded)
+			}
+		}
+	}
+}
+
+// chunkFromGenerator returns one chunk's worth of raw heightfield at a
+// random chunk coordinate from a real Generator, for realistic test/
+// benchmark input.
+func chunkFromGenerator(r *rand.Rand) []byte {
+	t := New(noise.NewDefault())
+	cx, cy := uint(r.Intn(chunkCount)), uint(r.Intn(chunkCount))
+	c := t.getChunk(cx*chunkSize, cy*chunkSize)
+	return c.raw()
+}
+
+// BenchmarkCodecs_CompressionRatio reports each codec's encoded size against
+// real generator output, run from the package's own chunk grid so results
+// reflect actual gameplay terrain rather than synthetic data.
+func BenchmarkCodecs_CompressionRatio(b *testing.B) {
+	t := New(noise.NewDefault())
+
+	var raws [][]byte
+	for cx := uint(0); cx < 8; cx++ {
+		for cy := uint(0); cy < 8; cy++ {
+			c := t.getChunk(cx*chunkSize, cy*chunkSize)
+			raws = append(raws, c.raw())
+		}
+	}
+
+	names := []string{"rle", "delta", "paeth"}
+
+	for i, codec := range codecs {
+		codec, name := codec, names[i]
+		b.Run(name, func(b *testing.B) {
+			b.ResetTimer()
+			var totalIn, totalOut int
+			for n := 0; n < b.N; n++ {
+				raw := raws[n%len(raws)]
+				encoded := codec.Encode(raw)
+				totalIn += len(raw)
+				totalOut += len(encoded)
+			}
+			if totalIn > 0 {
+				b.ReportMetric(100*float64(totalOut)/float64(totalIn), "pct-of-raw")
+			}
+		})
+	}
+}
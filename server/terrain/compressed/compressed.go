@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/SoftbearStudios/mk48/server/terrain"
 	"github.com/SoftbearStudios/mk48/server/world"
+	"github.com/cespare/xxhash/v2"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -31,7 +32,29 @@ type Terrain struct {
 	generator  terrain.Source
 	chunks     [chunkCount][chunkCount]*chunk
 	chunkCount int32
-	mutex      sync.Mutex
+	// mutexes shards getChunkSlow's generate-on-first-access lock by chunk
+	// coordinate (see shardIndex), so generating/evicting chunk (i,j) never
+	// blocks a concurrent getChunkSlow for an unrelated chunk (k,l).
+	mutexes      [shardCount]sync.Mutex
+	dirtyTracker dirtyTracker
+	pathCache    pathCache
+	// tileCache memoizes EncodeTile's bytes and xxhash64 per tile revision
+	// (see tilecache.go), so a tick's worth of AtDelta calls - one per
+	// connected client with the tile in view - encode and hash it once
+	// instead of once per client.
+	tileCache tileCache
+	// snapshotDir is set by Snapshot/Load, and lets getChunkSlow try a
+	// lazy on-disk reload (see loadChunkFile) before generateChunk.
+	snapshotDir string
+
+	// hits/misses/prefetches/evictions are Prometheus-style atomic counters
+	// (see worker.go's Stats) - compressed has no dependency on an actual
+	// metrics library, so they're exposed as a plain snapshot struct for a
+	// caller (e.g. Hub.ServeMetrics) to report however it likes.
+	hits, misses, prefetches, evictions uint64
+	// prefetchQueue is non-nil between StartWorkers and its stop func being
+	// called; Prefetch is a no-op while it's nil.
+	prefetchQueue chan [2]uint32
 }
 
 // New creates a new Terrain from a source.
@@ -82,7 +105,7 @@ func (t *Terrain) Clamp(aabb world.AABB) world.AABB {
 func (t *Terrain) At(aabb world.AABB) *terrain.Data {
 	clamped, x, y, width, height := clampAABB(aabb)
 
-	data := terrain.NewData()
+	data := terrain.NewData(int(width * height))
 	buffer := Buffer{
 		buf: data.Data,
 	}
@@ -97,6 +120,7 @@ func (t *Terrain) At(aabb world.AABB) *terrain.Data {
 	data.Data = buffer.Buffer()
 	data.Stride = int(width)
 	data.Length = int(width * height)
+	data.Hash = xxhash.Sum64(data.Data)
 
 	return data
 }
@@ -118,6 +142,8 @@ func (t *Terrain) Repair() {
 			if c != nil && millis >= c.regen {
 				if c.regen != 0 { // Don't regen the first time
 					generateChunk(t.generator, uint(ucx)-Size/chunkSize/2, uint(ucy)-Size/chunkSize/2, c)
+					c.revision++
+					t.markDirty(uint(ucx), uint(ucy))
 				}
 				c.regen = millis + regenMillis + int64(rand.Intn(10000)) // add some randomness to avoid simultaneous regen
 			}
@@ -218,6 +244,30 @@ func (t *Terrain) AtPos(pos world.Vec2f) byte {
 	return blerp(c00, c10, c01, c11, delta.X, delta.Y)
 }
 
+// BiomeAt returns the terrain.Biome at pos, sampled directly from the
+// underlying Source rather than the chunk cache - biome isn't part of the
+// compressed nibble format (see chunk), so there's nothing to cache it
+// against. Cheap enough for occasional spawn-bias lookups (see
+// Hub.Spawn), not meant for per-tile rendering. Returns terrain.BiomeUnknown
+// if the Source passed to New doesn't implement terrain.TypedSource.
+func (t *Terrain) BiomeAt(pos world.Vec2f) terrain.Biome {
+	typed, ok := t.generator.(terrain.TypedSource)
+	if !ok {
+		return terrain.BiomeUnknown
+	}
+
+	pos = pos.Mul(1.0 / terrain.Scale).Floor()
+	x := int(pos.X) + Size/2
+	y := int(pos.Y) + Size/2
+	if x < 0 || y < 0 || x >= Size || y >= Size {
+		return terrain.BiomeUnknown
+	}
+
+	// Sources take signed terrain coordinates (see generateChunk).
+	_, biomes := typed.GenerateTyped(x-Size/2, y-Size/2, 1, 1)
+	return biomes[0]
+}
+
 // Sculpt changes the terrain height at pos by an amount.
 func (t *Terrain) Sculpt(pos world.Vec2f, amount float32) {
 	pos = pos.Mul(1.0 / terrain.Scale)
@@ -255,7 +305,11 @@ func (t *Terrain) at(x, y uint) byte {
 
 // at sets the height of the terrain given x, y unsigned terrain coords and the value to set it to.
 func (t *Terrain) set(x, y uint, value byte) {
-	t.getChunk(x, y).set(x, y, value)
+	c := t.getChunk(x, y)
+	c.set(x, y, value)
+	c.revision++
+	c.sculptedAt = time.Now().UnixNano() / int64(time.Millisecond/time.Nanosecond)
+	t.markDirty((x/chunkSize)&(chunkCount-1), (y/chunkSize)&(chunkCount-1))
 }
 
 // getChunk gets a chunk given its unsigned terrain coordinates.
@@ -271,25 +325,37 @@ func (t *Terrain) getChunk(x, y uint) *chunk {
 	if c == nil {
 		return t.getChunkSlow(x, y)
 	}
+	atomic.AddUint64(&t.hits, 1)
+	atomic.StoreInt64(&c.lastAccess, nowMillis())
 	return c
 }
 
 func (t *Terrain) getChunkSlow(x, y uint) *chunk {
+	atomic.AddUint64(&t.misses, 1)
 	chunkPtr := (*unsafe.Pointer)(unsafe.Pointer(&t.chunks[x][y]))
 
-	t.mutex.Lock()
-	defer t.mutex.Unlock()
+	mu := &t.mutexes[shardIndex(x, y)]
+	mu.Lock()
+	defer mu.Unlock()
 
 	// Load again to make sure its still nil after acquiring the lock
 	c := (*chunk)(atomic.LoadPointer(chunkPtr))
 	if c == nil {
-		// Generate chunk
-		c = generateChunk(t.generator, x-chunkCount/2, y-chunkCount/2, nil)
-		t.chunkCount++
+		// Prefer a chunk snapshotted to disk (see snapshot.go) over
+		// regenerating it from scratch, so player-sculpted terrain survives
+		// a restart.
+		if t.snapshotDir != "" {
+			c = t.loadChunkFile(x, y)
+		}
+		if c == nil {
+			c = generateChunk(t.generator, x-chunkCount/2, y-chunkCount/2, nil)
+		}
+		atomic.AddInt32(&t.chunkCount, 1)
 
 		// Store generated chunk
 		atomic.StorePointer(chunkPtr, unsafe.Pointer(c))
 	}
+	atomic.StoreInt64(&c.lastAccess, nowMillis())
 
 	return c
 }
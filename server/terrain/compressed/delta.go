@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import "encoding/binary"
+
+// deltaEscape is the reserved 4-bit delta code meaning "this sample's delta
+// didn't fit in the other 15 codes - its value is Huffman-coded in the
+// escape stream instead" (see deltaCodec). The other 15 codes (1-15) map to
+// signed deltas -7..7 via code-8.
+const deltaEscape = 0
+
+// deltaCodec stores the first sample as a base value, then every later
+// sample as a signed 4-bit delta from its predecessor (deltaEscape plus a
+// Huffman-coded escape byte when the actual delta doesn't fit). Best for
+// smooth gradients (e.g. an ocean-to-sand transition) where successive
+// samples rarely differ by more than a couple of steps.
+//
+// Encoded layout:
+//
+//	[0]     base sample (0-15)
+//	[1:3]   escape count, little-endian uint16
+//	[3:19]  16 bytes of Huffman code length per escape symbol (0 = unused)
+//	[19:]   one 4-bit delta code per remaining sample, packed 2 per byte,
+//	        followed immediately (bit-packed, not byte-aligned) by the
+//	        Huffman-coded escape values in the order their escapes appear
+type deltaCodec struct{}
+
+func (deltaCodec) Encode(raw []byte) []byte {
+	n := len(raw)
+	codes := make([]byte, n-1)
+	var escapes []byte
+	var freq [16]int
+
+	prev := int(raw[0] >> 4)
+	for i := 1; i < n; i++ {
+		v := int(raw[i] >> 4)
+		delta := v - prev
+		if delta >= -7 && delta <= 7 {
+			codes[i-1] = byte(delta + 8)
+		} else {
+			codes[i-1] = deltaEscape
+			escapes = append(escapes, byte(v))
+			freq[v]++
+		}
+		prev = v
+	}
+
+	lengths := huffmanLengths(freq[:])
+	huffCodes := canonicalCodes(lengths)
+
+	out := make([]byte, 0, 19+len(codes)/2+len(escapes))
+	out = append(out, raw[0]>>4)
+
+	var countBuf [2]byte
+	binary.LittleEndian.PutUint16(countBuf[:], uint16(len(escapes)))
+	out = append(out, countBuf[:]...)
+
+	for _, l := range lengths {
+		out = append(out, byte(l))
+	}
+
+	for i := 0; i < len(codes); i += 2 {
+		b := codes[i] << 4
+		if i+1 < len(codes) {
+			b |= codes[i+1]
+		}
+		out = append(out, b)
+	}
+
+	var bw bitWriter
+	for _, e := range escapes {
+		bw.writeBits(huffCodes[e], lengths[e])
+	}
+	out = append(out, bw.buf...)
+
+	return out
+}
+
+func (deltaCodec) Decode(data []byte) []byte {
+	base := int(data[0])
+	escapeCount := int(binary.LittleEndian.Uint16(data[1:3]))
+
+	lengths := make([]int, 16)
+	for i := 0; i < 16; i++ {
+		lengths[i] = int(data[3+i])
+	}
+	huffCodes := canonicalCodes(lengths)
+
+	// Invert huffCodes/lengths into a lookup by (length, code) for decoding,
+	// since canonical codes alone don't say where one ends and the next
+	// begins without walking bit-by-bit against known lengths.
+	type codeKey struct {
+		length int
+		code   uint16
+	}
+	bySymbol := make(map[codeKey]int, 16)
+	for sym, l := range lengths {
+		if l > 0 {
+			bySymbol[codeKey{l, huffCodes[sym]}] = sym
+		}
+	}
+
+	n := chunkSize * chunkSize
+	packedOff := 19
+	numDeltas := n - 1
+	packedLen := (numDeltas + 1) / 2
+	packed := data[packedOff : packedOff+packedLen]
+
+	codes := make([]byte, numDeltas)
+	for i := 0; i < numDeltas; i++ {
+		b := packed[i/2]
+		if i%2 == 0 {
+			codes[i] = b >> 4
+		} else {
+			codes[i] = b & 0xF
+		}
+	}
+
+	br := bitReader{buf: data[packedOff+packedLen:]}
+	readEscape := func() int {
+		var code uint16
+		for length := 1; length <= 16; length++ {
+			code = code<<1 | uint16(br.readBit())
+			if sym, ok := bySymbol[codeKey{length, code}]; ok {
+				return sym
+			}
+		}
+		return 0
+	}
+
+	raw := make([]byte, n)
+	raw[0] = byte(base << 4)
+	prev := base
+	escapesLeft := escapeCount
+	for i, c := range codes {
+		var v int
+		if c == deltaEscape && escapesLeft > 0 {
+			v = readEscape()
+			escapesLeft--
+		} else {
+			v = prev + int(c) - 8
+		}
+		raw[i+1] = byte(v << 4)
+		prev = v
+	}
+
+	return raw
+}
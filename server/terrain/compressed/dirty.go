@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import "sync"
+
+// tileID identifies a chunk by its chunk coordinates, packed into a uint32
+// (chunk coordinates each fit in 16 bits since chunkCount is small).
+type tileID = uint32
+
+// dirtyTracker records which chunks have changed (via Sculpt or Repair)
+// since the last time they were uploaded, along with a version counter that
+// increments on every change. This lets a Cloud upload only the tiles that
+// changed instead of the whole terrain every period.
+type dirtyTracker struct {
+	mutex   sync.Mutex
+	version uint64
+	dirty   map[tileID]struct{}
+	// pathDirty is a second, independently-drained dirty set, so the path
+	// cache (see path.go) can invalidate only its own affected cells without
+	// racing with DirtyTiles' consumer (Cloud uploads).
+	pathDirty map[tileID]struct{}
+}
+
+// TileID packs a chunk's coordinates into the id used by DirtyTiles,
+// EncodeTile, and Cloud.UploadTerrainDelta.
+func TileID(cx, cy uint) uint32 {
+	return uint32(cx)<<16 | uint32(cy)
+}
+
+// markDirty records that the chunk at cx, cy changed, bumping the version.
+func (t *Terrain) markDirty(cx, cy uint) {
+	t.dirtyTracker.mutex.Lock()
+	defer t.dirtyTracker.mutex.Unlock()
+
+	if t.dirtyTracker.dirty == nil {
+		t.dirtyTracker.dirty = make(map[tileID]struct{})
+	}
+	if t.dirtyTracker.pathDirty == nil {
+		t.dirtyTracker.pathDirty = make(map[tileID]struct{})
+	}
+	t.dirtyTracker.version++
+	id := TileID(cx, cy)
+	t.dirtyTracker.dirty[id] = struct{}{}
+	t.dirtyTracker.pathDirty[id] = struct{}{}
+}
+
+// drainPathDirtyTiles returns the ids of chunks that have changed since the
+// last call to drainPathDirtyTiles, and clears that dirty set. Distinct from
+// DirtyTiles so the path cache and Cloud uploads can each drain at their own
+// pace.
+func (t *Terrain) drainPathDirtyTiles() []uint32 {
+	t.dirtyTracker.mutex.Lock()
+	defer t.dirtyTracker.mutex.Unlock()
+
+	tiles := make([]uint32, 0, len(t.dirtyTracker.pathDirty))
+	for id := range t.dirtyTracker.pathDirty {
+		tiles = append(tiles, id)
+		delete(t.dirtyTracker.pathDirty, id)
+	}
+	return tiles
+}
+
+// Version returns the current version, incremented every time any chunk changes.
+func (t *Terrain) Version() uint64 {
+	t.dirtyTracker.mutex.Lock()
+	defer t.dirtyTracker.mutex.Unlock()
+	return t.dirtyTracker.version
+}
+
+// DirtyTiles returns the ids of chunks that have changed since the last call
+// to DirtyTiles, and clears the dirty set.
+func (t *Terrain) DirtyTiles() []uint32 {
+	t.dirtyTracker.mutex.Lock()
+	defer t.dirtyTracker.mutex.Unlock()
+
+	tiles := make([]uint32, 0, len(t.dirtyTracker.dirty))
+	for id := range t.dirtyTracker.dirty {
+		tiles = append(tiles, id)
+		delete(t.dirtyTracker.dirty, id)
+	}
+	return tiles
+}
+
+// EncodeTile returns the chunk identified by tileID, compressed with
+// whichever Codec generateChunk found smallest for it (see chunk.codec),
+// prefixed with that codec's registry index, suitable for
+// Cloud.UploadTerrainDelta and later DecodeTile.
+func (t *Terrain) EncodeTile(id uint32) []byte {
+	cx, cy := uint(id>>16), uint(id&0xffff)
+	c := t.getChunk(cx*chunkSize, cy*chunkSize)
+
+	encoded := codecs[c.codec].Encode(c.raw())
+	return append([]byte{c.codec}, encoded...)
+}
+
+// DecodeTile overwrites the chunk identified by tileID with data previously
+// produced by EncodeTile, as applied by a replay of Cloud.UploadTerrainDelta.
+func (t *Terrain) DecodeTile(id uint32, data []byte) {
+	cx, cy := uint(id>>16), uint(id&0xffff)
+	c := t.getChunk(cx*chunkSize, cy*chunkSize)
+
+	c.codec = data[0]
+	raw := codecs[c.codec].Decode(data[1:])
+	for y := uint(0); y < chunkSize; y++ {
+		for x := uint(0); x < chunkSize; x++ {
+			c.set(x, y, raw[y*chunkSize+x])
+		}
+	}
+}
+
+// Keyframe returns the current version and every chunk's EncodeTile bytes
+// (generating any chunk not yet generated), suitable
+// for Cloud.UploadTerrainKeyframe and later reconstruction via DecodeTile.
+func (t *Terrain) Keyframe() (version uint64, tiles map[uint32][]byte) {
+	version = t.Version()
+	tiles = make(map[uint32][]byte)
+	for cx := range t.chunks {
+		for cy := range t.chunks[cx] {
+			id := TileID(uint(cx), uint(cy))
+			tiles[id] = t.EncodeTile(id)
+		}
+	}
+	return
+}
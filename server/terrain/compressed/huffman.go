@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import "sort"
+
+// huffmanNode is an internal or leaf node of the tree built by
+// huffmanLengths, kept only long enough to derive each symbol's code
+// length - canonicalCodes does the actual code assignment.
+type huffmanNode struct {
+	freq        int
+	symbol      int // only meaningful on a leaf (left == nil)
+	left, right *huffmanNode
+}
+
+// huffmanLengths returns each symbol's Huffman code length given its
+// frequency (freq[sym] == 0 means the symbol is unused and gets length 0).
+// Building the tree from freq rather than transmitting it means an encoder
+// and decoder that agree on freq (deltaCodec's escape-value histogram, which
+// the header carries as lengths - see canonicalCodes) always derive the
+// same codes without shipping the tree shape itself.
+func huffmanLengths(freq []int) []int {
+	lengths := make([]int, len(freq))
+
+	var nodes []*huffmanNode
+	for sym, f := range freq {
+		if f > 0 {
+			nodes = append(nodes, &huffmanNode{freq: f, symbol: sym})
+		}
+	}
+
+	switch len(nodes) {
+	case 0:
+		return lengths
+	case 1:
+		// A single distinct symbol still needs a 1-bit code to be emitted.
+		lengths[nodes[0].symbol] = 1
+		return lengths
+	}
+
+	for len(nodes) > 1 {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].freq < nodes[j].freq })
+		a, b := nodes[0], nodes[1]
+		nodes = append(nodes[2:], &huffmanNode{freq: a.freq + b.freq, left: a, right: b})
+	}
+
+	var walk func(n *huffmanNode, depth int)
+	walk = func(n *huffmanNode, depth int) {
+		if n.left == nil {
+			lengths[n.symbol] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(nodes[0], 0)
+
+	return lengths
+}
+
+// canonicalCodes assigns canonical Huffman codes from lengths (0 = symbol
+// unused), shortest-length-first and breaking ties by symbol value, so a
+// decoder given the same lengths derives the identical codes.
+func canonicalCodes(lengths []int) []uint16 {
+	codes := make([]uint16, len(lengths))
+
+	type symLen struct{ sym, length int }
+	var symbols []symLen
+	for sym, l := range lengths {
+		if l > 0 {
+			symbols = append(symbols, symLen{sym, l})
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].length != symbols[j].length {
+			return symbols[i].length < symbols[j].length
+		}
+		return symbols[i].sym < symbols[j].sym
+	})
+
+	code, prevLen := uint16(0), 0
+	for _, s := range symbols {
+		code <<= uint(s.length - prevLen)
+		codes[s.sym] = code
+		code++
+		prevLen = s.length
+	}
+
+	return codes
+}
+
+// bitWriter packs MSB-first variable-length codes into a growing byte slice.
+type bitWriter struct {
+	buf     []byte
+	bitsUse uint8 // bits already used in the last byte of buf
+}
+
+func (w *bitWriter) writeBits(value uint16, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if w.bitsUse == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if (value>>uint(i))&1 != 0 {
+			w.buf[len(w.buf)-1] |= 1 << (7 - w.bitsUse)
+		}
+		w.bitsUse = (w.bitsUse + 1) % 8
+	}
+}
+
+// bitReader unpacks what a bitWriter packed, one bit at a time via readBit
+// (0 past the end of buf); deltaCodec.Decode walks it bit-by-bit to match
+// canonical Huffman codes.
+type bitReader struct {
+	buf []byte
+	pos int // bit position
+}
+
+func (r *bitReader) readBit() int {
+	byteIdx := r.pos / 8
+	if byteIdx >= len(r.buf) {
+		r.pos++
+		return 0
+	}
+	bit := int((r.buf[byteIdx] >> uint(7-r.pos%8)) & 1)
+	r.pos++
+	return bit
+}
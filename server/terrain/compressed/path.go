@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"sync"
+)
+
+// pathDraftMargin is how many units of height a unit of draft keeps a path
+// away from, capped at pathMaxMargin.
+const pathDraftMargin = 0.1
+const pathMaxMargin = 20
+
+// pathCache caches sampled heights per terrain.PathCell, so FindPath only
+// pays for AtPos once per cell instead of once per call. Cells belonging to
+// a chunk that's changed since the last FindPath are evicted lazily (see
+// Terrain.drainPathDirtyTiles) rather than the whole cache being rebuilt.
+type pathCache struct {
+	mutex  sync.Mutex
+	height map[terrain.PathCell]byte
+}
+
+// FindPath implements terrain.Terrain.
+func (t *Terrain) FindPath(from, to world.Vec2f, draft float32) []world.Vec2f {
+	t.pathCache.mutex.Lock()
+	defer t.pathCache.mutex.Unlock()
+
+	if t.pathCache.height == nil {
+		t.pathCache.height = make(map[terrain.PathCell]byte)
+	}
+
+	for _, id := range t.drainPathDirtyTiles() {
+		t.evictPathCells(id)
+	}
+
+	margin := byte(0)
+	if draft > 0 {
+		scaled := draft * pathDraftMargin
+		if scaled > pathMaxMargin {
+			scaled = pathMaxMargin
+		}
+		margin = byte(scaled)
+	}
+	blockedAbove := byte(terrain.OceanLevel) - margin
+
+	blocked := func(c terrain.PathCell) bool {
+		return t.cachedHeight(c) > blockedAbove
+	}
+
+	return terrain.FindGridPath(blocked, terrain.WorldToPathCell(from), terrain.WorldToPathCell(to))
+}
+
+// cachedHeight returns the height at cell's center, sampling and caching it
+// if this is the first time it's been asked for since the last eviction.
+func (t *Terrain) cachedHeight(c terrain.PathCell) byte {
+	if h, ok := t.pathCache.height[c]; ok {
+		return h
+	}
+	h := t.AtPos(terrain.PathCellToWorld(c))
+	t.pathCache.height[c] = h
+	return h
+}
+
+// evictPathCells drops every cached path cell that falls within the chunk
+// identified by id, so the next FindPath re-samples them.
+func (t *Terrain) evictPathCells(id uint32) {
+	cx, cy := uint(id>>16), uint(id&0xffff)
+
+	// Chunk coordinates are unsigned terrain coordinates / chunkSize (see the
+	// coordinate comment atop compressed.go), so shift back by Size/2 before
+	// scaling up to world meters.
+	chunkMeters := float32(chunkSize) * terrain.Scale
+	minCorner := world.Vec2f{
+		X: (float32(cx)*chunkSize - Size/2) * terrain.Scale,
+		Y: (float32(cy)*chunkSize - Size/2) * terrain.Scale,
+	}
+	maxCorner := minCorner.Add(world.Vec2f{X: chunkMeters, Y: chunkMeters})
+
+	minCell := terrain.WorldToPathCell(minCorner)
+	maxCell := terrain.WorldToPathCell(maxCorner)
+
+	for x := minCell.X; x <= maxCell.X; x++ {
+		for y := minCell.Y; y <= maxCell.Y; y++ {
+			delete(t.pathCache.height, terrain.PathCell{X: x, Y: y})
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain/noise"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"testing"
+)
+
+func TestTerrain_FindPath(t *testing.T) {
+	terr := New(noise.NewDefault())
+
+	from := world.Vec2f{}
+	if path := terr.FindPath(from, from, 0); path != nil {
+		t.Error("expected nil path when from == to, got", path)
+	}
+}
+
+func BenchmarkTerrain_FindPath(b *testing.B) {
+	terr := New(noise.NewDefault())
+
+	from := world.Vec2f{X: -500, Y: -500}
+	to := world.Vec2f{X: 500, Y: 500}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = terr.FindPath(from, to, 20)
+	}
+}
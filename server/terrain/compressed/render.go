@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"bytes"
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// renderColors is the grass/sand/ocean/rock gradient terrain.Render uses,
+// duplicated here because RenderPNG walks raw chunk bytes directly (see
+// below) rather than going through At/AtPos, which would force generation
+// of every chunk the requested aabb touches.
+var renderColors = [...]color.RGBA{
+	{R: 0, G: 50, B: 115, A: 255},
+	{R: 0, G: 75, B: 130, A: 255},
+	{R: 194, G: 178, B: 128, A: 255},
+	{R: 90, G: 180, B: 30, A: 255},
+	{R: 105, G: 110, B: 115, A: 255},
+	{R: 220, G: 220, B: 220, A: 255},
+}
+
+func lerpColor(a, b color.RGBA, factor float32) color.RGBA {
+	return color.RGBA{
+		R: lerpByte(a.R, b.R, factor),
+		G: lerpByte(a.G, b.G, factor),
+		B: lerpByte(a.B, b.B, factor),
+		A: 255,
+	}
+}
+
+func lerpByte(a, b byte, factor float32) byte {
+	return byte(world.Lerp(float32(a), float32(b), clamp01(factor)))
+}
+
+func clamp01(f float32) float32 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+// heightColor maps a packed heightfield byte to a color, using the same
+// bands as terrain.Render.
+func heightColor(h byte) color.RGBA {
+	switch {
+	case h <= terrain.OceanLevel:
+		return lerpColor(renderColors[0], renderColors[1], float32(h)/float32(terrain.OceanLevel))
+	case h <= terrain.SandLevel:
+		return renderColors[2]
+	case h <= terrain.GrassLevel:
+		return lerpColor(renderColors[2], renderColors[3], float32(h-terrain.SandLevel)*0.05)
+	case h <= terrain.RockLevel:
+		return lerpColor(renderColors[3], renderColors[4], float32(h-terrain.GrassLevel)*0.1)
+	default:
+		return lerpColor(renderColors[4], renderColors[5], float32(h-terrain.RockLevel)*0.07)
+	}
+}
+
+// RenderPNG renders a top-down, grass/sand/ocean-shaded PNG of aabb. Unlike
+// terrain.Render (which samples through At/AtPos), it walks only chunks
+// already allocated in t.chunks, leaving any nil (never-touched) chunk
+// transparent instead of forcing it to generate - so a map request never
+// causes generation of untouched regions. scale nearest-neighbor-upsamples
+// the result, so a request covering the whole world (Size x Size terrain
+// pixels) can still produce a full-resolution minimap PNG.
+func (t *Terrain) RenderPNG(aabb world.AABB, scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+
+	_, ux, uy, width, height := clampAABB(aabb)
+
+	img := image.NewRGBA(image.Rect(0, 0, int(width)*scale, int(height)*scale))
+
+	for j := uint(0); j < height; j++ {
+		for i := uint(0); i < width; i++ {
+			x, y := ux+i, uy+j
+			cx := (x / chunkSize) & (chunkCount - 1)
+			cy := (y / chunkSize) & (chunkCount - 1)
+
+			var col color.RGBA
+			if c := t.chunks[cx][cy]; c != nil {
+				col = heightColor(c.at(x, y))
+			}
+
+			for sy := 0; sy < scale; sy++ {
+				for sx := 0; sx < scale; sx++ {
+					img.SetRGBA(int(i)*scale+sx, int(j)*scale+sy, col)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// chunkHeaderSize is the size in bytes of the fixed-width header written
+// before a chunk's packed heightfield in its snapshot file.
+const chunkHeaderSize = 32
+
+// Snapshot writes every chunk currently resident in memory to dir, one file
+// per chunk (see chunkFilename), and remembers dir for getChunkSlow's lazy
+// reload. It's a stdlib-only stand-in for an embedded
+// key-value store (LevelDB/BoltDB): neither is an existing dependency of
+// this module and chunk coordinates already make a natural filesystem key.
+// Like Repair, it can't be called concurrently with any other terrain
+// function.
+func (t *Terrain) Snapshot(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	t.snapshotDir = dir
+
+	for cx := range t.chunks {
+		for cy := range t.chunks[cx] {
+			c := t.chunks[cx][cy]
+			if c == nil {
+				continue
+			}
+
+			path := filepath.Join(dir, chunkFilename(uint(cx), uint(cy)))
+			if err := writeChunkFile(path, c); err != nil {
+				return fmt.Errorf("snapshotting chunk %d,%d: %w", cx, cy, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Load eagerly reads every chunk file previously written by Snapshot out of
+// dir, and remembers dir so getChunkSlow can lazily reload any chunk not
+// already loaded here (for example one generated after a world resize).
+// Chunks with no file in dir are left to be generated normally on first
+// access. Intended to run once at startup, before the Hub starts ticking.
+func (t *Terrain) Load(dir string) error {
+	t.snapshotDir = dir
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		cx, cy, ok := parseChunkFilename(entry.Name())
+		if !ok || cx >= chunkCount || cy >= chunkCount {
+			continue
+		}
+
+		c := new(chunk)
+		if err := readChunkFile(filepath.Join(dir, entry.Name()), c); err != nil {
+			return fmt.Errorf("loading chunk %d,%d: %w", cx, cy, err)
+		}
+
+		t.chunks[cx][cy] = c
+	}
+
+	return nil
+}
+
+// loadChunkFile is getChunkSlow's lazy counterpart to Load: it tries to read
+// a single chunk's file out of t.snapshotDir, returning nil if there isn't
+// one (or it can't be read), so the caller falls back to generateChunk.
+func (t *Terrain) loadChunkFile(cx, cy uint) *chunk {
+	c := new(chunk)
+	if err := readChunkFile(filepath.Join(t.snapshotDir, chunkFilename(cx, cy)), c); err != nil {
+		return nil
+	}
+	return c
+}
+
+// StartAutoSnapshot runs Snapshot(dir) every interval until the returned
+// stop func is called, so a crashed or restarted server resumes from
+// player-modified terrain instead of the raw generator output.
+func (t *Terrain) StartAutoSnapshot(dir string, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.Snapshot(dir); err != nil {
+					fmt.Println("auto-snapshotting terrain:", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// chunkFilename is the on-disk filename of the chunk at chunk coordinates
+// cx, cy.
+func chunkFilename(cx, cy uint) string {
+	return fmt.Sprintf("%d_%d.chunk", cx, cy)
+}
+
+// parseChunkFilename parses a filename produced by chunkFilename.
+func parseChunkFilename(name string) (cx, cy uint, ok bool) {
+	var x, y int
+	if n, err := fmt.Sscanf(name, "%d_%d.chunk", &x, &y); err != nil || n != 2 || x < 0 || y < 0 {
+		return 0, 0, false
+	}
+	return uint(x), uint(y), true
+}
+
+// writeChunkFile writes c's header (regen/revision/sculptedAt/codec) and
+// packed heightfield to path, truncating any existing file.
+func writeChunkFile(path string, c *chunk) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var header [chunkHeaderSize]byte
+	binary.LittleEndian.PutUint64(header[0:8], uint64(c.regen))
+	binary.LittleEndian.PutUint64(header[8:16], c.revision)
+	binary.LittleEndian.PutUint64(header[16:24], uint64(c.sculptedAt))
+	binary.LittleEndian.PutUint64(header[24:32], uint64(c.codec))
+	if _, err := file.Write(header[:]); err != nil {
+		return err
+	}
+
+	for i := range c.data {
+		if _, err := file.Write(c.data[i][:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readChunkFile reads a file written by writeChunkFile into c.
+func readChunkFile(path string, c *chunk) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var header [chunkHeaderSize]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil {
+		return err
+	}
+	c.regen = int64(binary.LittleEndian.Uint64(header[0:8]))
+	c.revision = binary.LittleEndian.Uint64(header[8:16])
+	c.sculptedAt = int64(binary.LittleEndian.Uint64(header[16:24]))
+	c.codec = byte(binary.LittleEndian.Uint64(header[24:32]))
+
+	for i := range c.data {
+		if _, err := io.ReadFull(file, c.data[i][:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
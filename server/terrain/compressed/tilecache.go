@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"github.com/cespare/xxhash/v2"
+	"sync"
+)
+
+// tileCacheEntry is one tile's most recently encoded bytes and xxhash64, kept
+// alongside the chunk revision they were computed from.
+type tileCacheEntry struct {
+	revision uint64
+	data     []byte
+	hash     uint64
+}
+
+// tileCache guards a map of tileCacheEntry, one per tile ever encoded. It's
+// naturally bounded to chunkCount*chunkCount entries (at most 1024), so
+// unlike ClientTileHashes it doesn't need LRU eviction.
+type tileCache struct {
+	mutex   sync.Mutex
+	entries map[tileID]tileCacheEntry
+}
+
+// encodeTile returns id's current EncodeTile bytes and their xxhash64,
+// reusing the cached encoding and hash if the chunk hasn't mutated (via
+// Sculpt or Repair - see chunk.revision) since they were last computed.
+// Lets many clients sharing a tile in AtDelta (see tilehash.go) skip
+// redundant encode/hash work for the same tile within a revision.
+func (t *Terrain) encodeTile(id uint32) ([]byte, uint64) {
+	cx, cy := uint(id>>16), uint(id&0xffff)
+	revision := t.getChunk(cx*chunkSize, cy*chunkSize).revision
+
+	t.tileCache.mutex.Lock()
+	if e, ok := t.tileCache.entries[id]; ok && e.revision == revision {
+		t.tileCache.mutex.Unlock()
+		return e.data, e.hash
+	}
+	t.tileCache.mutex.Unlock()
+
+	data := t.EncodeTile(id)
+	hash := xxhash.Sum64(data)
+
+	t.tileCache.mutex.Lock()
+	if t.tileCache.entries == nil {
+		t.tileCache.entries = make(map[tileID]tileCacheEntry)
+	}
+	t.tileCache.entries[id] = tileCacheEntry{revision: revision, data: data, hash: hash}
+	t.tileCache.mutex.Unlock()
+
+	return data, hash
+}
@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"math"
+)
+
+// maxClientTileHashes bounds ClientTileHashes, so a client that pans across
+// the whole Size x Size map doesn't grow its hash table without limit.
+const maxClientTileHashes = 1024
+
+// tileHashEntry is one remembered tile hash, plus an LRU sequence number.
+type tileHashEntry struct {
+	hash uint64
+	seq  uint64
+}
+
+// ClientTileHashes remembers, for one connected client, the xxhash64 of the
+// last tile AtDelta sent it (see Terrain.AtDelta), so a later AtDelta call
+// over the same area can tell Hub.updateClient which tiles to omit. It's
+// bounded to maxClientTileHashes entries (LRU by insertion order) rather
+// than by the client's actual view, since a fast-moving client's recently
+// seen tiles are the ones worth remembering regardless of where its view
+// currently is.
+//
+// The zero value is not usable; construct with NewClientTileHashes.
+type ClientTileHashes struct {
+	entries map[uint32]tileHashEntry
+	seq     uint64
+}
+
+// NewClientTileHashes returns an empty ClientTileHashes, ready for AtDelta.
+func NewClientTileHashes() *ClientTileHashes {
+	return &ClientTileHashes{entries: make(map[uint32]tileHashEntry)}
+}
+
+// Reset clears every remembered tile hash, forcing the next AtDelta call to
+// report every tile in view as changed. server.Hub.sendTerrain calls it on
+// every forced terrain resend (see shouldForceSendTerrain); a view that
+// merely moves keeps its hashes.
+func (h *ClientTileHashes) Reset() {
+	for id := range h.entries {
+		delete(h.entries, id)
+	}
+	h.seq = 0
+}
+
+func (h *ClientTileHashes) get(id uint32) (uint64, bool) {
+	e, ok := h.entries[id]
+	return e.hash, ok
+}
+
+func (h *ClientTileHashes) set(id uint32, hash uint64) {
+	h.seq++
+	if _, ok := h.entries[id]; !ok && len(h.entries) >= maxClientTileHashes {
+		h.evictOldest()
+	}
+	h.entries[id] = tileHashEntry{hash: hash, seq: h.seq}
+}
+
+// evictOldest removes the entry with the smallest seq, i.e. the one that's
+// gone longest without being re-set by an AtDelta call.
+func (h *ClientTileHashes) evictOldest() {
+	oldestID := uint32(0)
+	oldestSeq := uint64(math.MaxUint64)
+	for id, e := range h.entries {
+		if e.seq < oldestSeq {
+			oldestSeq, oldestID = e.seq, id
+		}
+	}
+	delete(h.entries, oldestID)
+}
+
+// tileRange returns the inclusive tile-coordinate range covering width x
+// height unsigned terrain coords starting at ux, uy.
+func tileRange(ux, uy, width, height uint) (tx0, ty0, tx1, ty1 uint) {
+	tx0, ty0 = ux/chunkSize, uy/chunkSize
+	tx1, ty1 = (ux+width-1)/chunkSize, (uy+height-1)/chunkSize
+	return
+}
+
+// AtDelta is like At, except instead of a full heightmap it returns only the
+// tiles whose xxhash64 (see encodeTile) differs from what hashes last saw for
+// this connection, plus a bitmask of which tiles were omitted because they're
+// unchanged. Hub.sendTerrain calls it for every terrain update, Resetting
+// hashes first on a forced resend (see shouldForceSendTerrain) so that every
+// tile in view comes back as changed.
+func (t *Terrain) AtDelta(aabb world.AABB, hashes *ClientTileHashes) *terrain.Data {
+	clamped, ux, uy, width, height := clampAABB(aabb)
+	if width == 0 || height == 0 {
+		return &terrain.Data{AABB: clamped}
+	}
+
+	tx0, ty0, tx1, ty1 := tileRange(ux, uy, width, height)
+	tileWidth := int(tx1-tx0) + 1
+	tileHeight := int(ty1-ty0) + 1
+
+	mask := make([]byte, (tileWidth*tileHeight+7)/8)
+	var changed []terrain.Tile
+
+	i := 0
+	for ty := ty0; ty <= ty1; ty++ {
+		for tx := tx0; tx <= tx1; tx++ {
+			id := TileID(tx, ty)
+			data, hash := t.encodeTile(id)
+
+			if prev, ok := hashes.get(id); ok && prev == hash {
+				mask[i/8] |= 1 << (i % 8)
+			} else {
+				hashes.set(id, hash)
+				changed = append(changed, terrain.Tile{Data: data})
+			}
+			i++
+		}
+	}
+
+	return &terrain.Data{
+		AABB:   clamped,
+		Stride: int(width),
+		Length: int(width * height),
+		Delta: &terrain.Delta{
+			Version:       t.Version(),
+			TileWidth:     tileWidth,
+			TileHeight:    tileHeight,
+			ChangedTiles:  changed,
+			UnchangedMask: mask,
+		},
+	}
+}
+
+// decodeTile expands a chunk-sized tile's EncodeTile bytes (a codecs index
+// followed by that Codec's encoding) into one height byte per pixel, the
+// same decoding DecodeTile does before writing a chunk.
+func decodeTile(data []byte) []byte {
+	return codecs[data[0]].Decode(data[1:])
+}
+
+// ApplyDelta reconstructs the full raw heightmap data describes (data.Delta
+// must be non-nil - see AtDelta), given prev, the raw heightmap this
+// connection decoded the last time it saw this AABB at an earlier Version.
+// Unchanged tiles are copied from prev; changed tiles are expanded from
+// data.Delta.ChangedTiles. prev must cover an AABB at least as large as
+// data's, row-major with the same Stride convention as Decode's output.
+//
+// This is the reference decoder the browser client's own (TypeScript)
+// implementation of the same tile-hash delta algorithm is expected to
+// match - that client lives in a separate repository, so this is exercised
+// here (and by tests) as the server-side source of truth for the format.
+func (t *Terrain) ApplyDelta(data *terrain.Data, prev []byte) ([]byte, error) {
+	delta := data.Delta
+	raw := make([]byte, data.Length)
+	height := data.Length / data.Stride
+
+	// data.AABB is clampAABB's output, which starts half a pixel before the
+	// first sample; tiles start on chunk boundaries, so offX/offY is how far
+	// into the first tile column/row that sample sits.
+	offX := (int(data.X/terrain.Scale+0.5) + Size/2) % chunkSize
+	offY := (int(data.Y/terrain.Scale+0.5) + Size/2) % chunkSize
+
+	tileIndex := 0
+	changedIndex := 0
+	for ty := 0; ty < delta.TileHeight; ty++ {
+		for tx := 0; tx < delta.TileWidth; tx++ {
+			unchanged := delta.UnchangedMask[tileIndex/8]&(1<<(tileIndex%8)) != 0
+
+			var tile []byte
+			if !unchanged {
+				tile = decodeTile(delta.ChangedTiles[changedIndex].Data)
+				changedIndex++
+			}
+
+			for y := 0; y < chunkSize; y++ {
+				py := ty*chunkSize + y - offY
+				if py < 0 {
+					continue
+				}
+				if py >= height {
+					break
+				}
+				for x := 0; x < chunkSize; x++ {
+					px := tx*chunkSize + x - offX
+					if px < 0 {
+						continue
+					}
+					if px >= data.Stride {
+						break
+					}
+
+					out := py*data.Stride + px
+					if unchanged {
+						raw[out] = prev[out]
+					} else {
+						raw[out] = tile[y*chunkSize+x]
+					}
+				}
+			}
+
+			tileIndex++
+		}
+	}
+
+	return raw, nil
+}
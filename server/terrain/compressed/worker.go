@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package compressed
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	// shardCount is the number of mutexes getChunkSlow/evictStale stripe
+	// chunk coordinates across. Must be a power of 2.
+	shardCount = 16
+
+	// evictCheckPeriod is how often StartWorkers' eviction goroutine sweeps
+	// the chunk grid, independent of the TTL chunks are evicted after.
+	evictCheckPeriod = time.Minute
+)
+
+// shardIndex maps a chunk coordinate to one of shardCount mutexes. It's not
+// meant to distribute coordinates uniformly across shards with any
+// cryptographic rigor, just well enough that two unrelated chunks rarely
+// collide on the same lock.
+func shardIndex(cx, cy uint) uint32 {
+	return uint32(cx*2654435761+cy) & (shardCount - 1)
+}
+
+// nowMillis is time.Now() in the same unit set/Repair/Sculpt persist.
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond/time.Nanosecond)
+}
+
+// TerrainStats is a point-in-time snapshot of a Terrain's background
+// prefetch/eviction counters. It's not wired into an actual metrics library
+// (compressed has no dependency on one) - a caller with access to one (e.g.
+// server.Hub, via its Cloud field) can poll Stats and report it however it
+// likes.
+type TerrainStats struct {
+	Hits, Misses, Prefetches, Evictions uint64
+}
+
+// Stats returns the current values of Terrain's hit/miss/prefetch/eviction
+// counters (see getChunk, StartWorkers, evictStale).
+func (t *Terrain) Stats() TerrainStats {
+	return TerrainStats{
+		Hits:       atomic.LoadUint64(&t.hits),
+		Misses:     atomic.LoadUint64(&t.misses),
+		Prefetches: atomic.LoadUint64(&t.prefetches),
+		Evictions:  atomic.LoadUint64(&t.evictions),
+	}
+}
+
+// StartWorkers starts workers background goroutines draining the queue
+// Prefetch feeds (forcing chunk generation off of whatever gameplay
+// goroutine would otherwise have blocked on it in getChunkSlow), plus one
+// goroutine evicting chunks that haven't been accessed in evictTTL, as long
+// as they haven't diverged from the generator's output (see evictStale). A
+// non-positive evictTTL disables eviction; workers is clamped to at least 1.
+// The returned stop func waits for every goroutine to exit before returning.
+func (t *Terrain) StartWorkers(workers int, evictTTL time.Duration) (stop func()) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	t.prefetchQueue = make(chan [2]uint32, 256)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for coord := range t.prefetchQueue {
+				t.getChunk(uint(coord[0])*chunkSize, uint(coord[1])*chunkSize)
+				atomic.AddUint64(&t.prefetches, 1)
+			}
+		}()
+	}
+
+	if evictTTL > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(evictCheckPeriod)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					t.evictStale(evictTTL)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	return func() {
+		close(done)
+		close(t.prefetchQueue)
+		wg.Wait()
+		t.prefetchQueue = nil
+	}
+}
+
+// Prefetch enqueues every chunk within radius of pos for background
+// generation by StartWorkers, so a later At/AtPos/Collides call over that
+// area is less likely to block on generateChunk. It's a best-effort hint:
+// if the queue is full, or StartWorkers was never called, this is a no-op.
+// Callers are expected to call it periodically for every active
+// world.Entity (see Hub.prefetchTerrain).
+func (t *Terrain) Prefetch(pos world.Vec2f, radius float32) {
+	if t.prefetchQueue == nil {
+		return
+	}
+
+	aabb := world.AABB{
+		Vec2f:  pos.Sub(world.Vec2f{X: radius, Y: radius}),
+		Width:  radius * 2,
+		Height: radius * 2,
+	}
+	_, ux, uy, width, height := clampAABB(aabb)
+	if width == 0 || height == 0 {
+		return
+	}
+
+	cx0, cy0 := ux/chunkSize, uy/chunkSize
+	cx1, cy1 := (ux+width)/chunkSize, (uy+height)/chunkSize
+
+	for cy := cy0; cy <= cy1 && cy < chunkCount; cy++ {
+		for cx := cx0; cx <= cx1 && cx < chunkCount; cx++ {
+			t.enqueuePrefetch(cx, cy)
+		}
+	}
+}
+
+// enqueuePrefetch queues chunk (cx, cy) for background generation, unless
+// it's already generated or the queue is full.
+func (t *Terrain) enqueuePrefetch(cx, cy uint) {
+	chunkPtr := (*unsafe.Pointer)(unsafe.Pointer(&t.chunks[cx][cy]))
+	if atomic.LoadPointer(chunkPtr) != nil {
+		return
+	}
+
+	select {
+	case t.prefetchQueue <- [2]uint32{uint32(cx), uint32(cy)}:
+	default:
+	}
+}
+
+// evictStale frees chunks that haven't been accessed (see getChunk) in ttl,
+// and whose contents still match the generator's output - i.e. sculptedAt is
+// still zero, so freeing it loses nothing a later getChunkSlow can't
+// reconstruct byte-for-byte. Chunks a player has ever sculpted are never
+// evicted, regardless of age.
+func (t *Terrain) evictStale(ttl time.Duration) {
+	deadline := nowMillis() - ttl.Milliseconds()
+
+	for cx := uint(0); cx < chunkCount; cx++ {
+		for cy := uint(0); cy < chunkCount; cy++ {
+			chunkPtr := (*unsafe.Pointer)(unsafe.Pointer(&t.chunks[cx][cy]))
+
+			c := (*chunk)(atomic.LoadPointer(chunkPtr))
+			if c == nil || c.sculptedAt != 0 || atomic.LoadInt64(&c.lastAccess) > deadline {
+				continue
+			}
+
+			mu := &t.mutexes[shardIndex(cx, cy)]
+			mu.Lock()
+			// Re-check under the shard lock: a concurrent getChunkSlow or
+			// Sculpt may have touched this chunk since the lock-free checks
+			// above.
+			c = (*chunk)(atomic.LoadPointer(chunkPtr))
+			if c != nil && c.sculptedAt == 0 && atomic.LoadInt64(&c.lastAccess) <= deadline {
+				atomic.StorePointer(chunkPtr, nil)
+				atomic.AddInt32(&t.chunkCount, -1)
+				atomic.AddUint64(&t.evictions, 1)
+			}
+			mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package terrain
+
+import "github.com/SoftbearStudios/mk48/server/world"
+
+// DefaultContourLevels are the elevation thresholds ContourRenderer uses by
+// default - the same bands DefaultPalette shades, so the resulting
+// coastline/vegetation/rock contours line up with a Render/TileRenderer
+// preview of the same region.
+var DefaultContourLevels = []byte{OceanLevel, SandLevel, GrassLevel, RockLevel}
+
+// ContourRenderer runs marching squares over a Terrain's decoded heightmap
+// at a set of elevation thresholds, for exporting coastlines/terrain bands
+// to external tooling (GIS viewers, map editors) as GeoJSON.
+type ContourRenderer struct {
+	Terrain Terrain
+}
+
+// NewContourRenderer returns a ContourRenderer for t.
+func NewContourRenderer(t Terrain) *ContourRenderer {
+	return &ContourRenderer{Terrain: t}
+}
+
+// Render runs marching squares at each of levels over the decoded heightmap
+// of a size x size world-unit square centered on the origin (the same
+// region Render/TileRenderer would draw), returning one GeoJSON
+// MultiLineString feature per level with a "level" property.
+//
+// Each line segment is emitted independently rather than stitched into long
+// paths - simpler and still valid GeoJSON, at the cost of many short
+// segments instead of fewer long ones.
+func (r *ContourRenderer) Render(size int, levels []byte) GeoJSONFeatureCollection {
+	o := float32(-size) * 0.5 * Scale
+	s := float32(size * Scale)
+	data := r.Terrain.At(world.AABBFrom(o, o, s, s))
+	raw, _ := r.Terrain.Decode(data)
+
+	width := data.Stride
+	height := data.Length / width
+
+	fc := GeoJSONFeatureCollection{Type: "FeatureCollection"}
+	for _, level := range levels {
+		var lines [][][2]float64
+
+		for j := 0; j < height-1; j++ {
+			for i := 0; i < width-1; i++ {
+				for _, seg := range marchingSquareCell(raw, width, i, j, level) {
+					lines = append(lines, [][2]float64{
+						{float64(o) + seg[0][0]*Scale, float64(o) + seg[0][1]*Scale},
+						{float64(o) + seg[1][0]*Scale, float64(o) + seg[1][1]*Scale},
+					})
+				}
+			}
+		}
+
+		fc.Features = append(fc.Features, GeoJSONFeature{
+			Type:       "Feature",
+			Properties: map[string]interface{}{"level": level},
+			Geometry:   GeoJSONGeometry{Type: "MultiLineString", Coordinates: lines},
+		})
+	}
+
+	return fc
+}
+
+// marchingSquareCell returns 0, 1, or 2 line segments (each a pair of
+// points in heightmap-pixel space) where level crosses the 2x2 cell whose
+// top-left corner is raw pixel (i, j).
+func marchingSquareCell(raw []byte, width, i, j int, level byte) [][2][2]float64 {
+	tl := raw[i+j*width]
+	tr := raw[(i+1)+j*width]
+	br := raw[(i+1)+(j+1)*width]
+	bl := raw[i+(j+1)*width]
+
+	aboveTL, aboveTR := tl >= level, tr >= level
+	aboveBR, aboveBL := br >= level, bl >= level
+
+	var top, right, bottom, left [2]float64
+	var hasTop, hasRight, hasBottom, hasLeft bool
+
+	if aboveTL != aboveTR {
+		top = [2]float64{float64(i) + contourLerp(tl, tr, level), float64(j)}
+		hasTop = true
+	}
+	if aboveTR != aboveBR {
+		right = [2]float64{float64(i + 1), float64(j) + contourLerp(tr, br, level)}
+		hasRight = true
+	}
+	if aboveBL != aboveBR {
+		bottom = [2]float64{float64(i) + contourLerp(bl, br, level), float64(j + 1)}
+		hasBottom = true
+	}
+	if aboveTL != aboveBL {
+		left = [2]float64{float64(i), float64(j) + contourLerp(tl, bl, level)}
+		hasLeft = true
+	}
+
+	edges := [4]struct {
+		point [2]float64
+		has   bool
+	}{{top, hasTop}, {right, hasRight}, {bottom, hasBottom}, {left, hasLeft}}
+
+	count := 0
+	for _, e := range edges {
+		if e.has {
+			count++
+		}
+	}
+
+	switch count {
+	case 2:
+		var a, b [2]float64
+		found := 0
+		for _, e := range edges {
+			if !e.has {
+				continue
+			}
+			if found == 0 {
+				a = e.point
+			} else {
+				b = e.point
+			}
+			found++
+		}
+		return [][2][2]float64{{a, b}}
+	case 4:
+		// Saddle: corners alternate (tl==br, tr==bl, tl!=tr). Pair each
+		// "high" corner's two isolating edges together - a standard, if
+		// simplified, disambiguation that doesn't sample the cell center.
+		if aboveTL {
+			return [][2][2]float64{{top, left}, {right, bottom}}
+		}
+		return [][2][2]float64{{top, right}, {left, bottom}}
+	default:
+		// 0: cell doesn't cross level at all.
+		return nil
+	}
+}
+
+// contourLerp returns how far along the edge from a corner valued a to one
+// valued b the level crossing sits, in [0, 1].
+func contourLerp(a, b, level byte) float64 {
+	if a == b {
+		return 0.5
+	}
+	return float64(int(level)-int(a)) / float64(int(b)-int(a))
+}
+
+// GeoJSON is the minimal subset of the spec ContourRenderer needs - this
+// module has no existing GeoJSON dependency, and encoding/json's struct
+// tags cover it without one.
+type (
+	GeoJSONFeatureCollection struct {
+		Type     string           `json:"type"`
+		Features []GeoJSONFeature `json:"features"`
+	}
+
+	GeoJSONFeature struct {
+		Type       string                 `json:"type"`
+		Properties map[string]interface{} `json:"properties"`
+		Geometry   GeoJSONGeometry        `json:"geometry"`
+	}
+
+	GeoJSONGeometry struct {
+		Type        string         `json:"type"`
+		Coordinates [][][2]float64 `json:"coordinates"`
+	}
+)
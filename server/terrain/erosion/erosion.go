@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package erosion is a terrain.Source post-pass: it generates a heightmap
+// from a wrapped base terrain.Source, then simulates droplets of water
+// flowing downhill across it, eroding high ground and depositing the
+// sediment they carry in low ground, so a generic heightmap grows connected
+// drainage channels and deltas instead of looking uniformly sculpted.
+// Registered as "hydraulic-erosion" (see register.go).
+package erosion
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/chewxy/math32"
+	"math/rand"
+)
+
+const (
+	defaultDroplets = 4096
+	maxLifetime     = 64 // steps a single droplet takes before it's given up on
+
+	inertia       = 0.05 // how much a droplet keeps its prior direction vs. following the gradient
+	minSlope      = 0.01
+	capacity      = 8 // sediment a droplet can carry, scaled by speed, water and slope
+	depositRate   = 0.3
+	erodeRate     = 0.3
+	evaporateRate = 0.02
+	gravity       = 4.0
+)
+
+// Generator wraps a base terrain.Source and erodes its heightmap.
+type Generator struct {
+	base     terrain.Source
+	rng      *rand.Rand
+	droplets int
+}
+
+// New creates a Generator that runs droplets simulated raindrops, seeded
+// from seed, over base's heightmap. droplets <= 0 uses defaultDroplets.
+func New(base terrain.Source, seed int64, droplets int) *Generator {
+	if droplets <= 0 {
+		droplets = defaultDroplets
+	}
+	return &Generator{base: base, rng: rand.New(rand.NewSource(seed)), droplets: droplets}
+}
+
+// Generate implements terrain.Source.Generate.
+func (g *Generator) Generate(x, y, width, height int) []byte {
+	buf := g.base.Generate(x, y, width, height)
+
+	h := make([]float32, len(buf))
+	for i, b := range buf {
+		h[i] = float32(b)
+	}
+
+	for n := 0; n < g.droplets; n++ {
+		g.simulateDroplet(h, width, height)
+	}
+
+	out := make([]byte, len(buf))
+	for i, v := range h {
+		out[i] = clampToByte(v)
+	}
+	return out
+}
+
+type vec2 struct{ x, y float32 }
+
+// simulateDroplet runs one droplet's lifetime, mutating h in place.
+func (g *Generator) simulateDroplet(h []float32, width, height int) {
+	pos := vec2{x: g.rng.Float32() * float32(width-1), y: g.rng.Float32() * float32(height-1)}
+	dir := vec2{}
+	speed := float32(1)
+	water := float32(1)
+	sediment := float32(0)
+
+	for step := 0; step < maxLifetime; step++ {
+		grad, height0 := gradientAndHeight(h, width, height, pos)
+
+		dir = vec2{
+			x: dir.x*inertia - grad.x*(1-inertia),
+			y: dir.y*inertia - grad.y*(1-inertia),
+		}
+		if dir.x == 0 && dir.y == 0 {
+			break
+		}
+		dir = dir.norm()
+
+		next := vec2{x: pos.x + dir.x, y: pos.y + dir.y}
+		if next.x < 0 || next.y < 0 || next.x >= float32(width-1) || next.y >= float32(height-1) {
+			break
+		}
+
+		_, height1 := gradientAndHeight(h, width, height, next)
+		deltaHeight := height1 - height0
+
+		newCapacity := maxf(-deltaHeight, minSlope) * speed * water * capacity
+		if deltaHeight > 0 || sediment > newCapacity {
+			// Flowed uphill, or is carrying more than it can: drop some.
+			amount := sediment * depositRate
+			if deltaHeight > 0 {
+				amount = minf(amount+deltaHeight, sediment)
+			}
+			sediment -= amount
+			deposit(h, width, height, pos, amount)
+		} else {
+			// Still has room to pick up sediment: erode the ground it's on.
+			amount := minf((newCapacity-sediment)*erodeRate, -deltaHeight)
+			sediment += amount
+			erode(h, width, height, pos, amount)
+		}
+
+		speed = math32.Sqrt(maxf(0, speed*speed-deltaHeight*gravity))
+		water *= 1 - evaporateRate
+		pos = next
+		if water < 0.01 {
+			break
+		}
+	}
+}
+
+// gradientAndHeight bilinearly interpolates h's gradient and height at pos.
+func gradientAndHeight(h []float32, width, height int, pos vec2) (vec2, float32) {
+	ix, iy := int(pos.x), int(pos.y)
+	fx, fy := pos.x-float32(ix), pos.y-float32(iy)
+
+	nw := at(h, width, height, ix, iy)
+	ne := at(h, width, height, ix+1, iy)
+	sw := at(h, width, height, ix, iy+1)
+	se := at(h, width, height, ix+1, iy+1)
+
+	gradX := (ne-nw)*(1-fy) + (se-sw)*fy
+	gradY := (sw-nw)*(1-fx) + (se-ne)*fx
+	h0 := nw*(1-fx)*(1-fy) + ne*fx*(1-fy) + sw*(1-fx)*fy + se*fx*fy
+
+	return vec2{x: gradX, y: gradY}, h0
+}
+
+// deposit adds amount of height around pos, weighted by bilinear distance,
+// mirroring how gradientAndHeight reads it.
+func deposit(h []float32, width, height int, pos vec2, amount float32) {
+	addAt(h, width, height, pos, amount)
+}
+
+// erode removes amount of height around pos, weighted the same way deposit
+// adds it.
+func erode(h []float32, width, height int, pos vec2, amount float32) {
+	addAt(h, width, height, pos, -amount)
+}
+
+func addAt(h []float32, width, height int, pos vec2, amount float32) {
+	ix, iy := int(pos.x), int(pos.y)
+	fx, fy := pos.x-float32(ix), pos.y-float32(iy)
+
+	addTo(h, width, height, ix, iy, amount*(1-fx)*(1-fy))
+	addTo(h, width, height, ix+1, iy, amount*fx*(1-fy))
+	addTo(h, width, height, ix, iy+1, amount*(1-fx)*fy)
+	addTo(h, width, height, ix+1, iy+1, amount*fx*fy)
+}
+
+func addTo(h []float32, width, height, x, y int, amount float32) {
+	if x < 0 || y < 0 || x >= width || y >= height {
+		return
+	}
+	h[x+y*width] += amount
+}
+
+func at(h []float32, width, height, x, y int) float32 {
+	if x < 0 {
+		x = 0
+	} else if x >= width {
+		x = width - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= height {
+		y = height - 1
+	}
+	return h[x+y*width]
+}
+
+func (v vec2) norm() vec2 {
+	length := math32.Hypot(v.x, v.y)
+	if length == 0 {
+		return v
+	}
+	return vec2{x: v.x / length, y: v.y / length}
+}
+
+func maxf(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minf(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func clampToByte(f float32) byte {
+	if f < 0 {
+		return 0
+	}
+	if f > 255 {
+		return 255
+	}
+	return byte(f)
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package erosion
+
+import (
+	"encoding/json"
+	"github.com/SoftbearStudios/mk48/server/terrain"
+)
+
+// Params configures Generator (see New). Base/BaseParams select the
+// terrain.Source whose heightmap gets eroded - droplets need real relief to
+// carve into, so Base defaults to "ridged-multifractal" rather than flat
+// noise.
+type Params struct {
+	Base       string          `json:"base"`
+	BaseParams json.RawMessage `json:"baseParams"`
+	Seed       int64           `json:"seed"`
+	Droplets   int             `json:"droplets"`
+}
+
+func init() {
+	terrain.RegisterSource("hydraulic-erosion", newSource)
+}
+
+func newSource(params []byte) (terrain.Source, error) {
+	p := Params{Base: "ridged-multifractal", Seed: terrain.Seed}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+
+	var baseParams []byte
+	if len(p.BaseParams) > 0 {
+		baseParams = p.BaseParams
+	}
+	base, err := terrain.NewSource(p.Base, baseParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(base, p.Seed, p.Droplets), nil
+}
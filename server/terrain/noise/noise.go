@@ -23,6 +23,12 @@ type Generator struct {
 	// Open water depth floor heightmap noise
 	waterLo *perlin.Perlin
 
+	// Biome fields, only sampled by GenerateTyped (see classify). Both are
+	// lower frequency than landLo/waterLo - biomes are meant to span many
+	// zones, not vary zone to zone.
+	temp     *perlin.Perlin
+	humidity *perlin.Perlin
+
 	offset world.Vec2f
 }
 
@@ -33,16 +39,44 @@ func NewDefault() *Generator {
 // New creates a new Generator with a seed.
 func New(seed int64, offsetX, offsetY float32) *Generator {
 	return &Generator{
-		landHi:  perlin.NewPerlin(1.5, 2.0, 4, seed),
-		landLo:  perlin.NewPerlin(2.5, 3.0, 4, seed+1),
-		waterLo: perlin.NewPerlin(2, 3.0, 3, seed+2),
-		offset:  world.Vec2f{X: offsetX, Y: offsetY}.Mul(1.0 / terrain.Scale), // Scale to terrain space
+		landHi:   perlin.NewPerlin(1.5, 2.0, 4, seed),
+		landLo:   perlin.NewPerlin(2.5, 3.0, 4, seed+1),
+		waterLo:  perlin.NewPerlin(2, 3.0, 3, seed+2),
+		temp:     perlin.NewPerlin(2, 2.0, 2, seed+3),
+		humidity: perlin.NewPerlin(2, 2.0, 2, seed+4),
+		offset:   world.Vec2f{X: offsetX, Y: offsetY}.Mul(1.0 / terrain.Scale), // Scale to terrain space
 	}
 }
 
 // Generate implements terrain.Source.Generate.
 func (g *Generator) Generate(px, py, width, height int) []byte {
-	buf := make([]byte, width*height)
+	buf, _, _ := g.generate(px, py, width, height, false)
+	return buf
+}
+
+// GenerateTyped implements terrain.TypedSource.GenerateTyped, classifying
+// each cell into a Biome alongside its height (see classify).
+func (g *Generator) GenerateTyped(px, py, width, height int) ([]byte, []terrain.Biome) {
+	buf, temp, humidity := g.generate(px, py, width, height, true)
+
+	biomes := make([]terrain.Biome, len(buf))
+	for i, h := range buf {
+		biomes[i] = classify(h, temp[i], humidity[i])
+	}
+
+	return buf, biomes
+}
+
+// generate is the shared heightmap loop behind Generate/GenerateTyped. It
+// only samples temp/humidity (returned row-major, same shape as buf) when
+// typed is set, so plain Generate callers (the common case: every chunk a
+// compressed.Terrain generates) don't pay for octaves they don't use.
+func (g *Generator) generate(px, py, width, height int, typed bool) (buf []byte, temp, humidity []float64) {
+	buf = make([]byte, width*height)
+	if typed {
+		temp = make([]float64, width*height)
+		humidity = make([]float64, width*height)
+	}
 
 	// Offsets in terrain space
 	offX := float64(g.offset.X) + float64(px)
@@ -64,9 +98,37 @@ func (g *Generator) Generate(px, py, width, height int) []byte {
 
 			depthFloor := clamp((g.waterLo.Noise2D(x*zoneFrequency, y*zoneFrequency)+0.3)*4, 0, 1) * terrain.SandLevel
 
-			buf[i+j*width] = clampToByte(max(h, depthFloor))
+			idx := i + j*width
+			buf[idx] = clampToByte(max(h, depthFloor))
+
+			if typed {
+				temp[idx] = g.temp.Noise2D(x*zoneFrequency/2, y*zoneFrequency/2)
+				humidity[idx] = g.humidity.Noise2D(x*zoneFrequency/2, y*zoneFrequency/2)
+			}
 		}
 	}
 
-	return buf
+	return
+}
+
+// classify turns a generated height plus its temp/humidity samples into a
+// Biome. Height bands up to SandLevel (deep ocean, shallows, beach) take
+// priority over temp/humidity (a deep trench is deep regardless of
+// climate); above SandLevel, temp picks out arctic cells first, then
+// humidity/height separate rocky terrain from plains.
+func classify(h byte, temp, humidity float64) terrain.Biome {
+	switch {
+	case h <= terrain.OceanLevel-20:
+		return terrain.BiomeDeepOcean
+	case h <= terrain.OceanLevel:
+		return terrain.BiomeShallows
+	case h <= terrain.SandLevel:
+		return terrain.BiomeBeach
+	case temp < -0.3:
+		return terrain.BiomeArctic
+	case h > terrain.RockLevel || humidity < -0.3:
+		return terrain.BiomeRocky
+	default:
+		return terrain.BiomePlains
+	}
 }
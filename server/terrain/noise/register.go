@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package noise
+
+import (
+	"encoding/json"
+	"github.com/SoftbearStudios/mk48/server/terrain"
+)
+
+// Params configures Generator (see New). A zero-valued Params isn't useful
+// (Seed 0 still works, but OffsetX/OffsetY 0 centers the map on the origin
+// rather than terrain's curated default offset) - NewSource fills in
+// terrain.Seed/OffsetX/OffsetY for any field params.json omits.
+type Params struct {
+	Seed    int64   `json:"seed"`
+	OffsetX float32 `json:"offsetX"`
+	OffsetY float32 `json:"offsetY"`
+}
+
+func init() {
+	terrain.RegisterSource("perlin", newSource)
+}
+
+func newSource(params []byte) (terrain.Source, error) {
+	p := Params{Seed: terrain.Seed, OffsetX: terrain.OffsetX, OffsetY: terrain.OffsetY}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	return New(p.Seed, p.OffsetX, p.OffsetY), nil
+}
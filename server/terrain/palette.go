@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package terrain
+
+// Palette maps a raw heightmap sample to a color, so Render, TileRenderer
+// and anything else turning a heightmap into an image can swap looks (e.g.
+// "heatmap", "bathymetric") without duplicating the height-band switch
+// statement.
+type Palette interface {
+	Color(h byte) ColorVec
+}
+
+// defaultPaletteColors is the grass/sand/ocean/rock gradient every renderer
+// used before Palette existed.
+var defaultPaletteColors = [...]ColorVec{
+	RGB(0, 50, 115),
+	RGB(0, 75, 130),
+	RGB(194, 178, 128),
+	RGB(90, 180, 30),
+	RGB(105, 110, 115),
+	Gray(220),
+}
+
+type defaultPalette struct{}
+
+// DefaultPalette is the original grass/sand/ocean/rock gradient, banded at
+// OceanLevel/SandLevel/GrassLevel/RockLevel.
+var DefaultPalette Palette = defaultPalette{}
+
+func (defaultPalette) Color(h byte) ColorVec {
+	c := defaultPaletteColors
+	switch {
+	case h <= OceanLevel:
+		return c[0].Lerp(c[1], clamp(float32(h)/float32(OceanLevel)))
+	case h <= SandLevel:
+		return c[2]
+	case h <= GrassLevel:
+		return c[2].Lerp(c[3], clamp(float32(h-SandLevel)*0.05))
+	case h <= RockLevel:
+		return c[3].Lerp(c[4], clamp(float32(h-GrassLevel)*0.1))
+	default:
+		return c[4].Lerp(c[5], clamp(float32(h-RockLevel)*0.07))
+	}
+}
+
+type heatmapPalette struct{}
+
+// HeatmapPalette colors purely by normalized height, blue (low) to red
+// (high), ignoring the ocean/land distinction - useful for spotting
+// generator artifacts rather than reading the map as a player would.
+var HeatmapPalette Palette = heatmapPalette{}
+
+func (heatmapPalette) Color(h byte) ColorVec {
+	t := float32(h) / 255
+	return RGB(0, 0, 255).Lerp(RGB(255, 0, 0), clamp(t))
+}
+
+type bathymetricPalette struct{}
+
+// BathymetricPalette emphasizes underwater depth bands (dark blue at depth
+// to pale cyan near the surface) and flattens all land to a single gray, for
+// overlaying bathymetry on external charting tools.
+var BathymetricPalette Palette = bathymetricPalette{}
+
+func (bathymetricPalette) Color(h byte) ColorVec {
+	if h > OceanLevel {
+		return Gray(200)
+	}
+	return RGB(0, 20, 80).Lerp(RGB(120, 200, 255), clamp(float32(h)/float32(OceanLevel)))
+}
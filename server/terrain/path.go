@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package terrain
+
+import (
+	"container/heap"
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// PathCellSize is the side length, in meters, of one pathfinding grid cell.
+// Coarser than Scale so A* over a large radius stays cheap.
+const PathCellSize = Scale * 4
+
+// PathCell is a grid coordinate in FindGridPath's cell space (see
+// WorldToPathCell/PathCellToWorld). Terrain implementations that support
+// FindPath build their own traversability cache keyed by PathCell.
+type PathCell struct {
+	X, Y int32
+}
+
+func WorldToPathCell(pos world.Vec2f) PathCell {
+	return PathCell{X: int32(pos.X / PathCellSize), Y: int32(pos.Y / PathCellSize)}
+}
+
+func PathCellToWorld(c PathCell) world.Vec2f {
+	return world.Vec2f{X: float32(c.X) * PathCellSize, Y: float32(c.Y) * PathCellSize}
+}
+
+// maxPathExpansions backstops pathological/huge searches (e.g. an
+// unreachable goal on the far side of the map) from blowing the per-tick
+// budget of a server handling hundreds of bots.
+const maxPathExpansions = 2048
+
+// FindGridPath runs A* from `from` to `to` over an implicit grid, calling
+// blocked to test traversability on demand (so callers can cache/invalidate
+// however suits their storage). It returns the waypoints to follow in order,
+// excluding `from` itself; nil means no path was found within
+// maxPathExpansions or `to` is blocked.
+func FindGridPath(blocked func(PathCell) bool, from, to PathCell) []world.Vec2f {
+	if from == to {
+		return nil
+	}
+	if blocked(to) {
+		return nil
+	}
+
+	open := &pathQueue{}
+	heap.Init(open)
+	heap.Push(open, &pathNode{cell: from, priority: pathHeuristic(from, to)})
+
+	cameFrom := map[PathCell]PathCell{}
+	costSoFar := map[PathCell]float32{from: 0}
+
+	expansions := 0
+	for open.Len() > 0 && expansions < maxPathExpansions {
+		current := heap.Pop(open).(*pathNode).cell
+		expansions++
+
+		if current == to {
+			return reconstructPath(cameFrom, from, to)
+		}
+
+		for _, next := range pathNeighbors(current) {
+			if blocked(next) {
+				continue
+			}
+
+			newCost := costSoFar[current] + pathStepCost(current, next)
+			if existing, ok := costSoFar[next]; !ok || newCost < existing {
+				costSoFar[next] = newCost
+				cameFrom[next] = current
+				heap.Push(open, &pathNode{cell: next, priority: newCost + pathHeuristic(next, to)})
+			}
+		}
+	}
+
+	return nil
+}
+
+func pathNeighbors(c PathCell) []PathCell {
+	return []PathCell{
+		{c.X + 1, c.Y}, {c.X - 1, c.Y}, {c.X, c.Y + 1}, {c.X, c.Y - 1},
+		{c.X + 1, c.Y + 1}, {c.X - 1, c.Y - 1}, {c.X + 1, c.Y - 1}, {c.X - 1, c.Y + 1},
+	}
+}
+
+func pathStepCost(a, b PathCell) float32 {
+	if a.X != b.X && a.Y != b.Y {
+		return 1.41421356 // diagonal
+	}
+	return 1
+}
+
+func pathHeuristic(a, b PathCell) float32 {
+	dx := float32(a.X - b.X)
+	dy := float32(a.Y - b.Y)
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	if dx < dy {
+		dx, dy = dy, dx
+	}
+	return dx + (1.41421356-1)*dy // octile distance
+}
+
+func reconstructPath(cameFrom map[PathCell]PathCell, start, goal PathCell) []world.Vec2f {
+	var cells []PathCell
+	for c := goal; c != start; c = cameFrom[c] {
+		cells = append(cells, c)
+	}
+
+	waypoints := make([]world.Vec2f, len(cells))
+	for i, c := range cells {
+		// Reverse while converting back to world space.
+		waypoints[len(cells)-1-i] = PathCellToWorld(c)
+	}
+	return waypoints
+}
+
+// pathNode is an entry in pathQueue's min-heap, ordered by priority (cost so
+// far plus heuristic).
+type pathNode struct {
+	cell     PathCell
+	priority float32
+}
+
+// pathQueue implements container/heap.Interface over pathNodes.
+type pathQueue []*pathNode
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(*pathNode)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
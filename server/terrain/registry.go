@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package terrain
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SourceFactory builds a Source from a JSON-encoded parameter blob specific
+// to that Source implementation (e.g. noise.Params). params may be nil, in
+// which case the factory should fall back to sensible defaults.
+type SourceFactory func(params []byte) (Source, error)
+
+var sourceFactories = make(map[string]SourceFactory)
+
+// RegisterSource adds name to the registry NewSource looks up, panicking on
+// a duplicate name. Generator packages (noise, ridged, worley, erosion) call
+// this from their own init, so importing one for its side effect is enough
+// to make it selectable via HubOptions.Terrain/the server_main -terrain flag
+// without the terrain package itself needing to import any of them.
+func RegisterSource(name string, factory SourceFactory) {
+	if _, ok := sourceFactories[name]; ok {
+		panic(fmt.Sprintf("terrain: source %q already registered", name))
+	}
+	sourceFactories[name] = factory
+}
+
+// NewSource builds the named registered Source, parsing params (may be nil)
+// as that source's own parameter type. The caller (e.g. NewHub) must have
+// imported the package that registers name, or this returns an error.
+func NewSource(name string, params []byte) (Source, error) {
+	factory, ok := sourceFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("terrain: unknown source %q (forgot to import its package?)", name)
+	}
+	return factory(params)
+}
+
+func init() {
+	RegisterSource("flat", newFlatSource)
+}
+
+// flatParams configures "flat" (see newFlatSource). Height defaults to
+// SandLevel, i.e. dry land at sea level - a flat ocean isn't a useful
+// default for testing collision/pathing against a coastline.
+type flatParams struct {
+	Height byte `json:"height"`
+}
+
+// flatSource is a trivial Source that ignores x/y and returns the same
+// height everywhere, useful for isolating physics/collision bugs from
+// terrain generation entirely.
+type flatSource byte
+
+func newFlatSource(params []byte) (Source, error) {
+	p := flatParams{Height: SandLevel}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	return flatSource(p.Height), nil
+}
+
+func (s flatSource) Generate(x, y, width, height int) []byte {
+	buf := make([]byte, width*height)
+	for i := range buf {
+		buf[i] = byte(s)
+	}
+	return buf
+}
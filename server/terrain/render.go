@@ -1,3 +1,6 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
 package terrain
 
 import (
@@ -9,16 +12,18 @@ import (
 
 type ColorVec [3]float32
 
-var colors = [...]ColorVec{
-	RGB(0, 50, 115),
-	RGB(0, 75, 130),
-	RGB(194, 178, 128),
-	RGB(90, 180, 30),
-	RGB(105, 110, 115),
-	Gray(220),
+// Render renders a size x size world-unit square centered on the origin
+// using DefaultPalette. Materializes the whole region into one
+// image.RGBA - fine for small previews/minimaps (see debug.go), but use
+// TileRenderer for anything world-scale, since this has to hold every pixel
+// in memory at once.
+func Render(t Terrain, size int) image.Image {
+	return RenderWithPalette(t, size, DefaultPalette)
 }
 
-func (t *Terrain) Render(size int) image.Image {
+// RenderWithPalette is Render with an explicit Palette, e.g. HeatmapPalette
+// or BathymetricPalette instead of the default grass/sand/ocean/rock look.
+func RenderWithPalette(t Terrain, size int, palette Palette) image.Image {
 	o := float32(-size) * 0.5 * Scale
 	s := float32(size * Scale)
 	data := t.At(world.AABBFrom(o, o, s, s))
@@ -30,23 +35,7 @@ func (t *Terrain) Render(size int) image.Image {
 
 	for j := 0; j < width; j++ {
 		for i := 0; i < height; i++ {
-			var c ColorVec
-
-			h := raw[i+j*width]
-			switch {
-			case h <= OceanLevel:
-				c = colors[0].Lerp(colors[1], clamp(float32(h)/float32(OceanLevel)))
-			case h <= SandLevel:
-				c = colors[2]
-			case h <= GrassLevel:
-				c = colors[2].Lerp(colors[3], clamp(float32(h-SandLevel)*0.05))
-			case h <= RockLevel:
-				c = colors[3].Lerp(colors[4], clamp(float32(h-GrassLevel)*0.1))
-			default:
-				c = colors[4].Lerp(colors[5], clamp(float32(h-RockLevel)*0.07))
-			}
-
-			img.Set(i, j, c.Color())
+			img.Set(i, j, palette.Color(raw[i+j*width]).Color())
 		}
 	}
 
@@ -31,7 +31,9 @@ var colors = [...]ColorVec{
 
 func main() {
 	var cpuProfile string
+	var verify bool
 	flag.StringVar(&cpuProfile, "cpuprofile", "", "write cpu profile to `file`")
+	flag.BoolVar(&verify, "verify", false, "reconstruct terrain from a keyframe plus deltas and check it matches")
 	flag.Parse()
 
 	if cpuProfile != "" {
@@ -46,9 +48,61 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	if verify {
+		verifyKeyframeAndDeltas()
+		return
+	}
+
 	run()
 }
 
+// verifyKeyframeAndDeltas sculpts a terrain, records it as a keyframe plus a
+// sequence of deltas (as a Cloud would via UploadTerrainKeyframe/
+// UploadTerrainDelta), reconstructs a second terrain from just that keyframe
+// and those deltas, and checks the two terrains end up pixel-identical.
+func verifyKeyframeAndDeltas() {
+	source := noise.NewDefault()
+	original := compressed.New(source)
+
+	// Force every chunk to exist so the keyframe below isn't just zeroes.
+	o := float32(-compressed.Size * 0.5 * terrain.Scale)
+	s := float32(compressed.Size * terrain.Scale)
+	original.At(world.AABBFrom(o, o, s, s))
+
+	_, keyframeTiles := original.Keyframe()
+
+	reconstructed := compressed.New(source)
+	reconstructed.At(world.AABBFrom(o, o, s, s))
+	for id, data := range keyframeTiles {
+		reconstructed.DecodeTile(id, data)
+	}
+
+	// Sculpt a 10x10 grid of points and ship only the resulting deltas.
+	for i := 0; i < 100; i++ {
+		pos := world.Vec2f{X: s * (float32(i%10)/10 - 0.5), Y: s * (float32(i/10)/10 - 0.5)}
+		original.Sculpt(pos, 10)
+	}
+	for _, id := range original.DirtyTiles() {
+		reconstructed.DecodeTile(id, original.EncodeTile(id))
+	}
+
+	mismatches := 0
+	for y := uint(0); y < compressed.Size; y++ {
+		for x := uint(0); x < compressed.Size; x++ {
+			pos := world.Vec2f{X: float32(x) - compressed.Size/2, Y: float32(y) - compressed.Size/2}.Mul(terrain.Scale)
+			if original.AtPos(pos) != reconstructed.AtPos(pos) {
+				mismatches++
+			}
+		}
+	}
+
+	if mismatches == 0 {
+		fmt.Println("verify ok: reconstructed terrain matches original")
+	} else {
+		log.Fatalf("verify failed: %d mismatched pixels", mismatches)
+	}
+}
+
 func run() {
 	t := compressed.New(noise.NewDefault())
 	o := float32(-compressed.Size * 0.5 * terrain.Scale)
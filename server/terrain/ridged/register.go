@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package ridged
+
+import (
+	"encoding/json"
+	"github.com/SoftbearStudios/mk48/server/terrain"
+)
+
+// Params configures Generator (see New), mirroring noise.Params - the same
+// Seed/OffsetX/OffsetY fields, filled in from terrain's curated default when
+// params.json omits them.
+type Params struct {
+	Seed    int64   `json:"seed"`
+	OffsetX float32 `json:"offsetX"`
+	OffsetY float32 `json:"offsetY"`
+}
+
+func init() {
+	terrain.RegisterSource("ridged-multifractal", newSource)
+}
+
+func newSource(params []byte) (terrain.Source, error) {
+	p := Params{Seed: terrain.Seed, OffsetX: terrain.OffsetX, OffsetY: terrain.OffsetY}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	return New(p.Seed, p.OffsetX, p.OffsetY), nil
+}
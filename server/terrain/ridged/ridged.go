@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package ridged is a ridged multifractal terrain.Source - several octaves
+// of Perlin noise folded around zero (1-|n|) and raised to a sharpening
+// exponent, which carves connected mountain-ridge-like land masses instead
+// of noise's smoother, more uniform coastlines. Registered as
+// "ridged-multifractal" (see register.go).
+package ridged
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/aquilax/go-perlin"
+)
+
+const (
+	octaves    = 5
+	lacunarity = 2.0  // frequency multiplier between octaves
+	gain       = 2.0  // how much of the next octave's signal a ridge lets through there
+	exponent   = 2.0  // sharpens ridges; higher is spikier
+	frequency  = 0.001
+)
+
+// Generator generates a heightmap using ridged multifractal noise.
+type Generator struct {
+	octaves [octaves]*perlin.Perlin
+	offset  world2
+}
+
+type world2 struct{ x, y float32 }
+
+// New creates a Generator seeded from seed, offset by (offsetX, offsetY) in
+// world space (same convention as noise.New).
+func New(seed int64, offsetX, offsetY float32) *Generator {
+	g := &Generator{offset: world2{x: offsetX / terrain.Scale, y: offsetY / terrain.Scale}}
+	for i := range g.octaves {
+		// Distinct seeds per octave, same trick noise.Generator uses for its
+		// landHi/landLo/waterLo sub-generators.
+		g.octaves[i] = perlin.NewPerlin(2.0, 2.0, 3, seed+int64(i))
+	}
+	return g
+}
+
+// Generate implements terrain.Source.Generate.
+func (g *Generator) Generate(px, py, width, height int) []byte {
+	buf := make([]byte, width*height)
+
+	offX := float64(g.offset.x) + float64(px)
+	offY := float64(g.offset.y) + float64(py)
+
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			x := (float64(i) + offX) * terrain.Scale
+			y := (float64(j) + offY) * terrain.Scale
+
+			var sum, amplitude, freq float64 = 0, 1, frequency
+			weight := 1.0
+			for _, octave := range g.octaves {
+				n := octave.Noise2D(x*freq, y*freq)
+				signal := 1 - abs(n)
+				signal = pow(signal, exponent)
+				signal *= weight
+
+				// A weak signal here (away from a ridge) dampens the next,
+				// finer octave's contribution, so detail builds up along
+				// ridges while the ground between them stays smooth.
+				weight = clamp(signal*gain, 0, 1)
+
+				sum += signal * amplitude
+				amplitude *= 0.5
+				freq *= lacunarity
+			}
+
+			buf[i+j*width] = clampToByte(sum*200 + terrain.SandLevel - 60)
+		}
+	}
+
+	return buf
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+func pow(base float64, exp float64) float64 {
+	result := 1.0
+	// exp is always the small constant `exponent` above, so a loop avoids
+	// pulling in math.Pow for one call site.
+	for i := 0; i < int(exp); i++ {
+		result *= base
+	}
+	return result
+}
+
+func clamp(f, min, max float64) float64 {
+	if f < min {
+		return min
+	}
+	if f > max {
+		return max
+	}
+	return f
+}
+
+func clampToByte(f float64) byte {
+	if f < 0 {
+		return 0
+	}
+	if f > 255 {
+		return 255
+	}
+	return byte(f)
+}
@@ -57,6 +57,12 @@ type Terrain interface {
 	// Debug prints debug info to os.StdOut.
 	// Can't be called concurrently with any other terrain function.
 	Debug()
+	// FindPath returns a coarse route from `from` to `to` that avoids land,
+	// or nil if none was found within budget. draft is roughly the
+	// traveling ship's length, and widens the margin kept from shore.
+	// Implementations are expected to cache their traversability grid
+	// between calls and only re-derive cells affected by Sculpt/Repair.
+	FindPath(from, to world.Vec2f, draft float32) []world.Vec2f
 }
 
 // Data describes part of a heightmap.
@@ -66,23 +72,97 @@ type Data struct {
 	Data   []byte `json:"data"`   // Data is a possibly compressed terrain heightmap.
 	Stride int    `json:"stride"` // Stride is width of Data.
 	Length int    `json:"length"` // Length is uncompressed length of Data for faster reading.
+	// Hash is the xxhash64 of Data, set by implementations that compute it
+	// anyway for their own dedup purposes (see compressed.Terrain.At). Zero
+	// for a Delta response, whose content-addressing instead happens per
+	// tile (see compressed.Terrain.AtDelta and ClientTileHashes). A client
+	// can use it to recognize it already has this exact payload cached
+	// without comparing bytes.
+	Hash uint64 `json:"hash,omitempty"`
+	// Delta, when non-nil, means Data only carries the tiles that changed
+	// since the connection's last AABB-covering Data, instead of a full
+	// heightmap - see compressed.Terrain.AtDelta and Delta.
+	Delta *Delta `json:"delta,omitempty"`
+	// sizeClass remembers which dataPool bucket this Data's buffer came
+	// from (see sizeClassFor), so Pool returns it to the same bucket
+	// instead of whichever pool happens to be looked up from its grown len.
+	sizeClass int
 }
 
-var dataPool = sync.Pool{
-	New: func() interface{} {
-		return &Data{
-			Data: make([]byte, 0, 2048),
-		}
-	},
+// Delta is Data's optional incremental-update payload (see
+// compressed.Terrain.AtDelta). A decoder that applied a different Version
+// last (e.g. it missed an intervening Update) can't safely apply Delta, and
+// should instead wait for a full resend: a non-Delta Data, or a Delta whose
+// UnchangedMask has no bit set (see compressed.ClientTileHashes.Reset).
+type Delta struct {
+	Version uint64 `json:"version"`
+	// TileWidth/TileHeight is the shape, in tiles, of the grid
+	// UnchangedMask and ChangedTiles are indexed into (row-major).
+	TileWidth  int `json:"tileWidth"`
+	TileHeight int `json:"tileHeight"`
+	// ChangedTiles holds one Tile per unset bit in UnchangedMask, in
+	// ascending row-major order.
+	ChangedTiles []Tile `json:"changedTiles"`
+	// UnchangedMask has one bit per tile (TileWidth*TileHeight bits, packed
+	// 8 per byte, row-major, low bit first) - a set bit means the decoder
+	// should keep whatever it already has for that tile instead of
+	// expecting an entry in ChangedTiles.
+	UnchangedMask []byte `json:"unchangedMask"`
 }
 
-func NewData() *Data {
-	return dataPool.Get().(*Data)
+// Tile is one changed tile's raw (possibly compressed) bytes within a Delta.
+type Tile struct {
+	Data []byte `json:"data"`
 }
 
-func (data *Data) Pool() {
-	*data = Data{
-		Data: data.Data[:0],
+// minDataSize is the smallest dataPool bucket - roughly one compressed.Terrain
+// tile's worth of bytes (see sizeClassFor), so a single-tile EncodeTile-sized
+// request doesn't pay for a buffer sized for a whole view radius.
+const minDataSize = 2048
+
+// dataPools pools Data buffers by size class (see sizeClassFor), keyed by
+// the class's byte count, so a caller asking for roughly the same amount of
+// data each time (e.g. one tile vs. a client's whole view radius) reuses a
+// correctly-sized buffer instead of whatever an unrelated-sized caller last
+// returned to a single shared pool.
+var dataPools sync.Map // int (size class) -> *sync.Pool
+
+// sizeClassFor rounds n up to the next power-of-two bucket at or above
+// minDataSize.
+func sizeClassFor(n int) int {
+	class := minDataSize
+	for class < n {
+		class *= 2
+	}
+	return class
+}
+
+func dataPoolFor(class int) *sync.Pool {
+	if p, ok := dataPools.Load(class); ok {
+		return p.(*sync.Pool)
 	}
-	dataPool.Put(data)
+	p := &sync.Pool{
+		New: func() interface{} {
+			return &Data{Data: make([]byte, 0, class)}
+		},
+	}
+	actual, _ := dataPools.LoadOrStore(class, p)
+	return actual.(*sync.Pool)
+}
+
+// NewData returns a pooled Data whose buffer has at least n bytes of
+// capacity (see sizeClassFor) - pass the caller's expected encoded size
+// (e.g. width*height for a full At, or one tile's byte count for a
+// per-tile caller) so the buffer doesn't need to grow on first use.
+func NewData(n int) *Data {
+	class := sizeClassFor(n)
+	data := dataPoolFor(class).Get().(*Data)
+	data.sizeClass = class
+	return data
+}
+
+func (data *Data) Pool() {
+	class := data.sizeClass
+	*data = Data{Data: data.Data[:0], sizeClass: class}
+	dataPoolFor(class).Put(data)
 }
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package terrain
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/cloud/fs"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"image"
+	"image/png"
+)
+
+// tileRenderSize is the width/height in heightmap pixels of one rendered
+// tile - matching compressed.Terrain's chunk size by convention (so one
+// tile corresponds to one chunk's worth of data), but kept as its own
+// constant here since this package can't import compressed (compressed
+// imports terrain, not the other way around).
+const tileRenderSize = 64
+
+// TileRenderer walks a Terrain in tileRenderSize-aligned tiles and uploads
+// each as its own PNG to a Leaflet/slippy-map-style "z/x/y.png" pyramid on
+// an fs.Filesystem, so a world-scale export never has to hold the whole
+// region in memory at once the way Render does.
+type TileRenderer struct {
+	Terrain Terrain
+	Palette Palette
+}
+
+// NewTileRenderer returns a TileRenderer for t using DefaultPalette.
+func NewTileRenderer(t Terrain) *TileRenderer {
+	return &TileRenderer{Terrain: t, Palette: DefaultPalette}
+}
+
+// RenderZoom renders every tile of zoom level z covering a size x size
+// world-unit square centered on the origin, uploading each to fileSystem at
+// "z/x/y.png" with the given client-cache lifetime. z only affects the
+// uploaded path (a real slippy-map pyramid would downsample per zoom level;
+// that's left to whatever consumes these tiles, since this renderer always
+// samples at full heightmap resolution).
+func (r *TileRenderer) RenderZoom(fileSystem fs.Filesystem, z int, size int, secondsCache int) error {
+	o := float32(-size) * 0.5 * Scale
+	s := float32(size * Scale)
+	data := r.Terrain.At(world.AABBFrom(o, o, s, s))
+	raw, err := r.Terrain.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	width := data.Stride
+	height := data.Length / width
+
+	palette := r.Palette
+	if palette == nil {
+		palette = DefaultPalette
+	}
+
+	tilesX := (width + tileRenderSize - 1) / tileRenderSize
+	tilesY := (height + tileRenderSize - 1) / tileRenderSize
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			img := renderTile(raw, width, height, tx, ty, palette)
+
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				return fmt.Errorf("encoding tile %d/%d/%d: %w", z, tx, ty, err)
+			}
+
+			path := fmt.Sprintf("%d/%d/%d.png", z, tx, ty)
+			if _, err := fileSystem.UploadStaticFile(path, secondsCache, &buf, false); err != nil {
+				return fmt.Errorf("uploading tile %s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// renderTile renders the single tileRenderSize x tileRenderSize tile at
+// tile coordinates tx, ty out of the full-region heightmap raw (width x
+// height), clipping at the region's edges for a partial last tile.
+func renderTile(raw []byte, width, height, tx, ty int, palette Palette) image.Image {
+	x0, y0 := tx*tileRenderSize, ty*tileRenderSize
+	x1, y1 := x0+tileRenderSize, y0+tileRenderSize
+	if x1 > width {
+		x1 = width
+	}
+	if y1 > height {
+		y1 = height
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, tileRenderSize, tileRenderSize))
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			img.Set(x-x0, y-y0, palette.Color(raw[x+y*width]).Color())
+		}
+	}
+	return img
+}
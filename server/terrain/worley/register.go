@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package worley
+
+import (
+	"encoding/json"
+	"github.com/SoftbearStudios/mk48/server/terrain"
+)
+
+// Params configures Generator (see New), mirroring noise.Params.
+type Params struct {
+	Seed    int64   `json:"seed"`
+	OffsetX float32 `json:"offsetX"`
+	OffsetY float32 `json:"offsetY"`
+}
+
+func init() {
+	terrain.RegisterSource("worley-islands", newSource)
+}
+
+func newSource(params []byte) (terrain.Source, error) {
+	p := Params{Seed: terrain.Seed, OffsetX: terrain.OffsetX, OffsetY: terrain.OffsetY}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	return New(p.Seed, p.OffsetX, p.OffsetY), nil
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package worley is a Worley (cellular) noise terrain.Source - height falls
+// off with distance from the nearest of a jittered grid of feature points,
+// so each feature point grows into its own island instead of noise's
+// continuous, connected coastlines. Registered as "worley-islands" (see
+// register.go).
+package worley
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/chewxy/math32"
+	"math/rand"
+)
+
+const (
+	// cellSize is how many meters of world space each feature-point grid
+	// cell covers; bigger cells make fewer, larger islands.
+	cellSize = 600.0
+	// peakHeight is how tall an island is at its own feature point.
+	peakHeight = 130
+	// falloff shapes how fast height drops with distance from the nearest
+	// feature point; smaller makes wider islands.
+	falloff = 0.00035
+)
+
+// Generator generates a heightmap using Worley noise.
+type Generator struct {
+	seed   int64
+	offset world2
+}
+
+type world2 struct{ x, y float32 }
+
+// New creates a Generator seeded from seed, offset by (offsetX, offsetY) in
+// world space (same convention as noise.New).
+func New(seed int64, offsetX, offsetY float32) *Generator {
+	return &Generator{seed: seed, offset: world2{x: offsetX, y: offsetY}}
+}
+
+// Generate implements terrain.Source.Generate.
+func (g *Generator) Generate(px, py, width, height int) []byte {
+	buf := make([]byte, width*height)
+
+	offX := g.offset.x/terrain.Scale + float32(px)
+	offY := g.offset.y/terrain.Scale + float32(py)
+
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			x := (float32(i) + offX) * terrain.Scale
+			y := (float32(j) + offY) * terrain.Scale
+
+			d := g.nearestFeatureDistance(x, y)
+			h := peakHeight - d*d*falloff
+			buf[i+j*width] = clampToByte(h + terrain.SandLevel - 40)
+		}
+	}
+
+	return buf
+}
+
+// nearestFeatureDistance returns the distance in meters from (x, y) to the
+// nearest jittered feature point, searching the 3x3 grid of cellSize cells
+// around (x, y) - a feature point can only be missed if featurePoint ever
+// jittered it more than cellSize from its own cell, which it doesn't.
+func (g *Generator) nearestFeatureDistance(x, y float32) float32 {
+	cx := int32(math32.Floor(x / cellSize))
+	cy := int32(math32.Floor(y / cellSize))
+
+	best := float32(math32.MaxFloat32)
+	for dy := int32(-1); dy <= 1; dy++ {
+		for dx := int32(-1); dx <= 1; dx++ {
+			fx, fy := g.featurePoint(cx+dx, cy+dy)
+			if dist := math32.Hypot(fx-x, fy-y); dist < best {
+				best = dist
+			}
+		}
+	}
+	return best
+}
+
+// featurePoint deterministically jitters cell (cx, cy)'s feature point
+// within that cell, seeded so the same cell always yields the same point no
+// matter which neighboring cell asks or in what order.
+func (g *Generator) featurePoint(cx, cy int32) (float32, float32) {
+	r := rand.New(rand.NewSource(g.seed ^ int64(cx)<<32 ^ int64(uint32(cy))))
+	return (float32(cx) + r.Float32()) * cellSize, (float32(cy) + r.Float32()) * cellSize
+}
+
+func clampToByte(f float32) byte {
+	if f < 0 {
+		return 0
+	}
+	if f > 255 {
+		return 255
+	}
+	return byte(f)
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/terrain/compressed"
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// prefetchTerrain hints compressed.Terrain.Prefetch for every active
+// entity's position, so chunks around boats are generated by
+// StartWorkers' background goroutines before a gameplay goroutine's next
+// At/AtPos/Collides call for that area would otherwise have blocked on
+// generateChunk. Called from leaderboardTicker, the same cadence Repair
+// already runs terrain maintenance on. A no-op unless the Hub's terrain is
+// a *compressed.Terrain (see ServeMap, SnapshotTerrain for the same
+// type-assertion convention).
+func (h *Hub) prefetchTerrain() {
+	ct, ok := h.terrain.(*compressed.Terrain)
+	if !ok {
+		return
+	}
+
+	h.world.ForEntities(func(entity *world.Entity) (stop, remove bool) {
+		ct.Prefetch(entity.Position, terrainPrefetchRadius)
+		return
+	})
+}
+
+// sendTerrain returns the terrain.Data for aabb to put in p's next Update: a
+// tile-hash delta (see compressed.Terrain.AtDelta) against p.TerrainHashes,
+// or a full resend when force is set (e.g. shouldForceSendTerrain) or p has
+// no baseline yet - either of which also (re)establishes that baseline, via
+// ClientTileHashes.Reset, for future delta calls. Falls back to a plain At()
+// for any terrain.Terrain that isn't a *compressed.Terrain.
+func (h *Hub) sendTerrain(p *Player, aabb world.AABB, force bool) *terrain.Data {
+	ct, ok := h.terrain.(*compressed.Terrain)
+	if !ok {
+		return h.terrain.At(aabb)
+	}
+
+	if p.TerrainHashes == nil {
+		p.TerrainHashes = compressed.NewClientTileHashes()
+	}
+	if force {
+		p.TerrainHashes.Reset()
+	}
+
+	return ct.AtDelta(aabb, p.TerrainHashes)
+}
+
+// TerrainStats returns compressed.Terrain's hit/miss/prefetch/eviction
+// counters, or the zero value if the Hub's terrain isn't a
+// *compressed.Terrain. Meant for a Cloud implementation (e.g. Prometheus,
+// via GaugeFunc) to poll, rather than being pushed on every change.
+func (h *Hub) TerrainStats() compressed.TerrainStats {
+	ct, ok := h.terrain.(*compressed.Terrain)
+	if !ok {
+		return compressed.TerrainStats{}
+	}
+	return ct.Stats()
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// TestTopKMatchesFullRebuild fuzzes world.TopK against topPlayersHeap's full
+// rebuild over random add/update/remove sequences, checking after every edit
+// that the incremental result still matches a from-scratch one. This test
+// needs direct access to the unexported topPlayersHeap defined alongside
+// Hub.Leaderboard in leaderboard.go, so - unlike the stale `package main`
+// still declared by leaderboard_test.go and jsoniter_test.go - it declares
+// `package server` to match what leaderboard.go actually is.
+func TestTopKMatchesFullRebuild(t *testing.T) {
+	const k = 10
+	const iterations = 2000
+
+	random := rand.New(rand.NewSource(1))
+	topK := world.NewTopK(k)
+	live := make(map[world.PlayerID]*world.Player)
+	nextName := 0
+
+	checkMatches := func() {
+		t.Helper()
+
+		playerSet := make(world.PlayerSet, 0, len(live))
+		for _, p := range live {
+			playerSet = append(playerSet, p)
+		}
+		want := topPlayersHeap(playerSet, k)
+		got := topK.Snapshot(nil)
+
+		if len(got) != len(want) {
+			t.Fatalf("length mismatch: got %d, want %d", len(got), len(want))
+		}
+		for i := range want {
+			if got[i].PlayerData != want[i] {
+				t.Fatalf("entry %d mismatch: got %+v, want %+v", i, got[i].PlayerData, want[i])
+			}
+		}
+	}
+
+	for i := 0; i < iterations; i++ {
+		switch random.Intn(3) {
+		case 0: // a new player joins
+			p := &world.Player{PlayerData: world.PlayerData{
+				Name:  "p" + strconv.Itoa(nextName),
+				Score: random.Intn(1000),
+			}}
+			nextName++
+			live[p.PlayerID()] = p
+			topK.Update(p.PlayerID(), p.PlayerData)
+		case 1: // an existing player's score changes
+			for id, p := range live {
+				p.Score = random.Intn(1000)
+				topK.Update(id, p.PlayerData)
+				break
+			}
+		case 2: // a player disconnects/dies
+			for id := range live {
+				delete(live, id)
+				topK.Remove(id)
+				break
+			}
+		}
+		checkMatches()
+	}
+}
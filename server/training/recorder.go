@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package training records a reproducible ML-training dataset from headless
+// bots: a raw-channel binary frame per tick (see server.Rasterize) paired
+// with the bot's chosen action and the reward signals that followed it.
+// It deliberately doesn't import server (HubOptions.TrainingRecorder holds
+// a *Recorder the other way around, which would cycle), so Action/Reward
+// are plain structs rather than server.Manual/server.Contact themselves.
+package training
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const defaultShardSize = 10000
+
+type (
+	// Action is the subset of a Manual command worth logging alongside the
+	// frame that produced it.
+	Action struct {
+		VelocityTarget  float32 // m/s
+		DirectionTarget float32 // radians
+		TurretTarget    float32 // radians, relative to the ship; 0 if no turret
+		Fire            bool
+	}
+
+	// Reward summarizes the outcome of the tick a Frame was recorded for.
+	Reward struct {
+		DamageDealt float32
+		DamageTaken float32
+		ScoreDelta  int
+		Died        bool
+	}
+
+	// Recorder writes frames and their accompanying CSV rows into shard
+	// subdirectories of at most shardSize frames each, so no single
+	// directory grows unbounded over a long recording session.
+	Recorder struct {
+		dir       string
+		shardSize int
+
+		shardIndex int
+		frameIndex int
+		csvFile    *os.File
+		csvWriter  *csv.Writer
+	}
+)
+
+// NewRecorder creates dir (and any missing parents) and opens its first
+// shard. shardSize <= 0 defaults to defaultShardSize.
+func NewRecorder(dir string, shardSize int) (*Recorder, error) {
+	if shardSize <= 0 {
+		shardSize = defaultShardSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &Recorder{dir: dir, shardSize: shardSize}
+	if err := r.openShard(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) shardDir() string {
+	return filepath.Join(r.dir, fmt.Sprintf("shard-%04d", r.shardIndex))
+}
+
+func (r *Recorder) openShard() error {
+	if err := os.MkdirAll(r.shardDir(), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(r.shardDir(), "log.csv"), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	r.csvFile = f
+	r.csvWriter = csv.NewWriter(f)
+	return nil
+}
+
+// Record writes frame as a raw binary file in the current shard, appends a
+// CSV row of action/reward plus the frame's filename, and rotates to a
+// fresh shard once shardSize frames have accumulated in this one.
+func (r *Recorder) Record(frame []byte, action Action, reward Reward) error {
+	frameName := fmt.Sprintf("frame-%06d.bin", r.frameIndex)
+	if err := os.WriteFile(filepath.Join(r.shardDir(), frameName), frame, 0644); err != nil {
+		return err
+	}
+
+	fire, died := 0, 0
+	if action.Fire {
+		fire = 1
+	}
+	if reward.Died {
+		died = 1
+	}
+	row := []string{
+		frameName,
+		strconv.FormatFloat(float64(action.VelocityTarget), 'f', 2, 32),
+		strconv.FormatFloat(float64(action.DirectionTarget), 'f', 4, 32),
+		strconv.FormatFloat(float64(action.TurretTarget), 'f', 4, 32),
+		strconv.Itoa(fire),
+		strconv.FormatFloat(float64(reward.DamageDealt), 'f', 2, 32),
+		strconv.FormatFloat(float64(reward.DamageTaken), 'f', 2, 32),
+		strconv.Itoa(reward.ScoreDelta),
+		strconv.Itoa(died),
+	}
+	if err := r.csvWriter.Write(row); err != nil {
+		return err
+	}
+	r.csvWriter.Flush()
+	if err := r.csvWriter.Error(); err != nil {
+		return err
+	}
+
+	r.frameIndex++
+	if r.frameIndex >= r.shardSize {
+		return r.rotate()
+	}
+	return nil
+}
+
+func (r *Recorder) rotate() error {
+	if err := r.csvFile.Close(); err != nil {
+		return err
+	}
+	r.shardIndex++
+	r.frameIndex = 0
+	return r.openShard()
+}
+
+// Flush closes the current shard's CSV file so a clean shutdown doesn't
+// lose buffered rows. The Recorder must not be used afterward.
+func (r *Recorder) Flush() error {
+	return r.csvFile.Close()
+}
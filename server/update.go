@@ -72,6 +72,7 @@ func (h *Hub) Update() {
 	// chats have been sent, reset the buffer
 	// Cannot reuse slice because would cause data race
 	h.chats = nil
+	h.broadcasts = nil
 	for _, team := range h.teams {
 		team.Chats = nil
 	}
@@ -79,18 +80,61 @@ func (h *Hub) Update() {
 	h.updateCounter++
 }
 
+// filterChats drops any player-authored Chat whose sender Name is in muted
+// (see Player.Muted, set by /mute), and drops System Chats entirely if
+// hideSystem is set (see Player.HideSystemChat). Returns chats unmodified
+// in the common case (no muting, system chat not hidden) rather than
+// allocating a copy.
+func filterChats(chats []Chat, muted map[string]bool, hideSystem bool) []Chat {
+	if len(muted) == 0 && !hideSystem {
+		return chats
+	}
+
+	filtered := chats[:0:0]
+	for _, chat := range chats {
+		if chat.System {
+			if !hideSystem {
+				filtered = append(filtered, chat)
+			}
+		} else if !muted[chat.Name] {
+			filtered = append(filtered, chat)
+		}
+	}
+	return filtered
+}
+
 // Sends an Update to a Client containing contacts, chat, and team info.
 // Can be safely called concurrently once per client/player.
 func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 	update := NewUpdate()
 	p := &client.Data().Player
 	player := &p.Player
+	forceSendContacts := h.shouldForceSendContacts(client)
 
 	update.EntityID = player.EntityID
 	update.PlayerID = player.PlayerID()
 	update.DeathReason = player.DeathReason
 	update.WorldRadius = h.worldRadius
-	update.Chats = h.chats
+	update.Chats = filterChats(h.chats, p.Muted, p.HideSystemChat)
+
+	// Drain any Hub.Broadcast calls whose filter matches this player. Skipped
+	// entirely for a client nothing renders (see Client.WantsSystemMessages)
+	// so bots/replay don't pay to evaluate every pending filter every tick.
+	if !p.HideSystemChat && client.WantsSystemMessages() && len(h.broadcasts) > 0 {
+		// filterChats returns h.chats itself, unmodified, in the common case
+		// (no muting, system chat not hidden) - updateClient runs
+		// concurrently per client (see Hub.Update), so appending to
+		// update.Chats in place here would race other clients reading that
+		// same shared slice. Copy first.
+		merged := make([]Chat, len(update.Chats), len(update.Chats)+len(h.broadcasts))
+		copy(merged, update.Chats)
+		for _, b := range h.broadcasts {
+			if b.filter == nil || b.filter(p) {
+				merged = append(merged, b.chat)
+			}
+		}
+		update.Chats = merged
+	}
 
 	h.world.EntityByID(player.EntityID, func(ship *world.Entity) (_ bool) {
 		var visualRange float32
@@ -99,12 +143,16 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 		var position world.Vec2f
 		var active bool
 		var absVel float32
+		var shipData *world.EntityTypeData
+		var shipDirection world.Angle
 
 		if ship == nil {
 			active = true
 			position, visualRange, radarRange, sonarRange = p.Camera()
 		} else {
 			active = ship.Active()
+			shipData = ship.Data()
+			shipDirection = ship.Direction
 
 			absVel = math32.Abs(ship.Velocity.Float())
 			position, visualRange, radarRange, sonarRange = ship.Camera()
@@ -128,16 +176,23 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 			// uncertainty is the amount of error of the sensor
 			var uncertainty float32
 
+			// Bearing of the contact relative to the viewing ship's own
+			// Direction, used to limit detection to each sensor's azimuth arc.
+			var bearing world.Angle
+			if shipData != nil {
+				bearing = entity.Position.Sub(position).Angle() - shipDirection
+			}
+
 			if !known {
 				invSize := data.InvSize // cached 1.0 / min(1, data.Radius*(1.0/50.0)*(1-data.Stealth))
 				defaultRatio := distanceSquared * invSize
 				uncertainty = 1.0
 				contactAbsVel := math32.Abs(entity.Velocity.Float())
 
-				if radarRangeInv != 0 && alt >= -0.1 {
+				if radarRangeInv != 0 && alt >= -0.1 && (shipData == nil || shipData.Sensors.Radar.InArc(bearing)) {
 					radarRatio := defaultRatio * radarRangeInv
 
-					if active {
+					if active && (shipData == nil || shipData.Sensors.Radar.Mode.CanEmit()) {
 						// Active radar can see moving targets easier
 						uncertainty = min(uncertainty, radarRatio*15/(15+contactAbsVel))
 					}
@@ -146,7 +201,7 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 					emission := float32(5)
 					if data.Kind == world.EntityKindBoat {
 						emission += 5
-						if entity.Active() && data.Sensors.Radar.Range > 0 {
+						if entity.Active() && data.Sensors.Radar.Mode.CanEmit() && data.Sensors.Radar.Range > 0 {
 							// Active radar gives away entity's position
 							emission += 20
 						}
@@ -159,9 +214,9 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 					uncertainty = min(uncertainty, radarRatio)
 				}
 
-				if sonarRangeInv != 0 && alt <= 0 {
+				if sonarRangeInv != 0 && alt <= 0 && (shipData == nil || shipData.Sensors.Sonar.InArc(bearing)) {
 					sonarRatio := defaultRatio * sonarRangeInv
-					if active {
+					if active && (shipData == nil || shipData.Sensors.Sonar.Mode.CanEmit()) {
 						// Active sonar
 						uncertainty = min(uncertainty, sonarRatio)
 					}
@@ -173,7 +228,7 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 
 						if data.Kind != world.EntityKindBoat {
 							noise += 100
-						} else if entity.Active() && data.Sensors.Sonar.Range > 0 {
+						} else if entity.Active() && data.Sensors.Sonar.Mode.CanEmit() && data.Sensors.Sonar.Range > 0 {
 							// Active sonar gives away entity's position
 							noise += 20
 						}
@@ -255,6 +310,32 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 			return
 		})
 
+		// Stitch in entities from a neighboring shard near this one's
+		// border (see border_contacts.go), so a player near h.shardBounds
+		// still sees what's on the other side instead of a wall of nothing.
+		if router := h.router; router != nil {
+			for _, bc := range router.neighborBorderContacts(h) {
+				if bc.Position.DistanceSquared(position) > maxRange*maxRange {
+					continue
+				}
+
+				if contacts := update.Contacts; len(contacts) == cap(contacts) {
+					update.Contacts = append(contacts, IDContact{})[:len(contacts)]
+				}
+				n := len(update.Contacts)
+				update.Contacts = update.Contacts[:n+1]
+				c := &update.Contacts[n]
+
+				c.EntityID = bc.EntityID
+				c.Transform = bc.Transform
+				c.EntityType = bc.EntityType
+				c.Damage = bc.DamagePercent
+				c.IDPlayerData = bc.IDPlayerData
+				c.Friendly = bc.TeamID != world.TeamIDInvalid && bc.TeamID == player.TeamID
+				c.Uncertainty = 0
+			}
+		}
+
 		// Bot client doesn't need terrain data
 		if _, ok := client.(*BotClient); !ok {
 			terrainPos := position.Sub(world.Vec2f{X: visualRange, Y: visualRange})
@@ -263,15 +344,44 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 			// If terrain changed
 			if clamped := h.terrain.Clamp(aabb); p.TerrainArea != clamped || forceSendTerrain {
 				p.TerrainArea = clamped
-				update.Terrain = h.terrain.At(aabb)
+				update.Terrain = h.sendTerrain(p, aabb, forceSendTerrain)
 			}
 		}
 
 		return
 	})
 
+	// If this client's negotiated Codec supports it, replace the just-built
+	// full update.Contacts with a delta against contactsCache (see
+	// diffContacts in contacts_delta.go) - except on the periodic
+	// contactsFullPeriod resync, where the full Contacts is kept and the
+	// cache is (re)started fresh, bounding how long a client can drift if
+	// it ever misses an Update.
+	if socketClient, ok := client.(*SocketClient); ok && socketClient.codec.SupportsContactsDelta() {
+		if socketClient.contactsCache != nil && !forceSendContacts {
+			added, updated, removed := diffContacts(socketClient.contactsCache, update.Contacts)
+			updateContactsCache(socketClient.contactsCache, added, updated, removed)
+			update.ContactsAdded = append(update.ContactsAdded, added...)
+			update.ContactsUpdated = append(update.ContactsUpdated, updated...)
+			update.ContactsRemoved = append(update.ContactsRemoved, removed...)
+			update.Contacts = update.Contacts[:0]
+		} else {
+			if socketClient.contactsCache == nil {
+				socketClient.contactsCache = make(map[world.EntityID]Contact, poolContactsCap)
+			} else {
+				for id := range socketClient.contactsCache {
+					delete(socketClient.contactsCache, id)
+				}
+			}
+			for _, c := range update.Contacts {
+				socketClient.contactsCache[c.EntityID] = c.Contact
+			}
+			update.ContactsFull = true
+		}
+	}
+
 	if team := h.teams[player.TeamID]; team != nil {
-		update.TeamChats = team.Chats
+		update.TeamChats = filterChats(team.Chats, p.Muted, p.HideSystemChat)
 		update.TeamMembers = team.Members.AppendData(update.TeamMembers)
 
 		// Only team owner gets the requests
@@ -281,6 +391,8 @@ func (h *Hub) updateClient(client Client, forceSendTerrain bool) {
 		}
 	}
 
+	h.captureOutboundUpdate(player.PlayerID(), update)
+
 	// Client pools update when its done with it
 	client.Send(update)
 }
@@ -0,0 +1,331 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// updateBinaryTag marks an Update encoded by marshalUpdateBinary rather
+// than registerBinaryType's generic fixed-field scheme (which Update can
+// never qualify for - Chats/Terrain alone rule it out) or the tag-0 JSON
+// fallback every other irregular type still uses. It's a fixed sentinel
+// rather than one handed out by registerBinaryType's nextBinaryTag counter,
+// since Update is never passed through registerBinaryType's qualifying
+// scan at all (see marshalUpdateBinary's own call site in
+// Message.MarshalBinary).
+const updateBinaryTag = 0xff
+
+// marshalUpdateBinary is Update's counterpart to jsoniter.go's
+// encodeUpdateContacts: Contacts is the dominant cost of an Update (every
+// visible ship, turret and projectile, every tick), so it gets a
+// hand-written compact encoding here, while the rest of Update - Chats,
+// TeamMembers, Terrain, and the other fields that are either rare, small,
+// or already reference-pooled - keeps going through the existing JSON
+// path. Framed as [tag][4-byte JSON rest length][JSON rest][1-byte
+// ContactsFull][2-byte contact count][contact, contact, ...][2-byte added
+// count][contact, ...][2-byte updated count][contact, ...][2-byte removed
+// count][EntityID, ...].
+//
+// Temporarily nils update.Contacts/ContactsAdded/ContactsUpdated/
+// ContactsRemoved to marshal the "rest" of Update via the normal
+// json.Marshal path (all four have `omitempty`, so nil is simply absent
+// from that JSON rather than costing a "contacts":[] or "contacts":null).
+// Safe because a given *Update is only ever touched by one goroutine at a
+// time - the client's own writePump, which called codec.Encode
+// synchronously (see SocketClient.writeOne) - never concurrently with
+// whatever built it.
+func marshalUpdateBinary(update *Update) ([]byte, error) {
+	contacts := update.Contacts
+	added := update.ContactsAdded
+	updated := update.ContactsUpdated
+	removed := update.ContactsRemoved
+	update.Contacts = nil
+	update.ContactsAdded = nil
+	update.ContactsUpdated = nil
+	update.ContactsRemoved = nil
+	rest, err := json.Marshal(update)
+	update.Contacts = contacts
+	update.ContactsAdded = added
+	update.ContactsUpdated = updated
+	update.ContactsRemoved = removed
+	if err != nil {
+		return nil, err
+	}
+
+	size := 1 + 4 + len(rest) + 1 + 2 + len(contacts)*32 + 2 + len(added)*32 + 2 + len(updated)*32 + 2 + len(removed)*4
+	buf := make([]byte, 0, size)
+	buf = append(buf, updateBinaryTag)
+	buf = appendUint32(buf, uint32(len(rest)))
+	buf = append(buf, rest...)
+	if update.ContactsFull {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = appendUint16(buf, uint16(len(contacts)))
+	for i := range contacts {
+		buf = appendIDContact(buf, &contacts[i])
+	}
+	buf = appendUint16(buf, uint16(len(added)))
+	for i := range added {
+		buf = appendIDContact(buf, &added[i])
+	}
+	buf = appendUint16(buf, uint16(len(updated)))
+	for i := range updated {
+		buf = appendIDContact(buf, &updated[i])
+	}
+	buf = appendUint16(buf, uint16(len(removed)))
+	for _, id := range removed {
+		buf = appendUint32(buf, uint32(id))
+	}
+	return buf, nil
+}
+
+// appendIDContact appends c in the fixed-plus-armament/turret-derived
+// layout WriteSnapshot uses for Entity (see world/binary_snapshot.go):
+// ArmamentConsumption/TurretAngles aren't length-prefixed on the wire,
+// since their length is already implied by EntityType (world.EntityType.
+// Data().Armaments/.Turrets) and every Contact is built with slices that
+// length, the same invariant the world snapshot codec relies on.
+func appendIDContact(buf []byte, c *IDContact) []byte {
+	buf = appendUint32(buf, uint32(c.EntityID))
+	buf = append(buf, uint8(c.EntityType))
+	if c.Friendly {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+
+	buf = appendFloat32(buf, c.Position.X)
+	buf = appendFloat32(buf, c.Position.Y)
+	buf = appendUint16(buf, uint16(c.Velocity))
+	buf = appendUint16(buf, uint16(c.Direction))
+
+	buf = appendUint16(buf, uint16(c.DirectionTarget))
+	buf = appendFloat32(buf, c.VelocityTarget)
+
+	for _, consumption := range c.ArmamentConsumption {
+		buf = appendFloat32(buf, consumption)
+	}
+	for _, angle := range c.TurretAngles {
+		buf = appendUint16(buf, uint16(angle))
+	}
+
+	buf = appendFloat32(buf, c.Altitude)
+	buf = appendFloat32(buf, c.Damage)
+	buf = appendFloat32(buf, c.Uncertainty)
+
+	// PlayerID is a uintptr in world/player.go (an internal slot index,
+	// not a wire type), but well within uint32 range in practice - the
+	// same truncation jsoniter.go's encodePlayerID avoids only by
+	// formatting as hex text instead, which isn't worth the extra bytes
+	// here.
+	buf = appendUint32(buf, uint32(c.PlayerID))
+	buf = appendUint64(buf, uint64(c.TeamID))
+	// A player's Score fits comfortably in an int32; see world.PlayerData.
+	buf = appendUint32(buf, uint32(int32(c.Score)))
+	buf = append(buf, uint8(len(c.Name)))
+	buf = append(buf, c.Name...)
+
+	return buf
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendFloat32(buf []byte, v float32) []byte {
+	return appendUint32(buf, math.Float32bits(v))
+}
+
+// unmarshalUpdateBinary reverses marshalUpdateBinary. Nothing in this
+// server decodes its own Outbound traffic in production (a client does
+// that), but it's kept symmetric with marshalUpdateBinary - and tested
+// against it in update_binary_test.go - the same way the rest of this
+// codec round-trips (see TestOutboundCodecRoundTrip).
+func unmarshalUpdateBinary(data []byte) (*Update, error) {
+	if len(data) < 1+4 {
+		return nil, fmt.Errorf("update_binary: truncated header")
+	}
+	restLen := binary.LittleEndian.Uint32(data[1:5])
+	pos := 5 + int(restLen)
+	if pos > len(data) {
+		return nil, fmt.Errorf("update_binary: truncated rest")
+	}
+
+	var update Update
+	if err := json.Unmarshal(data[5:pos], &update); err != nil {
+		return nil, err
+	}
+
+	if len(data)-pos < 1 {
+		return nil, fmt.Errorf("update_binary: truncated contacts-full flag")
+	}
+	update.ContactsFull = data[pos] != 0
+	pos++
+
+	var err error
+	update.Contacts, pos, err = readIDContacts(data, pos)
+	if err != nil {
+		return nil, err
+	}
+	update.ContactsAdded, pos, err = readIDContacts(data, pos)
+	if err != nil {
+		return nil, err
+	}
+	update.ContactsUpdated, pos, err = readIDContacts(data, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data)-pos < 2 {
+		return nil, fmt.Errorf("update_binary: truncated removed count")
+	}
+	removedCount := binary.LittleEndian.Uint16(data[pos : pos+2])
+	pos += 2
+	if removedCount > 0 {
+		update.ContactsRemoved = make([]world.EntityID, removedCount)
+		for i := range update.ContactsRemoved {
+			if len(data)-pos < 4 {
+				return nil, fmt.Errorf("update_binary: truncated removed entity id")
+			}
+			update.ContactsRemoved[i] = world.EntityID(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+		}
+	}
+
+	return &update, nil
+}
+
+// readIDContacts decodes a [2-byte count][contact, contact, ...] run, the
+// shape marshalUpdateBinary writes for each of Contacts/ContactsAdded/
+// ContactsUpdated.
+func readIDContacts(data []byte, pos int) ([]IDContact, int, error) {
+	if len(data)-pos < 2 {
+		return nil, 0, fmt.Errorf("update_binary: truncated contact count")
+	}
+	count := binary.LittleEndian.Uint16(data[pos : pos+2])
+	pos += 2
+
+	if count == 0 {
+		return nil, pos, nil
+	}
+
+	contacts := make([]IDContact, count)
+	for i := range contacts {
+		var err error
+		pos, err = readIDContact(&contacts[i], data, pos)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return contacts, pos, nil
+}
+
+// readIDContact decodes one appendIDContact record from data starting at
+// pos, returning the position just past it.
+func readIDContact(c *IDContact, data []byte, pos int) (int, error) {
+	const fixedLen = 4 + 1 + 1 + 4 + 4 + 2 + 2 + 2 + 4
+	if len(data)-pos < fixedLen {
+		return 0, fmt.Errorf("update_binary: truncated contact")
+	}
+
+	c.EntityID = world.EntityID(binary.LittleEndian.Uint32(data[pos:]))
+	pos += 4
+	c.EntityType = world.EntityType(data[pos])
+	pos++
+	c.Friendly = data[pos] != 0
+	pos++
+
+	c.Position.X = readFloat32(data[pos:])
+	pos += 4
+	c.Position.Y = readFloat32(data[pos:])
+	pos += 4
+	c.Velocity = world.Velocity(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	c.Direction = world.Angle(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+
+	c.DirectionTarget = world.Angle(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	c.VelocityTarget = readFloat32(data[pos:])
+	pos += 4
+
+	entityData := c.EntityType.Data()
+
+	armamentsLen := 4 * len(entityData.Armaments)
+	if len(data)-pos < armamentsLen {
+		return 0, fmt.Errorf("update_binary: truncated armament consumption")
+	}
+	if len(entityData.Armaments) > 0 {
+		c.ArmamentConsumption = make([]float32, len(entityData.Armaments))
+		for i := range c.ArmamentConsumption {
+			c.ArmamentConsumption[i] = readFloat32(data[pos:])
+			pos += 4
+		}
+	}
+
+	turretsLen := 2 * len(entityData.Turrets)
+	if len(data)-pos < turretsLen {
+		return 0, fmt.Errorf("update_binary: truncated turret angles")
+	}
+	if len(entityData.Turrets) > 0 {
+		c.TurretAngles = make([]world.Angle, len(entityData.Turrets))
+		for i := range c.TurretAngles {
+			c.TurretAngles[i] = world.Angle(binary.LittleEndian.Uint16(data[pos:]))
+			pos += 2
+		}
+	}
+
+	if len(data)-pos < 4+4+4+4+8+4+1 {
+		return 0, fmt.Errorf("update_binary: truncated contact tail")
+	}
+	c.Altitude = readFloat32(data[pos:])
+	pos += 4
+	c.Damage = readFloat32(data[pos:])
+	pos += 4
+	c.Uncertainty = readFloat32(data[pos:])
+	pos += 4
+
+	c.PlayerID = world.PlayerID(binary.LittleEndian.Uint32(data[pos:]))
+	pos += 4
+	c.TeamID = world.TeamID(binary.LittleEndian.Uint64(data[pos:]))
+	pos += 8
+	c.Score = int(int32(binary.LittleEndian.Uint32(data[pos:])))
+	pos += 4
+
+	nameLen := int(data[pos])
+	pos++
+	if len(data)-pos < nameLen {
+		return 0, fmt.Errorf("update_binary: truncated name")
+	}
+	c.Name = string(data[pos : pos+nameLen])
+	pos += nameLen
+
+	return pos, nil
+}
+
+func readFloat32(b []byte) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
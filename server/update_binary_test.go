@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SoftbearStudios/mk48/server/world"
+)
+
+// TestUpdateBinaryRoundTrip proves marshalUpdateBinary/unmarshalUpdateBinary
+// round-trip an Update exactly, the same guarantee
+// TestOutboundCodecRoundTrip gives every other Outbound - crate has no
+// armaments or turrets, so its Contact needs no ArmamentConsumption/
+// TurretAngles to satisfy appendIDContact's length invariant (see
+// readIDContact). Update.PlayerID/EntityID are left at their Invalid zero
+// values deliberately: jsoniter registers JSON encoders but not decoders
+// for world.PlayerID/world.EntityID (see jsoniter.go), so a non-zero value
+// here would encode fine but fail to decode; omitempty plus the registered
+// emptyPlayerID/emptyEntityID checks omit them from the "rest" JSON
+// entirely at the zero value, sidestepping the gap.
+func TestUpdateBinaryRoundTrip(t *testing.T) {
+	update := &Update{
+		WorldRadius: 1000,
+		Contacts: []IDContact{
+			{
+				Contact: Contact{
+					Guidance: world.Guidance{DirectionTarget: 123, VelocityTarget: 5},
+					IDPlayerData: world.IDPlayerData{
+						PlayerData: world.PlayerData{Name: "Alice", Score: 99, TeamID: 0},
+						PlayerID:   3,
+					},
+					Transform:   world.Transform{Position: world.Vec2f{X: 1.5, Y: -2.5}, Velocity: 6, Direction: 321},
+					Friendly:    true,
+					EntityType:  world.EntityTypeCrate,
+					Altitude:    10,
+					Damage:      20,
+					Uncertainty: 30,
+				},
+				EntityID: 55,
+			},
+		},
+	}
+
+	encoded, err := marshalUpdateBinary(update)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if encoded[0] != updateBinaryTag {
+		t.Fatalf("expected tag %d, got %d", updateBinaryTag, encoded[0])
+	}
+
+	decoded, err := unmarshalUpdateBinary(encoded)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if !reflect.DeepEqual(update, decoded) {
+		t.Errorf("round trip changed value: want %#v got %#v", update, decoded)
+	}
+}
+
+// TestUpdateBinaryRoundTripContactsDelta proves marshalUpdateBinary/
+// unmarshalUpdateBinary round-trip ContactsAdded/ContactsUpdated/
+// ContactsRemoved/ContactsFull the same way TestUpdateBinaryRoundTrip
+// proves it for Contacts - these are Contacts' delta-compressed
+// alternative (see diffContacts in contacts_delta.go) and must not fall
+// back to the slower JSON "rest" path on delta ticks.
+func TestUpdateBinaryRoundTripContactsDelta(t *testing.T) {
+	update := &Update{
+		WorldRadius: 1000,
+		ContactsAdded: []IDContact{
+			{Contact: Contact{EntityType: world.EntityTypeCrate, Uncertainty: 1}, EntityID: 1},
+		},
+		ContactsUpdated: []IDContact{
+			{Contact: Contact{EntityType: world.EntityTypeCrate, Uncertainty: 0.5}, EntityID: 2},
+		},
+		ContactsRemoved: []world.EntityID{3, 4},
+	}
+
+	encoded, err := marshalUpdateBinary(update)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	decoded, err := unmarshalUpdateBinary(encoded)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if !reflect.DeepEqual(update, decoded) {
+		t.Errorf("round trip changed value: want %#v got %#v", update, decoded)
+	}
+}
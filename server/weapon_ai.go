@@ -0,0 +1,280 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"github.com/SoftbearStudios/mk48/server/world"
+	"github.com/chewxy/math32"
+)
+
+// weaponCone is how wide of an azimuth difference (from dead on target) a
+// subkind of weapon is still allowed to fire at, and how close/far its
+// target needs to be relative to the weapon's own effective range.
+type weaponCone struct {
+	halfWidth      world.Angle // max allowed angle diff, Pi means any angle
+	minRangeFactor float32     // target must be at least this fraction of effective range away
+	maxRangeFactor float32     // target must be at most this fraction of effective range away
+}
+
+var weaponCones = map[world.EntitySubKind]weaponCone{
+	// Shells are direct-fire and go ballistic at range, so keep the cone tight.
+	world.EntitySubKindShell: {halfWidth: world.ToAngle(math32.Pi / 12), minRangeFactor: 0, maxRangeFactor: 0.9},
+	// Rockets and missiles are guided/vertical-launch, so azimuth barely matters.
+	world.EntitySubKindRocket:  {halfWidth: world.Pi, minRangeFactor: 0, maxRangeFactor: 1},
+	world.EntitySubKindMissile: {halfWidth: world.Pi, minRangeFactor: 0, maxRangeFactor: 1},
+	// Torpedoes are somewhat guided but shouldn't be dumped point blank on a
+	// rammer that's already closing.
+	world.EntitySubKindTorpedo: {halfWidth: world.ToAngle(math32.Pi / 3), minRangeFactor: 0.15, maxRangeFactor: 1},
+	// Depth charges are dropped, not aimed, so only range matters.
+	world.EntitySubKindDepthCharge: {halfWidth: world.Pi, minRangeFactor: 0, maxRangeFactor: 0.5},
+	// SAMs are vertical-launch and only useful against airborne threats.
+	world.EntitySubKindSAM: {halfWidth: world.Pi, minRangeFactor: 0, maxRangeFactor: 1},
+}
+
+// effectiveRange estimates how far a projectile EntityType can reach, since
+// EntityTypeData has no explicit range field: lifespan (seconds) times speed
+// (meters/second) is how far it travels before expiring.
+func effectiveRange(entityType world.EntityType) float32 {
+	data := entityType.Data()
+	return data.Lifespan.Float() * data.Speed.Float()
+}
+
+// goodWeaponTarget reports whether an armament of the given subkind makes sense to
+// use against a contact of the given subkind/kind.
+func goodWeaponTarget(weaponSubkind world.EntitySubKind, target *Contact) bool {
+	targetData := target.EntityType.Data()
+
+	switch weaponSubkind {
+	case world.EntitySubKindSAM:
+		// Only worth firing at things that fly.
+		return targetData.SubKind == world.EntitySubKindAircraft || targetData.SubKind == world.EntitySubKindMissile
+	case world.EntitySubKindTorpedo, world.EntitySubKindDepthCharge:
+		// Best against submarines, but still usable against surface boats.
+		return targetData.Kind == world.EntityKindBoat
+	case world.EntitySubKindShell, world.EntitySubKindRocket:
+		// Surface fire; submerged submarines are out of reach.
+		return targetData.Kind == world.EntityKindBoat && targetData.SubKind != world.EntitySubKindSubmarine
+	default:
+		return targetData.Kind == world.EntityKindBoat
+	}
+}
+
+// selectArmament picks the armament on ship to fire at target: among ready
+// weapons whose subkind suits the target (see goodWeaponTarget, e.g. SAMs
+// only at aircraft/missiles, shells/rockets not at submarines) and whose
+// range band and firing cone (see weaponCones) admit it, the one with the
+// smallest aim angle diff, vertical launchers counting as 0. It returns -1
+// if nothing is usable right now (on cooldown, wrong subkind for the
+// target, out of its range band, or outside its firing cone).
+func selectArmament(ship *Contact, target *Contact) (index int, aim world.Vec2f) {
+	index = -1
+
+	shipData := ship.EntityType.Data()
+	targetAngle := target.Position.Sub(ship.Position).Angle()
+	rangeSquared := ship.Position.DistanceSquared(target.Position)
+
+	bestScore := float32(math32.MaxFloat32)
+
+	for i := range shipData.Armaments {
+		armament := &shipData.Armaments[i]
+		if i >= len(ship.ArmamentConsumption) || ship.ArmamentConsumption[i] != 0 {
+			continue // reloading
+		}
+
+		armamentData := armament.Type.Data()
+		if armamentData.Kind != world.EntityKindWeapon {
+			continue
+		}
+
+		cone, ok := weaponCones[armamentData.SubKind]
+		if !ok || !goodWeaponTarget(armamentData.SubKind, target) {
+			continue
+		}
+
+		weaponRange := effectiveRange(armament.Type)
+		if rangeSquared < square(cone.minRangeFactor*weaponRange) || rangeSquared > square(cone.maxRangeFactor*weaponRange) {
+			continue
+		}
+
+		armamentTransform := world.ArmamentTransform(ship.EntityType, ship.Transform, ship.TurretAngles, i)
+		diff := targetAngle.Diff(armamentTransform.Direction).Abs()
+		if armament.Vertical {
+			diff = 0 // vertical launchers don't need to be aimed
+		}
+		if diff > cone.halfWidth.Float() {
+			continue
+		}
+
+		// Prefer the armament with the tightest angle diff among usable ones.
+		if diff < bestScore {
+			bestScore = diff
+			index = i
+		}
+	}
+
+	return index, target.Position
+}
+
+// selectArmamentBySubKind picks the first ready armament on ship of exactly
+// subKind, ignoring the range/cone checks selectArmament applies - a
+// script.Script's "aim_and_fire" rule already gates on distance itself (see
+// BotClient.Send), so this just answers "is one loaded at all".
+// It returns -1 if none is ready.
+func selectArmamentBySubKind(ship *Contact, subKind world.EntitySubKind) int {
+	shipData := ship.EntityType.Data()
+
+	for i := range shipData.Armaments {
+		armament := &shipData.Armaments[i]
+		if i >= len(ship.ArmamentConsumption) || ship.ArmamentConsumption[i] != 0 {
+			continue // reloading
+		}
+		if armament.Type.Data().SubKind == subKind {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// selectSAM picks a ready SAM armament on ship to fire at an airborne target
+// (aircraft/missile/rocket), leading the aim point by the target's estimated
+// time-to-intercept rather than firing straight at its current position. It
+// returns -1 if no SAM is ready or the target is out of range.
+func selectSAM(ship *Contact, target *Contact) (index int, aim world.Vec2f) {
+	index = -1
+
+	shipData := ship.EntityType.Data()
+	rangeSquared := ship.Position.DistanceSquared(target.Position)
+
+	for i := range shipData.Armaments {
+		armament := &shipData.Armaments[i]
+		if i >= len(ship.ArmamentConsumption) || ship.ArmamentConsumption[i] != 0 {
+			continue // reloading
+		}
+
+		armamentData := armament.Type.Data()
+		if armamentData.Kind != world.EntityKindWeapon || armamentData.SubKind != world.EntitySubKindSAM {
+			continue
+		}
+
+		if rangeSquared > square(effectiveRange(armament.Type)) {
+			continue
+		}
+
+		samSpeed := armamentData.Speed.Float()
+		tti := math32.Sqrt(rangeSquared) / samSpeed
+		aim = target.Position.AddScaled(target.Direction.Vec2f(), target.Velocity.Float()*tti)
+		return i, aim
+	}
+
+	return -1, world.Vec2f{}
+}
+
+// fireAutonomousTurret fires the first ready armament mounted on ship's
+// turretIndex, called right after Entity.UpdateTurretSensor reports that
+// turret locked onto a hostile. This gives oil platforms and capital ships
+// point-defense that fires on its own, without a BotClient driving the ship
+// the way selectArmament/selectSAM do for bots.
+func (h *Hub) fireAutonomousTurret(ship *world.Entity, turretIndex int) {
+	shipData := ship.Data()
+	consumption := ship.ArmamentConsumption()
+	angles := ship.TurretAngles()
+	turretData := &shipData.Turrets[turretIndex]
+
+	if !turretData.CheckAzimuth(angles[turretIndex]) {
+		return
+	}
+
+	for i := range shipData.Armaments {
+		armamentData := &shipData.Armaments[i]
+		if armamentData.TurretIndex() != turretIndex {
+			continue
+		}
+		if i >= len(consumption) || consumption[i] != 0 {
+			continue // reloading
+		}
+
+		transform := ship.ArmamentTransform(i)
+		armament := &world.Entity{
+			EntityType: armamentData.Type,
+			Owner:      ship.Owner,
+			Transform:  transform,
+			Guidance: world.Guidance{
+				DirectionTarget: transform.Direction,
+				VelocityTarget:  armamentData.Type.Data().Speed,
+			},
+		}
+
+		if h.spawnEntity(armament, 0) != world.EntityIDInvalid {
+			ship.ConsumeArmament(i)
+		}
+		return
+	}
+}
+
+// fireArmament spawns ship's index'th armament aimed at aim and marks it
+// consumed. It's the same minimal spawn fireAutonomousTurret uses, for
+// callers (like BotBoatController) that already picked an index via
+// selectArmament/selectSAM rather than driving a turret's own point-defense
+// check.
+func (h *Hub) fireArmament(ship *world.Entity, index int, aim world.Vec2f) bool {
+	shipData := ship.Data()
+	armamentData := &shipData.Armaments[index]
+	transform := ship.ArmamentTransform(index)
+
+	armament := &world.Entity{
+		EntityType: armamentData.Type,
+		Owner:      ship.Owner,
+		Transform:  transform,
+		Guidance: world.Guidance{
+			DirectionTarget: aim.Sub(transform.Position).Angle(),
+			VelocityTarget:  armamentData.Type.Data().Speed,
+		},
+	}
+
+	if h.spawnEntity(armament, 0) == world.EntityIDInvalid {
+		return false
+	}
+	ship.ConsumeArmament(index)
+	return true
+}
+
+// fireAtPosition picks the first ready non-SAM weapon on ship roughly aimed
+// at pos, for artillery bots firing at a squad-called position rather than a
+// sensed Contact (so selectArmament's per-subkind target compatibility
+// doesn't apply; any weapon in range and roughly aimed will do).
+func (bot *BotClient) fireAtPosition(ship *Contact, pos world.Vec2f) (index int, ok bool) {
+	shipData := ship.EntityType.Data()
+	targetAngle := pos.Sub(ship.Position).Angle()
+	rangeSquared := ship.Position.DistanceSquared(pos)
+
+	for i := range shipData.Armaments {
+		armament := &shipData.Armaments[i]
+		if i >= len(ship.ArmamentConsumption) || ship.ArmamentConsumption[i] != 0 {
+			continue // reloading
+		}
+
+		armamentData := armament.Type.Data()
+		if armamentData.Kind != world.EntityKindWeapon || armamentData.SubKind == world.EntitySubKindSAM {
+			continue
+		}
+
+		if rangeSquared > square(effectiveRange(armament.Type)) {
+			continue
+		}
+
+		armamentTransform := world.ArmamentTransform(ship.EntityType, ship.Transform, ship.TurretAngles, i)
+		diff := targetAngle.Diff(armamentTransform.Direction).Abs()
+		if armament.Vertical {
+			diff = 0
+		}
+		if diff > math32.Pi/3 {
+			continue
+		}
+
+		return i, true
+	}
+
+	return -1, false
+}
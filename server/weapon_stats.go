@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"fmt"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"os"
+	"time"
+)
+
+// weaponStatKey identifies one (attacker ship, attacker armament, victim
+// ship) bucket in Hub.weaponStats, in the spirit of the Xonotic WeaponStats
+// file format (see AppendWeaponStats). victimShip is EntityTypeInvalid for
+// recordWeaponFired, since a shot that hasn't hit anything has no victim
+// yet. attackerBot/victimBot let a post-processor exclude bot-vs-bot noise.
+type weaponStatKey struct {
+	attackerShip     world.EntityType
+	attackerArmament world.EntityType
+	victimShip       world.EntityType
+	attackerBot      bool
+	victimBot        bool
+}
+
+// weaponStatCounts accumulates one weaponStatKey's stats between
+// AppendWeaponStats calls.
+type weaponStatCounts struct {
+	fired  int
+	hit    int
+	kills  int
+	damage float32
+}
+
+// recordWeaponFired counts one armament launch (see Fire.Process), so
+// AppendWeaponStats can report fire rate even for shots that never hit
+// anything.
+func (h *Hub) recordWeaponFired(attackerShip, armament world.EntityType, attackerBot bool) {
+	h.weaponStat(weaponStatKey{
+		attackerShip:     attackerShip,
+		attackerArmament: armament,
+		victimShip:       world.EntityTypeInvalid,
+		attackerBot:      attackerBot,
+	}).fired++
+}
+
+// recordWeaponHit counts one armament's damage against a boat (see the
+// boat/weapon collision case in Physics), so AppendWeaponStats can report
+// hit rate, damage, and kills per ship/armament matchup.
+func (h *Hub) recordWeaponHit(attackerShip, armament, victimShip world.EntityType, attackerBot, victimBot bool, damage float32, killed bool) {
+	counts := h.weaponStat(weaponStatKey{
+		attackerShip:     attackerShip,
+		attackerArmament: armament,
+		victimShip:       victimShip,
+		attackerBot:      attackerBot,
+		victimBot:        victimBot,
+	})
+	counts.hit++
+	counts.damage += damage
+	if killed {
+		counts.kills++
+	}
+}
+
+// recordWeaponHitStats resolves the attacker's current ship type and both
+// players' bot/real status, then records the hit via recordWeaponHit.
+// Called from the boat/weapon collision case in Physics.
+func (h *Hub) recordWeaponHitStats(weapon, boat *world.Entity, damage float32, killed bool) {
+	attackerShip := world.EntityTypeInvalid
+	h.world.EntityByID(weapon.Owner.EntityID, func(attacker *world.Entity) (_ bool) {
+		if attacker != nil {
+			attackerShip = attacker.EntityType
+		}
+		return
+	})
+
+	attackerBot := true
+	if c := h.findClientByPlayerID(weapon.Owner.PlayerID()); c != nil {
+		attackerBot = c.Bot()
+	}
+	victimBot := true
+	if c := h.findClientByPlayerID(boat.Owner.PlayerID()); c != nil {
+		victimBot = c.Bot()
+	}
+
+	h.recordWeaponHit(attackerShip, weapon.EntityType, boat.EntityType, attackerBot, victimBot, damage, killed)
+}
+
+func (h *Hub) weaponStat(key weaponStatKey) *weaponStatCounts {
+	if h.weaponStats == nil {
+		h.weaponStats = make(map[weaponStatKey]*weaponStatCounts)
+	}
+	counts, ok := h.weaponStats[key]
+	if !ok {
+		counts = &weaponStatCounts{}
+		h.weaponStats[key] = counts
+	}
+	return counts
+}
+
+// AppendWeaponStats appends a header line (#begin statsfile, timestamp,
+// hostname, world radius) followed by one line per (attacker ship, attacker
+// armament, victim ship) tuple accumulated since the last call, in the
+// spirit of the Xonotic WeaponStats file format, then resets the counters.
+// A nil/empty weaponStats is a no-op (no header is written).
+func (h *Hub) AppendWeaponStats(filename string) error {
+	defer func() { h.weaponStats = nil }()
+
+	if len(h.weaponStats) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hostname, _ := os.Hostname()
+
+	if _, err := fmt.Fprintf(f, "#begin statsfile\n%d %s %.0f\n", time.Now().Unix(), hostname, h.worldRadius); err != nil {
+		return err
+	}
+
+	for key, counts := range h.weaponStats {
+		if _, err := fmt.Fprintf(f, "%s %s %s %v %v %d %d %.0f %d\n",
+			key.attackerShip, key.attackerArmament, key.victimShip,
+			key.attackerBot, key.victimBot,
+			counts.fired, counts.hit, counts.damage, counts.kills,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
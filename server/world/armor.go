@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+import (
+	"github.com/chewxy/math32"
+)
+
+// Facet is one of the four directional quarters an ArmorFacet applies to.
+type Facet int
+
+const (
+	FacetBow Facet = iota
+	FacetStarboard
+	FacetStern
+	FacetPort
+	FacetCount
+)
+
+// FacetOf returns the Facet a bearing (relative to the boat's own Direction,
+// i.e. the angle from the boat to the point of impact, already rotated into
+// the boat's own frame) falls into.
+func FacetOf(relativeBearing Angle) Facet {
+	switch {
+	case relativeBearing.Abs() <= math32.Pi/4:
+		return FacetBow
+	case relativeBearing.Diff(Pi/2).Abs() < math32.Pi/4:
+		return FacetStarboard
+	case relativeBearing.Diff(-Pi/2).Abs() < math32.Pi/4:
+		return FacetPort
+	default:
+		return FacetStern
+	}
+}
+
+// RegenShields regenerates each of a boat's shield pools by ticks worth of
+// its EntityType's per-facet regen rate, capped at that facet's capacity.
+func (entity *Entity) RegenShields(ticks Ticks) {
+	armor := &entity.Data().Armor
+	seconds := ticks.Float()
+	for i := range entity.Shields {
+		facet := &armor[i]
+		if facet.Shield == 0 {
+			continue
+		}
+		entity.Shields[i] = min(entity.Shields[i]+facet.ShieldRegen*seconds, facet.Shield)
+	}
+}
+
+// DamageAt damages a boat from a hit originating at impactPosition, routing
+// the damage through whichever directional ArmorFacet faces that bearing:
+// the facet's shield absorbs damage first, and its Multiplier scales
+// whatever damage remains before it reaches the hull.
+func (entity *Entity) DamageAt(damage Ticks, impactPosition Vec2f) bool {
+	bearing := impactPosition.Sub(entity.Position).Angle() - entity.Direction
+	facet := FacetOf(bearing)
+	armor := &entity.Data().Armor[facet]
+
+	remaining := damage.Damage()
+	if shield := entity.Shields[facet]; shield > 0 {
+		absorbed := min(shield, remaining)
+		entity.Shields[facet] -= absorbed
+		remaining -= absorbed
+	}
+
+	multiplier := armor.Multiplier
+	if multiplier == 0 {
+		// No armor data loaded for this facet; behave as a plain hull.
+		multiplier = 1
+	}
+
+	return entity.Damage(DamageToTicks(remaining * multiplier))
+}
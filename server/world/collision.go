@@ -46,97 +46,87 @@ func (entity *Entity) AltitudeOverlap(other *Entity) bool {
 	return math32.Abs(entity.Altitude()-other.Altitude()) <= AltitudeCollisionThreshold
 }
 
-// Collides does a rectangle to rectangle collision with another Entity.
-// Does not take into account altitude
+// Collides does a swept rectangle to rectangle collision with another Entity
+// over [0, seconds]. Does not take into account altitude.
 func (entity *Entity) Collides(otherEntity *Entity, seconds float32) bool {
+	hit, _ := entity.CollidesAt(otherEntity, seconds)
+	return hit
+}
+
+// CollidesAt does a true swept SAT collision test against otherEntity over
+// [0, seconds]: both entities are treated as rectangles translating along
+// their own Direction at their own Velocity over the interval, and the
+// earliest time of impact (if any) is returned so callers can compute
+// damage location, ram angle, etc. at the actual point of contact rather
+// than at the end-of-tick position.
+func (entity *Entity) CollidesAt(otherEntity *Entity, seconds float32) (hit bool, toi float32) {
 	data := entity.Data()
 	otherData := otherEntity.Data()
 
-	sweep := seconds * entity.Velocity.Float()
-	otherSweep := seconds * otherEntity.Velocity.Float()
-
-	r2 := data.Radius + otherData.Radius + sweep + otherSweep
-	r2 *= r2
-
-	// More precise version would offset the positions by sweep / 2 but would require a sqrt to calculate new radius
-	if entity.Position.DistanceSquared(otherEntity.Position) > r2 {
-		return false
+	// Coarse circle reject, using each entity's total displacement over the interval.
+	sweep := seconds * math32.Abs(entity.Velocity.Float())
+	otherSweep := seconds * math32.Abs(otherEntity.Velocity.Float())
+	r := data.Radius + otherData.Radius + sweep + otherSweep
+	if entity.Position.DistanceSquared(otherEntity.Position) > r*r {
+		return false, 0
 	}
 
-	// SAMs collide if within radius, simulating their blast-fragmentation warheads
+	// SAMs collide if within radius, simulating their blast-fragmentation warheads.
 	if data.SubKind == EntitySubKindSAM || otherData.SubKind == EntitySubKindSAM {
-		return true
+		return true, 0
 	}
 
-	dimensions := Vec2f{X: data.Length + sweep, Y: data.Width}
-	otherDimensions := Vec2f{X: otherData.Length + otherSweep, Y: otherData.Width}
-
 	normal := entity.Direction.Vec2f()
+	tangent := normal.Rot90()
 	otherNormal := otherEntity.Direction.Vec2f()
-
-	return satCollision(entity.Position.AddScaled(normal, sweep*0.5), otherEntity.Position, normal, otherNormal, dimensions, otherDimensions) &&
-		satCollision(otherEntity.Position.AddScaled(otherNormal, otherSweep*0.5), entity.Position, otherNormal, normal, otherDimensions, dimensions)
-}
-
-// Rectangle-based separating axis theorem collision
-func satCollision(position, otherPosition, axisNormal, otherAxisNormal, dimensions, otherDimensions Vec2f) bool {
-	// Dimensions
-	otherDimensions = otherDimensions.Mul(0.5)
-	dimensions = dimensions.Mul(0.5)
-	otherAxisTangent := otherAxisNormal.Rot90()
-
-	// Normal vectors scaled to dimensions
-	otherScaledNormal := otherAxisNormal.Mul(otherDimensions.X)
-	otherScaledTangent := otherAxisTangent.Mul(otherDimensions.Y)
-
-	// All corner positions of other
-	otherPosition1 := otherPosition.Add(otherScaledNormal)
-	otherPosition2 := otherPosition1.Sub(otherScaledTangent)
-	otherPosition1 = otherPosition1.Add(otherScaledTangent)
-
-	otherPosition3 := otherPosition.Sub(otherScaledNormal)
-	otherPosition4 := otherPosition3.Add(otherScaledTangent)
-	otherPosition3 = otherPosition3.Sub(otherScaledTangent)
-
-	for f := 0; f < 4; f++ {
-		// Current dimension
-		dimension := dimensions.X
-		if f&1 == 1 {
-			dimension = dimensions.Y
+	otherTangent := otherNormal.Rot90()
+
+	halfExtents := Vec2f{X: data.Length * 0.5, Y: data.Width * 0.5}
+	otherHalfExtents := Vec2f{X: otherData.Length * 0.5, Y: otherData.Width * 0.5}
+
+	relativePosition := otherEntity.Position.Sub(entity.Position)
+	relativeVelocity := otherNormal.Mul(otherEntity.Velocity.Float()).Sub(normal.Mul(entity.Velocity.Float()))
+
+	tEnter, tExit := float32(0), seconds
+
+	for _, axis := range [4]Vec2f{normal, tangent, otherNormal, otherTangent} {
+		extent := math32.Abs(normal.Dot(axis))*halfExtents.X + math32.Abs(tangent.Dot(axis))*halfExtents.Y
+		otherExtent := math32.Abs(otherNormal.Dot(axis))*otherHalfExtents.X + math32.Abs(otherTangent.Dot(axis))*otherHalfExtents.Y
+		sum := extent + otherExtent
+
+		gap := relativePosition.Dot(axis)
+		speed := relativeVelocity.Dot(axis)
+
+		var enter, exit float32
+		if speed == 0 {
+			if math32.Abs(gap) > sum {
+				// Parallel on this axis and never overlapping: separating axis found.
+				return false, 0
+			}
+			enter, exit = tEnter, tExit
+		} else {
+			t1 := (-sum - gap) / speed
+			t2 := (sum - gap) / speed
+			if t1 > t2 {
+				t1, t2 = t2, t1
+			}
+			enter, exit = t1, t2
 		}
 
-		// Faster than multiple dot products
-		dot := position.Dot(axisNormal)
-
-		// dimension is always positive so minimum must be less than maximum
-		minimum := dot - dimension
-		maximum := dot + dimension
-
-		// Unrolled loop ~70ns to ~60ns
-		d := otherPosition1.Dot(axisNormal)
-		otherMin := d
-		otherMax := d
-
-		d = otherPosition2.Dot(axisNormal)
-		otherMin = min(otherMin, d)
-		otherMax = max(otherMax, d)
-
-		d = otherPosition3.Dot(axisNormal)
-		otherMin = min(otherMin, d)
-		otherMax = max(otherMax, d)
-
-		d = otherPosition4.Dot(axisNormal)
-		otherMin = min(otherMin, d)
-		otherMax = max(otherMax, d)
-
-		// Not colliding
-		if minimum > otherMax || otherMin > maximum {
-			return false
+		if enter > tEnter {
+			tEnter = enter
+		}
+		if exit < tExit {
+			tExit = exit
 		}
+		if tEnter > tExit {
+			return false, 0
+		}
+	}
 
-		// Faster rotation
-		axisNormal = axisNormal.Rot90()
+	if tEnter > seconds || tExit < 0 {
+		return false, 0
 	}
 
-	return true
+	return true, max(tEnter, 0)
 }
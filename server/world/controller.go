@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+import "github.com/chewxy/math32"
+
+// ControllerView is what a Controller can observe about the world beyond the
+// Entity it's controlling. Entity.Update only ever threads a Collider
+// through to its movement code (see collision.go), so that's all a
+// Controller gets too. A Controller that needs to sense other entities (e.g.
+// picking a target) has to run where the broad-phase entity iteration lives,
+// at the Hub level (see server/bot_boat_controller.go), rather than from
+// inside Entity.Update.
+type ControllerView interface {
+	Collider
+}
+
+// Controller computes the Guidance entity should steer toward this tick, in
+// place of a human's Manual/AimTurrets messages. Controllers are looked up
+// by EntitySubKind (see controllers below) since, like the hard-coded
+// branches they replace, behavior currently only varies by SubKind; nothing
+// stops a future per-Player override map from shadowing controllers for
+// specific players.
+//
+// A Controller may also mutate entity directly as a side effect (e.g.
+// SubmarineDepthController adjusts altitude, which isn't part of Guidance)
+// rather than expressing every change through its return value - the same
+// way the logic it replaces did before being pulled out of Update.
+type Controller interface {
+	Control(entity *Entity, dt float32, view ControllerView) Guidance
+}
+
+// controllers holds the autonomous behaviors for EntitySubKinds that steer
+// themselves rather than being steered by a human or bot's Guidance writes
+// (see Entity.Update).
+var controllers = map[EntitySubKind]Controller{
+	EntitySubKindAircraft:  AircraftEscortController{},
+	EntitySubKindSubmarine: SubmarineDepthController{},
+}
+
+// AircraftEscortController flies carrier/sub-launched aircraft (Seahawks,
+// fighters, etc.) toward the owning boat's AimTarget, slowing down to let a
+// formation catch up or to loiter once close enough. It expresses both
+// "pursue" and "slow down" as VelocityTarget rather than lowering Update's
+// generic maxSpeed ceiling, so Guidance alone fully describes the result.
+type AircraftEscortController struct{}
+
+func (AircraftEscortController) Control(entity *Entity, dt float32, _ ControllerView) Guidance {
+	g := entity.Guidance
+
+	posTarget := entity.OwnerBoatAimTarget()
+	posDiff := posTarget.Sub(entity.Position)
+
+	// Vary angle based on entity hash so aircraft doesn't clump as much.
+	g.DirectionTarget = posDiff.Angle() + ToAngle(entity.Hash()*math32.Pi/4) - Pi/8
+	distance := posDiff.LengthSquared()
+
+	speed := entity.Data().Speed
+	// Probably will have heli sub-kind in future.
+	if entity.EntityType == EntityTypeSeahawk {
+		if distance < 35*35 {
+			speed = 0
+		}
+	} else {
+		// Let other aircraft catch up.
+		if distance < 75*75 || entity.Direction.Diff(g.DirectionTarget).Abs() > math32.Pi/3 {
+			speed -= 30 * MeterPerSecond
+		}
+	}
+	g.VelocityTarget = speed
+
+	return g
+}
+
+// SubmarineDepthController steps a submarine's altitude toward whatever
+// altitude target a player (or bot) last requested via SetAltitudeTarget.
+// Guidance is untouched; the altitude change is applied directly to the
+// owning Player's extension state, same as before this was pulled out of
+// Update.
+type SubmarineDepthController struct{}
+
+func (SubmarineDepthController) Control(entity *Entity, dt float32, _ ControllerView) Guidance {
+	ext := &entity.Owner.ext
+	targetAltitude := clamp(ext.altitudeTarget(), -1, 0)
+	const altitudeSpeed = 0.25
+	altitudeChange := clampMagnitude(targetAltitude-entity.Altitude(), altitudeSpeed*dt)
+	ext.setAltitude(entity.Altitude() + altitudeChange)
+
+	return entity.Guidance
+}
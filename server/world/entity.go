@@ -10,7 +10,7 @@ import (
 const spawnProtection Ticks = 10 * TicksPerSecond
 
 // Entity is an object in the world such as a boat, torpedo, crate or oil platform.
-// Its size is 32 bytes for optimal efficiency.
+// Kept as small as practical for efficiency.
 // Cannot modify EntityType directly.
 // Entity.Ticks is either damage or lifespan depending on the entity's type.
 // Cannot modify EntityID except in World.
@@ -20,15 +20,79 @@ type Entity struct {
 	Owner *Player
 	EntityType
 	Ticks    Ticks
+	Sinking  Ticks               // remaining ticks in a boat's staged death sequence; 0 if not sinking
+	Shields  [FacetCount]float32 // remaining shield pool of each directional ArmorFacet
 	EntityID EntityID
 }
 
+// sinkDuration is how long a killed boat continues ticking as a wreck -
+// decelerating, settling, and shedding cook-offs and debris - before it is
+// finally removed.
+const sinkDuration Ticks = 6 * TicksPerSecond
+
+// Sink begins a boat's staged death sequence in place of removing it
+// instantly. Update keeps ticking the entity as a wreck until Sinking
+// expires, at which point it returns die=true.
+func (entity *Entity) Sink() {
+	if entity.Sinking == 0 {
+		entity.Sinking = sinkDuration
+		entity.VelocityTarget = 0
+	}
+}
+
+// killBoat applies the same death penalty Hub.boatDied applies for a combat
+// kill (half the owner's score, capped at 80) and begins the staged sinking
+// sequence. Update's terrain/border death paths call this directly rather
+// than relying on boatDied, because by the time updateSinking finally
+// reports die=true for them, wasSinking was already true the tick before
+// (see physics.go's ForEntities callback), so boatDied's non-staged
+// "!wasSinking" path never runs for them.
+func (entity *Entity) killBoat() {
+	if owner := entity.Owner; owner != nil {
+		owner.Score /= 2
+		if owner.Score > 80 {
+			owner.Score = 80
+		}
+	}
+	entity.Sink()
+}
+
+// SinkProgress returns how far through its staged death sequence a sinking
+// boat is, in [0, 1), or 0 if it isn't sinking.
+func (entity *Entity) SinkProgress() float32 {
+	if entity.Sinking == 0 {
+		return 0
+	}
+	return 1 - entity.Sinking.Float()/sinkDuration.Float()
+}
+
+// updateSinking advances a wreck's death sequence by ticks: it keeps
+// drifting at decaying velocity and settles lower in the water, and reports
+// whether it should finally be removed.
+func (entity *Entity) updateSinking(ticks Ticks) (die bool) {
+	seconds := ticks.Float()
+	entity.Position = entity.Position.AddScaled(entity.Direction.Vec2f(), seconds*entity.Velocity.Float())
+	entity.Velocity = ToVelocity(max(0, entity.Velocity.Float()-3*seconds))
+	entity.Owner.ext.setAltitude(entity.Altitude() - 0.1*seconds)
+
+	if entity.Sinking <= ticks {
+		entity.Sinking = 0
+		return true
+	}
+	entity.Sinking -= ticks
+	return false
+}
+
 // Update updates all the variables of an Entity such as Position, Direction, ArmamentConsumption etc.
 // by an amount of time. It only modifies itself so each one can be processed by a different goroutine.
 // seconds cannot be > 1.0.
 func (entity *Entity) Update(ticks Ticks, worldRadius float32, collider Collider) (die bool) {
 	data := entity.Data()
 
+	if entity.Sinking != 0 {
+		return entity.updateSinking(ticks)
+	}
+
 	if lifespan := data.Lifespan; lifespan != 0 {
 		entity.Ticks += ticks
 
@@ -51,31 +115,10 @@ func (entity *Entity) Update(ticks Ticks, worldRadius float32, collider Collider
 	maxSpeed := data.Speed
 	seconds := ticks.Float()
 
-	if data.SubKind == EntitySubKindAircraft {
-		posTarget := entity.OwnerBoatAimTarget()
-		posDiff := posTarget.Sub(entity.Position)
-
-		// Vary angle based on entity hash so aircraft doesn't clump as much.
-		entity.DirectionTarget = posDiff.Angle() + ToAngle(entity.Hash()*math32.Pi/4) - Pi/8
-		distance := posDiff.LengthSquared()
-
-		// Probably will have heli sub-kind in future.
-		if entity.EntityType == EntityTypeSeahawk {
-			if distance < 35*35 {
-				maxSpeed = 0
-			}
-		} else {
-			// Let other aircraft catch up
-			if distance < 75*75 || entity.Direction.Diff(entity.DirectionTarget).Abs() > math32.Pi/3 {
-				maxSpeed -= 30 * MeterPerSecond
-			}
-		}
-	} else if data.SubKind == EntitySubKindSubmarine {
-		ext := &entity.Owner.ext
-		targetAltitude := clamp(ext.altitudeTarget(), -1, 0)
-		altitudeSpeed := float32(0.25)
-		altitudeChange := clampMagnitude(targetAltitude-entity.Altitude(), altitudeSpeed*seconds)
-		ext.setAltitude(entity.Altitude() + altitudeChange)
+	// Autonomous movement for SubKinds that steer themselves instead of
+	// being steered by a human/bot's Guidance writes (see controller.go).
+	if controller, ok := controllers[data.SubKind]; ok {
+		entity.Guidance = controller.Control(entity, seconds, collider)
 	}
 
 	boat := data.Kind == EntityKindBoat
@@ -98,6 +141,7 @@ func (entity *Entity) Update(ticks Ticks, worldRadius float32, collider Collider
 		}
 
 		entity.Repair(ticks)
+		entity.RegenShields(ticks)
 	}
 
 	// Shells that have been added so far can't turn
@@ -137,7 +181,8 @@ func (entity *Entity) Update(ticks Ticks, worldRadius float32, collider Collider
 					if owner := entity.Owner; owner != nil {
 						owner.DeathReason = DeathReason{Type: DeathTypeTerrain}
 					}
-					return true
+					// Boats sink in stages rather than vanishing on the spot.
+					entity.killBoat()
 				}
 			}
 		}
@@ -150,10 +195,13 @@ func (entity *Entity) Update(ticks Ticks, worldRadius float32, collider Collider
 		entity.Velocity += ToVelocity(clampMagnitude(entity.Velocity.Float()-6*entity.Position.Dot(entity.Direction.Vec2f()), 15))
 		// Everything but boats is instantly killed by border
 		if dead || data.Kind != EntityKindBoat || centerDist2 > square(worldRadius*RadiusClearance) {
-			if owner := entity.Owner; owner != nil && entity.Data().Kind == EntityKindBoat {
+			if data.Kind != EntityKindBoat {
+				return true
+			}
+			if owner := entity.Owner; owner != nil {
 				owner.DeathReason = DeathReason{Type: DeathTypeBorder}
 			}
-			return true
+			entity.killBoat()
 		}
 	}
 
@@ -181,8 +229,13 @@ func (entity *Entity) KillIn(ticks, killTime Ticks) bool {
 	return entity.Damage(ticks * (entity.MaxHealth() / killTime).ClampMin(1))
 }
 
-// UpdateSensor runs a simple AI for homing torpedoes/missiles.
-func (entity *Entity) UpdateSensor(otherEntity *Entity) {
+// UpdateSensor runs proportional-navigation (PN) guidance for homing
+// torpedoes, missiles, rockets, and SAMs. dt is the number of seconds since
+// the last call, used both to scale the lock-retention roll (see
+// Entity.UpdateLock) and to integrate the LOS rate. rng must be seeded
+// deterministically per tick per entity (see NewRng) so replayed ticks
+// reroll identically.
+func (entity *Entity) UpdateSensor(otherEntity *Entity, dt float32, rng *Rng) {
 	if entity.Owner.Friendly(otherEntity.Owner) {
 		return
 	}
@@ -196,11 +249,8 @@ func (entity *Entity) UpdateSensor(otherEntity *Entity) {
 	otherData := otherEntity.Data()
 
 	var relevant bool
-	var baseHomingStrength float32 = 600
-
 	switch data.SubKind {
 	case EntitySubKindSAM:
-		baseHomingStrength = 10000
 		relevant = otherData.SubKind == EntitySubKindAircraft || otherData.SubKind == EntitySubKindMissile || otherData.SubKind == EntitySubKindRocket
 	default:
 		relevant = otherData.Kind == EntityKindBoat || otherData.Kind == EntityKindDecoy
@@ -211,28 +261,146 @@ func (entity *Entity) UpdateSensor(otherEntity *Entity) {
 	}
 
 	diff := otherEntity.Position.Sub(entity.Position)
-	angle := diff.Angle()
+	rangeSquared := diff.LengthSquared()
+	if rangeSquared < 1 || rangeSquared > square(data.SeekerRange) {
+		// Too close to bear (avoids a degenerate LOS vector) or out of range.
+		return
+	}
+	los := diff.Angle()
+
+	if entity.DirectionTarget.Diff(los).Abs() > data.SeekerFOV.Float() {
+		// Target has left the cone the seeker is currently steering toward.
+		return
+	}
+	if entity.Direction.Diff(los).Abs() > data.SeekerFOV.Float() {
+		// Target has left the cone relative to the weapon's actual heading.
+		return
+	}
 
-	angleTargetDiff := entity.DirectionTarget.Diff(angle).Abs()
-	if angleTargetDiff > math32.Pi/6 {
-		// Should not go off target
+	// A weapon that isn't already tracking otherEntity must win the same
+	// per-tick retention roll UpdateLock uses to keep an existing lock
+	// before it can acquire otherEntity as a new one - otherwise a second
+	// valid target (or a decoy) in sensor range would steal the lock for
+	// free the moment it's processed, regardless of trackingRetention.
+	acquiring := entity.lockedOn != otherEntity.EntityID
+	if !entity.UpdateLock(otherEntity, dt, rng) {
+		if !acquiring {
+			// Every tracking mode failed its roll simultaneously; lose the
+			// lock and revert to ballistic guidance until something
+			// re-acquires.
+			entity.lockedOn = EntityIDInvalid
+		}
 		return
 	}
+	if acquiring {
+		// Resets LastLOS so the first tick's LOS rate isn't a spurious jump.
+		entity.lockedOn = otherEntity.EntityID
+		entity.LastLOS = los
+	}
+
+	// Proportional navigation: turn DirectionTarget at a rate proportional to
+	// the closing velocity Vc and the LOS rotation rate Ω, rather than simply
+	// lerping toward the target's bearing. This yields lead-pursuit intercepts
+	// against maneuvering targets instead of pure pursuit.
+	selfVelocity := entity.Direction.Vec2f().Mul(entity.Velocity.Float())
+	otherVelocity := otherEntity.Direction.Vec2f().Mul(otherEntity.Velocity.Float())
+	closingVelocity := -diff.Norm().Dot(otherVelocity.Sub(selfVelocity))
 
-	angleDiff := entity.Direction.Diff(angle).Abs()
-	if angleDiff > math32.Pi/5 {
-		// Cannot sense beyond this angle
+	losRate := los.Diff(entity.LastLOS).Float() / dt
+	entity.LastLOS = los
+
+	turnRate := clampMagnitude(data.NavigationConstant*closingVelocity*losRate, data.MaxTurnRate)
+	entity.DirectionTarget += ToAngle(turnRate * dt)
+}
+
+// UpdateTurretSensor runs target-acquisition for entity's autonomous turrets
+// (see TurretData.Autonomous) against one nearby hostile otherEntity, called
+// once per hostile candidate per tick (see physics.go, mirroring how
+// UpdateSensor is driven). Only runs while the hull has no explicit
+// AimTarget (see updateTurretAim's own check of the same condition) - a
+// player or bot giving an explicit order always takes priority.
+//
+// Each autonomous turret with otherEntity in its arc and range (see
+// TurretData.ReactionTime) has its TurretSighted counter advanced; any
+// autonomous turret that doesn't see otherEntity this call has its counter
+// reset, so losing line-of-sight restarts the reaction clock. Once a
+// turret's counter reaches ReactionTime it aims at otherEntity directly,
+// independent of AimTarget, at the same turn rate updateTurretAim uses.
+// Returns the indices of turrets that are locked onto (i.e. aimed at)
+// otherEntity as of this call, for the caller to consider firing.
+func (entity *Entity) UpdateTurretSensor(otherEntity *Entity, dt float32) (locked []int) {
+	if entity.Owner.Friendly(otherEntity.Owner) || entity.AimTarget() != (Vec2f{}) {
 		return
 	}
 
-	size := otherData.Radius
-	if otherData.Kind == EntityKindDecoy {
-		// Decoys appear very large to weapons
-		size = 100
+	data := entity.Data()
+	angles := entity.TurretAngles()
+	sighted := entity.TurretSighted()
+
+	type change struct {
+		index      int
+		newSighted Ticks
+		deltaAngle Angle
 	}
+	var changes []change
+
+	for i := range data.Turrets {
+		turretData := &data.Turrets[i]
+		if !turretData.Autonomous {
+			continue
+		}
+
+		turretGlobalTransform := entity.Transform.Add(Transform{
+			Position:  Vec2f{X: turretData.PositionForward, Y: turretData.PositionSide},
+			Direction: angles[i],
+		})
+		diff := otherEntity.Position.Sub(turretGlobalTransform.Position)
+		directionTarget := diff.Angle() - entity.Direction
+		inArc := diff.LengthSquared() <= square(data.Sensors.MaxRange()) && turretData.CheckAzimuth(directionTarget)
+
+		if !inArc {
+			if sighted[i] != 0 {
+				changes = append(changes, change{index: i})
+			}
+			continue
+		}
+
+		newSighted := sighted[i]
+		if newSighted < turretData.ReactionTime {
+			newSighted++
+		}
 
-	homingStrength := size * baseHomingStrength / (1 + diff.LengthSquared() + 1000*square(square(angleDiff)))
-	entity.DirectionTarget = entity.DirectionTarget.Lerp(angle, min(0.95, max(0.01, homingStrength)))
+		var deltaAngle Angle
+		if newSighted >= turretData.ReactionTime {
+			deltaAngle = directionTarget.Diff(angles[i]).ClampMagnitude(ToAngle(dt * (math32.Pi / 3)))
+			locked = append(locked, i)
+		}
+
+		if newSighted != sighted[i] || deltaAngle != 0 {
+			changes = append(changes, change{index: i, newSighted: newSighted, deltaAngle: deltaAngle})
+		}
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	entity.Owner.ext.copyTurretSighted()
+	sightedCopiesAll := entity.Owner.ext.copiesAll()
+	if !sightedCopiesAll {
+		entity.Owner.ext.copyTurretAngles()
+	}
+	sighted = entity.TurretSighted()
+	angles = entity.TurretAngles()
+
+	for _, c := range changes {
+		sighted[c.index] = c.newSighted
+		if c.deltaAngle != 0 {
+			angles[c.index] += c.deltaAngle
+		}
+	}
+
+	return
 }
 
 // Returns a float in range [0, 1) based on the entity's id.
@@ -247,10 +415,17 @@ func (entity *Entity) updateTurretAim(amount Angle) bool {
 	data := entity.Data()
 	angles := entity.TurretAngles()
 
+	aimTarget := entity.AimTarget()
+
 	for i := range angles {
 		turretData := data.Turrets[i]
+		if turretData.Autonomous && aimTarget == (Vec2f{}) {
+			// UpdateTurretSensor drives this turret's aim while the hull has
+			// no explicit AimTarget; don't fight it back toward rest.
+			continue
+		}
 		directionTarget := turretData.Angle
-		if target := entity.AimTarget(); target != (Vec2f{}) { // turret target lasts for 5 seconds
+		if target := aimTarget; target != (Vec2f{}) { // turret target lasts for 5 seconds
 			turretGlobalTransform := entity.Transform.Add(Transform{
 				Position: Vec2f{
 					X: turretData.PositionForward,
@@ -408,12 +583,20 @@ func (entity *Entity) ArmamentTransform(index int) Transform {
 func (entity *Entity) Close() {
 	data := entity.Data()
 	if data.Kind == EntityKindBoat && entity.Owner != nil {
-		if entity.Owner.EntityID == EntityIDInvalid {
+		if entity.Owner.EntityID == entity.EntityID {
+			// Primary ship died: the player's whole turn ends, same as
+			// before fleets (HubOptions.FleetSize) existed.
+			entity.Owner.Died(entity)
+			entity.Owner.EntityID = EntityIDInvalid
+			entity.Owner.ext = unsafeExtension{}
+		} else if entity.Owner.OwnsEntity(entity.EntityID) {
+			// A secondary fleet ship died; the player keeps playing their
+			// primary ship, so just drop the bookkeeping entry rather than
+			// running the full death/respawn flow.
+			entity.Owner.RemoveEntity(entity.EntityID)
+		} else {
 			panic("not player's entity")
 		}
-		entity.Owner.Died(entity)
-		entity.Owner.EntityID = EntityIDInvalid
-		entity.Owner.ext = unsafeExtension{}
 	} else if data.Kind == EntityKindWeapon {
 		// Regen limited armament
 		if data.Limited && entity.Owner != nil {
@@ -40,25 +40,49 @@ type (
 	// EntityTypeData is the description of an EntityType.
 	EntityTypeData struct {
 		// All units are SI (meters, seconds, etc.)
-		Kind         EntityKind    `json:"kind"`
-		SubKind      EntitySubKind `json:"subkind"`
-		Level        uint8         `json:"level"`
-		Limited      bool          `json:"limited"`
-		NPC          bool          `json:"npc"` // only bots can use
-		Lifespan     Ticks         `json:"lifespan"`
-		Reload       Ticks         `json:"reload"` // time to reload
-		Speed        Velocity      `json:"speed"`
-		Length       float32       `json:"length"`
-		Width        float32       `json:"width"`
-		Radius       float32       `json:"-"`
-		InvSize      float32       `json:"-"`
-		Damage       float32       `json:"damage"`       // health of ship, or damage dealt by weapon
-		AntiAircraft float32       `json:"antiAircraft"` // chance aircraft is shot down per second
-		Stealth      float32       `json:"stealth"`
-		Sensors      Sensors       `json:"sensors"`
-		Armaments    []Armament    `json:"armaments"`
-		Turrets      []Turret      `json:"turrets"`
-		Label        string        `json:"label"`
+		Kind     EntityKind    `json:"kind"`
+		SubKind  EntitySubKind `json:"subkind"`
+		Level    uint8         `json:"level"`
+		Limited  bool          `json:"limited"`
+		NPC      bool          `json:"npc"` // only bots can use
+		Lifespan Ticks         `json:"lifespan"`
+		Reload   Ticks         `json:"reload"` // time to reload
+		Speed    Velocity      `json:"speed"`
+		Length   float32       `json:"length"`
+		Width    float32       `json:"width"`
+		Radius   float32       `json:"-"`
+		InvSize  float32       `json:"-"`
+		// NavigationConstant, SeekerFOV, SeekerRange, and MaxTurnRate
+		// parameterize the proportional-navigation guidance homing weapons
+		// use in Entity.UpdateSensor. Not present in entities.json; derived
+		// per SubKind in entity_data_loader.go, the same way Radius and
+		// InvSize are derived above.
+		NavigationConstant float32 `json:"-"` // N in a_cmd = N * Vc * Ω, typically 3-5
+		SeekerFOV          Angle   `json:"-"` // cone half-angle the seeker can track within
+		SeekerRange        float32 `json:"-"` // max distance the seeker can track a target at
+		MaxTurnRate        float32 `json:"-"` // radians/sec, clamps the commanded turn rate
+		// HasAutonomousTurret is true if any entry in Turrets is Autonomous;
+		// lets physics.go cheaply decide whether a boat needs the wider
+		// broad-phase radius Entity.UpdateTurretSensor requires, without
+		// rescanning Turrets every tick. Derived below, like Radius/InvSize.
+		HasAutonomousTurret bool                   `json:"-"`
+		Damage              float32                `json:"damage"`       // health of ship, or damage dealt by weapon
+		AntiAircraft        float32                `json:"antiAircraft"` // chance aircraft is shot down per second
+		Stealth             float32                `json:"stealth"`
+		Sensors             Sensors                `json:"sensors"`
+		Armaments           []Armament             `json:"armaments"`
+		Turrets             []Turret               `json:"turrets"`
+		Armor               [FacetCount]ArmorFacet `json:"armor"`
+		Label               string                 `json:"label"`
+	}
+
+	// ArmorFacet describes one directional quarter of a boat's armor: a
+	// regenerating shield pool that absorbs damage before it reaches the
+	// hull, and a multiplier applied to whatever residual damage gets through.
+	ArmorFacet struct {
+		Multiplier  float32 `json:"multiplier"`  // scales damage after the shield is depleted
+		Shield      float32 `json:"shield"`      // shield pool capacity
+		ShieldRegen float32 `json:"shieldRegen"` // shield regenerated per second
 	}
 
 	Sensors struct {
@@ -70,7 +94,12 @@ type (
 	// Sensor the description of a sensor in an EntityType.
 	Sensor struct {
 		Range float32 `json:"range"`
-		// TODO: Azimuth limits, active/passive, etc.
+		// Mode is whether the sensor can emit (and thus be detected in turn).
+		Mode SensorMode `json:"mode,omitempty"`
+		// AzimuthCenter and AzimuthWidth limit the sensor to a cone relative
+		// to the entity's own Direction; AzimuthWidth of 0 means omnidirectional.
+		AzimuthCenter Angle `json:"azimuthCenter,omitempty"`
+		AzimuthWidth  Angle `json:"azimuthWidth,omitempty"`
 	}
 
 	// Turret is the description of a turret's relative transform in an EntityType.
@@ -82,6 +111,12 @@ type (
 		AzimuthFR       Angle   `json:"azimuthFR"`
 		AzimuthBL       Angle   `json:"azimuthBL"`
 		AzimuthBR       Angle   `json:"azimuthBR"`
+		// Autonomous turrets acquire and aim at nearby hostiles on their own
+		// when the hull has no explicit AimTarget (see Entity.UpdateTurretSensor).
+		Autonomous bool `json:"autonomous,omitempty"`
+		// ReactionTime is how long (see ext.turretSighted) a hostile must stay
+		// continuously within the turret's arc and range before it's locked on.
+		ReactionTime Ticks `json:"reactionTime,omitempty"`
 	}
 )
 
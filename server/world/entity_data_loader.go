@@ -7,6 +7,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"errors"
+	"github.com/chewxy/math32"
 	"sort"
 )
 
@@ -148,6 +149,13 @@ func init() {
 		}
 
 		data.InvSize = 1.0 / min(1, data.Radius*(1.0/30.0)*(1.0-data.Stealth))
+
+		for _, turret := range data.Turrets {
+			if turret.Autonomous {
+				data.HasAutonomousTurret = true
+				break
+			}
+		}
 	}
 
 	EntityKindBoat = ParseEntityKind("boat")
@@ -194,6 +202,31 @@ func init() {
 			BoatEntityTypesByLevel[data.Level] = append(BoatEntityTypesByLevel[data.Level], EntityType(i))
 		}
 	}
+
+	// Proportional-navigation guidance defaults for homing weapons (see
+	// Entity.UpdateSensor). These live here, instead of the Radius/InvSize
+	// loop above, because they're keyed off the SubKind constants parsed
+	// just above.
+	for i := range entityTypeData {
+		data := &entityTypeData[i]
+		switch data.SubKind {
+		case EntitySubKindSAM:
+			data.NavigationConstant = 4
+			data.SeekerFOV = ToAngle(math32.Pi / 3)
+			data.SeekerRange = 1000
+			data.MaxTurnRate = math32.Pi
+		case EntitySubKindMissile, EntitySubKindRocket:
+			data.NavigationConstant = 4
+			data.SeekerFOV = ToAngle(math32.Pi / 4)
+			data.SeekerRange = 600
+			data.MaxTurnRate = math32.Pi / 2
+		case EntitySubKindTorpedo:
+			data.NavigationConstant = 3
+			data.SeekerFOV = ToAngle(math32.Pi / 5)
+			data.SeekerRange = 300
+			data.MaxTurnRate = math32.Pi / 4
+		}
+	}
 }
 
 // Enums used in code
@@ -13,7 +13,11 @@ const EntityIDInvalid = EntityID(0)
 
 type EntityID uint32
 
-func AllocateEntityID(used func(id EntityID) bool) (uniqueID EntityID) {
+// AllocateEntityID picks an EntityID not reported as used by used, drawing
+// from r. r is an explicit parameter rather than math/rand's global source
+// so a World can be seeded (see World.SetRand) to make entity ID assignment,
+// and therefore anything recorded/replayed against it, reproducible.
+func AllocateEntityID(r *rand.Rand, used func(id EntityID) bool) (uniqueID EntityID) {
 	for i := 0; i < 10; i++ {
 		// Use shorter EntityIDs first to save on json
 		chars := i + 1
@@ -21,7 +25,7 @@ func AllocateEntityID(used func(id EntityID) bool) (uniqueID EntityID) {
 			chars = 8
 		}
 
-		uniqueID = EntityID(rand.Intn(1 << (chars * 4)))
+		uniqueID = EntityID(r.Intn(1 << (chars * 4)))
 		if uniqueID == EntityIDInvalid {
 			continue
 		}
@@ -18,6 +18,9 @@ type extension interface {
 	turretAngles() []Angle // Read only
 	copyTurretAngles()     // Copy for writes
 
+	turretSighted() []Ticks // Read only; ticks an autonomous turret has continuously sighted a target
+	copyTurretSighted()     // Copy for writes
+
 	aimTarget() Vec2f // Where turret wants to point
 	setAimTarget(target Vec2f)
 
@@ -90,11 +93,32 @@ func (entity *Entity) SetAltitudeTarget(altitudeTarget float32) {
 	entity.Owner.ext.setAltitudeTarget(clamp(altitudeTarget, -1, 1))
 }
 
+// Active returns whether this boat's dual-mode sensors are currently
+// emitting (see SensorMode); always false for sensors that don't have any.
+func (entity *Entity) Active() bool {
+	entity.mustBoat()
+	return entity.Owner.ext.getActive()
+}
+
+// SetActive toggles this boat's dual-mode sensors between active and passive.
+func (entity *Entity) SetActive(active bool) {
+	entity.mustBoat()
+	entity.Owner.ext.setActive(active)
+}
+
 func (entity *Entity) TurretAngles() []Angle {
 	entity.mustBoat()
 	return entity.Owner.ext.turretAngles()
 }
 
+// TurretSighted returns, per Turret, how many ticks an autonomous turret has
+// continuously sighted a candidate target (see Entity.UpdateTurretSensor).
+// Zero for non-autonomous turrets.
+func (entity *Entity) TurretSighted() []Ticks {
+	entity.mustBoat()
+	return entity.Owner.ext.turretSighted()
+}
+
 func (entity *Entity) AimTarget() Vec2f {
 	entity.mustBoat()
 	return entity.Owner.ext.aimTarget()
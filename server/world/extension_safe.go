@@ -6,10 +6,12 @@ package world
 type safeExtension struct {
 	armaments       []Ticks // consumption of each armament
 	angles          []Angle // angle of each turret
+	sighted         []Ticks // ticks each autonomous turret has continuously sighted a target
 	target          Vec2f   // turret target position
 	alt             float32 // altitude (see entity.Altitude for meaning)
 	altTarget       float32 // desired altitude
 	spawnProtection Ticks   // remaining
+	active          bool    // whether active sensors are currently emitting
 }
 
 var _ = extension(&safeExtension{})
@@ -26,6 +28,7 @@ func (ext *safeExtension) setType(entityType EntityType) {
 	// Reset turrets to base positions
 	turrets := data.Turrets
 	ext.angles = make([]Angle, len(turrets))
+	ext.sighted = make([]Ticks, len(turrets))
 
 	for i, turret := range turrets {
 		ext.angles[i] = turret.Angle
@@ -54,6 +57,14 @@ func (ext *safeExtension) copyTurretAngles() {
 	ext.angles = copyAngles(ext.angles)
 }
 
+func (ext *safeExtension) turretSighted() []Ticks {
+	return ext.sighted
+}
+
+func (ext *safeExtension) copyTurretSighted() {
+	ext.sighted = copyTicksSlice(ext.sighted)
+}
+
 func (ext *safeExtension) turretTarget() Vec2f {
 	return ext.target
 }
@@ -85,3 +96,11 @@ func (ext *safeExtension) getSpawnProtection() Ticks {
 func (ext *safeExtension) setSpawnProtection(val Ticks) {
 	ext.spawnProtection = val
 }
+
+func (ext *safeExtension) getActive() bool {
+	return ext.active
+}
+
+func (ext *safeExtension) setActive(active bool) {
+	ext.active = active
+}
@@ -17,6 +17,7 @@ type (
 		alt             float32
 		altTarget       float32
 		spawnProtection Ticks
+		active          bool
 		typ             EntityType
 	}
 )
@@ -29,8 +30,11 @@ func init() {
 	}
 }
 
+// unsafeDataLen is in units of uint16 (the common size of Ticks and Angle,
+// see the init check below): armaments, then turret angles, then one more
+// Ticks-sized slot per turret for turretSighted.
 func unsafeDataLen(data *EntityTypeData) int {
-	return len(data.Armaments) + len(data.Turrets)
+	return len(data.Armaments) + len(data.Turrets)*2
 }
 
 // setEntityType initializes to a size defined by entityType
@@ -102,6 +106,21 @@ func (ext *unsafeExtension) copyTurretAngles() {
 	ext.copy()
 }
 
+func (ext *unsafeExtension) turretSighted() (slice []Ticks) {
+	data := ext.typ.Data()
+	if n := len(data.Turrets); n != 0 {
+		header := (*reflect.SliceHeader)(unsafe.Pointer(&slice))
+		header.Data = uintptr(unsafe.Pointer(ext.data)) + uintptr(len(data.Armaments))*unsafe.Sizeof(Ticks(0)) + uintptr(n)*unsafe.Sizeof(Angle(0))
+		header.Len = n
+		header.Cap = n
+	}
+	return
+}
+
+func (ext *unsafeExtension) copyTurretSighted() {
+	ext.copy()
+}
+
 func (ext *unsafeExtension) altitude() float32 {
 	return ext.alt
 }
@@ -133,3 +152,11 @@ func (ext *unsafeExtension) getSpawnProtection() Ticks {
 func (ext *unsafeExtension) setSpawnProtection(val Ticks) {
 	ext.spawnProtection = val
 }
+
+func (ext *unsafeExtension) getActive() bool {
+	return ext.active
+}
+
+func (ext *unsafeExtension) setActive(active bool) {
+	ext.active = active
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+import (
+	"github.com/chewxy/math32"
+	"math/rand"
+)
+
+// freeSpotSamples bounds how many candidates ForFreeSpotNear tries before
+// giving up.
+const freeSpotSamples = 64
+
+// goldenAngle is 2*Pi times the golden ratio's conjugate, the angle step
+// that makes a golden-angle ("sunflower") spiral - spacing sample i*goldenAngle
+// apart and scaling its radius by sqrt(i) covers a disc far more evenly than
+// independent random samples, so ForFreeSpotNear tends to find a free spot
+// in few iterations at low occupancy without clumping samples together.
+const goldenAngle = 2.39996322972865332
+
+// ForFreeSpotNear searches a golden-angle spiral of candidate positions
+// outward from center, out to searchRadius, for one whose clearRadius disc
+// overlaps no entity already in w and whose distance from the origin is at
+// most worldRadius. Returns the first accepted candidate, or false if every
+// sample was rejected. The spiral's starting orientation is randomized (via
+// the package-level math/rand source, like the rest of this package's
+// spawn-position jitter - see e.g. RandomAngle) so repeated calls with the
+// same center don't all try the same candidates first.
+func ForFreeSpotNear(w World, center Vec2f, searchRadius, clearRadius, worldRadius float32) (Vec2f, bool) {
+	queryRadius := clearRadius + EntityRadiusMax
+	offset := rand.Float32() * math32.Pi * 2
+
+	for i := 0; i < freeSpotSamples; i++ {
+		frac := math32.Sqrt(float32(i) / freeSpotSamples)
+		angle := float32(i)*goldenAngle + offset
+		candidate := center.Add(Vec2f{X: math32.Cos(angle), Y: math32.Sin(angle)}.Mul(frac * searchRadius))
+
+		if candidate.LengthSquared() > worldRadius*worldRadius {
+			continue
+		}
+
+		clear := true
+		w.ForEntitiesInRadius(candidate, queryRadius, func(r float32, _ EntityID, other *Entity) (stop bool) {
+			t := clearRadius + other.Data().Radius
+			if r < t*t {
+				clear = false
+				return true
+			}
+			return false
+		})
+
+		if clear {
+			return candidate, true
+		}
+	}
+
+	return Vec2f{}, false
+}
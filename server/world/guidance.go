@@ -6,4 +6,11 @@ package world
 type Guidance struct {
 	DirectionTarget Angle   `json:"directionTarget,omitempty"`
 	VelocityTarget  float32 `json:"velocityTarget,omitempty"`
+	// lockedOn is the EntityID a guided weapon is currently tracking, or
+	// EntityIDInvalid if it's flying ballistic (no lock, or never had one).
+	lockedOn EntityID
+	// LastLOS is the line-of-sight angle to lockedOn as of the previous
+	// Entity.UpdateSensor call, used to derive the LOS rotation rate for
+	// proportional navigation without allocating a previous position.
+	LastLOS Angle `json:"-"`
 }
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+import (
+	"github.com/chewxy/math32"
+)
+
+// TrackingMode is a way a guided weapon can perceive its target.
+type TrackingMode int
+
+const (
+	TrackingOptical TrackingMode = iota
+	TrackingRadar
+	TrackingSonar
+	TrackingInfrared
+)
+
+// trackingRetention is the base per-second probability that a TrackingMode
+// keeps its lock, absent any target-specific modulation.
+type trackingRetention struct {
+	mode TrackingMode
+	base float32
+}
+
+// trackingModes lists, per weapon EntitySubKind, the TrackingModes it uses to
+// keep a lock and their baseline per-second retention probabilities. A weapon
+// keeps its lock as long as at least one mode's roll succeeds.
+var trackingModes = map[EntitySubKind][]trackingRetention{
+	EntitySubKindTorpedo: {
+		{TrackingSonar, 0.97},
+		{TrackingOptical, 0.9},
+	},
+	EntitySubKindMissile: {
+		{TrackingRadar, 0.96},
+		{TrackingInfrared, 0.93},
+	},
+	EntitySubKindRocket: {
+		{TrackingOptical, 0.92},
+	},
+	EntitySubKindSAM: {
+		{TrackingRadar, 0.98},
+		{TrackingInfrared, 0.95},
+	},
+}
+
+// modulation returns how much a TrackingMode's per-second retention is scaled
+// by properties of the target, in (0, 1]. 1 means no effect.
+func (mode TrackingMode) modulation(target *Entity) float32 {
+	targetData := target.Data()
+	submerged := targetData.SubKind == EntitySubKindSubmarine && target.Altitude() < 0
+	m := float32(1)
+
+	switch mode {
+	case TrackingOptical, TrackingRadar:
+		if submerged {
+			// Submerged submarines defeat optical/radar tracking.
+			m *= 0.05
+		}
+	case TrackingSonar:
+		if math32.Abs(target.Velocity.Float()) < 3 {
+			// Silent running / low speed makes for a weak sonar return.
+			m *= 0.4
+		}
+	case TrackingInfrared:
+		if submerged {
+			// Cool, submerged targets are hard to see with IR.
+			m *= 0.3
+		}
+	}
+
+	if targetData.Kind == EntityKindDecoy {
+		// Decoys are built to break a lock, regardless of mode.
+		m *= 0.15
+	}
+
+	return m
+}
+
+// retain rolls whether this TrackingMode keeps its lock over dt seconds, given
+// its base per-second retention probability and modulation from the target.
+// The effective per-tick retention is base^dt (the dt-th root of the
+// per-second probability), so the roll is independent of tick rate.
+func (mode TrackingMode) retain(base float32, target *Entity, dt float32, rng *Rng) bool {
+	p := math32.Pow(base*mode.modulation(target), dt)
+	return rng.Bool(p)
+}
+
+// UpdateLock rolls each TrackingMode a weapon's subkind uses against target,
+// updating its Guidance.locked state. It returns whether the weapon still has
+// a lock on target after the roll. rng must be seeded deterministically per
+// tick per entity (see NewRng) so that replayed ticks reroll identically.
+func (entity *Entity) UpdateLock(target *Entity, dt float32, rng *Rng) bool {
+	modes := trackingModes[entity.Data().SubKind]
+	if len(modes) == 0 {
+		return false
+	}
+
+	locked := false
+	for _, tracking := range modes {
+		if tracking.mode.retain(tracking.base, target, dt, rng) {
+			locked = true
+		}
+	}
+	return locked
+}
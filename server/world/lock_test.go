@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+import (
+	"github.com/chewxy/math32"
+	"testing"
+)
+
+// newTestEntityType registers a synthetic EntityTypeData and returns the
+// EntityType indexing it, so tests can exercise exact Kind/SubKind/seeker
+// combinations without depending on what entities.json happens to contain.
+func newTestEntityType(data EntityTypeData) EntityType {
+	entityTypeData = append(entityTypeData, data)
+	return EntityType(len(entityTypeData) - 1)
+}
+
+// testTorpedoType is a homing torpedo with the same seeker parameters
+// entity_data_loader.go's init derives for EntitySubKindTorpedo.
+func testTorpedoType() EntityType {
+	return newTestEntityType(EntityTypeData{
+		Kind:               EntityKindWeapon,
+		SubKind:            EntitySubKindTorpedo,
+		NavigationConstant: 3,
+		SeekerFOV:          ToAngle(math32.Pi / 5),
+		SeekerRange:        300,
+		MaxTurnRate:        math32.Pi / 4,
+	})
+}
+
+// testBoatType is a plain (non-submarine) boat, so TrackingMode.modulation's
+// submerged check - which would otherwise call Entity.Altitude(), requiring
+// a boat extension this package's tests don't construct - never triggers.
+func testBoatType() EntityType {
+	return newTestEntityType(EntityTypeData{Kind: EntityKindBoat, SubKind: EntitySubKindDredger})
+}
+
+func testDecoyType() EntityType {
+	return newTestEntityType(EntityTypeData{Kind: EntityKindDecoy})
+}
+
+func TestTrackingMode_Modulation(t *testing.T) {
+	target := &Entity{EntityType: testBoatType()}
+	decoy := &Entity{EntityType: testDecoyType()}
+
+	if m := TrackingOptical.modulation(target); m != 1 {
+		t.Errorf("expected no modulation against a real, surfaced target, got %v", m)
+	}
+	if m := TrackingOptical.modulation(decoy); m >= TrackingOptical.modulation(target) {
+		t.Errorf("expected a decoy to reduce modulation relative to a real target")
+	}
+	if m := TrackingSonar.modulation(decoy); m >= TrackingSonar.modulation(target) {
+		t.Errorf("expected a decoy to reduce sonar modulation relative to a real target")
+	}
+}
+
+// TestEntity_UpdateSensor_MultiTarget exercises the acquiring safeguard
+// Entity.UpdateSensor relies on (see its call to Entity.UpdateLock): a
+// torpedo that's already locked onto one valid target must win the same
+// per-tick retention roll to switch onto a second one that comes into range
+// the same tick, rather than switching onto whichever one physics.go happens
+// to process last. dt is used to force the roll, per TrackingMode.retain's
+// base^dt scaling: a vanishingly small dt drives p to ~1 (certain win), a
+// huge one drives it to ~0 (certain loss).
+func TestEntity_UpdateSensor_MultiTarget(t *testing.T) {
+	const forcedWin = 1e-9
+	const forcedLoss = 1e6
+
+	owner := &Player{}
+	torpedo := &Entity{
+		EntityType: testTorpedoType(),
+		Owner:      owner,
+		Ticks:      TicksPerSecond,
+	}
+
+	targetA := &Entity{
+		EntityType: testBoatType(),
+		Owner:      &Player{},
+		EntityID:   1,
+		Transform:  Transform{Position: Vec2f{X: 100, Y: 0}},
+	}
+	targetB := &Entity{
+		EntityType: testBoatType(),
+		Owner:      &Player{},
+		EntityID:   2,
+		Transform:  Transform{Position: Vec2f{X: 100, Y: 0}},
+	}
+
+	rng := NewRng(0, torpedo.EntityID)
+	torpedo.UpdateSensor(targetA, forcedWin, &rng)
+	if torpedo.lockedOn != targetA.EntityID {
+		t.Fatalf("expected torpedo to acquire targetA, lockedOn = %v", torpedo.lockedOn)
+	}
+
+	// targetB is simultaneously in range and relevant, but its acquisition
+	// roll is forced to fail: the lock must not move off targetA for free.
+	rng = NewRng(1, torpedo.EntityID)
+	torpedo.UpdateSensor(targetB, forcedLoss, &rng)
+	if torpedo.lockedOn != targetA.EntityID {
+		t.Errorf("expected targetA's lock to survive a failed acquisition roll against targetB, lockedOn = %v", torpedo.lockedOn)
+	}
+
+	// Only a won roll may steal the lock.
+	rng = NewRng(2, torpedo.EntityID)
+	torpedo.UpdateSensor(targetB, forcedWin, &rng)
+	if torpedo.lockedOn != targetB.EntityID {
+		t.Errorf("expected targetB to win the lock once its acquisition roll succeeds, lockedOn = %v", torpedo.lockedOn)
+	}
+}
+
+// TestEntity_UpdateSensor_DecoyWhileLocked covers the other case the same
+// safeguard protects against: a decoy deployed while a real lock is active
+// must win its own (heavily modulated, see TrackingMode.modulation) roll to
+// steal the lock, rather than always or never doing so regardless of
+// trackingRetention.
+func TestEntity_UpdateSensor_DecoyWhileLocked(t *testing.T) {
+	const forcedWin = 1e-9
+	const forcedLoss = 1e6
+
+	torpedo := &Entity{
+		EntityType: testTorpedoType(),
+		Owner:      &Player{},
+		Ticks:      TicksPerSecond,
+	}
+	target := &Entity{
+		EntityType: testBoatType(),
+		Owner:      &Player{},
+		EntityID:   1,
+		Transform:  Transform{Position: Vec2f{X: 100, Y: 0}},
+	}
+	decoy := &Entity{
+		EntityType: testDecoyType(),
+		Owner:      &Player{},
+		EntityID:   2,
+		Transform:  Transform{Position: Vec2f{X: 100, Y: 0}},
+	}
+
+	rng := NewRng(0, torpedo.EntityID)
+	torpedo.UpdateSensor(target, forcedWin, &rng)
+	if torpedo.lockedOn != target.EntityID {
+		t.Fatalf("expected torpedo to acquire target, lockedOn = %v", torpedo.lockedOn)
+	}
+
+	// A decoy appearing in the same tick must not steal the lock for free.
+	rng = NewRng(1, torpedo.EntityID)
+	torpedo.UpdateSensor(decoy, forcedLoss, &rng)
+	if torpedo.lockedOn != target.EntityID {
+		t.Errorf("expected the decoy's failed roll to leave the lock on target, lockedOn = %v", torpedo.lockedOn)
+	}
+
+	// But a decoy that wins its (modulated) roll can still break the lock.
+	rng = NewRng(2, torpedo.EntityID)
+	torpedo.UpdateSensor(decoy, forcedWin, &rng)
+	if torpedo.lockedOn != decoy.EntityID {
+		t.Errorf("expected the decoy to steal the lock once its own roll succeeds, lockedOn = %v", torpedo.lockedOn)
+	}
+}
@@ -31,6 +31,11 @@ type (
 		DeathVisual     float32 // if non-zero, in respawn animation
 		DeathFromPlayer bool
 		EntityID        EntityID
+		// EntityIDs holds any additional ships beyond EntityID, for a Hub
+		// configured with HubOptions.FleetSize > 1 (see spawnEntity in
+		// spawn.go and Spawn.Process in inbound.go). Empty for the default
+		// one-ship-per-player configuration.
+		EntityIDs []EntityID
 	}
 
 	// PlayerID is the unique id of a Player
@@ -101,6 +106,33 @@ func (player *Player) ClearDeath() {
 	player.DeathPos = Vec2f{}
 }
 
+// OwnsEntity returns whether entityID is player's primary ship (EntityID) or
+// one of their secondary fleet ships (EntityIDs).
+func (player *Player) OwnsEntity(entityID EntityID) bool {
+	if player.EntityID == entityID {
+		return true
+	}
+	for _, id := range player.EntityIDs {
+		if id == entityID {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveEntity removes entityID from player.EntityIDs. It does not touch
+// player.EntityID - the primary ship is cleared directly by Entity.Close, the
+// same way it always has been, since losing it still ends the player's turn.
+// No-op if entityID isn't present (e.g. already removed).
+func (player *Player) RemoveEntity(entityID EntityID) {
+	for i, id := range player.EntityIDs {
+		if id == entityID {
+			player.EntityIDs = append(player.EntityIDs[:i], player.EntityIDs[i+1:]...)
+			return
+		}
+	}
+}
+
 // Says nothing about whether player is in a team. Only whether they
 // are allowed to respawn with it if it exists.
 func (player Player) CanRespawnWithTeam() bool {
@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+// Rng is a small, deterministic pseudo-random source (a splitmix64 variant)
+// seeded from a physics tick number and an EntityID. Unlike math/rand's
+// global source, two runs that see the same (tick, entityID) always roll
+// the same outcome, regardless of goroutine scheduling. This is what lets
+// Hub.RecordTick/Hub.ReplayTick re-derive an exact post-tick state.
+// Not safe for concurrent use; callers derive one Rng per entity per tick.
+type Rng struct {
+	state uint64
+}
+
+// NewRng seeds a Rng from tick and entityID.
+func NewRng(tick uint32, entityID EntityID) Rng {
+	return Rng{state: uint64(tick)<<32 ^ uint64(entityID)}
+}
+
+// next advances the generator and returns its next raw 64-bit output.
+func (rng *Rng) next() uint64 {
+	rng.state += 0x9e3779b97f4a7c15
+	z := rng.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Float32 returns a pseudo-random float32 in [0, 1), like rand.Float32.
+func (rng *Rng) Float32() float32 {
+	return float32(rng.next()>>40) / (1 << 24)
+}
+
+// Bool rolls true with probability p, which must be in [0, 1].
+func (rng *Rng) Bool(p float32) bool {
+	return rng.Float32() < p
+}
@@ -4,13 +4,17 @@
 package sector
 
 import (
+	"mk48/server/metrics"
 	"mk48/server/world"
 	"runtime"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 func (w *World) ForEntities(callback func(entity *world.Entity) (stop, remove bool)) bool {
+	defer metrics.Observe(w.recorder, metrics.OpForEntities, time.Now())
+
 	if cpus := runtime.NumCPU(); cpus > 1 && w.parallel {
 		return w.forEntitiesParallel(callback, cpus)
 	}
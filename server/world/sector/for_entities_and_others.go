@@ -3,11 +3,32 @@
 
 package sector
 
-import "mk48/server/world"
-
-// ForEntitiesAndOthers TODO support multi-threading
+import (
+	"mk48/server/metrics"
+	"mk48/server/world"
+	"time"
+)
+
+// ForEntitiesAndOthers Iterates all the entities and other entities in a radius and returns if stopped early
+//
+// Unlike ForEntities, this has no parallel path: otherCallback is not
+// confined to mutating just the entity it's passed (physics.go's collision
+// closure, the only real caller, reaches into e.Owner.Score, Sinking, and
+// other shared state on whichever "other" entity a worker happens to find),
+// and forSectorsInRadius isn't bounded to a worker's own claimed batch of
+// outer sectors - so two workers can race on the same victim. Always serial
+// until a caller actually needs it parallel and proves the callback's
+// mutations are race-free under -race.
+//
+// Disposition: a sector-sharded worker pool mirroring forEntitiesParallel
+// (see for_entities.go) was built and then reverted in the same series of
+// changes - see forEntitiesAndOthersParallel in git history. It never ran
+// (physics.go always calls SetParallel(false) before reaching here) and
+// would have raced on exactly the shared-state mutations described above
+// the moment it did. Evaluated and rejected as unsafe, not merely unused.
 func (w *World) ForEntitiesAndOthers(entityCallback func(entityID world.EntityID, entity *world.Entity) (stop bool, radius float32),
 	otherCallback func(entityID world.EntityID, entity *world.Entity, otherEntityID world.EntityID, otherEntity *world.Entity) (stop, remove, removeOther bool)) bool {
+	defer metrics.Observe(w.recorder, metrics.OpForEntitiesAndOthers, time.Now())
 
 	canWrite := w.depth == 0 && !w.parallel
 	w.addDepth(1)
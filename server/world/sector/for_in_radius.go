@@ -4,7 +4,9 @@
 package sector
 
 import (
+	"mk48/server/metrics"
 	"mk48/server/world"
+	"time"
 )
 
 // Iterates all the sectors in a radius and returns if stopped early
@@ -46,6 +48,8 @@ func (w *World) forSectorsInRadius(position world.Vec2f, radius float32, callbac
 // ForEntitiesInRadius implements world.World.ForEntitiesInRadius
 // For reading only
 func (w *World) ForEntitiesInRadius(position world.Vec2f, radius float32, callback func(r float32, entityID world.EntityID, entity *world.Entity) (stop bool)) bool {
+	defer metrics.Observe(w.recorder, metrics.OpForEntitiesInRadius, time.Now())
+
 	w.addDepth(1)
 
 	r2 := radius * radius
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sector
+
+// LockManager serializes access to individual sectors by id, so that
+// whatever is sharing a World's underlying storage doesn't need a single
+// lock covering every sector at once. World itself is single-goroutine and
+// does not use a LockManager; this is the seam a multi-process deployment
+// (see ShmLockManager) slots into, to coordinate access to something
+// external shared the same way sectors are - for example a shared
+// heightmap-cache mmap.
+type LockManager interface {
+	Lock(id sectorID)
+	Unlock(id sectorID)
+	TryLock(id sectorID) bool
+}
+
+// trylock is a mutex with a non-blocking TryLock, implemented as a
+// buffered channel since this module targets Go 1.16 (sync.Mutex only
+// gained TryLock in Go 1.18).
+type trylock chan struct{}
+
+func newTrylock() trylock {
+	l := make(trylock, 1)
+	l <- struct{}{}
+	return l
+}
+
+func (l trylock) Lock()   { <-l }
+func (l trylock) Unlock() { l <- struct{}{} }
+func (l trylock) TryLock() bool {
+	select {
+	case <-l:
+		return true
+	default:
+		return false
+	}
+}
+
+// mutexLockManager is the in-process LockManager: one lock per sector,
+// indexed by sectorID.sliceIndex exactly like World.sectors, with a single
+// fallback lock for ids outside the configured width (rare, and not worth
+// a second kind of slot).
+type mutexLockManager struct {
+	width uint16
+	locks []trylock
+	oob   trylock
+}
+
+// NewLockManager returns the default in-process LockManager, sized for a
+// World of the given width (see World.width).
+func NewLockManager(width uint16) LockManager {
+	m := &mutexLockManager{
+		width: width,
+		locks: make([]trylock, int(width)*int(width)),
+		oob:   newTrylock(),
+	}
+	for i := range m.locks {
+		m.locks[i] = newTrylock()
+	}
+	return m
+}
+
+func (m *mutexLockManager) lock(id sectorID) trylock {
+	if i := id.sliceIndex(m.width); i != -1 {
+		return m.locks[i]
+	}
+	return m.oob
+}
+
+func (m *mutexLockManager) Lock(id sectorID)         { m.lock(id).Lock() }
+func (m *mutexLockManager) Unlock(id sectorID)       { m.lock(id).Unlock() }
+func (m *mutexLockManager) TryLock(id sectorID) bool { return m.lock(id).TryLock() }
+
+var _ LockManager = (*mutexLockManager)(nil)
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// +build linux
+
+package sector
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// shmLockSlotSize is the size in bytes of one sector's slot: a 4-byte PID
+// (0 meaning free).
+const shmLockSlotSize = 4
+
+// shmLockBackoff is how long Lock sleeps between TryLock attempts while
+// waiting for another process to release a sector.
+const shmLockBackoff = time.Millisecond
+
+// ShmLockManager is the POSIX-SHM-backed LockManager: the same one-slot-
+// per-sector layout as mutexLockManager, except the slots live in a shared
+// memory segment (a file under /dev/shm, mmap'd) so multiple *processes* -
+// not just goroutines - can coordinate, as needed to run the terrain/world
+// subsystem across multiple worker processes sharing a single heightmap-
+// cache mmap.
+//
+// Each slot holds the PID of the process currently holding that sector's
+// lock. Lock/Unlock/TryLock are implemented with a compare-and-swap
+// directly on the mapped memory - an atomic CPU instruction works the same
+// whether the two callers are goroutines in one process or threads in two,
+// so no kernel semaphore is required. Lock busy-waits with a short backoff
+// rather than blocking in the kernel; that's the tradeoff for not depending
+// on cgo or a named POSIX semaphore (sem_open), neither of which the
+// standard library exposes.
+type ShmLockManager struct {
+	width  uint16
+	file   *os.File
+	mem    []byte
+	owners []int32 // same backing memory as mem, viewed four bytes at a time
+}
+
+// NewShmLockManager creates or attaches to the shared memory segment at
+// /dev/shm/name, sized for a World of the given width, and returns a
+// LockManager backed by it. Every process coordinating on the same sectors
+// must use the same name and width.
+func NewShmLockManager(name string, width uint16) (*ShmLockManager, error) {
+	size := int64(width) * int64(width) * shmLockSlotSize
+
+	file, err := os.OpenFile("/dev/shm/"+name, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("opening shm segment: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stating shm segment: %w", err)
+	}
+	if info.Size() < size {
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("truncating shm segment: %w", err)
+		}
+	}
+
+	mem, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("mmapping shm segment: %w", err)
+	}
+
+	var owners []int32
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&owners))
+	header.Data = uintptr(unsafe.Pointer(&mem[0]))
+	header.Len = len(mem) / shmLockSlotSize
+	header.Cap = header.Len
+
+	return &ShmLockManager{width: width, file: file, mem: mem, owners: owners}, nil
+}
+
+// Close unmaps the segment and closes the backing file. It does not remove
+// /dev/shm/name, so other processes already holding locks aren't disrupted.
+func (m *ShmLockManager) Close() error {
+	if err := syscall.Munmap(m.mem); err != nil {
+		return err
+	}
+	return m.file.Close()
+}
+
+// slot returns the index of id's lock, falling back to a single shared
+// slot for ids outside the configured width (see mutexLockManager.lock).
+func (m *ShmLockManager) slot(id sectorID) int {
+	if i := id.sliceIndex(m.width); i != -1 {
+		return i
+	}
+	return 0
+}
+
+// Owner returns the PID currently holding id's lock, or 0 if it's free.
+func (m *ShmLockManager) Owner(id sectorID) int32 {
+	return atomic.LoadInt32(&m.owners[m.slot(id)])
+}
+
+func (m *ShmLockManager) TryLock(id sectorID) bool {
+	return atomic.CompareAndSwapInt32(&m.owners[m.slot(id)], 0, int32(os.Getpid()))
+}
+
+func (m *ShmLockManager) Lock(id sectorID) {
+	for !m.TryLock(id) {
+		time.Sleep(shmLockBackoff)
+	}
+}
+
+func (m *ShmLockManager) Unlock(id sectorID) {
+	atomic.StoreInt32(&m.owners[m.slot(id)], 0)
+}
+
+// ReapStuck clears every lock currently held by pid, for a supervisor to
+// call once it has confirmed pid's process crashed (e.g. /proc/pid no
+// longer exists) - otherwise a crashed worker's locks stay held forever,
+// since Unlock is never guaranteed to run on a crash. Returns how many
+// locks were cleared.
+func (m *ShmLockManager) ReapStuck(pid int32) (reaped int) {
+	for i := range m.owners {
+		if atomic.CompareAndSwapInt32(&m.owners[i], pid, 0) {
+			reaped++
+		}
+	}
+	return
+}
+
+var _ LockManager = (*ShmLockManager)(nil)
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// +build !linux
+
+package sector
+
+import "fmt"
+
+// ShmLockManager is unavailable on this platform: the POSIX SHM lock
+// manager (see shm_lock_manager_linux.go) relies on /dev/shm and mmap
+// semantics this module only implements for Linux today.
+type ShmLockManager struct{}
+
+// NewShmLockManager always fails on non-Linux platforms.
+func NewShmLockManager(name string, width uint16) (*ShmLockManager, error) {
+	return nil, fmt.Errorf("sector: ShmLockManager is not supported on this platform")
+}
+
+func (m *ShmLockManager) Lock(id sectorID)         {}
+func (m *ShmLockManager) Unlock(id sectorID)       {}
+func (m *ShmLockManager) TryLock(id sectorID) bool { return false }
+func (m *ShmLockManager) Owner(id sectorID) int32  { return 0 }
+func (m *ShmLockManager) ReapStuck(pid int32) int  { return 0 }
+func (m *ShmLockManager) Close() error             { return nil }
+
+var _ LockManager = (*ShmLockManager)(nil)
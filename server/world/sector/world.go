@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"github.com/chewxy/math32"
 	"math"
+	"math/rand"
+	"mk48/server/metrics"
 	"mk48/server/world"
+	"time"
 )
 
 const (
@@ -30,6 +33,8 @@ type (
 		logWidth    uint8                          // logWidth is log2(width)
 		depth       int8                           // call depth
 		parallel    bool                           // no writing during parallel
+		rand        *rand.Rand                     // see SetRand
+		recorder    metrics.Recorder               // see SetRecorder
 	}
 
 	// sector is one bucket of the World
@@ -49,6 +54,7 @@ func New(radius float32) *World {
 	w := &World{
 		entityIDs: make(map[world.EntityID]sectorIndex),
 		buffered:  make([]sectorEntity, 0, 16),
+		rand:      rand.New(rand.NewSource(rand.Int63())),
 	}
 
 	// Resize allocates World.sectors
@@ -61,13 +67,21 @@ func (w *World) Count() int {
 	return w.entityCount
 }
 
+// SetRecorder installs r to time AddEntity/EntityByID/ForEntities*
+// (see metrics.Recorder). A nil Recorder (the default) disables timing.
+func (w *World) SetRecorder(r metrics.Recorder) {
+	w.recorder = r
+}
+
 // AddEntity adds an entity to the world
 // Cannot add during parallel execution
 func (w *World) AddEntity(entity *world.Entity) world.EntityID {
+	defer metrics.Observe(w.recorder, metrics.OpAddEntity, time.Now())
+
 	if w.parallel {
 		panic("cannot write")
 	}
-	e := &sectorEntity{Entity: *entity, EntityID: world.AllocateEntityID(func(id world.EntityID) bool {
+	e := &sectorEntity{Entity: *entity, EntityID: world.AllocateEntityID(w.rand, func(id world.EntityID) bool {
 		_, ok := w.entityIDs[id]
 		return ok
 	})}
@@ -88,9 +102,27 @@ func (w *World) Debug() {
 	fmt.Printf("sector world: sectors: %d, entities: %d \n", len(w.sectors), w.Count())
 }
 
+// SectorEntityCounts returns the entity count of every occupied sector (one
+// element per non-empty sector, empty sectors omitted), for a caller that
+// wants the occupancy distribution rather than just the Count() total - e.g.
+// Hub.Debug building a Prometheus histogram to alert on hot-spotting before
+// it shows up as a tick-duration regression. Cannot be called concurrently
+// with writes, like Debug/Count.
+func (w *World) SectorEntityCounts() []int {
+	counts := make([]int, 0, len(w.sectors))
+	for i := range w.sectors {
+		if n := len(w.sectors[i].entities); n > 0 {
+			counts = append(counts, n)
+		}
+	}
+	return counts
+}
+
 // EntityByID gets an entity by its id
 // Cannot hold references to entity outside this function
 func (w *World) EntityByID(entityID world.EntityID, callback func(entity *world.Entity) (remove bool)) {
+	defer metrics.Observe(w.recorder, metrics.OpEntityByID, time.Now())
+
 	fullID, ok := w.entityIDs[entityID]
 	if !ok {
 		callback(nil)
@@ -157,6 +189,10 @@ func (w *World) SetParallel(parallel bool) bool {
 	return true
 }
 
+func (w *World) SetRand(r *rand.Rand) {
+	w.rand = r
+}
+
 // addBuffered adds buffered entities
 func (w *World) addBuffered() {
 	for i := range w.buffered {
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+// SensorMode is whether a Sensor only listens (Passive), only emits
+// (Active), or can be switched between the two at runtime (Dual).
+type SensorMode uint8
+
+const (
+	SensorPassive SensorMode = iota
+	SensorActive
+	SensorDual
+)
+
+// CanEmit returns whether the sensor is capable of actively emitting, either
+// always (SensorActive) or when switched on (SensorDual).
+func (mode SensorMode) CanEmit() bool {
+	return mode == SensorActive || mode == SensorDual
+}
+
+// InArc returns whether relativeBearing (the angle from the entity to a
+// target, already expressed relative to the entity's own Direction) falls
+// within the Sensor's azimuth cone. An AzimuthWidth of 0 means omnidirectional.
+// Shares its arc math with Turret.CheckAzimuth's notion of a centered cone.
+func (sensor *Sensor) InArc(relativeBearing Angle) bool {
+	if sensor.AzimuthWidth == 0 {
+		return true
+	}
+	return withinArc(relativeBearing, sensor.AzimuthCenter, sensor.AzimuthWidth/2)
+}
+
+// withinArc returns whether bearing is within halfWidth of center, the
+// shared primitive behind Sensor.InArc and (in spirit) Turret.CheckAzimuth.
+func withinArc(bearing, center, halfWidth Angle) bool {
+	return bearing.Diff(center).Abs() <= halfWidth.Float()
+}
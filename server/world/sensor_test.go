@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+import (
+	"encoding/json"
+	"github.com/chewxy/math32"
+	"testing"
+)
+
+func TestSensor_JSON(t *testing.T) {
+	sensor := Sensor{
+		Range:         500,
+		Mode:          SensorDual,
+		AzimuthCenter: Pi / 2,
+		AzimuthWidth:  Pi / 4,
+	}
+
+	buf, err := json.Marshal(sensor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var roundTripped Sensor
+	if err := json.Unmarshal(buf, &roundTripped); err != nil {
+		t.Fatal(err)
+	}
+
+	if roundTripped != sensor {
+		t.Errorf("expected %+v, got %+v", sensor, roundTripped)
+	}
+}
+
+func TestSensor_InArc(t *testing.T) {
+	sensor := Sensor{AzimuthCenter: 0, AzimuthWidth: Pi / 2} // +/- 45 degrees of dead ahead
+
+	if !sensor.InArc(0) {
+		t.Errorf("expected dead-ahead to be in arc")
+	}
+	if !sensor.InArc(ToAngle(math32.Pi / 8)) {
+		t.Errorf("expected within half-width to be in arc")
+	}
+	if sensor.InArc(ToAngle(math32.Pi / 2)) {
+		t.Errorf("expected outside half-width to not be in arc")
+	}
+
+	omni := Sensor{AzimuthWidth: 0}
+	if !omni.InArc(Pi) {
+		t.Errorf("expected zero-width sensor to be omnidirectional")
+	}
+}
+
+func BenchmarkSensor_InArc(b *testing.B) {
+	sensor := Sensor{AzimuthCenter: Pi / 4, AzimuthWidth: Pi / 2}
+	bearings := make([]Angle, 1024)
+	for i := range bearings {
+		bearings[i] = RandomAngle()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = sensor.InArc(bearings[i&(len(bearings)-1)])
+	}
+}
@@ -5,26 +5,40 @@ package single
 
 import (
 	"fmt"
+	"github.com/SoftbearStudios/mk48/server/metrics"
 	"github.com/SoftbearStudios/mk48/server/world"
+	"math/rand"
+	"time"
 )
 
 // A world holds entities
 type World struct {
 	entities map[world.EntityID]*world.Entity
+	rand     *rand.Rand       // see SetRand
+	recorder metrics.Recorder // see SetRecorder
 }
 
 func New() *World {
 	return &World{
 		entities: make(map[world.EntityID]*world.Entity),
+		rand:     rand.New(rand.NewSource(rand.Int63())),
 	}
 }
 
+// SetRecorder installs r to time AddEntity/EntityByID/ForEntities*
+// (see metrics.Recorder). A nil Recorder (the default) disables timing.
+func (w *World) SetRecorder(r metrics.Recorder) {
+	w.recorder = r
+}
+
 func (w *World) Count() int {
 	return len(w.entities)
 }
 
 func (w *World) AddEntity(entity *world.Entity) {
-	entity.EntityID = world.AllocateEntityID(func(id world.EntityID) bool {
+	defer metrics.Observe(w.recorder, metrics.OpAddEntity, time.Now())
+
+	entity.EntityID = world.AllocateEntityID(w.rand, func(id world.EntityID) bool {
 		_, ok := w.entities[id]
 		return ok
 	})
@@ -32,6 +46,8 @@ func (w *World) AddEntity(entity *world.Entity) {
 }
 
 func (w *World) EntityByID(entityID world.EntityID, callback func(entity *world.Entity) (remove bool)) {
+	defer metrics.Observe(w.recorder, metrics.OpEntityByID, time.Now())
+
 	entity := w.entities[entityID]
 	if callback(entity) && entity != nil {
 		w.removeEntity(entityID, entity)
@@ -39,6 +55,8 @@ func (w *World) EntityByID(entityID world.EntityID, callback func(entity *world.
 }
 
 func (w *World) ForEntities(callback func(entity *world.Entity) (stop, remove bool)) bool {
+	defer metrics.Observe(w.recorder, metrics.OpForEntities, time.Now())
+
 	for entityID, entity := range w.entities {
 		stop, remove := callback(entity)
 		if remove {
@@ -52,6 +70,8 @@ func (w *World) ForEntities(callback func(entity *world.Entity) (stop, remove bo
 }
 
 func (w *World) ForEntitiesInRadius(position world.Vec2f, radius float32, callback func(radius float32, entity *world.Entity) (stop bool)) bool {
+	defer metrics.Observe(w.recorder, metrics.OpForEntitiesInRadius, time.Now())
+
 	r2 := radius * radius
 	for _, entity := range w.entities {
 		r := position.DistanceSquared(entity.Position)
@@ -67,6 +87,7 @@ func (w *World) ForEntitiesInRadius(position world.Vec2f, radius float32, callba
 
 func (w *World) ForEntitiesAndOthers(entityCallback func(entity *world.Entity) (stop bool, radius float32),
 	otherCallback func(entityID world.EntityID, entity *world.Entity, otherEntityID world.EntityID, otherEntity *world.Entity) (stop, remove, removeOther bool)) bool {
+	defer metrics.Observe(w.recorder, metrics.OpForEntitiesAndOthers, time.Now())
 
 	for entityID, entity := range w.entities {
 		stop, radius := entityCallback(entity)
@@ -112,6 +133,10 @@ func (w *World) Resize(radius float32) {
 	// Do nothing
 }
 
+func (w *World) SetRand(r *rand.Rand) {
+	w.rand = r
+}
+
 func (w *World) removeEntity(entityID world.EntityID, entity *world.Entity) {
 	entity.Close()
 	delete(w.entities, entityID)
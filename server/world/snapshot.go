@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+// EntitySnapshot is the subset of Entity state needed to deterministically
+// restore it: Transform and Guidance drive Entity.Update, Ticks is age/health,
+// and (for boats) the owning Player's extension state - armament
+// consumption, turret angles, altitude, and spawn protection - since those
+// also feed Update and firing logic. EntityID/EntityType identify which live
+// entity to restore onto; Owner itself is never captured, since Restore only
+// ever runs against the same live *Player the snapshot was taken from (see
+// Hub.RunAt in the server package).
+type EntitySnapshot struct {
+	EntityID   EntityID
+	EntityType EntityType
+	Transform  Transform
+	Guidance   Guidance
+	Ticks      Ticks
+
+	armamentConsumption []Ticks
+	turretAngles        []Angle
+	altitude            float32
+	altitudeTarget      float32
+	spawnProtection     Ticks
+}
+
+// WorldSnapshot is a point-in-time copy of every entity in a World, captured
+// by Snapshot and reapplied by Restore. It underlies Hub.RunAt's lag
+// compensation and anti-cheat replay (see server/replay.go): rewind to a
+// historical WorldSnapshot, re-run a hit test against it, then Restore the
+// present-day WorldSnapshot taken before the rewind.
+type WorldSnapshot struct {
+	entities []EntitySnapshot
+}
+
+// Snapshot captures every entity currently in w.
+func Snapshot(w World) *WorldSnapshot {
+	var entities []EntitySnapshot
+	w.ForEntities(func(entityID EntityID, entity *Entity) (stop, remove bool) {
+		snap := EntitySnapshot{
+			EntityID:   entityID,
+			EntityType: entity.EntityType,
+			Transform:  entity.Transform,
+			Guidance:   entity.Guidance,
+			Ticks:      entity.Ticks,
+		}
+		if entity.Data().Kind == EntityKindBoat && entity.Owner != nil {
+			ext := &entity.Owner.ext
+			snap.armamentConsumption = copyTicksSlice(ext.armamentConsumption())
+			snap.turretAngles = copyAngles(ext.turretAngles())
+			snap.altitude = ext.altitude()
+			snap.altitudeTarget = ext.altitudeTarget()
+			snap.spawnProtection = ext.getSpawnProtection()
+		}
+		return
+	})
+	return &WorldSnapshot{entities: entities}
+}
+
+// Restore overwrites every entity present in both w and s back to its
+// snapshotted state. Entities snapshotted but since removed from w are
+// skipped (they have nothing left to restore); entities added to w after s
+// was captured are left untouched, since s has no record of them.
+func Restore(w World, s *WorldSnapshot) {
+	for i := range s.entities {
+		snap := &s.entities[i]
+		w.EntityByID(snap.EntityID, func(entity *Entity) (remove bool) {
+			entity.EntityType = snap.EntityType
+			entity.Transform = snap.Transform
+			entity.Guidance = snap.Guidance
+			entity.Ticks = snap.Ticks
+
+			if entity.Data().Kind == EntityKindBoat && entity.Owner != nil {
+				ext := &entity.Owner.ext
+				ext.copyArmamentConsumption()
+				copy(ext.armamentConsumption(), snap.armamentConsumption)
+				ext.copyTurretAngles()
+				copy(ext.turretAngles(), snap.turretAngles)
+				ext.setAltitude(snap.altitude)
+				ext.setAltitudeTarget(snap.altitudeTarget)
+				ext.setSpawnProtection(snap.spawnProtection)
+			}
+
+			return false
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package world
+
+import "container/heap"
+
+// TopK maintains the K players with the highest Score, updated incrementally
+// as individual players' PlayerData changes, rather than rebuilt from a full
+// PlayerSet every call like TopPlayers (see server/leaderboard.go). Update
+// and Remove are both O(log K) regardless of how many players exist overall,
+// since a player outside the top K is never stored.
+//
+// TopK is not safe for concurrent use; callers (Hub.Leaderboard) already run
+// single-threaded.
+type TopK struct {
+	k     int
+	heap  []IDPlayerData
+	index map[PlayerID]int // PlayerID -> position in heap
+}
+
+// NewTopK returns a TopK tracking the k highest-Score players.
+func NewTopK(k int) *TopK {
+	return &TopK{
+		k:     k,
+		index: make(map[PlayerID]int, k),
+	}
+}
+
+// Len is how many players are currently tracked (at most k).
+func (t *TopK) Len() int {
+	return len(t.heap)
+}
+
+// Update records id's latest data, returning whether id is in the top k
+// afterward. If id was already tracked, its entry is repositioned in place.
+// Otherwise, id enters the top k only if there's room or it outranks the
+// current worst tracked entry (per ScoreLess); if neither, Update is a no-op
+// and returns false.
+func (t *TopK) Update(id PlayerID, data PlayerData) bool {
+	if i, ok := t.index[id]; ok {
+		t.heap[i].PlayerData = data
+		heap.Fix(t, i)
+		return true
+	}
+
+	entry := IDPlayerData{PlayerData: data, PlayerID: id}
+
+	if len(t.heap) < t.k {
+		heap.Push(t, entry)
+		return true
+	}
+
+	// heap[0] is the worst of the currently tracked players (see t.Less).
+	if !data.ScoreLess(&t.heap[0].PlayerData) {
+		return false
+	}
+
+	delete(t.index, t.heap[0].PlayerID)
+	t.heap[0] = entry
+	t.index[id] = 0
+	heap.Fix(t, 0)
+	return true
+}
+
+// Remove stops tracking id, e.g. on disconnect or death. A no-op if id
+// wasn't in the top k.
+func (t *TopK) Remove(id PlayerID) {
+	i, ok := t.index[id]
+	if !ok {
+		return
+	}
+	heap.Remove(t, i)
+	delete(t.index, id)
+}
+
+// Snapshot appends the tracked players to buf, best (highest Score) first,
+// reusing its backing array the same way PlayerSet.AppendData does.
+func (t *TopK) Snapshot(buf []IDPlayerData) []IDPlayerData {
+	sorted := append(make([]IDPlayerData, 0, len(t.heap)), t.heap...)
+	r := reverseTopKHeap(sorted)
+	heap.Init(&r)
+	for len(r) > 0 {
+		buf = append(buf, r[0])
+		heap.Pop(&r)
+	}
+	return buf
+}
+
+// heap.Interface, rooted at the WORST tracked player - the opposite of
+// PlayerSet's heap.Interface in team.go, which roots the best. Rooting the
+// worst lets Update decide in O(1) whether an untracked player now outranks
+// the bottom of the top k.
+
+func (t *TopK) Less(i, j int) bool {
+	// i is worse than j exactly when j would sort before i.
+	return t.heap[j].PlayerData.ScoreLess(&t.heap[i].PlayerData)
+}
+
+func (t *TopK) Swap(i, j int) {
+	t.heap[i], t.heap[j] = t.heap[j], t.heap[i]
+	t.index[t.heap[i].PlayerID] = i
+	t.index[t.heap[j].PlayerID] = j
+}
+
+func (t *TopK) Push(x interface{}) {
+	entry := x.(IDPlayerData)
+	t.index[entry.PlayerID] = len(t.heap)
+	t.heap = append(t.heap, entry)
+}
+
+func (t *TopK) Pop() interface{} {
+	n := len(t.heap) - 1
+	entry := t.heap[n]
+	t.heap[n] = IDPlayerData{}
+	t.heap = t.heap[:n]
+	return entry
+}
+
+// reverseTopKHeap is a throwaway copy of TopK's tracked entries with Less
+// inverted, so heap.Init/heap.Pop on it yield best-first order; used only by
+// Snapshot, so it never disturbs TopK's own worst-first invariant or index.
+type reverseTopKHeap []IDPlayerData
+
+func (h reverseTopKHeap) Len() int          { return len(h) }
+func (h reverseTopKHeap) Less(i, j int) bool { return h[i].PlayerData.ScoreLess(&h[j].PlayerData) }
+func (h reverseTopKHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *reverseTopKHeap) Push(x interface{}) {
+	*h = append(*h, x.(IDPlayerData))
+}
+func (h *reverseTopKHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	x := old[n]
+	*h = old[:n]
+	return x
+}
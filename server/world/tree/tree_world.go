@@ -1,24 +1,56 @@
 // SPDX-FileCopyrightText: 2021 Softbear, Inc.
 // SPDX-License-Identifier: AGPL-3.0-or-later
 
+// Package tree is a loose-quadtree-backed world.World, meant as a drop-in
+// alternative to world/sector for the O(n log n) broad-phase entity queries
+// (ForEntitiesInRadius/ForEntitiesAndOthers) that back UpdateSensor and
+// entity-entity collision - not the Collider interface (collision.go in the
+// parent package), which only governs terrain/land collision and has
+// nothing to do with entity spatial partitioning. See tree_world_test.go for
+// a benchmark against sector.World at matching entity counts.
 package tree
 
 import (
 	"encoding/json"
 	"fmt"
 	"github.com/SoftbearStudios/mk48/server/world"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
-const treeNodeMaxEntities = 8
+const (
+	treeNodeMaxEntities = 8
+
+	// minNodeRadius is the smallest a node's radius is allowed to get before
+	// subdivide gives up and lets entities pile up in a leaf instead, so a
+	// World with a huge radius doesn't recurse forever chasing
+	// treeNodeMaxEntities in a crowded region.
+	minNodeRadius = 50 // meters
+)
 
 type (
-	// TODO not functional yet
+	// World is a loose quadtree implementation of world.World. Unlike a
+	// strict quadtree, an entity is placed in the first child whose *loose*
+	// bounds (see loosen) - 2x the child's nominal AABB, same center -
+	// contain it, rather than the child's tight bounds. That means an entity
+	// straddling the tight boundary between two children still fits entirely
+	// inside one of them instead of getting kicked up to their parent, which
+	// is what keeps ForEntitiesInRadius's O(n) pairwise fallback from
+	// degenerating to the root on worlds with entities spread near cell
+	// edges.
 	World struct {
-		root *treeNode
+		root     *treeNode
+		maxDepth int
+		rand     *rand.Rand // see SetRand
+		parallel bool       // see SetParallel
 	}
 
 	treeNode struct {
 		world.AABB
+		depth    int
+		parent   *treeNode
 		children [4]*treeNode
 		entities []world.Entity
 	}
@@ -26,68 +58,147 @@ type (
 
 func New(radius int) *World {
 	return &World{
-		root: newTreeNode(radiusAABB(world.Vec2f{}, float32(radius))),
+		root:     newTreeNode(radiusAABB(world.Vec2f{}, float32(radius)), 0),
+		maxDepth: maxTreeDepth(radius),
+		rand:     rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// maxTreeDepth is how many times a node half the size of its parent can
+// still be subdivided before minNodeRadius would be undercut.
+func maxTreeDepth(radius int) int {
+	depth := 0
+	for float32(radius) > minNodeRadius {
+		radius /= 2
+		depth++
 	}
+	return depth
 }
 
 func (w *World) Count() (count int) {
 	return w.root.count()
 }
 
-func (w *World) AddEntity(entity *world.Entity) {
-	entity.EntityID = world.AllocateEntityID(func(id world.EntityID) bool {
-		return false // TODO
+// AddEntity adds an entity to the world.
+// Cannot add during parallel execution (see SetParallel).
+func (w *World) AddEntity(entity *world.Entity) world.EntityID {
+	if w.parallel {
+		panic("cannot write")
+	}
+
+	entity.EntityID = world.AllocateEntityID(w.rand, func(id world.EntityID) bool {
+		found := false
+		w.EntityByID(id, func(*world.Entity) (remove bool) {
+			found = true
+			return false
+		})
+		return found
 	})
 
-	w.root.add(entity)
+	w.root.add(entity, w.maxDepth)
+	return entity.EntityID
 }
 
 func (w *World) EntityByID(entityID world.EntityID, callback func(entity *world.Entity) (remove bool)) {
-	w.root.iterate(func(entity *world.Entity) (stop, remove bool) {
-		if entityID == entity.EntityID {
+	w.root.iterate(func(id world.EntityID, entity *world.Entity) (stop, remove bool) {
+		if entityID == id {
 			remove = callback(entity)
 			stop = true
 		}
 		return
-	})
+	}, w.reinsert)
+}
+
+func (w *World) ForEntities(callback func(entityID world.EntityID, entity *world.Entity) (stop, remove bool)) bool {
+	if cpus := runtime.NumCPU(); cpus > 1 && w.parallel {
+		return w.forEntitiesParallel(callback)
+	}
+	return w.root.iterate(callback, w.reinsert)
 }
 
-func (w *World) ForEntities(callback func(entity *world.Entity) (stop, remove bool)) bool {
-	return w.root.iterate(callback)
+// forEntitiesParallel is ForEntities, but runs root's own entities and each
+// of root's direct children in its own goroutine - at most 5 jobs, few
+// enough that one goroutine per job is simpler than sector.World's
+// atomic work-stealing over many more sectors (see
+// sector/for_entities.go's forEntitiesParallel) while still spreading a
+// populated World across every CPU. An entity that moves out of its node
+// can't be reinserted concurrently, since reinsertion may write into
+// another job's subtree, so moved entities are collected under a mutex and
+// walked back in from the root serially once every job finishes.
+func (w *World) forEntitiesParallel(callback func(entityID world.EntityID, entity *world.Entity) (stop, remove bool)) bool {
+	var reinsertMu sync.Mutex
+	var toReinsert []world.Entity
+	collect := func(entity *world.Entity) {
+		reinsertMu.Lock()
+		toReinsert = append(toReinsert, *entity)
+		reinsertMu.Unlock()
+	}
+
+	var stopped int32
+	var wait sync.WaitGroup
+
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		if w.root.iterateSelf(callback, collect) {
+			atomic.StoreInt32(&stopped, 1)
+		}
+	}()
+
+	for _, child := range w.root.children {
+		if child == nil {
+			continue
+		}
+		wait.Add(1)
+		go func(node *treeNode) {
+			defer wait.Done()
+			if node.iterate(callback, collect) {
+				atomic.StoreInt32(&stopped, 1)
+			}
+		}(child)
+	}
+
+	wait.Wait()
+
+	for i := range toReinsert {
+		w.root.add(&toReinsert[i], w.maxDepth)
+	}
+
+	return stopped != 0
 }
 
-func (w *World) ForEntitiesInRadius(position world.Vec2f, radius float32, callback func(r float32, entity *world.Entity) (stop bool)) bool {
+func (w *World) ForEntitiesInRadius(position world.Vec2f, radius float32, callback func(r float32, entityID world.EntityID, entity *world.Entity) (stop bool)) bool {
 	aabb := radiusAABB(position, radius)
-	return w.root.iterateAABB(aabb, func(entity *world.Entity) (stop, remove bool) {
-		return callback(position.DistanceSquared(entity.Position), entity), false
+	return w.root.iterateAABB(aabb, func(id world.EntityID, entity *world.Entity) (stop, remove bool) {
+		return callback(position.DistanceSquared(entity.Position), id, entity), false
 	})
 }
 
-func (w *World) ForEntitiesAndOthers(entityCallback func(entity *world.Entity) (stop bool, radius float32),
-	otherCallback func(entity *world.Entity, otherEntity *world.Entity) (stop, remove, removeOther bool)) bool {
+// ForEntitiesAndOthers iterates as ForEntities does, additionally visiting
+// every other entity within the radius entityCallback returns. As with
+// sector.World, entityCallback may move an entity (handled by the same
+// rehoming as ForEntities); otherCallback may not, since it runs nested
+// inside an in-progress radius query over the tree.
+func (w *World) ForEntitiesAndOthers(entityCallback func(entityID world.EntityID, entity *world.Entity) (stop bool, radius float32),
+	otherCallback func(entityID world.EntityID, entity *world.Entity, otherEntityID world.EntityID, otherEntity *world.Entity) (stop, remove, removeOther bool)) bool {
 
-	return w.root.iterate(func(entity *world.Entity) (stopFirst, _ bool) {
+	return w.root.iterate(func(id world.EntityID, entity *world.Entity) (stopFirst, _ bool) {
 		var radius float32
-		stopFirst, radius = entityCallback(entity)
-
-		if radius <= 0.0 {
-			return
-		}
+		stopFirst, radius = entityCallback(id, entity)
 
-		if stopFirst {
+		if radius <= 0.0 || stopFirst {
 			return
 		}
 
 		aabb := radiusAABB(entity.Position, radius)
 		r2 := radius * radius
 
-		// 'i' can change if entities are removed so lookup with 'i' each time to get entity
-		w.root.iterateAABB(aabb, func(other *world.Entity) (stop, _ bool) {
+		w.root.iterateAABB(aabb, func(otherID world.EntityID, other *world.Entity) (stop, _ bool) {
 			if entity == other || entity.Position.DistanceSquared(other.Position) > r2 {
 				return
 			}
 
-			stop, _, _ = otherCallback(entity, other)
+			stop, _, _ = otherCallback(id, entity, otherID, other)
 
 			if stop {
 				stopFirst = true
@@ -97,10 +208,15 @@ func (w *World) ForEntitiesAndOthers(entityCallback func(entity *world.Entity) (
 		})
 
 		return
-	})
+	}, w.reinsert)
 }
 
-func (w *World) SetParallel(readOnly bool) bool {
+// SetParallel marks the World as read-only for concurrent reads (see
+// forEntitiesParallel). Mirrors sector.World.SetParallel: while enabled,
+// AddEntity and any remove panic instead of mutating, since writes from
+// multiple goroutines would race.
+func (w *World) SetParallel(parallel bool) bool {
+	w.parallel = parallel
 	return true
 }
 
@@ -109,12 +225,36 @@ func (w *World) Debug() {
 	fmt.Printf("tree world: nodes: %d, entities: %d\n", w.root.nodeCount(), entityCount)
 }
 
+// Resize re-roots the World into an AABB sized from radius and re-inserts
+// every existing entity, since a tree's depth/bounds are derived from the
+// radius it was constructed with (see New) and don't otherwise adapt to a
+// changed world size.
 func (w *World) Resize(radius float32) {
-	// Do nothing
+	newRoot := newTreeNode(radiusAABB(world.Vec2f{}, radius), 0)
+	newMaxDepth := maxTreeDepth(int(radius))
+
+	var entities []world.Entity
+	w.root.collectAll(&entities)
+	for i := range entities {
+		newRoot.add(&entities[i], newMaxDepth)
+	}
+
+	w.root = newRoot
+	w.maxDepth = newMaxDepth
+}
+
+func (w *World) SetRand(r *rand.Rand) {
+	w.rand = r
+}
+
+// reinsert walks an entity that moved outside its node's loose bounds back
+// in from the root. See treeNode.iterate.
+func (w *World) reinsert(entity *world.Entity) {
+	w.root.add(entity, w.maxDepth)
 }
 
-func newTreeNode(aabb world.AABB) *treeNode {
-	return &treeNode{AABB: aabb}
+func newTreeNode(aabb world.AABB, depth int) *treeNode {
+	return &treeNode{AABB: aabb, depth: depth}
 }
 
 func (node *treeNode) String() string {
@@ -147,12 +287,23 @@ func (node *treeNode) nodeCount() (count int) {
 	return
 }
 
-func (node *treeNode) iterate(callback func(entity *world.Entity) (stop, remove bool)) bool {
-	for i := range node.entities {
+// iterateSelf is the node-local half of iterate: it visits only the
+// entities stored directly in node, not its children. Factored out so
+// forEntitiesParallel can run it over root's own entities in its own
+// goroutine without also recursing into children, which it runs as
+// separate jobs.
+func (node *treeNode) iterateSelf(callback func(entityID world.EntityID, entity *world.Entity) (stop, remove bool), reinsert func(entity *world.Entity)) bool {
+	for i := 0; i < len(node.entities); i++ {
 		entity := &node.entities[i]
-		stop, remove := callback(entity)
+		oldPos := entity.Position
 
-		if remove {
+		stop, remove := callback(entity.EntityID, entity)
+
+		if !remove && entity.Position != oldPos && !node.looseAABB().Contains(entityAABB(entity)) {
+			moved := *entity
+			i = node.remove(i)
+			reinsert(&moved)
+		} else if remove {
 			i = node.remove(i)
 		}
 
@@ -160,26 +311,41 @@ func (node *treeNode) iterate(callback func(entity *world.Entity) (stop, remove
 			return true
 		}
 	}
+	return false
+}
+
+// iterate visits every entity in node and its children. callback may move an
+// entity (e.g. physics integrating its Position); if that moves it outside
+// node's own loose bounds, it's removed here and handed to reinsert, which
+// walks it back in from the root - the same move-during-iteration support
+// sector.World.ForEntities gives entities (see sector/for_entities.go).
+func (node *treeNode) iterate(callback func(entityID world.EntityID, entity *world.Entity) (stop, remove bool), reinsert func(entity *world.Entity)) bool {
+	if node.iterateSelf(callback, reinsert) {
+		return true
+	}
 
 	for _, child := range node.children {
 		if child == nil {
 			continue
 		}
 
-		if child.iterate(callback) {
+		if child.iterate(callback, reinsert) {
 			return true
 		}
 	}
 	return false
 }
 
-func (node *treeNode) iterateAABB(aabb world.AABB, callback func(entity *world.Entity) (stop, remove bool)) bool {
-	for i := range node.entities {
+// iterateAABB is iterate, but skips entities/children whose loose bounds
+// don't intersect aabb. It's only used for read-only radius queries, so
+// unlike iterate it doesn't support callback moving entity.
+func (node *treeNode) iterateAABB(aabb world.AABB, callback func(entityID world.EntityID, entity *world.Entity) (stop, remove bool)) bool {
+	for i := 0; i < len(node.entities); i++ {
 		entity := &node.entities[i]
 		if !entityAABB(entity).Intersects(aabb) {
 			continue
 		}
-		stop, remove := callback(entity)
+		stop, remove := callback(entity.EntityID, entity)
 
 		if remove {
 			i = node.remove(i)
@@ -195,32 +361,32 @@ func (node *treeNode) iterateAABB(aabb world.AABB, callback func(entity *world.E
 			continue
 		}
 
-		if !child.AABB.Intersects(aabb) {
+		if !child.looseAABB().Intersects(aabb) {
 			continue
 		}
 
-		if child.iterate(callback) {
+		if child.iterateAABB(aabb, callback) {
 			return true
 		}
 	}
 	return false
 }
 
-func (node *treeNode) add(entity *world.Entity) {
+func (node *treeNode) add(entity *world.Entity, maxDepth int) {
 	node.entities = append(node.entities, *entity)
-	if len(node.entities) > treeNodeMaxEntities {
+	if len(node.entities) > treeNodeMaxEntities && node.depth < maxDepth {
 		start := 0
 		// Entities already failed subdivision
 		if end := len(node.entities) - 1; end > treeNodeMaxEntities {
 			start = end
 		}
-		node.subdivide(start)
+		node.subdivide(start, maxDepth)
 	}
 }
 
 // Subdivides the node into 4 new nodes and places fitting entities in them
 // Starts at the start index
-func (node *treeNode) subdivide(start int) {
+func (node *treeNode) subdivide(start int, maxDepth int) {
 	quadrants := node.Quadrants()
 
 	j := start
@@ -230,14 +396,15 @@ func (node *treeNode) subdivide(start int) {
 
 		removed := false
 		for k, quad := range quadrants {
-			if quad.Contains(aabb) {
+			if loosen(quad).Contains(aabb) {
 				child := node.children[k]
 				if child == nil {
-					child = newTreeNode(quad)
+					child = newTreeNode(quad, node.depth+1)
+					child.parent = node
 					node.children[k] = child
 				}
 
-				child.add(entity)
+				child.add(entity, maxDepth)
 				removed = true
 				break
 			}
@@ -257,9 +424,46 @@ func (node *treeNode) remove(index int) int {
 	node.entities[index] = node.entities[end]
 	node.entities[end] = world.Entity{} // Clear pointers
 	node.shrink(end)
+	node.collapseIfSparse()
 	return index - 1
 }
 
+// collapseIfSparse checks node and each of its ancestors in turn: if a node
+// has children but its total count() has dropped below
+// treeNodeMaxEntities/2, every descendant entity is pulled back into the
+// node itself and its children are nulled out, undoing subdivide once a
+// region thins back out. Called after every removal, since that's the only
+// thing that can make a subtree sparse enough to collapse.
+func (node *treeNode) collapseIfSparse() {
+	for n := node; n != nil; n = n.parent {
+		hasChildren := false
+		for _, child := range n.children {
+			if child != nil {
+				hasChildren = true
+				break
+			}
+		}
+		if !hasChildren || n.count() >= treeNodeMaxEntities/2 {
+			continue
+		}
+
+		entities := make([]world.Entity, 0, n.count())
+		n.collectAll(&entities)
+		n.entities = entities
+		n.children = [4]*treeNode{}
+	}
+}
+
+// collectAll appends every entity in node and its children to out.
+func (node *treeNode) collectAll(out *[]world.Entity) {
+	*out = append(*out, node.entities...)
+	for _, child := range node.children {
+		if child != nil {
+			child.collectAll(out)
+		}
+	}
+}
+
 // Re-slices entities length to n and shrinks slice if too much space is remaining
 func (node *treeNode) shrink(n int) {
 	node.entities = node.entities[:n]
@@ -270,6 +474,24 @@ func (node *treeNode) shrink(n int) {
 	}
 }
 
+// looseAABB is node's effective bounds for placement/query purposes: 2x its
+// nominal AABB, same center. See loosen.
+func (node *treeNode) looseAABB() world.AABB {
+	return loosen(node.AABB)
+}
+
+// loosen doubles a's Width/Height about its own center, which is what makes
+// this package's quadtree "loose": an entity is matched against a
+// quadrant's loosened bounds (see subdivide/iterateAABB) rather than its
+// tight ones, so entities near a shared edge still land in a single child.
+func loosen(a world.AABB) world.AABB {
+	return world.AABB{
+		Vec2f:  world.Vec2f{X: a.X - a.Width*0.5, Y: a.Y - a.Height*0.5},
+		Width:  a.Width * 2,
+		Height: a.Height * 2,
+	}
+}
+
 func entityAABB(entity *world.Entity) world.AABB {
 	return radiusAABB(entity.Position, entity.Data().Radius)
 }
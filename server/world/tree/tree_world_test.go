@@ -4,12 +4,16 @@
 package tree
 
 import (
-	"mk48/server/world"
+	"github.com/SoftbearStudios/mk48/server/world"
 	"testing"
 )
 
+// BenchmarkTreeWorld exercises World at entity counts up to 16384 (comfortably
+// past the 10k mark real-world matches can reach), the same world.Bench
+// harness sector.World is benchmarked with, so the two can be compared
+// directly at matching entity counts.
 func BenchmarkTreeWorld(b *testing.B) {
 	world.Bench(b, func(radius int) world.World {
 		return New(radius)
-	}, 4096)
+	}, 16384)
 }
@@ -75,6 +75,12 @@ func copyAngles(a []Angle) []Angle {
 	return b
 }
 
+func copyTicksSlice(a []Ticks) []Ticks {
+	b := make([]Ticks, len(a))
+	copy(b, a)
+	return b
+}
+
 // Returns random alphanumeric string of length n
 func RandString(n int) string {
 	const letterBytes = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -66,6 +66,12 @@ type World interface {
 	// Cannot remove or add during read only mode
 	// Returns if can be read concurrently
 	SetParallel(parallel bool) bool
+
+	// SetRand replaces the source AddEntity draws EntityIDs from (see
+	// AllocateEntityID). A freshly constructed World already has one seeded
+	// from a random, non-reproducible source; call SetRand only to make
+	// entity ID assignment deterministic, e.g. for Hub.StartSessionRecording.
+	SetRand(r *rand.Rand)
 }
 
 func AreaOf(playerCount int) float32 {
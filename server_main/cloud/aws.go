@@ -30,6 +30,26 @@ type UserData struct {
 	Stage         string
 	ServerSlots   int
 	Route53ZoneID string
+	// DNSBackend selects the dns.DNS backend cloud.New opens (see
+	// dns.Register): "route53" (default), "cloudflare", or "static".
+	DNSBackend string
+	// CloudflareZoneID/CloudflareAPIToken are required by the
+	// "cloudflare" DNSBackend.
+	CloudflareZoneID   string
+	CloudflareAPIToken string
+	// StaticDNSPath is the file the "static" DNSBackend reads/writes its
+	// routes from.
+	StaticDNSPath string
+	// GeoIPPath is the path to a GeoLite2-Country .mmdb file, used to
+	// auto-select Region when it's left unset (see cloud.New). Optional.
+	GeoIPPath string
+	// Backend selects the db.Database backend cloud.New opens:
+	// "dynamodb" (default), "postgres", or "embedded" (see db.Register).
+	Backend string
+	// DatabaseDSN is the connection string for the "postgres" backend.
+	DatabaseDSN string
+	// DatabaseDir is the directory the "embedded" backend persists to.
+	DatabaseDir string
 }
 
 func getAWSSession(region string) (*session.Session, error) {
@@ -111,23 +131,43 @@ func loadUserData() (data *UserData, err error) {
 			}
 		case "ROUTE53_ZONEID":
 			data.Route53ZoneID = value
+		case "DNS_BACKEND":
+			data.DNSBackend = value
+		case "CLOUDFLARE_ZONEID":
+			data.CloudflareZoneID = value
+		case "CLOUDFLARE_API_TOKEN":
+			data.CloudflareAPIToken = value
+		case "STATIC_DNS_PATH":
+			data.StaticDNSPath = value
+		case "GEOIP_PATH":
+			data.GeoIPPath = value
+		case "BACKEND":
+			data.Backend = value
+		case "DATABASE_DSN":
+			data.DatabaseDSN = value
+		case "DATABASE_DIR":
+			data.DatabaseDir = value
 		}
 	}
 
 	if data.Domain == "" {
 		return nil, errors.New("missing domain")
 	}
-	if data.Region == "" {
-		return nil, errors.New("missing region")
-	}
+	// Region is allowed to be empty: cloud.New falls back to GeoIP-based
+	// auto-selection from the server's public IP when GeoIPPath is set.
 	if data.Stage == "" {
 		return nil, errors.New("missing stage")
 	}
 	if data.ServerSlots < 1 {
 		return nil, errors.New("missing server slots")
 	}
-	if data.Route53ZoneID == "" {
-		return nil, errors.New("missing route53 zoneID")
+	// Route53ZoneID is only required for the default "route53" DNSBackend;
+	// "cloudflare" and "static" validate their own fields in dns.Open
+	// instead.
+	if data.DNSBackend == "" || data.DNSBackend == "route53" {
+		if data.Route53ZoneID == "" {
+			return nil, errors.New("missing route53 zoneID")
+		}
 	}
 	return data, nil
 }
@@ -4,24 +4,46 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/SoftbearStudios/mk48/server"
+	_ "github.com/SoftbearStudios/mk48/server/terrain/erosion"
+	_ "github.com/SoftbearStudios/mk48/server/terrain/ridged"
+	_ "github.com/SoftbearStudios/mk48/server/terrain/worley"
 	"github.com/SoftbearStudios/mk48/server_main/cloud"
 	"golang.org/x/net/netutil"
 	"log"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
 	var (
-		auth           string
-		botLevel       int
-		port           int
-		maxConnections int
-		players        int
+		auth             string
+		botLevel         int
+		port             int
+		maxConnections   int
+		players          int
+		connRateLimit    float64
+		connRateBurst    float64
+		messageRateLimit float64
+		messageRateBurst float64
+		trustedProxies   string
+		botProfiles      string
+		seed             int64
+		sessionReplay    string
+		sessionRecord    string
+		terrainSource    string
+		terrainParams    string
+		shutdownTimeout  time.Duration
 	)
 
 	flag.StringVar(&auth, "auth", "", "admin auth code")
@@ -29,6 +51,18 @@ func main() {
 	flag.IntVar(&port, "port", 8192, "http service port")
 	flag.IntVar(&players, "players", 40, "minimum number of players")
 	flag.IntVar(&maxConnections, "max-connections", 256, "maximum number of inbound TCP connections")
+	flag.Float64Var(&connRateLimit, "conn-rate-limit", 2, "new connections per second allowed per IP")
+	flag.Float64Var(&connRateBurst, "conn-rate-burst", 10, "burst of new connections allowed per IP")
+	flag.Float64Var(&messageRateLimit, "message-rate-limit", 20, "inbound messages per second allowed per IP")
+	flag.Float64Var(&messageRateBurst, "message-rate-burst", 40, "burst of inbound messages allowed per IP")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma-separated CIDRs allowed to set X-Forwarded-For")
+	flag.StringVar(&botProfiles, "bot-profiles", "", "path to a JSON file of bot personality profiles (see server.LoadBotProfiles)")
+	flag.Int64Var(&seed, "seed", 0, "seed for deterministic entity IDs and bot RNG (see server.HubOptions.Seed); required to replay a session log recorded with the same seed")
+	flag.StringVar(&sessionReplay, "session-replay", "", "path to a log written by Hub.StartSessionRecording; replays it against a fresh Hub (implies port < 0) instead of serving live connections")
+	flag.StringVar(&sessionRecord, "record", "", "directory to write a session recording to (see server.Hub.StartSessionRecording); filename is derived from the start time. Pair with -seed so the recording can later be replayed via -session-replay")
+	flag.StringVar(&terrainSource, "terrain", "", "terrain.Source to generate the world from: perlin, ridged-multifractal, worley-islands or hydraulic-erosion (see server.HubOptions.Terrain); empty keeps the default perlin source")
+	flag.StringVar(&terrainParams, "terrain-params", "", "JSON params for -terrain's Source (e.g. its own Params struct); empty uses that Source's defaults")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "grace period on SIGTERM/SIGINT for in-flight HTTP requests and hub.Shutdown (see server.Hub.Shutdown) to finish before forcing exit")
 	flag.Parse()
 
 	if players < 0 {
@@ -45,15 +79,98 @@ func main() {
 		c = server.Offline{}
 	}
 
+	var proxies []string
+	if trustedProxies != "" {
+		proxies = strings.Split(trustedProxies, ",")
+	}
+
+	var profiles []server.BotProfile
+	if botProfiles != "" {
+		profiles, err = server.LoadBotProfiles(botProfiles)
+		if err != nil {
+			log.Fatalf("loading bot profiles: %v", err)
+		}
+	}
+
 	hub := server.NewHub(server.HubOptions{
 		Cloud:            c,
 		MinClients:       players,
 		MaxBotSpawnLevel: uint8(botLevel),
 		Auth:             auth,
+		ConnRateLimit:    connRateLimit,
+		ConnRateBurst:    connRateBurst,
+		MessageRateLimit: messageRateLimit,
+		MessageRateBurst: messageRateBurst,
+		TrustedProxies:   proxies,
+		BotProfiles:      profiles,
+		Seed:             seed,
+		Terrain: server.TerrainOptions{
+			Source: terrainSource,
+			Params: []byte(terrainParams),
+		},
 	})
 
+	if err := hub.LoadWorldSnapshot(); err != nil {
+		// A missing/corrupt snapshot isn't fatal, just a cold start.
+		log.Printf("loading world snapshot: %v\n", err)
+	}
+
+	if sessionRecord != "" {
+		path := filepath.Join(sessionRecord, fmt.Sprintf("session-%d.log", time.Now().UnixNano()))
+		if err := hub.StartSessionRecording(path); err != nil {
+			log.Fatalf("starting session recording: %v", err)
+		}
+		log.Println("recording session to", path)
+	}
+
 	go hub.Run()
 
+	// srv is assigned below, once it exists, but the signal handler is set
+	// up now so a SIGTERM during session replay or simulation mode (port <
+	// 0, where srv is never created) still stops the hub cleanly.
+	var srv *http.Server
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("shutting down")
+
+		if srv != nil {
+			// Stop accepting new HTTP requests (including /ws upgrades)
+			// before asking the hub to drain, so ServeSocket's own
+			// Draining() check (see server/http.go) isn't racing new
+			// connections in underneath it.
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Printf("http shutdown: %v\n", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-hub.Shutdown("Server restarting, please reconnect shortly"):
+		case <-time.After(shutdownTimeout):
+			log.Println("hub.Shutdown timed out, exiting anyway")
+		}
+
+		if sessionRecord != "" {
+			if err := hub.StopSessionRecording(); err != nil {
+				log.Printf("stopping session recording: %v\n", err)
+			}
+		}
+
+		os.Exit(0)
+	}()
+
+	if sessionReplay != "" {
+		if err := server.ReplaySession(sessionReplay, hub); err != nil {
+			log.Fatalf("replaying session %s: %v", sessionReplay, err)
+		}
+		log.Println("session replay finished with no checkpoint mismatches")
+		return
+	}
+
 	if port < 0 {
 		log.Println("https://mk48.io simulation started")
 		// Block forever
@@ -65,6 +182,8 @@ func main() {
 
 	http.HandleFunc("/", hub.ServeIndex)
 	http.HandleFunc("/ws", hub.ServeSocket)
+	http.HandleFunc("/admin", hub.ServeAdmin)
+	http.HandleFunc("/events", hub.ServeEvents)
 
 	l, err := net.Listen("tcp", fmt.Sprint(":", port))
 
@@ -75,5 +194,8 @@ func main() {
 
 	l = netutil.LimitListener(l, maxConnections)
 
-	log.Fatal("ListenAndServe: ", http.Serve(l, nil))
+	srv = &http.Server{Handler: http.DefaultServeMux}
+	if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		log.Fatal("ListenAndServe: ", err)
+	}
 }
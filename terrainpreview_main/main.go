@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2021 Softbear, Inc.
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Command terrainpreview_main renders a PNG of a registered terrain.Source,
+// mirroring how assets/resize.go renders entity sprites - useful for eyeing
+// a generator's output without starting a Hub. See server.HubOptions.Terrain
+// for the -terrain/-terrain-params conventions this flag set mirrors.
+package main
+
+import (
+	"flag"
+	"github.com/SoftbearStudios/mk48/server/terrain"
+	"github.com/SoftbearStudios/mk48/server/terrain/compressed"
+	_ "github.com/SoftbearStudios/mk48/server/terrain/erosion"
+	_ "github.com/SoftbearStudios/mk48/server/terrain/noise"
+	_ "github.com/SoftbearStudios/mk48/server/terrain/ridged"
+	_ "github.com/SoftbearStudios/mk48/server/terrain/worley"
+	"github.com/SoftbearStudios/mk48/server/world"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+)
+
+var colors = [...][3]float32{
+	{0, 50.0 / 255, 115.0 / 255},
+	{0, 75.0 / 255, 130.0 / 255},
+	{194.0 / 255, 178.0 / 255, 128.0 / 255},
+	{90.0 / 255, 180.0 / 255, 30.0 / 255},
+	{105.0 / 255, 110.0 / 255, 115.0 / 255},
+	{220.0 / 255, 220.0 / 255, 220.0 / 255},
+}
+
+func main() {
+	var (
+		source string
+		params string
+		size   int
+		out    string
+	)
+
+	flag.StringVar(&source, "terrain", "perlin", "terrain.Source to preview: perlin, ridged-multifractal, worley-islands, hydraulic-erosion or flat")
+	flag.StringVar(&params, "terrain-params", "", "JSON params for -terrain's Source; empty uses that Source's defaults")
+	flag.IntVar(&size, "size", 2000, "size in meters of the square region to render")
+	flag.StringVar(&out, "out", "out.png", "path to write the rendered PNG")
+	flag.Parse()
+
+	src, err := terrain.NewSource(source, []byte(params))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	t := compressed.New(src)
+
+	o := -float32(size) * 0.5
+	data := t.At(world.AABBFrom(o, o, float32(size), float32(size)))
+	raw, err := t.Decode(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	width := data.Stride
+	height := data.Length / width
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			h := raw[i+j*width]
+			img.Set(i, j, shade(h))
+		}
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func shade(h byte) color.RGBA {
+	var c [3]float32
+	switch {
+	case h <= terrain.OceanLevel:
+		c = lerp(colors[0], colors[1], clamp(float32(h)/float32(terrain.OceanLevel)))
+	case h <= terrain.SandLevel:
+		c = colors[2]
+	case h <= terrain.GrassLevel:
+		c = lerp(colors[2], colors[3], clamp(float32(h-terrain.SandLevel)*0.05))
+	case h <= terrain.RockLevel:
+		c = lerp(colors[3], colors[4], clamp(float32(h-terrain.GrassLevel)*0.1))
+	default:
+		c = lerp(colors[4], colors[5], clamp(float32(h-terrain.RockLevel)*0.07))
+	}
+	return color.RGBA{R: toByte(c[0]), G: toByte(c[1]), B: toByte(c[2]), A: 255}
+}
+
+func lerp(a, b [3]float32, factor float32) [3]float32 {
+	var out [3]float32
+	for i := range out {
+		out[i] = a[i] + (b[i]-a[i])*factor
+	}
+	return out
+}
+
+func clamp(f float32) float32 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+func toByte(f float32) byte {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 255
+	}
+	return byte(f * 255)
+}